@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/google/go-github/v32/github"
+)
+
+const (
+	checkRunName = "trivy"
+	// GitHub accepts at most 50 annotations per request, more are added by updating the run
+	annotationsPerRequest = 50
+	// the longest check run summary GitHub accepts
+	maxCheckRunSummary = 65535
+)
+
+// annotatedFinding is a finding to annotate and the path it is anchored on
+type annotatedFinding struct {
+	finding report.Finding
+	path    string
+}
+
+// largePullRequest reports why the PR is too large for inline comments, empty when it isn't
+func largePullRequest(pr *github.PullRequest, findings int, cfg settings) string {
+	if cfg.largePRFiles > 0 && pr.GetChangedFiles() > cfg.largePRFiles {
+		return fmt.Sprintf("%d changed files, more than the limit of %d", pr.GetChangedFiles(), cfg.largePRFiles)
+	}
+	if cfg.largePRFindings > 0 && findings > cfg.largePRFindings {
+		return fmt.Sprintf("%d findings, more than the limit of %d", findings, cfg.largePRFindings)
+	}
+	return ""
+}
+
+// annotationFindings collects the findings of every target at or above its minimum severity
+func annotationFindings(targets []reportTarget) []annotatedFinding {
+	var findings []annotatedFinding
+	for _, t := range targets {
+		anchor := workspaceAnchor(t.cfg)
+		for _, f := range report.FilterBySeverity(t.unique, t.cfg.minSeverity) {
+			findings = append(findings, annotatedFinding{finding: f, path: anchor(f.Target)})
+		}
+	}
+	return findings
+}
+
+// annotateTargets reports the findings as annotations of a single check run with a summary,
+// returning the errors and the failing targets like processTargets. An error is returned when
+// the check run can't be created, so the caller can fall back to comments.
+func annotateTargets(client *github.Client, owner, repo, sha string, targets []reportTarget, formatter commenter.Formatter) ([]string, []string, error) {
+	failingTargets := gateFailingTargets(targets)
+	conclusion := "neutral"
+	if len(failingTargets) > 0 {
+		conclusion = "failure"
+	}
+
+	findings := annotationFindings(targets)
+	summary, err := targetsSummary(targets, findings, formatter, maxCheckRunSummary, truncatedSummary)
+	if err != nil {
+		return nil, nil, err
+	}
+	title := fmt.Sprintf("trivy found %s", commenter.IssueCount(len(findings)))
+
+	annotations := make([]*github.CheckRunAnnotation, 0, len(findings))
+	for _, a := range findings {
+		annotations = append(annotations, annotation(a))
+	}
+	first := annotations
+	if len(first) > annotationsPerRequest {
+		first = first[:annotationsPerRequest]
+	}
+
+	ctx := shutdown
+	now := github.Timestamp{Time: time.Now()}
+	run, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:        checkRunName,
+		HeadSHA:     sha,
+		Status:      github.String("completed"),
+		Conclusion:  &conclusion,
+		CompletedAt: &now,
+		Output:      &github.CheckRunOutput{Title: &title, Summary: &summary, Annotations: first},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the check run, it needs the checks: write permission (%s)", err.Error())
+	}
+	stats.annotations += len(first)
+
+	var errMessages []string
+	for start := len(first); start < len(annotations); start += annotationsPerRequest {
+		if cancelled() {
+			break
+		}
+		end := start + annotationsPerRequest
+		if end > len(annotations) {
+			end = len(annotations)
+		}
+		_, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, run.GetID(), github.UpdateCheckRunOptions{
+			Name:   checkRunName,
+			Output: &github.CheckRunOutput{Title: &title, Summary: &summary, Annotations: annotations[start:end]},
+		})
+		if err != nil {
+			errMessages = append(errMessages, fmt.Sprintf("failed to add annotations %d to %d of the check run. %s", start+1, end, err.Error()))
+			continue
+		}
+		stats.annotations += end - start
+	}
+	logger.Info(fmt.Sprintf("Annotated %d findings on check run %s", stats.annotations, run.GetHTMLURL()), "annotations", stats.annotations, "check_run", run.GetID())
+	return errMessages, failingTargets, nil
+}
+
+const truncatedSummary = "\n\n_The summary was truncated, see the annotations for every finding._\n"
+
+// targetsSummary renders the summary of the findings of the targets followed by the sections
+// their settings add, cut down to max bytes with the marker
+func targetsSummary(targets []reportTarget, findings []annotatedFinding, formatter commenter.Formatter, max int, marker string) (string, error) {
+	reported := make([]report.Finding, 0, len(findings))
+	for _, a := range findings {
+		reported = append(reported, a.finding)
+	}
+	if formatter == nil {
+		formatter = commenter.DefaultFormatter
+	}
+	summary, err := formatter.Summary(reported)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the summary: %w", err)
+	}
+	for _, t := range targets {
+		if t.cfg.sbomBase != nil {
+			summary += dependencyChanges(t.results, t.findings, t.cfg)
+		}
+	}
+	// the link goes after the truncation, where it's the way to what was cut
+	var link string
+	if len(targets) > 0 {
+		summary += riskSummary(reported, targets[0].cfg)
+		summary += ownerSections(targets)
+		var results []report.Result
+		for _, t := range targets {
+			results = append(results, t.results...)
+		}
+		link = reportArtifactLink(results, targets[0].cfg)
+	}
+	return commenter.Truncate(summary, max-len(link), marker) + link, nil
+}
+
+// gateFailingTargets are the names of the targets with a finding at or above their gate
+// severity, leaving out those that soft fail
+func gateFailingTargets(targets []reportTarget) []string {
+	var failing []string
+	for _, t := range targets {
+		if !t.cfg.softFail && gateReached(t) {
+			failing = append(failing, t.name)
+		}
+	}
+	return failing
+}
+
+// gateReached reports whether the target has a finding at or above its gate severity
+func gateReached(t reportTarget) bool {
+	for _, f := range report.FilterBySeverity(exploitableFindings(t), t.cfg.minSeverity) {
+		if report.SeverityRank(f.Severity) >= report.SeverityRank(t.cfg.gateSeverity) {
+			return true
+		}
+	}
+	return false
+}
+
+// exploitableFindings are the findings of the target no VEX statement suppressed
+func exploitableFindings(t reportTarget) []report.Finding {
+	return report.Filter(t.findings, func(f report.Finding) bool { return !f.Suppressed })
+}
+
+func annotation(a annotatedFinding) *github.CheckRunAnnotation {
+	f := a.finding
+	startLine, endLine := f.StartLine, f.EndLine
+	if startLine < 1 {
+		// an annotation needs a line, findings on the file as a whole go on the first
+		startLine, endLine = 1, 1
+	}
+	message := f.Message
+	if message == "" {
+		message = f.Description
+	}
+	details := f.Resolution
+	if len(f.References) > 0 {
+		details = strings.TrimSpace(details + "\n\n" + strings.Join(f.References, "\n"))
+	}
+	annotation := &github.CheckRunAnnotation{
+		Path:            github.String(a.path),
+		StartLine:       &startLine,
+		EndLine:         &endLine,
+		AnnotationLevel: github.String(annotationLevel(f.Severity)),
+		Message:         &message,
+		Title:           github.String(fmt.Sprintf("%s %s: %s", f.Severity, f.ID, f.Title)),
+	}
+	if details != "" {
+		annotation.RawDetails = &details
+	}
+	return annotation
+}
+
+func annotationLevel(severity string) string {
+	switch severity {
+	case "CRITICAL", "HIGH":
+		return "failure"
+	case "MEDIUM":
+		return "warning"
+	}
+	return "notice"
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// artifactService is the Twirp service of the Actions artifact API behind actions/upload-artifact@v4
+const artifactService = "/twirp/github.actions.results.api.v1.ArtifactService/"
+
+// reportArtifactLink uploads the results at or above the minimum severity as an artifact of
+// the workflow run and returns a link to download it, for the summary. It is empty when the
+// upload isn't enabled, or fails, which is logged rather than failing the run.
+func reportArtifactLink(results []report.Result, cfg settings) string {
+	if cfg.reportArtifact == "" {
+		return ""
+	}
+	filtered := filterResults(results, cfg.minSeverity)
+	data, err := json.MarshalIndent(map[string]any{"SchemaVersion": report.SupportedSchemaVersion, "Results": filtered}, "", "  ")
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to encode the report to upload. %s", err.Error()))
+		return ""
+	}
+	url, err := uploadArtifact(cfg.reportArtifact, "trivy-report.json", data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to upload the report. %s", err.Error()))
+		return ""
+	}
+	logger.Info(fmt.Sprintf("Uploaded the report as artifact %s", cfg.reportArtifact), "artifact", url)
+	return fmt.Sprintf("\n[Download the full report](%s) of every finding at or above %s.\n", url, cfg.minSeverity)
+}
+
+// filterResults keeps the misconfigurations, vulnerabilities, secrets and licenses at or above
+// the minimum severity, and the results left with any
+func filterResults(results []report.Result, minSeverity string) []report.Result {
+	atSeverity := func(severity string) bool {
+		return report.SeverityRank(severity) >= report.SeverityRank(minSeverity)
+	}
+	var filtered []report.Result
+	for _, r := range results {
+		kept := report.Result{Target: r.Target, Class: r.Class, Type: r.Type}
+		for _, m := range r.Misconfigurations {
+			if atSeverity(m.Severity) {
+				kept.Misconfigurations = append(kept.Misconfigurations, m)
+			}
+		}
+		for _, v := range r.Vulnerabilities {
+			if atSeverity(v.Severity) {
+				kept.Vulnerabilities = append(kept.Vulnerabilities, v)
+			}
+		}
+		for _, s := range r.Secrets {
+			if atSeverity(s.Severity) {
+				kept.Secrets = append(kept.Secrets, s)
+			}
+		}
+		for _, l := range r.Licenses {
+			if atSeverity(l.Severity) {
+				kept.Licenses = append(kept.Licenses, l)
+			}
+		}
+		if len(kept.Misconfigurations)+len(kept.Vulnerabilities)+len(kept.Secrets)+len(kept.Licenses) > 0 {
+			filtered = append(filtered, kept)
+		}
+	}
+	return filtered
+}
+
+// uploadArtifact zips the file into an artifact of the workflow run through the Actions
+// artifact API, returning the artifact's download page. It needs the ACTIONS_RUNTIME_TOKEN
+// and ACTIONS_RESULTS_URL the runner gives every step.
+func uploadArtifact(name, filename string, content []byte) (string, error) {
+	token, resultsURL := os.Getenv("ACTIONS_RUNTIME_TOKEN"), os.Getenv("ACTIONS_RESULTS_URL")
+	if token == "" || resultsURL == "" {
+		return "", errors.New("ACTIONS_RUNTIME_TOKEN and ACTIONS_RESULTS_URL are only set in a workflow run")
+	}
+	runID, jobID, err := artifactBackendIDs(token)
+	if err != nil {
+		return "", err
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: filename, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(content); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Transport: apiTransport, Timeout: 60 * time.Second}
+	var created struct {
+		OK              bool   `json:"ok"`
+		SignedUploadURL string `json:"signedUploadUrl"`
+	}
+	err = artifactCall(client, resultsURL, token, "CreateArtifact", map[string]any{
+		"workflowRunBackendId": runID, "workflowJobRunBackendId": jobID, "name": name, "version": 4,
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	if !created.OK || created.SignedUploadURL == "" {
+		return "", fmt.Errorf("the artifact %s could not be created", name)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, created.SignedUploadURL, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("Content-Type", "application/zip")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload the artifact: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("failed to upload the artifact: %s", resp.Status)
+	}
+
+	sum := sha256.Sum256(archive.Bytes())
+	var finalized struct {
+		OK         bool   `json:"ok"`
+		ArtifactID string `json:"artifactId"`
+	}
+	err = artifactCall(client, resultsURL, token, "FinalizeArtifact", map[string]any{
+		"workflowRunBackendId": runID, "workflowJobRunBackendId": jobID, "name": name,
+		"size": strconv.Itoa(archive.Len()), "hash": map[string]string{"value": "sha256:" + hex.EncodeToString(sum[:])},
+	}, &finalized)
+	if err != nil {
+		return "", err
+	}
+	if !finalized.OK {
+		return "", fmt.Errorf("the artifact %s could not be finalized", name)
+	}
+
+	server := os.Getenv("GITHUB_SERVER_URL")
+	if server == "" {
+		server = "https://github.com"
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s/artifacts/%s", strings.TrimSuffix(server, "/"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"), finalized.ArtifactID), nil
+}
+
+func artifactCall(client *http.Client, resultsURL, token, method string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(resultsURL, "/")+artifactService+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", method, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// artifactBackendIDs reads the run and job IDs of the artifact API from the scope of the
+// runtime token, a JWT whose scp claim holds Actions.Results:<run>:<job>
+func artifactBackendIDs(token string) (string, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("ACTIONS_RUNTIME_TOKEN is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("ACTIONS_RUNTIME_TOKEN can't be decoded: %w", err)
+	}
+	var claims struct {
+		Scope string `json:"scp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", fmt.Errorf("ACTIONS_RUNTIME_TOKEN can't be decoded: %w", err)
+	}
+	for _, scope := range strings.Fields(claims.Scope) {
+		fields := strings.Split(scope, ":")
+		if len(fields) == 3 && fields[0] == "Actions.Results" {
+			return fields[1], fields[2], nil
+		}
+	}
+	return "", "", errors.New("ACTIONS_RUNTIME_TOKEN has no Actions.Results scope")
+}
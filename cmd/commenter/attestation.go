@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+const (
+	// inTotoStatement is the type of the attestation, an in-toto statement about the reports
+	inTotoStatement = "https://in-toto.io/Statement/v1"
+	// attestationPredicate is the type of what the statement says, how the reports were commented on
+	attestationPredicate = "https://github.com/XiaxueTech/trivy-terraform-pr-commenter/attestation/run/v1"
+)
+
+// runAttestation records what a comment run read and did, for the attestation written at the end
+type runAttestation struct {
+	mu       sync.Mutex
+	reports  []attestedSubject
+	pr       int
+	targets  []attestedTarget
+	comments []attestedComment
+}
+
+var attested = &runAttestation{}
+
+type attestedSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// attestedTarget are the filters applied to the findings of a target
+type attestedTarget struct {
+	Name          string `json:"name,omitempty"`
+	MinSeverity   string `json:"min_severity"`
+	GateSeverity  string `json:"gate_severity"`
+	MaxComments   int    `json:"max_comments"`
+	SoftFail      bool   `json:"soft_fail"`
+	SkipGenerated bool   `json:"skip_generated"`
+	VEXStatements int    `json:"vex_statements"`
+	VEXAction     string `json:"vex_action,omitempty"`
+	LicensePolicy bool   `json:"license_policy"`
+}
+
+type attestedComment struct {
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	Status     string `json:"status"`
+	BodySHA256 string `json:"body_sha256"`
+}
+
+// addReport records the digest of a report the run read, hashing it as it's read so a large
+// report isn't held in memory
+func (a *runAttestation) addReport(path string) {
+	a.addReportAs(path, path)
+}
+
+// addReportAs records the digest of the file a report was downloaded to under its source
+func (a *runAttestation) addReportAs(name, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return
+	}
+	a.addDigest(name, hash.Sum(nil))
+}
+
+// addDigest records the SHA-256 digest of a report read other than from a file, e.g. stdin
+func (a *runAttestation) addDigest(name string, sum []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reports = append(a.reports, attestedSubject{Name: name, Digest: map[string]string{"sha256": hex.EncodeToString(sum)}})
+}
+
+func (a *runAttestation) addTargets(targets []reportTarget) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, t := range targets {
+		a.targets = append(a.targets, attestedTarget{
+			Name:          t.name,
+			MinSeverity:   t.cfg.minSeverity,
+			GateSeverity:  t.cfg.gateSeverity,
+			MaxComments:   t.cfg.maxComments,
+			SoftFail:      t.cfg.softFail,
+			SkipGenerated: t.cfg.skipGenerated,
+			VEXStatements: len(t.cfg.vexStatements),
+			VEXAction:     t.cfg.vexAction,
+			LicensePolicy: t.cfg.licensePolicy != nil,
+		})
+	}
+}
+
+func (a *runAttestation) addComment(c commenter.Comment) {
+	sum := sha256.Sum256([]byte(c.Body))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.comments = append(a.comments, attestedComment{
+		File: c.File, StartLine: c.Finding.StartLine, EndLine: c.Finding.EndLine, Rule: c.Finding.ID,
+		Severity: c.Finding.Severity, Status: string(c.Status), BodySHA256: hex.EncodeToString(sum[:]),
+	})
+}
+
+// statement is the in-toto statement of the run: the reports are its subjects, the predicate
+// the filters applied, the comments written and the gate decision
+func (a *runAttestation) statement(gate string) map[string]any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	metrics := make(map[string]any)
+	for _, m := range stats.metrics(gate) {
+		metrics[m.name] = m.value
+	}
+	runAttempt, _ := strconv.Atoi(os.Getenv("GITHUB_RUN_ATTEMPT"))
+	return map[string]any{
+		"_type":         inTotoStatement,
+		"subject":       append([]attestedSubject{}, a.reports...),
+		"predicateType": attestationPredicate,
+		"predicate": map[string]any{
+			"commenter": map[string]string{"version": version, "commit": commit},
+			"run": map[string]any{
+				"repository":   os.Getenv("GITHUB_REPOSITORY"),
+				"pull_request": a.pr,
+				"sha":          os.Getenv("GITHUB_SHA"),
+				"workflow_ref": os.Getenv("GITHUB_WORKFLOW_REF"),
+				"run_id":       os.Getenv("GITHUB_RUN_ID"),
+				"run_attempt":  runAttempt,
+			},
+			"targets":  append([]attestedTarget{}, a.targets...),
+			"comments": append([]attestedComment{}, a.comments...),
+			"gate":     gate,
+			"metrics":  metrics,
+		},
+	}
+}
+
+// writeAttestation writes the in-toto statement of the run to INPUT_ATTESTATION or, with
+// INPUT_ATTESTATION_SIGN, a Sigstore bundle of the statement signed keyless with the
+// workflow's identity. A failure is logged, it doesn't change the run's result.
+func writeAttestation(gate string) {
+	path := os.Getenv("INPUT_ATTESTATION")
+	if path == "" {
+		return
+	}
+	statement, err := json.Marshal(attested.statement(gate))
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to encode the attestation. %s", err.Error()))
+		return
+	}
+	out := statement
+	if os.Getenv("INPUT_ATTESTATION_SIGN") == "true" {
+		bundle, err := signStatement(statement)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to sign the attestation. %s", err.Error()))
+			return
+		}
+		out = bundle
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the attestation. %s", err.Error()))
+		return
+	}
+	logger.Info(fmt.Sprintf("Attestation of the run written to %s", path), "attestation", path)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/google/go-github/v32/github"
+)
+
+// The modes of autofix: a companion PR against the PR's branch, or a commit on the branch itself
+const (
+	autofixPR     = "pr"
+	autofixCommit = "commit"
+)
+
+func parseAutofix(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", autofixPR, autofixCommit:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown autofix mode %q, expected %s or %s", value, autofixPR, autofixCommit)
+}
+
+// autofixBranch is the branch the fixes of a companion PR are pushed to, the same on every run
+// so the companion PR is updated rather than opened again
+func autofixBranch(prNo int) string {
+	return fmt.Sprintf("trivy-autofix/pr-%d", prNo)
+}
+
+// pushAutofix commits the suggestions of the findings, the package upgrades, base images,
+// Kubernetes and Terraform fixes the comments suggest, on top of the PR's head. The commit goes onto a
+// branch of its own with a companion PR against the PR's branch or, in the commit mode, onto
+// the PR's branch itself. The PR's branch has to be in the repo, the token can't push to a fork.
+func pushAutofix(client *github.Client, owner, repo string, pr *github.PullRequest, findings []annotatedFinding, mode string) error {
+	byPath := make(map[string][]report.Finding)
+	for _, a := range findings {
+		if a.finding.Suggestion != "" {
+			path := strings.TrimPrefix(a.path, "./")
+			byPath[path] = append(byPath[path], a.finding)
+		}
+	}
+	if len(byPath) == 0 {
+		logger.Info("No finding has a fix to commit")
+		return nil
+	}
+	head := pr.GetHead()
+	if head.GetRepo().GetFullName() != owner+"/"+repo {
+		return fmt.Errorf("not committing the fixes, the PR's branch is in the fork %s", head.GetRepo().GetFullName())
+	}
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ctx := shutdown
+	sha := head.GetSHA()
+	parent, _, err := client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return fmt.Errorf("failed to read the commit %s: %w", sha, err)
+	}
+	files := &headTree{client: client, owner: owner, repo: repo, root: parent.GetTree().GetSHA(), dirs: make(map[string]map[string]*github.TreeEntry)}
+	var entries []*github.TreeEntry
+	var fixed []annotatedFinding
+	for _, path := range paths {
+		entry, err := files.entry(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %s: %w", path, sha, err)
+		}
+		content, err := fileContent(client, owner, repo, path, sha, entry)
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %s: %w", path, sha, err)
+		}
+		patched, applied := report.ApplySuggestions(content, byPath[path])
+		if len(applied) == 0 {
+			continue
+		}
+		// the mode of the file is kept, an executable stays executable
+		entries = append(entries, &github.TreeEntry{
+			Path: github.String(path), Mode: entry.Mode, Type: github.String("blob"), Content: github.String(string(patched)),
+		})
+		for _, f := range applied {
+			fixed = append(fixed, annotatedFinding{finding: f, path: path})
+		}
+	}
+	if len(fixed) == 0 {
+		logger.Info("No fix applies to the PR's head, the files changed since the scan")
+		return nil
+	}
+
+	tree, _, err := client.Git.CreateTree(ctx, owner, repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return fmt.Errorf("failed to create the fix tree, it needs the contents: write permission (%w)", err)
+	}
+	message := fmt.Sprintf("Fix %d trivy findings\n\n", len(fixed))
+	for _, a := range fixed {
+		message += fmt.Sprintf("- %s in %s:%d\n", a.finding.ID, a.path, a.finding.StartLine)
+	}
+	commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: github.String(sha)}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create the fix commit: %w", err)
+	}
+
+	if mode == autofixCommit {
+		// not forced, a push since the scan wins over the fixes meant for what it replaced
+		ref := &github.Reference{Ref: github.String("refs/heads/" + head.GetRef()), Object: &github.GitObject{SHA: commit.SHA}}
+		if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, false); err != nil {
+			return fmt.Errorf("failed to push the fixes to %s: %w", head.GetRef(), err)
+		}
+		logger.Info(fmt.Sprintf("Pushed %d fixes to %s", len(fixed), head.GetRef()), "fixes", len(fixed), "commit", commit.GetSHA())
+		return nil
+	}
+
+	branch := autofixBranch(pr.GetNumber())
+	ref := &github.Reference{Ref: github.String("refs/heads/" + branch), Object: &github.GitObject{SHA: commit.SHA}}
+	if _, resp, err := client.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+		if resp == nil || resp.StatusCode != http.StatusUnprocessableEntity {
+			return fmt.Errorf("failed to create the branch %s: %w", branch, err)
+		}
+		// the branch of an earlier run, its fixes are replaced with this run's
+		if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, true); err != nil {
+			return fmt.Errorf("failed to update the branch %s: %w", branch, err)
+		}
+	}
+
+	body := autofixBody(pr, fixed, findingComments(client, owner, repo, pr.GetNumber()))
+	existing, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{State: "open", Head: owner + ":" + branch})
+	if err != nil {
+		return fmt.Errorf("failed to look up the autofix PR: %w", err)
+	}
+	if len(existing) > 0 {
+		if _, _, err := client.PullRequests.Edit(ctx, owner, repo, existing[0].GetNumber(), &github.PullRequest{Body: &body}); err != nil {
+			return fmt.Errorf("failed to update the autofix PR #%d: %w", existing[0].GetNumber(), err)
+		}
+		logger.Info(fmt.Sprintf("Updated the autofix PR %s with %d fixes", existing[0].GetHTMLURL(), len(fixed)), "fixes", len(fixed), "autofix_pr", existing[0].GetNumber())
+		return nil
+	}
+	companion, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("Fix trivy findings of #%d", pr.GetNumber())),
+		Head:  github.String(branch),
+		Base:  github.String(head.GetRef()),
+		Body:  &body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open the autofix PR, it needs the pull-requests: write permission (%w)", err)
+	}
+	logger.Info(fmt.Sprintf("Opened the autofix PR %s with %d fixes", companion.GetHTMLURL(), len(fixed)), "fixes", len(fixed), "autofix_pr", companion.GetNumber())
+	return nil
+}
+
+// headTree looks up the files of the PR's head in its tree, a directory at a time so a large
+// repo isn't listed in full for the few files with fixes
+type headTree struct {
+	client *github.Client
+	owner  string
+	repo   string
+	root   string
+	dirs   map[string]map[string]*github.TreeEntry
+}
+
+// entry is the tree entry of the file, with its mode and blob
+func (t *headTree) entry(path string) (*github.TreeEntry, error) {
+	dir, sha := "", t.root
+	parts := strings.Split(path, "/")
+	for i, name := range parts {
+		entries, ok := t.dirs[dir]
+		if !ok {
+			tree, _, err := t.client.Git.GetTree(shutdown, t.owner, t.repo, sha, false)
+			if err != nil {
+				return nil, err
+			}
+			entries = make(map[string]*github.TreeEntry)
+			for _, e := range tree.Entries {
+				entries[e.GetPath()] = e
+			}
+			t.dirs[dir] = entries
+		}
+		e, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("the file isn't in the PR's head")
+		}
+		if i == len(parts)-1 {
+			if e.GetType() != "blob" {
+				return nil, fmt.Errorf("the path is a %s rather than a file", e.GetType())
+			}
+			return e, nil
+		}
+		dir, sha = path[:len(dir)+len(name)+1], e.GetSHA()
+	}
+	return nil, fmt.Errorf("the file isn't in the PR's head")
+}
+
+// fileContent reads the file at the ref. The contents API doesn't return the content of a file
+// over 1MB, its blob is read instead.
+func fileContent(client *github.Client, owner, repo, path, ref string, entry *github.TreeEntry) ([]byte, error) {
+	file, _, _, err := client.Repositories.GetContents(shutdown, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err == nil && file != nil {
+		if content, err := file.GetContent(); err == nil && (content != "" || file.GetSize() == 0) {
+			return []byte(content), nil
+		}
+	}
+	blob, _, err := client.Git.GetBlobRaw(shutdown, owner, repo, entry.GetSHA())
+	return blob, err
+}
+
+// findingComments lists the comments on the PR by their file and last line, for the autofix PR
+// to link. None are listed when they can't be, the autofix PR then goes without the links.
+func findingComments(client *github.Client, owner, repo string, prNo int) map[string][]*github.PullRequestComment {
+	byLine := make(map[string][]*github.PullRequestComment)
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(shutdown, owner, repo, prNo, opts)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Not linking the comments from the autofix PR, they can't be listed (%s)", err.Error()))
+			return byLine
+		}
+		for _, c := range comments {
+			key := fmt.Sprintf("%s:%d", c.GetPath(), c.GetLine())
+			byLine[key] = append(byLine[key], c)
+		}
+		if resp.NextPage == 0 {
+			return byLine
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func autofixBody(pr *github.PullRequest, fixed []annotatedFinding, comments map[string][]*github.PullRequestComment) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Fixes for the findings trivy commented on in #%d. Merging this PR into `%s` adds them to #%d.\n\n", pr.GetNumber(), pr.GetHead().GetRef(), pr.GetNumber())
+	sb.WriteString("| File | Lines | Rule | Severity | Comment |\n|---|---|---|---|---|\n")
+	for _, a := range fixed {
+		lines := fmt.Sprintf("%d", a.finding.StartLine)
+		if a.finding.EndLine > a.finding.StartLine {
+			lines += fmt.Sprintf("-%d", a.finding.EndLine)
+		}
+		comment := "-"
+		for _, c := range comments[fmt.Sprintf("%s:%d", a.path, a.finding.EndLine)] {
+			if strings.Contains(c.GetBody(), a.finding.ID) {
+				comment = fmt.Sprintf("[comment](%s)", c.GetHTMLURL())
+				break
+			}
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s | `%s` | %s | %s |\n", a.path, lines, a.finding.ID, a.finding.Severity, comment)
+	}
+	return commenter.Truncate(sb.String(), commenter.MaxCommentLength, commenter.TruncatedMarker)
+}
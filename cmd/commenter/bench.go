@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// benchStage is the cost of one stage of a comment run over every iteration
+type benchStage struct {
+	name   string
+	total  time.Duration
+	allocs uint64
+	bytes  uint64
+}
+
+// runBench times parsing, filtering and rendering over a report, so users with huge reports
+// can tell whether their template or settings are what makes a run slow
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	reportFile := flags.String("report", resultsFile, "trivy JSON report to benchmark")
+	templateFile := flags.String("template", "", "template rendering the comments, defaults to the configured formatter")
+	iterations := flags.Int("n", 10, "number of times every stage is run")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stderr)
+
+	if *iterations < 1 {
+		fail("usage: commenter bench --report <report> [--template <template>] [--n <iterations>]")
+	}
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	if *templateFile != "" {
+		formatter, err := commenter.NewTemplateFormatter(*templateFile)
+		if err != nil {
+			fail(fmt.Sprintf("failed to parse the template. %s", err.Error()))
+		}
+		cfg.formatter = formatter
+	}
+	formatter := cfg.formatter
+	if formatter == nil {
+		formatter = commenter.DefaultFormatter
+	}
+
+	data, err := os.ReadFile(*reportFile)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+	results, err := report.Parse(data)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+	findings := report.Findings(results)
+	anchor := workspaceAnchor(cfg)
+	var commented []report.Finding
+	for _, group := range commenter.Group(report.FilterBySeverity(commenter.Dedupe(findings), cfg.minSeverity)) {
+		commented = append(commented, group[0])
+	}
+
+	stages := []benchStage{
+		measure("parse", *iterations, func() error {
+			_, err := report.Parse(data)
+			return err
+		}),
+		measure("filter", *iterations, func() error {
+			for _, group := range commenter.Group(report.FilterBySeverity(commenter.Dedupe(report.Findings(results)), cfg.minSeverity)) {
+				anchor(group[0].Target)
+			}
+			return nil
+		}),
+		// rendered without the cache of a comment run, so the formatter itself is measured
+		measure("render", *iterations, func() error {
+			for _, f := range commented {
+				if _, err := formatter.Comment(f); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		measure("summary", *iterations, func() error {
+			_, err := formatter.Summary(findings)
+			return err
+		}),
+	}
+
+	fmt.Printf("%d findings, %d comments, %d iterations\n\n", len(findings), len(commented), *iterations)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "stage\ttotal\tper run\tallocs/run\tbytes/run\t")
+	for _, s := range stages {
+		n := uint64(*iterations)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t\n", s.name, s.total.Round(time.Microsecond),
+			(s.total / time.Duration(n)).Round(time.Microsecond), s.allocs/n, s.bytes/n)
+	}
+	_ = w.Flush()
+}
+
+// measure runs the stage n times, failing on its first error
+func measure(name string, n int, stage func() error) benchStage {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := stage(); err != nil {
+			fail(fmt.Sprintf("%s failed. %s", name, err.Error()))
+		}
+	}
+	total := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return benchStage{
+		name:   name,
+		total:  total,
+		allocs: after.Mallocs - before.Mallocs,
+		bytes:  after.TotalAlloc - before.TotalAlloc,
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// runCluster publishes the vulnerable control plane and node components of a trivy k8s report
+// as a check run, for PRs bumping the cluster's version, whose findings have no lines to comment
+// on. The run fails when a component has a vulnerability at or above the gate severity.
+func runCluster(args []string) {
+	flags := flag.NewFlagSet("cluster", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	local := flags.Bool("local", false, "print the table instead of publishing the check run")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stderr)
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	data, err := readReportFile(reportFileArg(flags))
+	if err != nil {
+		fail(fmt.Sprintf("failed to load the cluster report. %s", err.Error()))
+	}
+	r, err := report.ParseClusterReport(data)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load the cluster report. %s", err.Error()))
+	}
+	vulnerable := r.Vulnerable()
+	logger.Info(fmt.Sprintf("%s: %d of %d components are vulnerable", r.Name, len(vulnerable), len(r.Components)),
+		"cluster", r.Name, "components", len(r.Components), "vulnerable", len(vulnerable))
+
+	blocking := false
+	for _, c := range vulnerable {
+		if report.SeverityRank(c.Findings[0].Severity) >= report.SeverityRank(cfg.gateSeverity) {
+			blocking = true
+		}
+	}
+
+	summary := commenter.ClusterSummary(r)
+	if *local {
+		fmt.Print(summary)
+		exitCheckGate(blocking, cfg, "a vulnerability of a component", "cluster")
+		return
+	}
+	client, owner, repo, sha := checkRunTarget()
+	conclusion := "success"
+	if blocking {
+		conclusion = "failure"
+	} else if len(vulnerable) > 0 {
+		conclusion = "neutral"
+	}
+	title := fmt.Sprintf("%d of %d components are vulnerable", len(vulnerable), len(r.Components))
+	publishCheckRun(client, owner, repo, sha, "trivy cluster "+r.Name, title, summary, conclusion)
+	exitCheckGate(blocking, cfg, "a vulnerability of a component", "cluster")
+}
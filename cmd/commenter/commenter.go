@@ -1,139 +1,840 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/owenrumney/go-github-pr-commenter/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
 )
 
+// subcommands are dispatched on the first argument, anything else runs comment for backwards compatibility
+var subcommands = map[string]func(args []string){
+	"bench":      runBench,
+	"cluster":    runCluster,
+	"comment":    runComment,
+	"completion": runCompletion,
+	"compliance": runCompliance,
+	"digest":     runDigest,
+	"doctor":     runDoctor,
+	"gate":       runGate,
+	"help":       runHelp,
+	"init":       runInit,
+	"merge":      runMerge,
+	"render":     runRender,
+	"review":     runReview,
+	"scan":       runScan,
+	"summary":    runSummary,
+	"update":     runUpdate,
+	"validate":   runValidate,
+}
+
+var subcommandDescriptions = map[string]string{
+	"bench":      "time parsing, filtering and rendering of a report",
+	"cluster":    "publish the vulnerable components of a trivy k8s report as a check run",
+	"comment":    "post the report as PR comments (the default)",
+	"completion": "print a bash, zsh or fish completion script",
+	"compliance": "publish a trivy compliance report as a check run",
+	"digest":     "update a tracking issue with the findings of a scheduled scan",
+	"doctor":     "diagnose the environment with a pass/fail checklist",
+	"gate":       "fail when findings reach a severity threshold",
+	"help":       "show this help",
+	"init":       "scaffold a GitHub Actions workflow",
+	"merge":      "merge the reports of matrix jobs and comment on them once",
+	"render":     "write every would-be comment to files for snapshot tests",
+	"review":     "interactively triage a report locally",
+	"scan":       "run trivy and comment on its results in one step",
+	"summary":    "render a markdown summary of the report",
+	"update":     "replace the binary with the latest release",
+	"validate":   "check the configuration and environment",
+}
+
 func main() {
-	fmt.Println("Starting the GitHub commenter")
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			runExitHooks()
+			return
+		}
+	}
+	runComment(os.Args[1:])
+	runExitHooks()
+}
 
-	token := os.Getenv("INPUT_GITHUB_TOKEN")
-	if len(token) == 0 {
-		fail("the INPUT_GITHUB_TOKEN has not been set")
+func runHelp([]string) {
+	fmt.Printf("%s\n\nUsage: commenter [command] [flags] [report file]\n\nCommands:\n", versionString())
+	for _, name := range commandNames() {
+		fmt.Printf("  %-11s %s\n", name, subcommandDescriptions[name])
 	}
+	fmt.Println("\nRun commenter <command> --help for the flags of a command.")
+}
 
-	githubRepository := os.Getenv("GITHUB_REPOSITORY")
-	split := strings.Split(githubRepository, "/")
-	if len(split) != 2 {
-		fail(fmt.Sprintf("unexpected value for GITHUB_REPOSITORY. Expected <organization/name>, found %v", split))
+func runComment(args []string) {
+	flags := flag.NewFlagSet("commenter", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	showVersion := flags.Bool("version", false, "print the version and exit")
+	local := flags.Bool("local", false, "render comments locally instead of posting them to GitHub")
+	output := flags.String("output", "", "file to write the rendered markdown to in local mode, defaults to stdout")
+	targetsFile := flags.String("targets", os.Getenv("INPUT_TARGETS_FILE"), "targets file describing each scanned component, replaces the report file")
+	quiet := flags.Bool("quiet", strings.ToLower(os.Getenv("INPUT_QUIET")) == "true", "only log errors and a final summary line")
+	profile := flags.String("pprof", "", "write CPU and heap profiles to <prefix>.cpu.pprof and <prefix>.heap.pprof")
+	strict := flags.Bool("strict-schema", strings.ToLower(os.Getenv("INPUT_STRICT_SCHEMA")) == "true", "fail when the report doesn't match the expected schema")
+	formatName := flags.String("format", reportFormat, reportFormatUsage)
+	_ = flags.Parse(args)
+	strictSchema = *strict
+	reportFormat = *formatName
+
+	if *showVersion {
+		fmt.Println(versionString())
+		return
 	}
-	owner := split[0]
-	repo := split[1]
 
-	fmt.Printf("Working in repository %s\n", repo)
+	logOutput := os.Stdout
+	if *local && *output == "" {
+		// keep stdout clean for the rendered markdown
+		logOutput = os.Stderr
+	}
+	quietLogging = *quiet
+	setupLogger(*logFormat, logOutput)
+	if *profile != "" {
+		startProfiling(*profile)
+	}
 
-	prNo, err := extractPullRequestNumber()
-	if err != nil {
-		fmt.Println("Not a PR, nothing to comment on, exiting")
+	logger.Info(fmt.Sprintf("Starting the GitHub commenter - %s", versionString()), "version", version, "commit", commit, "date", date)
+
+	reportFile := reportFileArg(flags)
+	if *targetsFile != "" {
+		commentOnResults(func(cfg settings) []reportTarget { return loadTargets(*targetsFile, cfg) }, *local, *output)
 		return
 	}
-	fmt.Printf("Working in PR %v\n", prNo)
+	commentOnResults(func(cfg settings) []reportTarget { return singleTarget(loadResults(reportFile), cfg) }, *local, *output)
+}
 
-	results, err := loadResultsFile()
+// commentOnResults posts the results to the PR, or renders them when running locally.
+// The results are loaded lazily so nothing is read when there is no PR to comment on.
+func commentOnResults(load func(cfg settings) []reportTarget, local bool, output string) {
+	handleShutdownSignals()
+	cfg, err := loadSettings()
 	if err != nil {
-		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+		fail(err.Error())
 	}
+	startRuntimeBudget(cfg.maxRuntime)
 
-	if len(results) == 0 {
-		fmt.Println("No issues found.")
-		os.Exit(0)
+	if local {
+		targets := load(cfg)
+		writeHTMLReport(targets, cfg)
+		recordRiskScore(targets)
+		if cfg.commentMode == commentModeSummary {
+			runLocalSummary(targets, cfg.formatter, output, cfg.commentScope)
+			return
+		}
+		runLocal(targets, output)
+		return
+	}
+
+	token := githubToken()
+	if len(token) == 0 {
+		fail("the INPUT_GITHUB_TOKEN has not been set and there is no GITHUB_TOKEN to fall back to")
 	}
-	fmt.Printf("trivy found %v issues\n", len(results))
 
-	c, err := createCommenter(token, owner, repo, prNo)
+	owner, repo, err := parseRepository()
+	if err != nil {
+		fail(err.Error())
+	}
+
+	logger.Info(fmt.Sprintf("Working in repository %s", repo), "owner", owner, "repo", repo)
+
+	installAPITransport()
+	installETagCache(os.Getenv("INPUT_ETAG_CACHE"))
+	installRateLimiter(cfg.maxQPS)
+	client, err := newGithubClient(token)
 	if err != nil {
 		fail(fmt.Sprintf("could not connect to GitHub (%s)", err.Error()))
 	}
 
-	workspacePath := fmt.Sprintf("%s/", os.Getenv("GITHUB_WORKSPACE"))
-	fmt.Printf("Working in GITHUB_WORKSPACE %s\n", workspacePath)
+	prNo, err := resolvePullRequestNumber(client, owner, repo)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Not a PR, nothing to comment on, exiting (%s)", err.Error()))
+		return
+	}
+	logger.Info(fmt.Sprintf("Working in PR %v", prNo), "pr", prNo)
+	attested.pr = prNo
 
-	workingDir := os.Getenv("INPUT_WORKING_DIRECTORY")
-	if workingDir != "" {
-		workingDir = strings.TrimPrefix(workingDir, "./")
-		workingDir = strings.TrimSuffix(workingDir, "/") + "/"
+	pr, err := preflightCheck(client, owner, repo, prNo)
+	if err != nil {
+		fail(err.Error())
 	}
+	permalinkCommit = pr.GetHead().GetSHA()
 
-	var errMessages []string
-	var validCommentWritten bool
-	for _, result := range results {
-		result.Range.Filename = workingDir + strings.ReplaceAll(result.Range.Filename, workspacePath, "")
-		comment := generateErrorMessage(result.Misconfigurations[0]) // Pass the first misconfiguration
-		fmt.Printf("Preparing comment for violation of rule %v in %v\n", result.Misconfigurations[0].ID, result.Range.Filename)
-		err := c.WriteMultiLineComment(result.Range.Filename, comment, result.Misconfigurations[0].CauseMetadata.StartLine, result.Misconfigurations[0].CauseMetadata.EndLine)
+	targets := load(cfg)
+	attested.addTargets(targets)
+	writeHTMLReport(targets, cfg)
+	recordRiskScore(targets)
+
+	if cfg.commentMode == commentModeSummary {
+		errMessages, failingTargets := postSummaryComment(client, owner, repo, prNo, targets, cfg.formatter, cfg.commentScope)
+		if err := routedReviewers.request(client, owner, repo, pr); err != nil {
+			logger.Error(err.Error())
+		}
+		if cfg.autofix != "" {
+			if err := pushAutofix(client, owner, repo, pr, annotationFindings(targets), cfg.autofix); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+		if err := etags.save(); err != nil {
+			errMessages = append(errMessages, fmt.Sprintf("failed to save the ETag cache. %s", err.Error()))
+		}
+		exitWithGateDecision(errMessages, failingTargets)
+		return
+	}
+
+	if reason := largePullRequest(pr, len(annotationFindings(targets)), cfg); reason != "" {
+		logger.Info(fmt.Sprintf("Large PR (%s), annotating a check run instead of commenting", reason), "reason", reason)
+		errMessages, failingTargets, err := annotateTargets(client, owner, repo, pr.GetHead().GetSHA(), targets, cfg.formatter)
+		if err == nil {
+			for _, a := range annotationFindings(targets) {
+				routedReviewers.add(commenter.Reviewers(cfg.routes, a.finding, a.path))
+			}
+			if err := routedReviewers.request(client, owner, repo, pr); err != nil {
+				logger.Error(err.Error())
+			}
+			if cfg.autofix != "" {
+				if err := pushAutofix(client, owner, repo, pr, annotationFindings(targets), cfg.autofix); err != nil {
+					logger.Error(err.Error())
+				}
+			}
+			if err := etags.save(); err != nil {
+				errMessages = append(errMessages, fmt.Sprintf("failed to save the ETag cache. %s", err.Error()))
+			}
+			exitWithGateDecision(errMessages, failingTargets)
+			return
+		}
+		logger.Error(fmt.Sprintf("%s, commenting instead", err.Error()))
+	}
+
+	var c commenter.Provider
+	if cfg.commentMode == commentModeReview {
+		review, err := commenter.NewReview(shutdown, client, owner, repo, prNo)
+		if err != nil {
+			fail(fmt.Sprintf("could not start the review (%s)", err.Error()))
+		}
+		pullReview = &batchedReview{Review: review}
+		c = review
+	} else if c, err = commenter.NewGitHub(token, owner, repo, prNo, os.Getenv("GITHUB_API_URL")); err != nil {
+		fail(fmt.Sprintf("could not connect to GitHub (%s)", err.Error()))
+	}
+
+	c = skipPermalinkedComments(c, client, owner, repo, prNo)
+
+	// a review is written at once at the end of the run, there is nothing to resume
+	if path := os.Getenv("INPUT_RUN_STATE"); path != "" && pullReview == nil {
+		state, err := loadRunState(path, prNo, os.Getenv("GITHUB_SHA"))
 		if err != nil {
-			// don't error if it's simply that the comments aren't valid for the PR
-			switch err.(type) {
-			case commenter.CommentAlreadyWrittenError:
-				fmt.Println("Ignoring - comment already written")
-				validCommentWritten = true
-			case commenter.CommentNotValidError:
-				fmt.Println("Ignoring - change not part of the current PR")
-				continue
-			default:
-				errMessages = append(errMessages, err.Error())
+			logger.Error(fmt.Sprintf("Ignoring the run state. %s", err.Error()))
+		} else {
+			if len(state.Completed) > 0 {
+				logger.Info(fmt.Sprintf("Resuming an earlier run, %d comments were already written", len(state.Completed)), "completed", len(state.Completed))
 			}
+			c = state.wrap(c)
+		}
+	}
+
+	// the retried comments may come up again, they must not be written twice
+	p := commenter.Once(c)
+	if path := os.Getenv("INPUT_RETRY_QUEUE"); path != "" {
+		if retries, err = loadRetryQueue(path, prNo); err != nil {
+			logger.Error(fmt.Sprintf("Ignoring the retry queue. %s", err.Error()))
 		} else {
-			validCommentWritten = true
-			fmt.Printf("Commenting for %s to %s:%d:%d\n", result.Misconfigurations[0].Description, result.Range.Filename, result.Misconfigurations[0].CauseMetadata.StartLine, result.Misconfigurations[0].CauseMetadata.EndLine)
+			retries.retry(p)
 		}
 	}
 
-	if len(errMessages) > 0 {
-		fmt.Printf("There were %d errors:\n", len(errMessages))
-		for _, err := range errMessages {
-			fmt.Println(err)
+	errMessages, failingTargets := processTargets(p, targets)
+	if pullReview != nil {
+		// the comments queued before a cancellation are still written
+		errMessages = append(errMessages, pullReview.submit()...)
+	}
+	if cfg.staleComments != "" && !cancelled() {
+		errMessages = append(errMessages, cleanUpStaleComments(client, owner, repo, prNo, targets, cfg.staleComments)...)
+	}
+	if cfg.summaryComment {
+		findings := annotationFindings(targets)
+		body, err := summaryCommentBody(targets, findings, cfg.formatter, cfg.commentScope)
+		if err == nil {
+			_, err = writeSummaryComment(client, owner, repo, prNo, body)
+		}
+		if err != nil {
+			errMessages = append(errMessages, err.Error())
 		}
-		os.Exit(1)
 	}
-	if validCommentWritten || len(errMessages) > 0 {
-		if softFail, ok := os.LookupEnv("INPUT_SOFT_FAIL_COMMENTER"); ok && strings.ToLower(softFail) == "true" {
-			return
+	if err := routedReviewers.request(client, owner, repo, pr); err != nil {
+		// the comments still mention the reviewers
+		logger.Error(err.Error())
+	}
+	if cfg.autofix != "" && !cancelled() {
+		// the comments still suggest the fixes
+		if err := pushAutofix(client, owner, repo, pr, annotationFindings(targets), cfg.autofix); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	if err := etags.save(); err != nil {
+		errMessages = append(errMessages, fmt.Sprintf("failed to save the ETag cache. %s", err.Error()))
+	}
+	if retries != nil {
+		if err := retries.save(); err != nil {
+			errMessages = append(errMessages, fmt.Sprintf("failed to save the retry queue. %s", err.Error()))
+		} else if len(retries.Comments) > 0 {
+			logger.Info(fmt.Sprintf("%d comments queued to retry on the next run", len(retries.Comments)), "queued", len(retries.Comments))
 		}
-		os.Exit(1)
 	}
+	if cancelled() {
+		exitCancelledRun(errMessages)
+	}
+	if outOfTime() && stats.timedOut > 0 {
+		// a deadline passing after the last comment was written leaves nothing for the next run
+		exitPartialRun(errMessages, failingTargets)
+	}
+	exitWithGateDecision(errMessages, failingTargets)
+}
+
+func setupLogger(logFormat string, w io.Writer) {
+	format, err := parseLogFormat(logFormat)
+	if err != nil {
+		fail(err.Error())
+	}
+	logger = newLogger(format, w)
 }
 
-func createCommenter(token, owner, repo string, prNo int) (*commenter.Commenter, error) {
-	var err error
-	var c *commenter.Commenter
+// resultsFile is the report read when no path is given
+const resultsFile = "trivy_results.json"
 
-	githubAPIURL := os.Getenv("GITHUB_API_URL")
-	if githubAPIURL == "" || githubAPIURL == "https://api.github.com" {
-		c, err = commenter.NewCommenter(token, owner, repo, prNo)
-	} else {
-		u, err := url.Parse(githubAPIURL)
+// reportFileArg is the report of the arguments, several of them are joined into a list for
+// loadReport as when a shell expands a glob
+func reportFileArg(flags *flag.FlagSet) string {
+	if flags.NArg() > 0 && flags.Arg(0) != "" {
+		return strings.Join(flags.Args(), ",")
+	}
+	return resultsFile
+}
+
+func parseRepository() (string, string, error) {
+	githubRepository := os.Getenv("GITHUB_REPOSITORY")
+	split := strings.Split(githubRepository, "/")
+	if len(split) != 2 {
+		return "", "", fmt.Errorf("unexpected value for GITHUB_REPOSITORY. Expected <organization/name>, found %v", split)
+	}
+	return split[0], split[1], nil
+}
+
+func runLocal(targets []reportTarget, output string) {
+	w := os.Stdout
+	if output != "" && output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fail(fmt.Sprintf("failed to create output file. %s", err.Error()))
+		}
+		w = f
+	}
+
+	for i := range targets {
+		// the rendered comments are written to a single output in order
+		targets[i].cfg.maxParallel = 1
+	}
+	c := newLocalCommenter(w)
+	errMessages, failingTargets := processTargets(c, targets)
+	if err := c.writeSummary(); err != nil {
+		errMessages = append(errMessages, err.Error())
+	}
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			errMessages = append(errMessages, err.Error())
+		}
+		logger.Info(fmt.Sprintf("Rendered comments written to %s", output), "output", output)
+	}
+	if cancelled() {
+		exitCancelledRun(errMessages)
+	}
+	exitWithGateDecision(errMessages, failingTargets)
+}
+
+func loadResults(reportFile string) []report.Result {
+	results, err := loadReport(reportFile)
+	return checkResults(results, err)
+}
+
+// strictSchema fails on any drift from the report schema instead of warning about it
+var strictSchema bool
+
+// reportFormat is the format the reports are read as, one of report.Formats, detected from each
+// report when empty
+var reportFormat = os.Getenv("INPUT_FORMAT")
+
+var reportFormatUsage = "format of the report, one of " + strings.Join(report.Formats, ", ") + ", detected when unset"
+
+// loadReport reads the report, warning about fields that don't match the schema, so a new
+// Trivy release shows up in the log rather than as comments silently missing. A comma
+// separated list of reports or glob patterns, e.g. reports/*.json, loads every match and
+// merges their results with MergeResults.
+func loadReport(path string) ([]report.Result, error) {
+	paths, err := reportPaths(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []report.Result
+	for _, path := range paths {
+		r, err := loadReportFile(path)
+		if err != nil {
+			if len(paths) > 1 {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return nil, err
+		}
+		if err := checkDrift(reportName(path), r); err != nil {
+			return nil, err
+		}
+		results = append(results, r.Results...)
+	}
+	if len(paths) > 1 {
+		results, _ = report.MergeResults(results)
+	}
+	maskSecrets(results)
+	return results, nil
+}
+
+// stdinReport is the report path that reads the report from stdin, e.g. piped from trivy
+const stdinReport = "-"
+
+// loadReportFile decodes the report at path, on stdin for - or downloaded from a URL or
+// artifact, recording its digest for the attestation
+func loadReportFile(path string) (*report.Report, error) {
+	if isRemoteReport(path) {
+		file, cleanup, err := fetchReport(path)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		r, err := report.LoadReportFormat(file, reportFormat)
+		if err == nil {
+			attested.addReportAs(path, file)
+		}
+		return r, err
+	}
+	if path != stdinReport {
+		r, err := report.LoadReportFormat(path, reportFormat)
 		if err == nil {
-			enterpriseURL := fmt.Sprintf("%s://%s", u.Scheme, u.Hostname())
-			c, err = commenter.NewEnterpriseCommenter(token, enterpriseURL, enterpriseURL, owner, repo, prNo)
+			attested.addReport(path)
+		}
+		return r, err
+	}
+	hash := sha256.New()
+	stdin := io.TeeReader(os.Stdin, hash)
+	r, err := report.DecodeFormat(stdin, reportFormat)
+	if err != nil {
+		return nil, err
+	}
+	// the digest covers what follows the report too
+	if _, err := io.Copy(io.Discard, stdin); err != nil {
+		return nil, err
+	}
+	attested.addDigest(reportName(path), hash.Sum(nil))
+	return r, nil
+}
+
+// readReportFile reads the report at path, on stdin for - or downloaded, decompressed when
+// gzipped, for the commands reading other reports than trivy's JSON
+func readReportFile(path string) ([]byte, error) {
+	var in io.Reader = os.Stdin
+	if path != stdinReport {
+		if isRemoteReport(path) {
+			file, cleanup, err := fetchReport(path)
+			if err != nil {
+				return nil, err
+			}
+			defer cleanup()
+			path = file
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := report.Uncompressed(in)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// reportName names the report in logs
+func reportName(path string) string {
+	if path == stdinReport {
+		return "stdin"
+	}
+	return path
+}
+
+// reportPaths expands the list of reports and patterns, a pattern matching nothing is an error
+// rather than a run that silently comments on nothing. A list of several lines has a report on
+// each line, so a URL with commas in it can be listed as it is. Otherwise the reports are comma
+// separated and the commas of a URL have to be escaped as %2C.
+func reportPaths(list string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	separator := ","
+	if strings.Contains(strings.TrimSpace(list), "\n") {
+		separator = "\n"
+	}
+	for _, pattern := range strings.Split(list, separator) {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches := []string{pattern}
+		if !isRemoteReport(pattern) && strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("report pattern %s: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no report matches %s", pattern)
+			}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no report file given")
+	}
+	return paths, nil
+}
+
+// checkDrift logs the drift of the report, failing on it under --strict-schema
+func checkDrift(source string, r *report.Report) error {
+	if strictSchema {
+		return r.CheckSchema()
+	}
+	logDrift(source, r)
+	return nil
+}
+
+func logDrift(source string, r *report.Report) {
+	var unknown int
+	for _, d := range r.Drift {
+		if d.Kind == report.DriftUnknown {
+			unknown++
+			continue
+		}
+		logger.Warn(fmt.Sprintf("%s: %s", source, d), "report", source, "path", d.Path, "drift", string(d.Kind))
+	}
+	if unknown > 0 {
+		logger.Info(fmt.Sprintf("%s has %d fields this version doesn't know, they are ignored", source, unknown), "report", source, "unknown_fields", unknown)
+	}
+}
+
+// checkResults fails on a load error and exits early when there is nothing to comment on
+func checkResults(results []report.Result, err error) []report.Result {
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+
+	if len(results) == 0 && !cleansStaleComments() {
+		logger.Info("No issues found.", "event", eventGateDecision, "decision", "pass", "reason", "no_issues")
+		logRunSummary("pass")
+		exit(0)
+	}
+	issues := len(report.Findings(results))
+	logger.Info(fmt.Sprintf("trivy found %s", commenter.IssueCount(issues)), "issues", issues)
+	return results
+}
+
+// processTargets comments on every target, returning the errors and the targets whose
+// gate failed because a comment at or above their gate severity was written
+func processTargets(p commenter.Provider, targets []reportTarget) ([]string, []string) {
+	var errMessages []string
+	var failingTargets []string
+	for _, t := range targets {
+		if cancelled() {
+			break
+		}
+		if t.name != "" {
+			logger.Info(fmt.Sprintf("Processing target %s", t.name), "target", t.name)
+		}
+		errs, blocking := processResults(p, t)
+		errMessages = append(errMessages, errs...)
+		if !blocking {
+			continue
+		}
+		if t.cfg.softFail {
+			logger.Info(fmt.Sprintf("Soft fail enabled%s, not failing the run", forTarget(t.name)), "event", eventGateDecision, "decision", "pass", "reason", "soft_fail", "target", t.name)
+			continue
+		}
+		failingTargets = append(failingTargets, t.name)
+	}
+	return errMessages, failingTargets
+}
+
+// processResults writes a comment per finding of the target, returning the errors and whether
+// any comment at or above the gate severity was written
+func processResults(p commenter.Provider, t reportTarget) ([]string, bool) {
+	findings, cfg, owners := t.findings, t.cfg, t.owners
+	if workspace := os.Getenv("GITHUB_WORKSPACE"); workspace != "" {
+		logger.Info(fmt.Sprintf("Working in GITHUB_WORKSPACE %s/", workspace), "workspace", workspace+"/")
+	}
+
+	findingAttrs := func(c commenter.Comment) []any {
+		return []any{"rule", c.Finding.ID, "severity", c.Finding.Severity, "file", c.File,
+			"start_line", c.Finding.StartLine, "end_line", c.Finding.EndLine}
+	}
+	outcome := commenter.Post(p, findings, commenter.Options{
+		Context:      postingContext(),
+		MinSeverity:  cfg.minSeverity,
+		GateSeverity: cfg.gateSeverity,
+		MaxComments:  cfg.maxComments,
+		Owners:       owners,
+		Routes:       cfg.routes,
+		Formatter:    cfg.formatter,
+		Anchor:       workspaceAnchor(cfg),
+		Parallel:     cfg.maxParallel,
+		Unified:      cfg.unifiedComments,
+		Scope:        targetScope(t),
+		// every other comment would fail the same way
+		Fatal:      isCommentPermissionError,
+		BreakAfter: circuitBreakerThreshold,
+		OnPrepare: func(c commenter.Comment) {
+			logger.Info(fmt.Sprintf("Preparing comment for violation of rule %v in %v", c.Finding.ID, c.File),
+				append([]any{"event", eventFindingProcessed}, findingAttrs(c)...)...)
+		},
+		OnResult: func(c commenter.Comment) {
+			if retries != nil && c.Status == commenter.StatusFailed {
+				if cancelled() {
+					// interrupted rather than rejected
+					retries.push(c)
+				} else {
+					retries.add(c, c.Err)
+				}
+			}
+			attested.addComment(c)
+			if pullReview != nil && c.Status == commenter.StatusPosted {
+				pullReview.add(c)
+			}
+			if c.Status == commenter.StatusPosted || c.Status == commenter.StatusAlreadyWritten {
+				routedReviewers.add(commenter.Reviewers(cfg.routes, c.Finding, c.File))
+				for _, f := range c.Related {
+					routedReviewers.add(commenter.Reviewers(cfg.routes, f, c.File))
+				}
+			}
+			attrs := append([]any{"event", eventCommentPosted, "status", string(c.Status)}, findingAttrs(c)...)
+			switch c.Status {
+			case commenter.StatusPosted:
+				logger.Info(fmt.Sprintf("Commenting for %s to %s:%d:%d", c.Finding.Description, c.File, c.Finding.StartLine, c.Finding.EndLine), attrs...)
+			case commenter.StatusAlreadyWritten:
+				logger.Info("Ignoring - comment already written", attrs...)
+			case commenter.StatusNotInPR:
+				logger.Info("Ignoring - change not part of the current PR", attrs...)
+			}
+		},
+	})
+	stats.posted += outcome.Posted
+	stats.skipped += outcome.Skipped
+	for name, count := range outcome.Filtered {
+		stats.filtered[name] += count
+	}
+
+	var circuitOpen *commenter.CircuitOpenError
+	if errors.As(outcome.Aborted, &circuitOpen) {
+		reportUnposted(outcome.Unposted)
+		if retries != nil {
+			for _, c := range outcome.Unposted {
+				retries.add(c, circuitOpen.Last)
+			}
+		}
+	} else if errors.Is(outcome.Aborted, context.Canceled) || errors.Is(outcome.Aborted, context.DeadlineExceeded) {
+		if errors.Is(outcome.Aborted, context.DeadlineExceeded) {
+			stats.timedOut += len(outcome.Unposted)
+		}
+		reportUnposted(outcome.Unposted)
+		if retries != nil {
+			for _, c := range outcome.Unposted {
+				retries.push(c)
+			}
 		}
+	} else if outcome.Aborted != nil {
+		fail(fmt.Sprintf("%s (%s)", commentPermissionMessage, outcome.Aborted.Error()))
+	}
+	if outcome.Truncated {
+		logger.Info(fmt.Sprintf("Reached the limit of %d comments, skipping the remaining issues", cfg.maxComments), "max_comments", cfg.maxComments)
 	}
 
-	return c, err
+	var errMessages []string
+	for _, err := range outcome.Errors {
+		errMessages = append(errMessages, err.Error())
+	}
+	return errMessages, outcome.Blocking
 }
 
-func generateErrorMessage(misconf misconfiguration) string {
-	return fmt.Sprintf(`:warning: trivy found a **%s** severity issue from rule `+"`%s`"+`:
-> %s
+// consecutive API failures of the same class after which the remaining comments aren't attempted
+const circuitBreakerThreshold = 5
 
-More information available %s`,
-		misconf.Severity, misconf.ID, misconf.Description, formatUrls(misconf.References))
+// reportUnposted writes the comments that couldn't be posted to the job summary, so they
+// aren't lost when the API keeps failing
+func reportUnposted(comments []commenter.Comment) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## trivy comments that could not be posted\n\n")
+	for _, c := range comments {
+		fmt.Fprintf(&sb, "### %s\n\n%s\n\n", formatLocation(c.File, c.Finding.StartLine, c.Finding.EndLine), c.Body)
+	}
+
+	stepSummary := os.Getenv("GITHUB_STEP_SUMMARY")
+	if stepSummary == "" {
+		logger.Info(fmt.Sprintf("%d comments could not be posted and there is no job summary to write them to", len(comments)), "unposted", len(comments))
+		return
+	}
+	if err := appendToFile(stepSummary, sb.String()); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the unposted comments to the job summary. %s", err.Error()))
+		return
+	}
+	logger.Info(fmt.Sprintf("%d comments could not be posted and were written to the job summary instead", len(comments)), "unposted", len(comments))
 }
 
+// workspaceAnchor maps report targets onto repository paths, stripping the GITHUB_WORKSPACE
+// trivy ran in and resolving them against the working directories
+func workspaceAnchor(cfg settings) func(target string) string {
+	var workspacePath string
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace != "" {
+		workspacePath = fmt.Sprintf("%s/", workspace)
+	} else {
+		workspace = "."
+	}
+	return func(target string) string {
+		if workspacePath != "" {
+			target = strings.ReplaceAll(target, workspacePath, "")
+		}
+		return resolveFilename(target, cfg.workingDirectories, workspace)
+	}
+}
+
+// locatedFindings flattens the results and anchors the findings trivy reports on files that
+// aren't in the PR: built templates onto their source, vulnerable packages onto their lockfile
+// entry, the manifest fields kubescape points at onto their lines, resources of called modules
+// onto the module call, rendered Helm output onto its chart template and the vulnerabilities
+// of an image onto the Dockerfile's FROM line. Suggestions, secret remediation, the license
+// policy and VEX statements are then applied to them, the licenses of packages the base SBOM
+// already has are left out and the findings on generated and vendored files are suppressed.
+// Last, the findings on files are linked to their lines at the commit scanned.
+func locatedFindings(results []report.Result, cfg settings) []report.Finding {
+	anchor := workspaceAnchor(cfg)
+	root := os.Getenv("GITHUB_WORKSPACE")
+	read := func(target string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(root, anchor(target)))
+	}
+	list := func(dir string) ([]string, error) {
+		entries, err := os.ReadDir(filepath.Join(root, anchor(dir)))
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names, err
+	}
+	findings := report.MapSources(report.Findings(results), cfg.sourceRules, read)
+	findings = report.LocatePackages(findings, read)
+	findings = report.LocateManifestPaths(findings, read)
+	findings = report.LocateModuleCalls(findings, read, list)
+	findings = report.LocateHelmTemplates(findings, cfg.helmCharts, read)
+	if cfg.dockerfile != "" {
+		if content, err := read(cfg.dockerfile); err == nil {
+			findings = report.LocateBaseImages(findings, cfg.dockerfile, content)
+		}
+	}
+	if cfg.registryLookup {
+		findings = report.SuggestBaseImages(findings, read, registry.resolve)
+	}
+	findings = report.SuggestKubernetesFixes(findings, read)
+	findings = report.SuggestTerraformFixes(findings, read)
+	findings = report.RemediateSecrets(findings, cfg.secretActions)
+	if cfg.licensePolicy != nil {
+		findings = report.ApplyLicensePolicy(findings, *cfg.licensePolicy)
+	}
+	if cfg.sbomBase != nil {
+		findings = report.IntroducedLicenses(findings, cfg.sbomBase)
+	}
+	findings = report.ApplyVEX(findings, cfg.vexStatements, cfg.vexProducts, cfg.vexAction)
+	if cfg.skipGenerated {
+		findings = report.SkipGenerated(findings, anchor, func(name string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(root, name))
+		})
+	}
+	findings = report.LineHashes(findings, read)
+	if base := permalinkBase(); base != "" {
+		findings = report.Permalinks(findings, base, anchor, func(path string) bool {
+			info, err := os.Stat(filepath.Join(root, path))
+			return err == nil && !info.IsDir()
+		})
+	}
+	return findings
+}
+
+// registry is shared by every target, so each base image is looked up once
+var registry = newRegistryLookup()
+
+func exitWithGateDecision(errMessages []string, failingTargets []string) {
+	stats.errors = len(errMessages)
+	if len(errMessages) > 0 {
+		logger.Error(fmt.Sprintf("There were %d errors:", len(errMessages)), "errors", len(errMessages))
+		for _, err := range errMessages {
+			logger.Error(err, "event", eventError)
+		}
+		logger.Error("Failing the run due to errors", "event", eventGateDecision, "decision", "fail", "reason", "errors")
+		logRunSummary("fail")
+		exit(1)
+	}
+	if len(failingTargets) > 0 {
+		message := "Failing the run due to comments written"
+		if named := targetNames(failingTargets); named != "" {
+			message += " for " + named
+		}
+		logger.Error(message, "event", eventGateDecision, "decision", "fail", "reason", "comments_written", "targets", failingTargets)
+		logRunSummary("fail")
+		exit(1)
+	}
+	logger.Info("No comments at or above the gate severity written", "event", eventGateDecision, "decision", "pass", "reason", "below_gate_severity")
+	logRunSummary("pass")
+}
+
+func forTarget(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " for " + name
+}
+
+// the event payload location inside the Docker action mount, used when GITHUB_EVENT_PATH is not set
+const dockerGithubEventFile = "/github/workflow/event.json"
+
 func extractPullRequestNumber() (int, error) {
-	githubEventFile := "/github/workflow/event.json"
+	githubEventFile := os.Getenv("GITHUB_EVENT_PATH")
+	if githubEventFile == "" {
+		githubEventFile = dockerGithubEventFile
+	}
 	file, err := ioutil.ReadFile(githubEventFile)
 	if err != nil {
-		fail(fmt.Sprintf("GitHub event payload not found in %s", githubEventFile))
-		return -1, err
+		return -1, fmt.Errorf("GitHub event payload not found in %s", githubEventFile)
 	}
 
 	var data map[string]interface{}
@@ -149,18 +850,11 @@ func extractPullRequestNumber() (int, error) {
 	return prNumber, nil
 }
 
-func formatUrls(urls []string) string {
-	urlList := ""
-	for _, url := range urls {
-		if urlList != "" {
-			urlList += fmt.Sprintf(" and ")
-		}
-		urlList += fmt.Sprintf("[here](%s)", url)
-	}
-	return urlList
-}
-
 func fail(err string) {
-	fmt.Printf("Error: %s\n", err)
-	os.Exit(-1)
+	if cancelled() {
+		// the error is most likely the shutdown cancelling the request in flight
+		exitCancelledRun([]string{err})
+	}
+	logger.Error(err, "event", eventError)
+	exit(-1)
 }
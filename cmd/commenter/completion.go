@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// completionFlags lists the flags of each command, keep in sync when adding flags
+var completionFlags = map[string][]string{
+	"bench":      {"--log-format", "--report", "--template", "--n"},
+	"cluster":    {"--log-format", "--local"},
+	"comment":    {"--log-format", "--version", "--local", "--output", "--targets", "--quiet", "--pprof", "--strict-schema", "--format"},
+	"compliance": {"--log-format", "--local"},
+	"digest":     {"--log-format", "--issue", "--title", "--local"},
+	"doctor":     {"--log-format"},
+	"gate":       {"--log-format", "--severity"},
+	"init":       {"--output", "--working-directory", "--report-file", "--soft-fail", "--force"},
+	"merge":      {"--log-format", "--local", "--output", "--merged", "--strict-schema", "--format"},
+	"render":     {"--log-format", "--report", "--template", "--out", "--pprof", "--strict-schema", "--format"},
+	"review":     {"--ignore-file"},
+	"scan":       {"--log-format", "--local", "--quiet", "--output", "--trivy", "--pprof", "--strict-schema", "--scanners", "--severity"},
+	"summary":    {"--log-format", "--formatter"},
+	"update":     {"--check"},
+	"validate":   {"--log-format", "--strict-schema", "--format"},
+}
+
+// completionValues lists the accepted values of flags taking one of a fixed set
+var completionValues = map[string][]string{
+	"--log-format": {logFormatText, logFormatJSON},
+	"--severity":   report.Severities,
+}
+
+// runCompletion prints a completion script for the given shell
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		fail("usage: commenter completion bash|zsh|fish")
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported shell %q\n", args[0])
+		exit(1)
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(subcommandDescriptions))
+	for name := range subcommandDescriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bashCompletion() string {
+	var sb strings.Builder
+	sb.WriteString(`_commenter() {
+  local cur prev cmd flags
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  prev="${COMP_WORDS[COMP_CWORD-1]}"
+  cmd="${COMP_WORDS[1]}"
+
+  case "$prev" in
+`)
+	for _, flag := range sortedKeys(completionValues) {
+		fmt.Fprintf(&sb, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", flag, strings.Join(completionValues[flag], " "))
+	}
+	sb.WriteString("  esac\n\n")
+	fmt.Fprintf(&sb, "  if [ \"$COMP_CWORD\" -eq 1 ] && [[ \"$cur\" != -* ]]; then\n    COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -X '!*.json' -- \"$cur\"))\n    return\n  fi\n\n",
+		strings.Join(commandNames(), " "))
+	sb.WriteString("  case \"$cmd\" in\n")
+	for _, name := range sortedKeys(completionFlags) {
+		fmt.Fprintf(&sb, "    %s) flags=%q ;;\n", name, strings.Join(completionFlags[name], " "))
+	}
+	fmt.Fprintf(&sb, "    *) flags=%q ;;\n  esac\n\n", strings.Join(completionFlags["comment"], " "))
+	sb.WriteString(`  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -f -X '!*.json' -- "$cur") $(compgen -d -- "$cur"))
+  fi
+}
+complete -o filenames -F _commenter commenter
+`)
+	return sb.String()
+}
+
+func fishCompletion() string {
+	var sb strings.Builder
+	sb.WriteString("complete -c commenter -f\n")
+	for _, name := range commandNames() {
+		fmt.Fprintf(&sb, "complete -c commenter -n __fish_use_subcommand -a %s -d %q\n", name, subcommandDescriptions[name])
+	}
+	for _, name := range sortedKeys(completionFlags) {
+		condition := fmt.Sprintf("'__fish_seen_subcommand_from %s'", name)
+		if name == "comment" {
+			// comment is also the default command
+			condition = fmt.Sprintf("'__fish_seen_subcommand_from comment; or not __fish_seen_subcommand_from %s'", strings.Join(commandNames(), " "))
+		}
+		for _, flag := range completionFlags[name] {
+			values := ""
+			if v, ok := completionValues[flag]; ok {
+				values = fmt.Sprintf(" -x -a %q", strings.Join(v, " "))
+			}
+			fmt.Fprintf(&sb, "complete -c commenter -n %s -l %s%s\n", condition, strings.TrimPrefix(flag, "--"), values)
+		}
+	}
+	sb.WriteString("complete -c commenter -a '(__fish_complete_suffix .json)'\n")
+	return sb.String()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
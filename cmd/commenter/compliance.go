@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/google/go-github/v32/github"
+)
+
+// runCompliance publishes a trivy compliance report, e.g. of trivy config --compliance, as a
+// check run with a pass/fail table of its controls. The run fails when a control at or above
+// the gate severity fails.
+func runCompliance(args []string) {
+	flags := flag.NewFlagSet("compliance", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	local := flags.Bool("local", false, "print the table instead of publishing the check run")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stderr)
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	path := reportFileArg(flags)
+	data, err := readReportFile(path)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load the compliance report. %s", err.Error()))
+	}
+	r, err := report.ParseCompliance(data)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load the compliance report. %s", err.Error()))
+	}
+	logger.Info(fmt.Sprintf("%s: %d of %d controls fail", r.ID, r.Failing(), len(r.Controls)), "compliance", r.ID, "controls", len(r.Controls), "failing", r.Failing())
+
+	blocking := false
+	for _, c := range r.Controls {
+		if c.Status == report.ControlFail && report.SeverityRank(c.Severity) >= report.SeverityRank(cfg.gateSeverity) {
+			blocking = true
+		}
+	}
+
+	if *local {
+		fmt.Print(commenter.ComplianceSummary(r, complianceLink(cfg, os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_SHA"))))
+		exitCheckGate(blocking, cfg, "a control", "compliance")
+		return
+	}
+
+	client, owner, repo, sha := checkRunTarget()
+	summary := commenter.ComplianceSummary(r, complianceLink(cfg, owner+"/"+repo, sha))
+	conclusion := "success"
+	if blocking {
+		conclusion = "failure"
+	} else if r.Failing() > 0 {
+		conclusion = "neutral"
+	}
+	publishCheckRun(client, owner, repo, sha, "trivy compliance "+r.ID, fmt.Sprintf("%d of %d controls fail", r.Failing(), len(r.Controls)), summary, conclusion)
+	exitCheckGate(blocking, cfg, "a control", "compliance")
+}
+
+// checkRunTarget connects to GitHub for a check run, returning the commit it goes on
+func checkRunTarget() (*github.Client, string, string, string) {
+	token := githubToken()
+	if len(token) == 0 {
+		fail("the INPUT_GITHUB_TOKEN has not been set and there is no GITHUB_TOKEN to fall back to")
+	}
+	owner, repo, err := parseRepository()
+	if err != nil {
+		fail(err.Error())
+	}
+	installAPITransport()
+	client, err := newGithubClient(token)
+	if err != nil {
+		fail(fmt.Sprintf("could not connect to GitHub (%s)", err.Error()))
+	}
+	sha := os.Getenv("GITHUB_SHA")
+	// GITHUB_SHA of a PR is its merge commit, the check run belongs on the head
+	if prNo, err := resolvePullRequestNumber(client, owner, repo); err == nil {
+		pr, _, err := client.PullRequests.Get(shutdown, owner, repo, prNo)
+		if err != nil {
+			fail(fmt.Sprintf("failed to read PR %d: %s", prNo, err.Error()))
+		}
+		sha = pr.GetHead().GetSHA()
+	}
+	if sha == "" {
+		fail("there is no commit to publish the check run on, GITHUB_SHA is not set")
+	}
+	return client, owner, repo, sha
+}
+
+// publishCheckRun creates a completed check run with the summary, truncated to fit
+func publishCheckRun(client *github.Client, owner, repo, sha, name, title, summary, conclusion string) {
+	summary = commenter.Truncate(summary, maxCheckRunSummary, "\n\n_The table was truncated._\n")
+	now := github.Timestamp{Time: time.Now()}
+	run, _, err := client.Checks.CreateCheckRun(shutdown, owner, repo, github.CreateCheckRunOptions{
+		Name:        name,
+		HeadSHA:     sha,
+		Status:      github.String("completed"),
+		Conclusion:  &conclusion,
+		CompletedAt: &now,
+		Output:      &github.CheckRunOutput{Title: &title, Summary: &summary},
+	})
+	if err != nil {
+		fail(fmt.Sprintf("failed to create the check run, it needs the checks: write permission (%s)", err.Error()))
+	}
+	logger.Info(fmt.Sprintf("Published %s on check run %s", name, run.GetHTMLURL()), "check_run", run.GetID())
+}
+
+// complianceLink links a failing resource to its lines at the commit when it is a file of the
+// checkout, and to the check's documentation otherwise, e.g. for the ARN of a cloud scan
+func complianceLink(cfg settings, repository, sha string) func(f report.Finding) string {
+	anchor := workspaceAnchor(cfg)
+	server := os.Getenv("GITHUB_SERVER_URL")
+	if server == "" {
+		server = "https://github.com"
+	}
+	return func(f report.Finding) string {
+		path := anchor(f.Target)
+		if _, err := os.Stat(filepath.Join(os.Getenv("GITHUB_WORKSPACE"), path)); err != nil || repository == "" || sha == "" {
+			return f.PrimaryURL
+		}
+		url := fmt.Sprintf("%s/%s/blob/%s/%s", strings.TrimSuffix(server, "/"), repository, sha, strings.TrimPrefix(path, "./"))
+		if f.StartLine > 0 {
+			url += fmt.Sprintf("#L%d", f.StartLine)
+			if f.EndLine > f.StartLine {
+				url += fmt.Sprintf("-L%d", f.EndLine)
+			}
+		}
+		return url
+	}
+}
+
+// exitCheckGate fails the run when what the check run reports, e.g. a control, fails at or
+// above the gate severity. The reason is logged with the gate decision.
+func exitCheckGate(blocking bool, cfg settings, what, reason string) {
+	if !blocking {
+		logger.Info(fmt.Sprintf("Nothing at or above %s fails", cfg.gateSeverity), "event", eventGateDecision, "decision", "pass")
+		return
+	}
+	if cfg.softFail {
+		logger.Info("Soft fail enabled, not failing the run", "event", eventGateDecision, "decision", "pass", "reason", "soft_fail")
+		return
+	}
+	logger.Info(fmt.Sprintf("Failing the run, %s at or above %s fails", what, cfg.gateSeverity), "event", eventGateDecision, "decision", "fail", "reason", reason)
+	exit(1)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/google/go-github/v32/github"
+)
+
+const (
+	// digestLabel marks the tracking issue when no issue number is given
+	digestLabel = "trivy-digest"
+	// maxIssueBody is GitHub's limit on the length of an issue body
+	maxIssueBody = 65536
+	// digestHistory is how many earlier digests the issue remembers the counts of
+	digestHistory = 12
+	// digestDateFormat is the date the counts of a digest are recorded at
+	digestDateFormat = "2006-01-02"
+)
+
+// digestSnapshot is the counts of a digest, kept in the issue body to compare the next one with
+type digestSnapshot struct {
+	Date   string         `json:"date"`
+	Commit string         `json:"commit,omitempty"`
+	Counts map[string]int `json:"counts"`
+}
+
+var digestMarker = regexp.MustCompile(`<!-- trivy-digest (\[.*?\]) -->`)
+
+// runDigest updates a pinned tracking issue with the findings of a scan of the default
+// branch, for runs on a schedule. The issue keeps the counts of the earlier digests, so each
+// one shows the change since the digest a week before.
+func runDigest(args []string) {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	issueFlag := flags.String("issue", os.Getenv("INPUT_DIGEST_ISSUE"), "number of the tracking issue, defaults to the open issue labelled "+digestLabel)
+	title := flags.String("title", "trivy digest", "title of the tracking issue when one is created")
+	local := flags.Bool("local", false, "print the digest instead of updating the issue")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stderr)
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	results, err := loadReport(reportFileArg(flags))
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+	findings := report.FilterBySeverity(locatedFindings(results, cfg), cfg.minSeverity)
+	now := time.Now().UTC()
+	current := digestSnapshot{Date: now.Format(digestDateFormat), Commit: os.Getenv("GITHUB_SHA"), Counts: make(map[string]int)}
+	for _, f := range findings {
+		if !f.Suppressed {
+			current.Counts[strings.ToUpper(f.Severity)]++
+		}
+	}
+
+	if *local {
+		body, err := digestBody(cfg, findings, current, nil, now)
+		if err != nil {
+			fail(err.Error())
+		}
+		fmt.Print(body)
+		return
+	}
+
+	token := githubToken()
+	if len(token) == 0 {
+		fail("the INPUT_GITHUB_TOKEN has not been set and there is no GITHUB_TOKEN to fall back to")
+	}
+	owner, repo, err := parseRepository()
+	if err != nil {
+		fail(err.Error())
+	}
+	installAPITransport()
+	client, err := newGithubClient(token)
+	if err != nil {
+		fail(fmt.Sprintf("could not connect to GitHub (%s)", err.Error()))
+	}
+
+	issue, err := digestIssue(client, owner, repo, *issueFlag)
+	if err != nil {
+		fail(err.Error())
+	}
+	var history []digestSnapshot
+	if issue != nil {
+		history = parseDigestHistory(issue.GetBody())
+	}
+	body, err := digestBody(cfg, findings, current, history, now)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	ctx := shutdown
+	if issue == nil {
+		issue, _, err = client.Issues.Create(ctx, owner, repo, &github.IssueRequest{Title: title, Body: &body, Labels: &[]string{digestLabel}})
+		if err != nil {
+			fail(fmt.Sprintf("failed to create the tracking issue, the token needs the issues: write permission (%s)", err.Error()))
+		}
+		// pinning needs admin rights the token may not have, the issue can still be pinned by hand
+		for _, err := range runMutations(client, []graphQLMutation{pinIssueMutation(issue.GetNodeID())}) {
+			logger.Warn(fmt.Sprintf("failed to pin the tracking issue. %s", err.Error()))
+		}
+		logger.Info(fmt.Sprintf("Created the tracking issue %s", issue.GetHTMLURL()), "issue", issue.GetNumber())
+		return
+	}
+	if _, _, err := client.Issues.Edit(ctx, owner, repo, issue.GetNumber(), &github.IssueRequest{Body: &body}); err != nil {
+		fail(fmt.Sprintf("failed to update the tracking issue %d. %s", issue.GetNumber(), err.Error()))
+	}
+	logger.Info(fmt.Sprintf("Updated the tracking issue %s", issue.GetHTMLURL()), "issue", issue.GetNumber())
+}
+
+// digestIssue returns the tracking issue, the one numbered or else the newest open issue with
+// the digest label, nil when there is none yet
+func digestIssue(client *github.Client, owner, repo, number string) (*github.Issue, error) {
+	ctx := shutdown
+	if number != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(number), "#"))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("INPUT_DIGEST_ISSUE is not a valid issue number: %q", number)
+		}
+		issue, _, err := client.Issues.Get(ctx, owner, repo, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tracking issue %d: %w", n, err)
+		}
+		return issue, nil
+	}
+	issues, _, err := client.Issues.ListByRepo(ctx, owner, repo, &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      []string{digestLabel},
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for the tracking issue: %w", err)
+	}
+	if len(issues) == 0 {
+		return nil, nil
+	}
+	return issues[0], nil
+}
+
+func parseDigestHistory(body string) []digestSnapshot {
+	m := digestMarker.FindStringSubmatch(body)
+	if m == nil {
+		return nil
+	}
+	var history []digestSnapshot
+	if err := json.Unmarshal([]byte(m[1]), &history); err != nil {
+		logger.Warn(fmt.Sprintf("Ignoring the counts of the earlier digests, they can't be read. %s", err.Error()))
+		return nil
+	}
+	return history
+}
+
+// weekBefore returns the newest earlier digest at least a week old, or the oldest one when
+// the digests are more frequent and none is that old yet
+func weekBefore(history []digestSnapshot, now time.Time) (digestSnapshot, bool) {
+	if len(history) == 0 {
+		return digestSnapshot{}, false
+	}
+	cutoff := now.AddDate(0, 0, -7).Format(digestDateFormat)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Date <= cutoff {
+			return history[i], true
+		}
+	}
+	return history[0], true
+}
+
+// digestBody renders the digest: the counts by severity with the change since the digest a
+// week before, then the summary of the summary formatter. The counts of this digest are
+// added to the history at the top of the body, where truncation doesn't reach.
+func digestBody(cfg settings, findings []report.Finding, current digestSnapshot, history []digestSnapshot, now time.Time) (string, error) {
+	formatter := cfg.formatter
+	if formatter == nil {
+		formatter = commenter.DefaultFormatter
+	}
+	summary, err := formatter.Summary(findings)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the summary. %s", err.Error())
+	}
+	previous, compared := weekBefore(history, now)
+
+	// a second digest on the same day replaces the first
+	if len(history) > 0 && history[len(history)-1].Date == current.Date {
+		history = history[:len(history)-1]
+	}
+	history = append(history, current)
+	if len(history) > digestHistory {
+		history = history[len(history)-digestHistory:]
+	}
+	recorded, err := json.Marshal(history)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!-- trivy-digest %s -->\n", recorded)
+	branch := os.Getenv("GITHUB_REF_NAME")
+	if branch == "" {
+		branch = "the default branch"
+	}
+	fmt.Fprintf(&sb, "Findings of the latest scan of %s", branch)
+	if len(current.Commit) >= 7 {
+		fmt.Fprintf(&sb, " at %s", current.Commit[:7])
+	}
+	fmt.Fprintf(&sb, ", updated %s.\n\n", current.Date)
+
+	if compared {
+		fmt.Fprintf(&sb, "| Severity | Findings | Since %s |\n|---|---|---|\n", previous.Date)
+	} else {
+		sb.WriteString("| Severity | Findings |\n|---|---|\n")
+	}
+	for i := len(report.Severities) - 1; i >= 0; i-- {
+		severity := report.Severities[i]
+		count := current.Counts[severity]
+		if !compared {
+			fmt.Fprintf(&sb, "| %s | %d |\n", severity, count)
+			continue
+		}
+		change := "-"
+		if delta := count - previous.Counts[severity]; delta > 0 {
+			change = fmt.Sprintf(":small_red_triangle: +%d", delta)
+		} else if delta < 0 {
+			change = fmt.Sprintf(":small_red_triangle_down: %d", delta)
+		}
+		fmt.Fprintf(&sb, "| %s | %d | %s |\n", severity, count, change)
+	}
+	sb.WriteString("\n" + summary)
+	return commenter.Truncate(sb.String(), maxIssueBody, "\n\n_The digest was truncated, see the workflow run for every finding._\n"), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// doctorCheck is a single line of the doctor checklist, skipped when a check it relies on failed
+type doctorCheck struct {
+	name      string
+	dependsOn []string
+	run       func() error
+}
+
+// doctorWarning is a problem the run recovers from, reported without failing doctor
+type doctorWarning struct {
+	error
+}
+
+// doctorSkipped is a check that can't run in this environment, with why
+type doctorSkipped struct {
+	reason string
+}
+
+func (s doctorSkipped) Error() string {
+	return s.reason
+}
+
+// runDoctor probes the environment and prints a pass/fail checklist covering the usual support issues
+func runDoctor(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stdout)
+
+	reportFile := reportFileArg(flags)
+	token := githubToken()
+	var owner, repo string
+
+	checks := []doctorCheck{
+		{name: "report file", run: func() error { return checkReport(reportFile) }},
+		{name: "repository", run: func() error {
+			var err error
+			owner, repo, err = parseRepository()
+			return err
+		}},
+		{name: "token present", run: func() error {
+			if token == "" {
+				return errors.New("neither INPUT_GITHUB_TOKEN nor GITHUB_TOKEN has been set")
+			}
+			return nil
+		}},
+		{name: "API reachable", run: checkAPIReachable},
+		{name: "token permissions", dependsOn: []string{"repository", "token present"}, run: func() error {
+			return checkToken(owner, repo)
+		}},
+		{name: "event payload", run: checkEventPayload},
+	}
+
+	failed := make(map[string]bool)
+	for _, check := range checks {
+		if dependencyFailed(check, failed) {
+			logger.Info(fmt.Sprintf("[SKIP] %s", check.name), "check", check.name, "status", "skip")
+			failed[check.name] = true
+			continue
+		}
+		err := check.run()
+		var warning doctorWarning
+		var skipped doctorSkipped
+		switch {
+		case err == nil:
+			logger.Info(fmt.Sprintf("[PASS] %s", check.name), "check", check.name, "status", "pass")
+		case errors.As(err, &skipped):
+			logger.Info(fmt.Sprintf("[SKIP] %s: skipped: %s", check.name, skipped.reason), "check", check.name, "status", "skip", "reason", skipped.reason)
+		case errors.As(err, &warning):
+			logger.Info(fmt.Sprintf("[WARN] %s: %s", check.name, err.Error()), "check", check.name, "status", "warn", "error", err.Error())
+		default:
+			logger.Info(fmt.Sprintf("[FAIL] %s: %s", check.name, err.Error()), "check", check.name, "status", "fail", "error", err.Error())
+			failed[check.name] = true
+		}
+	}
+
+	if len(failed) > 0 {
+		exit(1)
+	}
+}
+
+func dependencyFailed(check doctorCheck, failed map[string]bool) bool {
+	for _, dependency := range check.dependsOn {
+		if failed[dependency] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAPIReachable calls the API root on github.com or the Enterprise URL. Without a token
+// there is nothing the run would call it with, so it is skipped.
+func checkAPIReachable() error {
+	token := githubToken()
+	if token == "" {
+		return doctorSkipped{reason: "no token"}
+	}
+	client, err := newGithubClient(token)
+	if err != nil {
+		return err
+	}
+	req, err := client.NewRequest("GET", "", nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(shutdown, req, nil); err != nil {
+		return fmt.Errorf("%s is not reachable: %w", client.BaseURL, err)
+	}
+	return nil
+}
+
+func checkEventPayload() error {
+	if input := os.Getenv("INPUT_PR_NUMBER"); input != "" {
+		if prNo, err := strconv.Atoi(strings.TrimSpace(input)); err != nil || prNo <= 0 {
+			return fmt.Errorf("INPUT_PR_NUMBER is not a valid PR number: %q", input)
+		}
+		return nil
+	}
+	if _, err := extractPullRequestNumber(); err != nil {
+		// the run falls back to the PR of the current commit
+		return doctorWarning{fmt.Errorf("%s, the PR will be looked up from the current commit", err.Error())}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// etagCache sends conditional requests for the PR listings read on every run. GitHub answers
+// an unchanged listing with 304 Not Modified, which doesn't count against the rate limit,
+// and the cached body is returned in its place.
+type etagCache struct {
+	base http.RoundTripper
+	path string
+
+	mu      sync.Mutex
+	Entries map[string]etagEntry `json:"entries"`
+}
+
+type etagEntry struct {
+	ETag string `json:"etag"`
+	Link string `json:"link,omitempty"`
+	Body []byte `json:"body"`
+}
+
+// etags is the installed cache, nil until installETagCache is called
+var etags *etagCache
+
+// installETagCache caches listings for the run, and between runs when a path is given
+func installETagCache(path string) {
+	base := http.DefaultClient.Transport
+	if base == nil {
+		base = apiTransport
+	}
+	etags = &etagCache{base: base, path: path, Entries: make(map[string]etagEntry)}
+	if path != "" {
+		if err := etags.load(); err != nil {
+			logger.Error(fmt.Sprintf("Ignoring the ETag cache. %s", err.Error()))
+			etags.Entries = make(map[string]etagEntry)
+		}
+	}
+	http.DefaultClient.Transport = etags
+}
+
+func (c *etagCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheableListing(req) {
+		return c.base.RoundTrip(req)
+	}
+	key := req.Header.Get("Accept") + " " + req.URL.String()
+
+	c.mu.Lock()
+	entry, cached := c.Entries[key]
+	c.mu.Unlock()
+	if cached {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		statsMu.Lock()
+		stats.notModified++
+		statsMu.Unlock()
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header.Set("Content-Type", "application/json; charset=utf-8")
+		if entry.Link != "" {
+			resp.Header.Set("Link", entry.Link)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(entry.Body))
+		resp.ContentLength = int64(len(entry.Body))
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		c.mu.Lock()
+		c.Entries[key] = etagEntry{ETag: resp.Header.Get("ETag"), Link: resp.Header.Get("Link"), Body: body}
+		c.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// cacheableListing matches the PR files and review comments listings
+func cacheableListing(req *http.Request) bool {
+	if req.Method != http.MethodGet || !strings.Contains(req.URL.Path, "/pulls/") {
+		return false
+	}
+	return strings.HasSuffix(req.URL.Path, "/files") || strings.HasSuffix(req.URL.Path, "/comments")
+}
+
+func (c *etagCache) load() error {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("ETag cache %s is not valid: %w", c.path, err)
+	}
+	if c.Entries == nil {
+		c.Entries = make(map[string]etagEntry)
+	}
+	return nil
+}
+
+// save persists the cache for the next run, when a path was given
+func (c *etagCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+	"github.com/google/go-github/v32/github"
+)
+
+func newETagClient(t *testing.T, gh *testutil.FakeGitHub, path string) (*etagCache, *github.Client) {
+	t.Helper()
+	cache := &etagCache{base: http.DefaultTransport, path: path, Entries: make(map[string]etagEntry)}
+	if err := cache.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	client := github.NewClient(&http.Client{Transport: cache})
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+	return cache, client
+}
+
+func TestETagCache(t *testing.T) {
+	saved, savedStats := logger, stats
+	logger = newLogger(logFormatText, io.Discard)
+	stats = runStats{filtered: make(map[string]int), started: time.Now()}
+	t.Cleanup(func() { logger, stats = saved, savedStats })
+
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, testutil.AddedFile("main.tf", 20))
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 3, "a comment")
+	path := filepath.Join(t.TempDir(), "etags.json")
+	ctx := context.Background()
+
+	cache, client := newETagClient(t, gh, path)
+	for i := 0; i < 2; i++ {
+		files, _, err := client.PullRequests.ListFiles(ctx, "org", "repo", 1, nil)
+		if err != nil || len(files) != 1 || files[0].GetFilename() != "main.tf" {
+			t.Fatalf("listing %d got the files %v, %v", i, files, err)
+		}
+	}
+	if stats.notModified != 1 {
+		t.Errorf("%d listings were answered from the cache, want the second", stats.notModified)
+	}
+	if _, _, err := client.PullRequests.Get(ctx, "org", "repo", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Entries) != 1 {
+		t.Errorf("cached %d responses, want only the files listing", len(cache.Entries))
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// the next run picks the cache up, and a changed listing is read again
+	_, client = newETagClient(t, gh, path)
+	if _, _, err := client.PullRequests.ListFiles(ctx, "org", "repo", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats.notModified != 2 {
+		t.Errorf("the saved cache answered %d listings, want a second one", stats.notModified-1)
+	}
+	for i := 0; i < 2; i++ {
+		comments, _, err := client.PullRequests.ListComments(ctx, "org", "repo", 1, nil)
+		if err != nil || len(comments) != i+1 {
+			t.Fatalf("listing %d got %d comments, %v, want %d", i, len(comments), err, i+1)
+		}
+		gh.AddComment(1, "reviewer", "main.tf", 5, "another comment")
+	}
+	if stats.notModified != 2 {
+		t.Errorf("a changed listing was answered from the cache")
+	}
+}
+
+func TestCacheableListing(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{method: http.MethodGet, path: "/repos/org/repo/pulls/1/files", want: true},
+		{method: http.MethodGet, path: "/repos/org/repo/pulls/1/comments", want: true},
+		{method: http.MethodPost, path: "/repos/org/repo/pulls/1/comments"},
+		{method: http.MethodGet, path: "/repos/org/repo/issues/1/comments"},
+		{method: http.MethodGet, path: "/repos/org/repo/pulls/1"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "https://api.github.com"+tt.path, nil)
+		if got := cacheableListing(req); got != tt.want {
+			t.Errorf("cacheableListing(%s %s) = %t, want %t", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// artifactReportPrefix names a report in an artifact of the workflow run, as
+// artifact:<name> or artifact:<name>/<file in the artifact>
+const artifactReportPrefix = "artifact:"
+
+// isRemoteReport reports whether the report is downloaded rather than read from a file. A
+// plain http:// URL counts as one so it's refused rather than looked up as a file.
+func isRemoteReport(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, artifactReportPrefix)
+}
+
+// fetchReport downloads the report at an HTTPS URL, or in an artifact another job of the run
+// uploaded, to a temporary file so it's decoded as it's read like any other report. The
+// returned function removes the file.
+func fetchReport(source string) (string, func(), error) {
+	if strings.HasPrefix(source, "http://") {
+		return "", nil, fmt.Errorf("not downloading the report %s, reports are only downloaded over HTTPS", source)
+	}
+	f, err := os.CreateTemp("", "trivy-report-*.json")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if strings.HasPrefix(source, artifactReportPrefix) {
+		err = fetchArtifactReport(strings.TrimPrefix(source, artifactReportPrefix), f)
+	} else {
+		err = fetchURL(source, f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download the report %s: %w", source, err)
+	}
+	logger.Info(fmt.Sprintf("Downloaded the report %s", source), "report", source)
+	return f.Name(), cleanup, nil
+}
+
+func fetchURL(url string, w io.Writer) error {
+	client := &http.Client{Transport: apiTransport, Timeout: 5 * time.Minute, CheckRedirect: httpsRedirects}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET returned %s", resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// httpsRedirects refuses a redirect off HTTPS, which would download the report in the clear
+func httpsRedirects(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing the redirect to %s, reports are only downloaded over HTTPS", req.URL.Redacted())
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// fetchArtifactReport copies the report out of an artifact of the workflow run, the file named
+// after the artifact's name in the source or, without one, its only JSON or SARIF file
+func fetchArtifactReport(name string, w io.Writer) error {
+	name, file, _ := strings.Cut(name, "/")
+	token, resultsURL := os.Getenv("ACTIONS_RUNTIME_TOKEN"), os.Getenv("ACTIONS_RESULTS_URL")
+	if token == "" || resultsURL == "" {
+		return errors.New("ACTIONS_RUNTIME_TOKEN and ACTIONS_RESULTS_URL are only set in a workflow run")
+	}
+	runID, jobID, err := artifactBackendIDs(token)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: apiTransport, Timeout: 5 * time.Minute}
+	var signed struct {
+		SignedURL string `json:"signedUrl"`
+	}
+	err = artifactCall(client, resultsURL, token, "GetSignedArtifactURL", map[string]any{
+		"workflowRunBackendId": runID, "workflowJobRunBackendId": jobID, "name": name,
+	}, &signed)
+	if err != nil {
+		return err
+	}
+	if signed.SignedURL == "" {
+		return fmt.Errorf("the run has no artifact %s", name)
+	}
+
+	archive, err := os.CreateTemp("", "trivy-artifact-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	if err := fetchURL(signed.SignedURL, archive); err != nil {
+		return err
+	}
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return fmt.Errorf("the artifact %s isn't a zip archive: %w", name, err)
+	}
+	entry, err := artifactEntry(zr, file)
+	if err != nil {
+		return fmt.Errorf("artifact %s: %w", name, err)
+	}
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func artifactEntry(zr *zip.Reader, file string) (*zip.File, error) {
+	var reports []*zip.File
+	for _, entry := range zr.File {
+		if file != "" && path.Clean(entry.Name) == path.Clean(file) {
+			return entry, nil
+		}
+		if strings.HasSuffix(entry.Name, ".json") || strings.HasSuffix(entry.Name, ".sarif") {
+			reports = append(reports, entry)
+		}
+	}
+	switch {
+	case file != "":
+		return nil, fmt.Errorf("no file %s", file)
+	case len(reports) == 1:
+		return reports[0], nil
+	case len(reports) == 0:
+		return nil, errors.New("no JSON or SARIF file")
+	}
+	names := make([]string, 0, len(reports))
+	for _, entry := range reports {
+		names = append(names, entry.Name)
+	}
+	return nil, fmt.Errorf("several reports, name one of %s as artifact:<name>/<file>", strings.Join(names, ", "))
+}
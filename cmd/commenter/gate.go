@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// runGate fails when the report, or a target of the targets file, contains findings at or
+// above its gate severity, independently of whether any comments could be written. The
+// findings are those the commenter would comment on, of every kind, less the suppressed ones
+// (VEX, allowed licenses and generated files) and the duplicates. A target with soft_fail set
+// doesn't fail it.
+func runGate(args []string) {
+	flags := flag.NewFlagSet("gate", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	threshold := flags.String("severity", "", "lowest severity that fails the gate, defaults to INPUT_GATE_SEVERITY or the profile's, a target's gate severity overrides it")
+	targetsFile := flags.String("targets", os.Getenv("INPUT_TARGETS_FILE"), "targets file describing each scanned component, replaces the report file")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stdout)
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	if *threshold != "" {
+		if cfg.gateSeverity, err = report.ParseSeverity(*threshold); err != nil {
+			fail(err.Error())
+		}
+	}
+
+	var targets []reportTarget
+	if *targetsFile != "" {
+		targets = loadTargets(*targetsFile, cfg)
+	} else {
+		results, err := loadReport(reportFileArg(flags))
+		if err != nil {
+			fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+		}
+		targets = singleTarget(results, cfg)
+	}
+
+	failing, failingTargets := gateFailingIssues(targets)
+	if failing > 0 {
+		message := fmt.Sprintf("Gate failed, %s at or above %s", commenter.IssueCount(failing), cfg.gateSeverity)
+		if names := targetNames(failingTargets); names != "" {
+			message = fmt.Sprintf("Gate failed, %s at or above the gate severity of %s", commenter.IssueCount(failing), names)
+		}
+		logger.Error(message, "event", eventGateDecision, "decision", "fail", "reason", "severity_threshold", "targets", strings.Join(failingTargets, ","), "issues", failing)
+		exit(1)
+	}
+	message := fmt.Sprintf("Gate passed, no issues at or above %s", cfg.gateSeverity)
+	if *targetsFile != "" {
+		message = "Gate passed, no target has issues at or above its gate severity"
+	}
+	logger.Info(message,
+		"event", eventGateDecision, "decision", "pass", "reason", "severity_threshold", "threshold", cfg.gateSeverity)
+}
+
+// gateFailures counts the findings the gate fails the target on, those at or above its gate
+// severity
+func gateFailures(t reportTarget) int {
+	var failing int
+	for _, f := range t.unique {
+		if report.SeverityRank(f.Severity) >= report.SeverityRank(t.cfg.gateSeverity) {
+			failing++
+		}
+	}
+	return failing
+}
+
+// gateFailingIssues counts the findings the gate fails on across the targets, and returns the
+// targets failing it. A soft failing target is logged instead.
+func gateFailingIssues(targets []reportTarget) (int, []string) {
+	var failing int
+	var failingTargets []string
+	for _, t := range targets {
+		n := gateFailures(t)
+		if n == 0 {
+			continue
+		}
+		if t.cfg.softFail {
+			logger.Info(fmt.Sprintf("Soft fail enabled%s, not failing the gate on %s at or above %s", forTarget(t.name), commenter.IssueCount(n), t.cfg.gateSeverity),
+				"event", eventGateDecision, "decision", "pass", "reason", "soft_fail", "target", t.name, "threshold", t.cfg.gateSeverity, "issues", n)
+			continue
+		}
+		if t.name != "" {
+			logger.Info(fmt.Sprintf("Target %s has %s at or above %s", t.name, commenter.IssueCount(n), t.cfg.gateSeverity), "target", t.name, "threshold", t.cfg.gateSeverity, "issues", n)
+		}
+		failing += n
+		failingTargets = append(failingTargets, t.name)
+	}
+	return failing, failingTargets
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestGateFailures(t *testing.T) {
+	misconfiguration := report.Misconfiguration{ID: "AVD-AWS-0086", Severity: "HIGH", CauseMetadata: report.CauseMetadata{StartLine: 3, EndLine: 5}}
+	results := []report.Result{{
+		Target: "main.tf", Class: "config", Type: "terraform",
+		// reported twice, e.g. by two scans merged
+		Misconfigurations: []report.Misconfiguration{misconfiguration, misconfiguration},
+	}, {
+		Target: "go.mod", Class: "lang-pkgs", Type: "gomod",
+		Vulnerabilities: []report.Vulnerability{
+			{VulnerabilityID: "CVE-2024-0001", PkgName: "golang.org/x/net", InstalledVersion: "v0.17.0", Severity: "CRITICAL"},
+			{VulnerabilityID: "CVE-2024-0002", PkgName: "golang.org/x/text", InstalledVersion: "v0.13.0", Severity: "LOW"},
+		},
+	}, {
+		Target: ".env", Class: "secret",
+		Secrets: []report.Secret{{RuleID: "aws-access-key-id", Category: "AWS", Severity: "CRITICAL", StartLine: 1, EndLine: 1}},
+	}, {
+		Target: "package-lock.json", Class: "license",
+		Licenses: []report.License{{PkgName: "readline", Name: "GPL-3.0", Severity: "HIGH"}},
+	}}
+
+	tests := []struct {
+		name         string
+		gateSeverity string
+		vex          []report.VEXStatement
+		want         int
+	}{
+		{name: "every kind", gateSeverity: "HIGH", want: 4},
+		{name: "critical only", gateSeverity: "CRITICAL", want: 2},
+		{name: "everything", gateSeverity: "UNKNOWN", want: 5},
+		{
+			name: "not affected", gateSeverity: "CRITICAL", want: 1,
+			vex: []report.VEXStatement{{Vulnerability: "CVE-2024-0001", Status: "not_affected", Justification: "vulnerable_code_not_in_execute_path"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultSettings
+			cfg.gateSeverity = tt.gateSeverity
+			cfg.vexStatements = tt.vex
+			cfg.vexAction = report.VEXSuppress
+
+			if got := gateFailures(singleTarget(results, cfg)[0]); got != tt.want {
+				t.Errorf("got %d failures, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGateFailingIssuesOfTargets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	high := `{"SchemaVersion": 2, "Results": [{"Target": "main.tf", "Class": "config", "Type": "terraform",
+		"Misconfigurations": [{"ID": "AVD-AWS-0086", "Severity": "HIGH", "CauseMetadata": {"StartLine": 3, "EndLine": 5}}]}]}`
+	writeFile("high.json", high)
+	targets := writeFile("targets.yaml", `targets:
+  - name: network
+    report: `+filepath.Join(dir, "high.json")+`
+  - name: storage
+    report: `+filepath.Join(dir, "high.json")+`
+    gate:
+      severity: CRITICAL
+  - name: legacy
+    report: `+filepath.Join(dir, "high.json")+`
+    gate:
+      soft_fail: true
+`)
+	saved := logger
+	logger = newLogger(logFormatText, io.Discard)
+	t.Cleanup(func() { logger = saved })
+
+	cfg := defaultSettings
+	cfg.gateSeverity = "HIGH"
+	failing, failingTargets := gateFailingIssues(loadTargets(targets, cfg))
+
+	if failing != 1 || strings.Join(failingTargets, ",") != "network" {
+		t.Errorf("got %d failures of %v, want the one of network", failing, failingTargets)
+	}
+}
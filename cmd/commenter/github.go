@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/oauth2"
+)
+
+// apiTransport carries the requests of every GitHub client of a run, the commenter library's
+// clients included, so comment batches reuse pooled keep-alive connections instead of
+// opening new ones
+var apiTransport = newAPITransport()
+
+func newAPITransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = true
+	t.MaxIdleConns = 100
+	// the default of 2 per host would close connections as soon as comments go out in parallel
+	t.MaxIdleConnsPerHost = 32
+	t.IdleConnTimeout = 90 * time.Second
+	t.TLSHandshakeTimeout = 10 * time.Second
+	t.ExpectContinueTimeout = time.Second
+	return t
+}
+
+// installAPITransport makes apiTransport the base of http.DefaultClient, which the commenter
+// library builds its clients on, with the requests in flight cancelled on shutdown. It must
+// come before the other transports are layered on top.
+func installAPITransport() {
+	if http.DefaultClient.Transport == nil {
+		http.DefaultClient.Transport = &shutdownTransport{base: apiTransport}
+	}
+}
+
+// newGithubClient creates an API client for the calls the commenter library doesn't cover,
+// honouring GITHUB_API_URL for Enterprise servers in the same way as commenter.NewGitHub
+func newGithubClient(token string) (*github.Client, error) {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	tc := oauth2.NewClient(context.Background(), ts)
+
+	githubAPIURL := os.Getenv("GITHUB_API_URL")
+	if githubAPIURL == "" || githubAPIURL == "https://api.github.com" {
+		return github.NewClient(tc), nil
+	}
+
+	u, err := url.Parse(githubAPIURL)
+	if err != nil {
+		return nil, err
+	}
+	enterpriseURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	return github.NewEnterpriseClient(enterpriseURL, enterpriseURL, tc)
+}
+
+// actionsBotLogin is the author of what the Actions token writes
+const actionsBotLogin = "github-actions[bot]"
+
+var (
+	tokenLoginOnce sync.Once
+	tokenLoginName string
+)
+
+// tokenLogin is the login of the user the token belongs to, which the commenter's own comments
+// are told from the others' by. An Actions token can't read its user, its comments are then
+// taken to be github-actions[bot]'s.
+func tokenLogin(ctx context.Context, client *github.Client) string {
+	tokenLoginOnce.Do(func() {
+		user, _, err := client.Users.Get(ctx, "")
+		if err != nil {
+			logger.Info(fmt.Sprintf("The token's user can't be read, taking its comments to be %s's (%s)", actionsBotLogin, err.Error()))
+			tokenLoginName = actionsBotLogin
+			return
+		}
+		tokenLoginName = user.GetLogin()
+	})
+	return tokenLoginName
+}
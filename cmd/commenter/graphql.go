@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// mutations sent per GraphQL request, well below GitHub's limit on the cost of one query
+const graphQLBatchSize = 25
+
+// graphQLMutation is one operation on a review thread or comment
+type graphQLMutation struct {
+	// name of the mutation, e.g. resolveReviewThread, its input type is derived from it
+	name  string
+	input map[string]any
+}
+
+func resolveThreadMutation(threadID string) graphQLMutation {
+	return graphQLMutation{name: "resolveReviewThread", input: map[string]any{"threadId": threadID}}
+}
+
+func pinIssueMutation(issueID string) graphQLMutation {
+	return graphQLMutation{name: "pinIssue", input: map[string]any{"issueId": issueID}}
+}
+
+type graphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Path    []any  `json:"path"`
+	} `json:"errors"`
+}
+
+// runQuery sends a GraphQL query, decoding the data it answers with into out
+func runQuery(client *github.Client, query string, variables map[string]any, out any) error {
+	req, err := client.NewRequest("POST", graphQLEndpoint(), map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		graphQLResponse
+		Data json.RawMessage `json:"data"`
+	}
+	if _, err := client.Do(shutdown, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("GraphQL query: %s", resp.Errors[0].Message)
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// runMutations sends the mutations as aliased operations of a few requests, rather than one
+// request per thread, returning an error per mutation that failed
+func runMutations(client *github.Client, mutations []graphQLMutation) []error {
+	endpoint := graphQLEndpoint()
+	var errs []error
+	for start := 0; start < len(mutations); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(mutations) {
+			end = len(mutations)
+		}
+		errs = append(errs, runMutationBatch(client, endpoint, mutations[start:end])...)
+	}
+	return errs
+}
+
+func runMutationBatch(client *github.Client, endpoint string, batch []graphQLMutation) []error {
+	var params, operations []string
+	variables := make(map[string]any, len(batch))
+	for i, m := range batch {
+		params = append(params, fmt.Sprintf("$i%d: %s%sInput!", i, strings.ToUpper(m.name[:1]), m.name[1:]))
+		operations = append(operations, fmt.Sprintf("m%d: %s(input: $i%d) { clientMutationId }", i, m.name, i))
+		variables[fmt.Sprintf("i%d", i)] = m.input
+	}
+	query := fmt.Sprintf("mutation(%s) { %s }", strings.Join(params, ", "), strings.Join(operations, " "))
+
+	req, err := client.NewRequest("POST", endpoint, map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return []error{err}
+	}
+	var resp graphQLResponse
+	if _, err := client.Do(shutdown, req, &resp); err != nil {
+		return []error{fmt.Errorf("GraphQL batch of %d mutations failed: %w", len(batch), err)}
+	}
+
+	var errs []error
+	for _, e := range resp.Errors {
+		operation := "batch"
+		if len(e.Path) > 0 {
+			var i int
+			if _, err := fmt.Sscanf(fmt.Sprint(e.Path[0]), "m%d", &i); err == nil && i < len(batch) {
+				operation = fmt.Sprintf("%s %v", batch[i].name, batch[i].input)
+			}
+		}
+		errs = append(errs, fmt.Errorf("GraphQL %s: %s", operation, e.Message))
+	}
+	return errs
+}
+
+// graphQLEndpoint is /graphql on github.com and /api/graphql on Enterprise servers
+func graphQLEndpoint() string {
+	githubAPIURL := os.Getenv("GITHUB_API_URL")
+	if githubAPIURL == "" || githubAPIURL == "https://api.github.com" {
+		return "https://api.github.com/graphql"
+	}
+	u, err := url.Parse(githubAPIURL)
+	if err != nil {
+		return "https://api.github.com/graphql"
+	}
+	return fmt.Sprintf("%s://%s/api/graphql", u.Scheme, u.Host)
+}
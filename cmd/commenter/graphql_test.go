@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+type graphQLRequest struct {
+	Query     string                       `json:"query"`
+	Variables map[string]map[string]string `json:"variables"`
+}
+
+// newGraphQLServer records the GraphQL requests, answering each with the errors of respond
+func newGraphQLServer(t *testing.T, respond func(graphQLRequest) []map[string]any) (*github.Client, func() []graphQLRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []graphQLRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/graphql" {
+			http.NotFound(w, r)
+			return
+		}
+		var request graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, request)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{}, "errors": respond(request)})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("GITHUB_API_URL", server.URL)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, func() []graphQLRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestRunMutationsBatchesAliasedOperations(t *testing.T) {
+	client, requests := newGraphQLServer(t, func(graphQLRequest) []map[string]any { return nil })
+	var mutations []graphQLMutation
+	for i := 0; i < graphQLBatchSize+2; i++ {
+		mutations = append(mutations, resolveThreadMutation(fmt.Sprintf("T%d", i)))
+	}
+
+	if errs := runMutations(client, mutations); len(errs) != 0 {
+		t.Fatalf("runMutations: %v", errs)
+	}
+
+	sent := requests()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	if n := strings.Count(sent[0].Query, "resolveReviewThread(input:"); n != graphQLBatchSize {
+		t.Errorf("the first request has %d mutations, want %d", n, graphQLBatchSize)
+	}
+	want := "mutation($i0: ResolveReviewThreadInput!, $i1: ResolveReviewThreadInput!) { " +
+		"m0: resolveReviewThread(input: $i0) { clientMutationId } m1: resolveReviewThread(input: $i1) { clientMutationId } }"
+	if sent[1].Query != want {
+		t.Errorf("sent the query\n%s\nwant\n%s", sent[1].Query, want)
+	}
+	for alias, threadID := range map[string]string{"i0": "T25", "i1": "T26"} {
+		if got := sent[1].Variables[alias]["threadId"]; got != threadID {
+			t.Errorf("the variable %s resolves %q, want %q", alias, got, threadID)
+		}
+	}
+}
+
+func TestRunMutationsReportsTheFailingOperation(t *testing.T) {
+	client, _ := newGraphQLServer(t, func(graphQLRequest) []map[string]any {
+		return []map[string]any{{"message": "Could not resolve to a node", "path": []string{"m1"}}}
+	})
+	mutations := []graphQLMutation{resolveThreadMutation("T0"), resolveThreadMutation("T1")}
+
+	errs := runMutations(client, mutations)
+	if len(errs) != 1 {
+		t.Fatalf("got the errors %v, want one", errs)
+	}
+	if got := errs[0].Error(); !strings.Contains(got, "resolveReviewThread map[threadId:T1]") || !strings.Contains(got, "Could not resolve to a node") {
+		t.Errorf("got the error %q, want it to name the second mutation", got)
+	}
+}
+
+func TestResolveStaleThreadsInOneBatch(t *testing.T) {
+	gh, client := newFakeClient(t)
+	for line := 1; line <= 5; line++ {
+		gh.AddComment(1, "github-actions[bot]", "main.tf", line, "a comment")
+	}
+
+	if errs := resolveStaleThreads(client, "org", "repo", 1, func(string, string) bool { return true }); len(errs) != 0 {
+		t.Fatalf("resolveStaleThreads: %v", errs)
+	}
+
+	// the threads are listed by one query and resolved by one mutation
+	if n := gh.Requests("POST /api/graphql"); n != 2 {
+		t.Errorf("sent %d GraphQL requests, want 2", n)
+	}
+	for _, c := range gh.Comments() {
+		if !gh.Resolved(c.GetID()) {
+			t.Errorf("the thread of comment %d isn't resolved", c.GetID())
+		}
+	}
+}
+
+func TestGraphQLEndpoint(t *testing.T) {
+	for apiURL, want := range map[string]string{
+		"":                                  "https://api.github.com/graphql",
+		"https://api.github.com":            "https://api.github.com/graphql",
+		"https://github.example.com/api/v3": "https://github.example.com/api/graphql",
+	} {
+		t.Setenv("GITHUB_API_URL", apiURL)
+		if got := graphQLEndpoint(); got != want {
+			t.Errorf("graphQLEndpoint() of %q = %q, want %q", apiURL, got, want)
+		}
+	}
+}
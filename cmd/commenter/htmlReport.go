@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// writeHTMLReport renders the findings of every target at its minimum severity as a standalone
+// HTML page at INPUT_HTML_REPORT, setting the html_report output to its path for a later step
+// to upload as an artifact. A failure is logged, it doesn't change the run's result.
+func writeHTMLReport(targets []reportTarget, cfg settings) {
+	if cfg.htmlReport == "" {
+		return
+	}
+	var findings []report.Finding
+	for _, a := range annotationFindings(targets) {
+		f := a.finding
+		f.Target = a.path
+		findings = append(findings, f)
+	}
+	title := "trivy results"
+	if repository := os.Getenv("GITHUB_REPOSITORY"); repository != "" {
+		title += " for " + repository
+	}
+	page, err := commenter.HTMLReport(title, findings)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to render the HTML report. %s", err.Error()))
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.htmlReport), 0o755); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the HTML report. %s", err.Error()))
+		return
+	}
+	if err := os.WriteFile(cfg.htmlReport, []byte(page), 0o644); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the HTML report. %s", err.Error()))
+		return
+	}
+	logger.Info(fmt.Sprintf("HTML report of %d findings written to %s", len(findings), cfg.htmlReport), "html_report", cfg.htmlReport)
+	if output := os.Getenv("GITHUB_OUTPUT"); output != "" {
+		if err := appendToFile(output, fmt.Sprintf("html_report=%s\n", cfg.htmlReport)); err != nil {
+			logger.Error(fmt.Sprintf("failed to write the step outputs. %s", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+const defaultWorkflowFile = ".github/workflows/trivy-pr-commenter.yml"
+
+var workflowTemplate = template.Must(template.New("workflow").Parse(`name: trivy
+
+on:
+  pull_request:
+
+# the commenter only needs to read the code and write review comments
+permissions:
+  contents: read
+  pull-requests: write
+
+jobs:
+  trivy:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+
+      - name: Run Trivy
+        uses: aquasecurity/trivy-action@0.28.0
+        with:
+          scan-type: config
+          scan-ref: {{ .WorkingDirectory }}
+          format: json
+          output: {{ .ReportFile }}
+          exit-code: '0'
+
+      - name: Comment on the PR
+        uses: XiaxueTech/trivy-terraform-pr-commenter@main
+        with:
+          github_token: ${{ "{{" }} secrets.GITHUB_TOKEN {{ "}}" }}
+          report_file: {{ .ReportFile }}
+          working_directory: {{ .WorkingDirectory }}
+          soft_fail_commenter: {{ .SoftFail }}
+`))
+
+type workflowOptions struct {
+	WorkingDirectory string
+	ReportFile       string
+	SoftFail         bool
+}
+
+// runInit scaffolds a GitHub Actions workflow running the scan and the commenter
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	output := flags.String("output", defaultWorkflowFile, "path of the workflow file to generate, - for stdout")
+	workingDir := flags.String("working-directory", ".", "directory to scan, from the repo root")
+	reportFile := flags.String("report-file", "trivy.json", "name of the report file handed from the scan to the commenter")
+	softFail := flags.Bool("soft-fail", false, "comment without failing the build")
+	force := flags.Bool("force", false, "overwrite an existing workflow file")
+	_ = flags.Parse(args)
+
+	opts := workflowOptions{
+		WorkingDirectory: *workingDir,
+		ReportFile:       *reportFile,
+		SoftFail:         *softFail,
+	}
+
+	if *output == "-" {
+		if err := workflowTemplate.Execute(os.Stdout, opts); err != nil {
+			fail(err.Error())
+		}
+		return
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		fail(fmt.Sprintf("%s already exists, use --force to overwrite it", *output))
+	}
+	if err := os.MkdirAll(filepath.Dir(*output), 0o755); err != nil {
+		fail(fmt.Sprintf("failed to create %s. %s", filepath.Dir(*output), err.Error()))
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		fail(fmt.Sprintf("failed to create %s. %s", *output, err.Error()))
+	}
+	if err := workflowTemplate.Execute(f, opts); err != nil {
+		f.Close()
+		fail(err.Error())
+	}
+	if err := f.Close(); err != nil {
+		fail(err.Error())
+	}
+	logger.Info(fmt.Sprintf("Workflow written to %s", *output), "output", *output)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// licensePolicyFile sorts licenses into the categories of a report.LicensePolicy, e.g.
+//
+//	allowed: [MIT, Apache-2.0, BSD-*, ISC]
+//	notice: [MPL-2.0]
+//	restricted: [LGPL-*]
+//	forbidden: [AGPL-*, GPL-*]
+type licensePolicyFile struct {
+	Allowed    []string `yaml:"allowed"`
+	Notice     []string `yaml:"notice"`
+	Restricted []string `yaml:"restricted"`
+	Forbidden  []string `yaml:"forbidden"`
+}
+
+func loadLicensePolicy(path string) (*report.LicensePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file licensePolicyFile
+	if err := yaml.Unmarshal([]byte(commenter.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	policy := report.LicensePolicy(file)
+	if len(policy.Allowed)+len(policy.Notice)+len(policy.Restricted)+len(policy.Forbidden) == 0 {
+		return nil, fmt.Errorf("%s lists no licenses", path)
+	}
+	return &policy, nil
+}
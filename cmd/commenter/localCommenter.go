@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+// localCommenter renders comments as markdown instead of posting them to GitHub
+type localCommenter struct {
+	w        io.Writer
+	comments []localComment
+}
+
+type localComment struct {
+	file      string
+	startLine int
+	endLine   int
+}
+
+func newLocalCommenter(w io.Writer) *localCommenter {
+	return &localCommenter{w: w}
+}
+
+func (c *localCommenter) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	if _, err := fmt.Fprintf(c.w, "### %s\n\n%s\n\n---\n\n", formatLocation(file, startLine, endLine), comment); err != nil {
+		return err
+	}
+	c.comments = append(c.comments, localComment{file: file, startLine: startLine, endLine: endLine})
+	return nil
+}
+
+func (c *localCommenter) writeSummary() error {
+	var sb strings.Builder
+	sb.WriteString("## Summary\n\n")
+	fmt.Fprintf(&sb, "trivy found %s\n\n", commenter.IssueCount(len(c.comments)))
+	if len(c.comments) > 0 {
+		sb.WriteString("| Location |\n|---|\n")
+		for _, comment := range c.comments {
+			fmt.Fprintf(&sb, "| `%s` |\n", formatLocation(comment.file, comment.startLine, comment.endLine))
+		}
+	}
+	_, err := io.WriteString(c.w, sb.String())
+	return err
+}
+
+func formatLocation(file string, startLine, endLine int) string {
+	if startLine == endLine {
+		return fmt.Sprintf("%s:%d", file, startLine)
+	}
+	return fmt.Sprintf("%s:%d-%d", file, startLine, endLine)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// log event names, emitted as the "event" attribute so aggregators can index runs
+const (
+	eventFindingProcessed = "finding_processed"
+	eventCommentPosted    = "comment_posted"
+	eventError            = "error"
+	eventGateDecision     = "gate_decision"
+	eventRunSummary       = "run_summary"
+)
+
+var logger = newLogger(logFormatText, os.Stdout)
+
+// quietLogging limits the output to errors and the final run summary
+var quietLogging bool
+
+func newLogger(format string, w io.Writer) *slog.Logger {
+	var handler slog.Handler = &plainHandler{w: w}
+	if format == logFormatJSON {
+		handler = slog.NewJSONHandler(w, nil)
+	}
+	if quietLogging {
+		handler = &quietHandler{next: handler}
+	}
+	return slog.New(&redactingHandler{next: handler})
+}
+
+func parseLogFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", logFormatText:
+		return logFormatText, nil
+	case logFormatJSON:
+		return logFormatJSON, nil
+	}
+	return "", fmt.Errorf("unsupported log format %q, expected %s or %s", format, logFormatText, logFormatJSON)
+}
+
+// plainHandler writes only the message, keeping the human readable output
+// identical to the original fmt based logging
+type plainHandler struct {
+	w io.Writer
+}
+
+func (h *plainHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := r.Message
+	if r.Level >= slog.LevelError {
+		msg = "Error: " + msg
+	} else if r.Level >= slog.LevelWarn {
+		msg = "Warning: " + msg
+	}
+	_, err := fmt.Fprintln(h.w, msg)
+	return err
+}
+
+func (h *plainHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *plainHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// quietHandler drops everything except errors and the run summary
+type quietHandler struct {
+	next slog.Handler
+}
+
+func (h *quietHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *quietHandler) Handle(ctx context.Context, r slog.Record) error {
+	keep := r.Level >= slog.LevelError
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "event" && (a.Value.String() == eventError || a.Value.String() == eventRunSummary) {
+			keep = true
+			return false
+		}
+		return true
+	})
+	if !keep {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *quietHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &quietHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *quietHandler) WithGroup(name string) slog.Handler {
+	return &quietHandler{next: h.next.WithGroup(name)}
+}
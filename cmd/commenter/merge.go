@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// runMerge comments once on the reports of several jobs, e.g. the artifacts of a matrix build
+// downloaded into one directory, instead of each shard commenting on its own and repeating the
+// findings they share. The reports are merged per target with the repeated findings dropped.
+// With --merged the merged report is written there instead, for a later comment step.
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	local := flags.Bool("local", false, "render comments locally instead of posting them to GitHub")
+	output := flags.String("output", "", "file to write the rendered markdown to in local mode, defaults to stdout")
+	merged := flags.String("merged", "", "write the merged report to this file instead of commenting")
+	strict := flags.Bool("strict-schema", strings.ToLower(os.Getenv("INPUT_STRICT_SCHEMA")) == "true", "fail when a report doesn't match the expected schema")
+	formatName := flags.String("format", reportFormat, reportFormatUsage)
+	_ = flags.Parse(args)
+	strictSchema = *strict
+	reportFormat = *formatName
+
+	logOutput := os.Stdout
+	if *local && *output == "" || *merged == "-" {
+		logOutput = os.Stderr
+	}
+	setupLogger(*logFormat, logOutput)
+	if flags.NArg() == 0 {
+		fail("merge needs the reports to merge, e.g. commenter merge reports/*.json")
+	}
+
+	load := func() []report.Result {
+		paths, err := reportPaths(reportFileArg(flags))
+		if err != nil {
+			fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+		}
+		var results []report.Result
+		for _, path := range paths {
+			loaded, err := loadReport(path)
+			if err != nil {
+				fail(fmt.Sprintf("failed to load results. %s: %s", path, err.Error()))
+			}
+			results = append(results, loaded...)
+		}
+		results, dropped := report.MergeResults(results)
+		logger.Info(fmt.Sprintf("Merged %d reports into %d results, dropping %d repeated findings", len(paths), len(results), dropped),
+			"reports", len(paths), "results", len(results), "dropped", dropped)
+		return results
+	}
+
+	if *merged != "" {
+		writeMergedReport(*merged, load())
+		return
+	}
+	commentOnResults(func(cfg settings) []reportTarget { return singleTarget(checkResults(load(), nil), cfg) }, *local, *output)
+}
+
+// writeMergedReport writes the results as a Trivy JSON report, to stdout for -
+func writeMergedReport(path string, results []report.Result) {
+	data, err := json.MarshalIndent(map[string]any{"SchemaVersion": report.SupportedSchemaVersion, "Results": results}, "", "  ")
+	if err != nil {
+		fail(fmt.Sprintf("failed to encode the merged report. %s", err.Error()))
+	}
+	if path == "-" {
+		fmt.Println(string(data))
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		fail(fmt.Sprintf("failed to write the merged report. %s", err.Error()))
+	}
+	logger.Info(fmt.Sprintf("Merged report written to %s", path), "output", path)
+}
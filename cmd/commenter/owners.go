@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// codeownersFiles are where GitHub looks for the CODEOWNERS file, in its order
+var codeownersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownerSections splits the findings of the targets at their minimum severity by owner for
+// the summary, when INPUT_OWNER_SECTIONS is set. The owners of a target of the targets file
+// own all of its findings, the CODEOWNERS file of the repo decides for the other targets.
+func ownerSections(targets []reportTarget) string {
+	if len(targets) == 0 || !targets[0].cfg.ownerSections {
+		return ""
+	}
+	codeowners := loadCodeowners()
+	owned := make(map[string][]report.Finding)
+	for _, t := range targets {
+		anchor := workspaceAnchor(t.cfg)
+		for _, f := range report.FilterBySeverity(t.unique, t.cfg.minSeverity) {
+			f.Target = anchor(f.Target)
+			owners := t.owners
+			if len(owners) == 0 {
+				owners = codeowners.Owners(f.Target)
+			}
+			if len(owners) == 0 {
+				owned[""] = append(owned[""], f)
+			}
+			for _, owner := range owners {
+				owned[owner] = append(owned[owner], f)
+			}
+		}
+	}
+	return commenter.OwnerSections(owned)
+}
+
+func loadCodeowners() report.Codeowners {
+	for _, name := range codeownersFiles {
+		if content, err := os.ReadFile(filepath.Join(os.Getenv("GITHUB_WORKSPACE"), name)); err == nil {
+			return report.ParseCodeowners(content)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/google/go-github/v32/github"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// permalinkCommit is the head of the PR commented on, once it has been read
+var permalinkCommit string
+
+// permalinkBase is the blob URL of the commit scanned, the PR's head rather than the merge
+// commit GITHUB_SHA is for a PR, empty when the repository or commit isn't known
+func permalinkBase() string {
+	repository, sha := os.Getenv("GITHUB_REPOSITORY"), permalinkCommit
+	if sha == "" {
+		sha = eventHeadSHA()
+	}
+	if sha == "" {
+		sha = os.Getenv("GITHUB_SHA")
+	}
+	if repository == "" || sha == "" {
+		return ""
+	}
+	server := os.Getenv("GITHUB_SERVER_URL")
+	if server == "" {
+		server = "https://github.com"
+	}
+	return fmt.Sprintf("%s/%s/blob/%s", strings.TrimSuffix(server, "/"), repository, sha)
+}
+
+// eventHeadSHA is the head commit of the PR of the event payload, empty for other events
+func eventHeadSHA() string {
+	githubEventFile := os.Getenv("GITHUB_EVENT_PATH")
+	if githubEventFile == "" {
+		githubEventFile = dockerGithubEventFile
+	}
+	file, err := os.ReadFile(githubEventFile)
+	if err != nil {
+		return ""
+	}
+	var event struct {
+		PullRequest struct {
+			Head struct {
+				SHA string `json:"sha"`
+			} `json:"head"`
+		} `json:"pull_request"`
+	}
+	_ = json.Unmarshal(file, &event)
+	return event.PullRequest.Head.SHA
+}
+
+// permalinkedProvider skips the comments an earlier run already wrote but for the permalink,
+// which points at that run's commit, and those on a finding whose fingerprint is already on
+// the PR, as when lines were added above it. Without it every push would repeat every comment.
+// Only the fingerprints the token's user wrote with the comment's scope count, another job or
+// user commenting on the same finding doesn't silence this one. As for the stale comments, one
+// written before comments had scopes counts for every scope.
+type permalinkedProvider struct {
+	commenter.Provider
+	client  *github.Client
+	owner   string
+	repo    string
+	prNo    int
+	once    sync.Once
+	written map[string]bool
+	// fingerprints are those of the token's user's comments, by fingerprint and scope
+	fingerprints map[string]bool
+}
+
+func skipPermalinkedComments(p commenter.Provider, client *github.Client, owner, repo string, prNo int) commenter.Provider {
+	return &permalinkedProvider{Provider: p, client: client, owner: owner, repo: repo, prNo: prNo}
+}
+
+func (p *permalinkedProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	p.once.Do(p.list)
+	if p.written[file+"\x00"+commenter.StripPermalink(comment)] {
+		return prcommenter.CommentAlreadyWrittenError{}
+	}
+	if fp := commenter.WrittenFingerprint(comment); fp != "" &&
+		(p.fingerprints[fp+"\x00"+commenter.WrittenScope(comment)] || p.fingerprints[fp+"\x00"]) {
+		return prcommenter.CommentAlreadyWrittenError{}
+	}
+	return p.Provider.WriteMultiLineComment(file, comment, startLine, endLine)
+}
+
+// list reads the comments on the PR once. When they can't be listed nothing is skipped, the
+// provider still skips the comments written exactly as they are.
+func (p *permalinkedProvider) list() {
+	p.written = make(map[string]bool)
+	p.fingerprints = make(map[string]bool)
+	login := tokenLogin(shutdown, p.client)
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := p.client.PullRequests.ListComments(shutdown, p.owner, p.repo, p.prNo, opts)
+		if err != nil {
+			logger.Info(fmt.Sprintf("Not matching the comments of earlier commits, they can't be listed (%s)", err.Error()))
+			return
+		}
+		for _, c := range comments {
+			p.written[c.GetPath()+"\x00"+commenter.StripPermalink(c.GetBody())] = true
+			if fp := commenter.WrittenFingerprint(c.GetBody()); fp != "" && sameLogin(c.GetUser().GetLogin(), login) {
+				p.fingerprints[fp+"\x00"+commenter.WrittenScope(c.GetBody())] = true
+			}
+		}
+		if resp.NextPage == 0 {
+			return
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// recordingProvider records the bodies of the comments written through it
+type recordingProvider struct {
+	written []string
+}
+
+func (p *recordingProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	p.written = append(p.written, comment)
+	return nil
+}
+
+func (p *recordingProvider) WriteLineComment(file, comment string, line int) error {
+	return p.WriteMultiLineComment(file, comment, line, line)
+}
+
+// fingerprinted is a comment on the finding as the commenter ends it
+func fingerprinted(body string, f report.Finding) string {
+	return body + "\n\n<!-- trivy-fingerprint " + commenter.StableFingerprint(f) + " -->"
+}
+
+func TestSkipPermalinkedComments(t *testing.T) {
+	gh, client := newFakeClient(t)
+	moved := report.Finding{ID: "AVD-AWS-0086", Target: "main.tf", StartLine: 3, EndLine: 5, Severity: "HIGH", LineHash: "abc"}
+	earlier := fingerprinted("HIGH AVD-AWS-0086 on lines 3-5", moved)
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 5, earlier+"\n\n[permalink](https://github.com/org/repo/blob/old/main.tf#L3-L5)")
+
+	inner := &recordingProvider{}
+	p := skipPermalinkedComments(inner, client, "org", "repo", 1)
+
+	// the same finding after lines were added above it
+	moved.StartLine, moved.EndLine = 13, 15
+	if err := p.WriteMultiLineComment("main.tf", fingerprinted("HIGH AVD-AWS-0086 on lines 13-15", moved), 13, 15); err != (prcommenter.CommentAlreadyWrittenError{}) {
+		t.Errorf("got %v for a finding already commented on, want it already written", err)
+	}
+	if err := p.WriteMultiLineComment("main.tf", earlier+"\n\n[permalink](https://github.com/org/repo/blob/new/main.tf#L3-L5)", 3, 5); err != (prcommenter.CommentAlreadyWrittenError{}) {
+		t.Errorf("got %v for a comment differing in its permalink, want it already written", err)
+	}
+
+	other := report.Finding{ID: "AVD-AWS-0087", Target: "main.tf", StartLine: 3, EndLine: 5, Severity: "HIGH", LineHash: "abc"}
+	if err := p.WriteMultiLineComment("main.tf", fingerprinted("HIGH AVD-AWS-0087 on lines 3-5", other), 3, 5); err != nil {
+		t.Errorf("got %v for a new finding, want it written", err)
+	}
+	if len(inner.written) != 1 || gh.Requests("GET /repos/org/repo/pulls/1/comments") != 1 {
+		t.Errorf("wrote %d comments listing the PR's %d times, want 1 and once", len(inner.written), gh.Requests("GET /repos/org/repo/pulls/1/comments"))
+	}
+}
+
+func TestSkipPermalinkedCommentsOfTheScope(t *testing.T) {
+	scoped := func(f report.Finding, scope string) string {
+		return "HIGH " + f.ID + "\n\n<!-- trivy-fingerprint " + commenter.StableFingerprint(f) + " scope=" + scope + " -->"
+	}
+	finding := func(id string) report.Finding {
+		return report.Finding{ID: id, Target: "main.tf", StartLine: 3, EndLine: 5, Severity: "HIGH", LineHash: "abc"}
+	}
+	gh, client := newFakeClient(t)
+	gh.AddComment(1, "reviewer", "main.tf", 5, scoped(finding("AVD-AWS-0086"), "ci%2Fscan")+"\n\nquoted")
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 5, scoped(finding("AVD-AWS-0087"), "ci%2Fother")+"\n\nother job")
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 5, scoped(finding("AVD-AWS-0088"), "ci%2Fscan")+"\n\nthis job")
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 5, fingerprinted("before scopes", finding("AVD-AWS-0089")))
+
+	inner := &recordingProvider{}
+	p := skipPermalinkedComments(inner, client, "org", "repo", 1)
+	tests := []struct {
+		id   string
+		want error
+	}{
+		{id: "AVD-AWS-0086"},
+		{id: "AVD-AWS-0087"},
+		{id: "AVD-AWS-0088", want: prcommenter.CommentAlreadyWrittenError{}},
+		{id: "AVD-AWS-0089", want: prcommenter.CommentAlreadyWrittenError{}},
+	}
+	for _, tt := range tests {
+		if err := p.WriteMultiLineComment("main.tf", scoped(finding(tt.id), "ci%2Fscan"), 3, 5); err != tt.want {
+			t.Errorf("got %v for %s, want %v", err, tt.id, tt.want)
+		}
+	}
+	if len(inner.written) != 2 {
+		t.Errorf("wrote %d comments, want those on the findings another user or job commented on", len(inner.written))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// githubToken prefers the action input, falling back to the GITHUB_TOKEN set by most runners
+func githubToken() string {
+	if token := os.Getenv("INPUT_GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// preflightCheck fails fast, naming the missing permission, rather than failing every comment
+// later. The PR is returned for the decisions that depend on its size.
+func preflightCheck(client *github.Client, owner, repo string, prNo int) (*github.PullRequest, error) {
+	if err := checkRepositoryAccess(client, owner, repo); err != nil {
+		return nil, err
+	}
+	pr, _, err := client.PullRequests.Get(shutdown, owner, repo, prNo)
+	if err != nil {
+		if status := errorStatus(err); status == http.StatusForbidden || status == http.StatusNotFound {
+			return nil, fmt.Errorf("the token cannot read PR %d, it needs the pull-requests: read permission (%s)", prNo, err.Error())
+		}
+		return nil, fmt.Errorf("failed to read PR %d: %w", prNo, err)
+	}
+	return pr, nil
+}
+
+// checkRepositoryAccess verifies the token can see the repository and that its scopes or
+// permissions, where GitHub reports them, allow PR comments to be written
+func checkRepositoryAccess(client *github.Client, owner, repo string) error {
+	repository, resp, err := client.Repositories.Get(shutdown, owner, repo)
+	if err != nil {
+		switch errorStatus(err) {
+		case http.StatusUnauthorized:
+			return fmt.Errorf("the token is invalid or has expired")
+		case http.StatusForbidden, http.StatusNotFound:
+			return fmt.Errorf("the token cannot access %s/%s, it needs the contents: read permission (%s)", owner, repo, err.Error())
+		}
+		return fmt.Errorf("the token cannot access %s/%s: %w", owner, repo, err)
+	}
+
+	// classic tokens report their scopes
+	if scopes := resp.Header.Get("X-OAuth-Scopes"); scopes != "" {
+		for _, scope := range strings.Split(scopes, ",") {
+			switch strings.TrimSpace(scope) {
+			case "repo", "public_repo":
+				return nil
+			}
+		}
+		return fmt.Errorf("the token scopes (%s) don't include repo or public_repo, which are needed to comment on PRs", scopes)
+	}
+
+	// user tokens report their permissions on the repository, Actions tokens report nothing
+	if permissions := repository.GetPermissions(); len(permissions) > 0 && !permissions["pull"] {
+		return fmt.Errorf("the token has no read access to %s/%s, which is needed to comment on PRs", owner, repo)
+	}
+	return nil
+}
+
+func errorStatus(err error) int {
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return errResp.Response.StatusCode
+	}
+	return 0
+}
+
+// isCommentPermissionError spots the 403 returned when writing a comment without permission.
+// The commenter library flattens errors into strings, so the message is matched.
+func isCommentPermissionError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, " 403 ") || strings.Contains(msg, "Resource not accessible by integration")
+}
+
+const commentPermissionMessage = "the token is not allowed to write PR comments, grant the workflow the pull-requests: write permission"
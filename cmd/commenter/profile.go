@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// exitHooks run before the process exits, whether a command returns or calls exit
+var exitHooks []func()
+
+// exit runs the exit hooks, such as flushing the profiles, before exiting with the code
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+func runExitHooks() {
+	hooks := exitHooks
+	exitHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+// startProfiling writes a CPU profile to <prefix>.cpu.pprof for the whole run and a heap
+// profile to <prefix>.heap.pprof at exit, for investigating pathologically slow runs
+func startProfiling(prefix string) {
+	cpu, err := os.Create(prefix + ".cpu.pprof")
+	if err != nil {
+		fail(fmt.Sprintf("failed to create the CPU profile. %s", err.Error()))
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		fail(fmt.Sprintf("failed to start the CPU profile. %s", err.Error()))
+	}
+
+	exitHooks = append(exitHooks, func() {
+		pprof.StopCPUProfile()
+		cpu.Close()
+
+		heap, err := os.Create(prefix + ".heap.pprof")
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to create the heap profile. %s", err.Error()))
+			return
+		}
+		defer heap.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(heap); err != nil {
+			logger.Error(fmt.Sprintf("failed to write the heap profile. %s", err.Error()))
+			return
+		}
+		logger.Info(fmt.Sprintf("Profiles written to %s.cpu.pprof and %s.heap.pprof", prefix, prefix))
+	})
+}
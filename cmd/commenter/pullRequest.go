@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// resolvePullRequestNumber works out which PR to comment on. An explicit INPUT_PR_NUMBER wins,
+// then the event payload, and finally the open PR associated with the current commit, which
+// covers workflow_dispatch, scheduled and local runs.
+func resolvePullRequestNumber(client *github.Client, owner, repo string) (int, error) {
+	if input := os.Getenv("INPUT_PR_NUMBER"); input != "" {
+		prNo, err := strconv.Atoi(strings.TrimSpace(input))
+		if err != nil || prNo <= 0 {
+			return 0, fmt.Errorf("INPUT_PR_NUMBER is not a valid PR number: %q", input)
+		}
+		logger.Info(fmt.Sprintf("Using PR %d from INPUT_PR_NUMBER", prNo), "pr", prNo)
+		return prNo, nil
+	}
+
+	prNo, err := extractPullRequestNumber()
+	if err == nil {
+		return prNo, nil
+	}
+	logger.Info(fmt.Sprintf("Could not read the PR number from the event payload (%s), looking it up via the API", err.Error()))
+
+	sha := currentCommitSha()
+	if sha == "" {
+		return 0, errors.New("the current commit could not be determined")
+	}
+	return findPullRequestForCommit(client, owner, repo, sha)
+}
+
+func findPullRequestForCommit(client *github.Client, owner, repo, sha string) (int, error) {
+	opts := &github.PullRequestListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := client.PullRequests.ListPullRequestsWithCommit(shutdown, owner, repo, sha, opts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list PRs for commit %s: %w", sha, err)
+		}
+		for _, pr := range prs {
+			if pr.GetState() == "open" {
+				return pr.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, fmt.Errorf("no open PR found for commit %s", sha)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func currentCommitSha() string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// newCommitPullsServer lists the PRs of the commit a page at a time, each page a PR with its state
+func newCommitPullsServer(t *testing.T, states ...string) (*github.Client, *int) {
+	t.Helper()
+	listed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/commits/abc123/pulls" {
+			http.NotFound(w, r)
+			return
+		}
+		listed++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < len(states) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%d>; rel="next"`, "http://"+r.Host, r.URL.Path, page+1))
+		}
+		number, state := page, states[page-1]
+		_ = json.NewEncoder(w).Encode([]*github.PullRequest{{Number: &number, State: &state}})
+	}))
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, &listed
+}
+
+func TestFindPullRequestForCommit(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		want   int
+		listed int
+	}{
+		{name: "open on the first page", states: []string{"open", "closed"}, want: 1, listed: 1},
+		{name: "open on a later page", states: []string{"closed", "closed", "open"}, want: 3, listed: 3},
+		{name: "none open", states: []string{"closed", "closed"}, listed: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, listed := newCommitPullsServer(t, tt.states...)
+			prNo, err := findPullRequestForCommit(client, "org", "repo", "abc123")
+			if tt.want == 0 && err == nil {
+				t.Errorf("found PR %d, want none open", prNo)
+			}
+			if tt.want != 0 && (err != nil || prNo != tt.want) {
+				t.Errorf("found PR %d, %v, want %d", prNo, err, tt.want)
+			}
+			if *listed != tt.listed {
+				t.Errorf("listed %d pages, want %d", *listed, tt.listed)
+			}
+		})
+	}
+}
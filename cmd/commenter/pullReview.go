@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+// pullReview batches the comments into a single review of the PR in the review comment mode,
+// nil otherwise
+var pullReview *batchedReview
+
+type batchedReview struct {
+	*commenter.Review
+	// comments are the comments queued for the review, listed in its body
+	comments []commenter.Comment
+}
+
+func (b *batchedReview) add(c commenter.Comment) {
+	b.comments = append(b.comments, c)
+}
+
+// submit writes the review of the queued comments, with their findings grouped by severity as
+// its body. The comments aren't on the PR when it fails, so they no longer count as posted.
+// The comments only have a link once the review is written, the body links to the findings'
+// permalinks until it's edited to link to the comments.
+func (b *batchedReview) submit() []string {
+	queued := b.Len()
+	if queued == 0 {
+		return nil
+	}
+	body := commenter.ReviewBody(b.comments, func(commenter.Comment) string { return "" })
+	ctx, cancel := flushContext()
+	defer cancel()
+	review, err := b.Submit(ctx, body)
+	if err != nil {
+		stats.posted -= queued
+		return []string{fmt.Sprintf("failed to submit the review of %d comments. %s", queued, err.Error())}
+	}
+	// the request creating them isn't one countRequest recognises
+	statsMu.Lock()
+	stats.created += queued
+	statsMu.Unlock()
+	logger.Info(fmt.Sprintf("Submitted the review of %d comments %s", queued, review.GetHTMLURL()), "comments", queued, "review", review.GetID())
+
+	urls, err := b.CommentURLs(ctx, review)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Not linking the comments from the review, %s", err.Error()))
+		return nil
+	}
+	body = commenter.ReviewBody(b.comments, func(c commenter.Comment) string { return urls[c.File+"\x00"+c.Body] })
+	if err := b.EditBody(ctx, review, body); err != nil {
+		logger.Info(fmt.Sprintf("Not linking the comments from the review, %s", err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// below this many remaining requests, the rest are spread over the time until the reset
+	rateLimitLowWater = 100
+	// requests kept in reserve, pausing until the reset once reached
+	rateLimitReserve = 5
+	// the longest pause before giving up and letting the request fail
+	rateLimitMaxWait = 15 * time.Minute
+)
+
+// rateLimitTransport paces GitHub API requests using the X-RateLimit headers of earlier
+// responses, pausing when the limit is nearly exhausted and retrying a request once when it
+// was rejected by a rate limit, rather than collecting a 403 for every remaining comment
+type rateLimitTransport struct {
+	base  http.RoundTripper
+	sleep func(time.Duration)
+
+	// least time between two requests, from INPUT_MAX_QPS
+	interval time.Duration
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	next      time.Time
+}
+
+// installRateLimiter paces every API call, to at most maxQPS requests a second when it isn't
+// zero. The commenter library builds its client on http.DefaultClient, so the limiter is
+// installed there rather than passed in.
+func installRateLimiter(maxQPS float64) {
+	if _, ok := http.DefaultClient.Transport.(*rateLimitTransport); ok {
+		return
+	}
+	base := http.DefaultClient.Transport
+	if base == nil {
+		base = apiTransport
+	}
+	t := &rateLimitTransport{base: base, sleep: sleepUnlessCancelled, remaining: -1}
+	if maxQPS > 0 {
+		t.interval = time.Duration(float64(time.Second) / maxQPS)
+	}
+	http.DefaultClient.Transport = t
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.pace()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.update(resp)
+	countRequest(req, resp)
+
+	wait, limited := rateLimitedFor(resp)
+	if !limited || wait > rateLimitMaxWait || !rewindable(req) {
+		return resp, nil
+	}
+	logger.Info(fmt.Sprintf("Rate limited by GitHub, retrying in %s", wait.Round(time.Second)), "wait_seconds", int(wait.Seconds()))
+	resp.Body.Close()
+	t.sleep(wait)
+	if cancelled() {
+		return nil, context.Canceled
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	statsMu.Lock()
+	stats.retries++
+	statsMu.Unlock()
+	resp, err = t.base.RoundTrip(req)
+	if err == nil {
+		t.update(resp)
+		countRequest(req, resp)
+	}
+	return resp, err
+}
+
+// countRequest records the API call in the run statistics, along with the comment it
+// created, updated or deleted
+func countRequest(req *http.Request, resp *http.Response) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.apiCalls++
+	if resp.StatusCode >= 300 {
+		return
+	}
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/comments"):
+		stats.created++
+	case req.Method == http.MethodPatch && strings.Contains(path, "/comments/"):
+		stats.updated++
+	case req.Method == http.MethodDelete && strings.Contains(path, "/comments/"):
+		stats.deleted++
+	}
+}
+
+// pace waits before a request when the remaining requests are running low, or when the
+// request would come sooner than the configured rate allows
+func (t *rateLimitTransport) pace() {
+	t.mu.Lock()
+	remaining, untilReset := t.remaining, time.Until(t.reset)
+	var slot time.Time
+	if t.interval > 0 {
+		// each request claims the next free slot, so concurrent requests queue up
+		slot = t.next
+		if now := time.Now(); slot.Before(now) {
+			slot = now
+		}
+		t.next = slot.Add(t.interval)
+	}
+	t.mu.Unlock()
+	if wait := time.Until(slot); wait > 0 {
+		t.sleep(wait)
+	}
+
+	if remaining < 0 || remaining >= rateLimitLowWater || untilReset <= 0 {
+		return
+	}
+	var wait time.Duration
+	if remaining <= rateLimitReserve {
+		wait = untilReset
+		logger.Info(fmt.Sprintf("GitHub rate limit nearly exhausted (%d left), pausing %s until it resets", remaining, untilReset.Round(time.Second)),
+			"remaining", remaining, "wait_seconds", int(untilReset.Seconds()))
+	} else {
+		wait = untilReset / time.Duration(remaining)
+	}
+	if wait > rateLimitMaxWait {
+		wait = rateLimitMaxWait
+	}
+	t.sleep(wait)
+}
+
+func (t *rateLimitTransport) update(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remaining = remaining
+	t.reset = time.Unix(reset, 0)
+}
+
+// rateLimitedFor reports whether the response is a primary or secondary rate limit rejection
+// and how long to wait before retrying
+func rateLimitedFor(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		wait := time.Until(time.Unix(reset, 0))
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
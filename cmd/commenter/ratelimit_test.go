@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// rateLimitResponse answers with the status and the rate limit headers, remaining < 0 leaving
+// them out
+func rateLimitResponse(status, remaining int, reset time.Time, retryAfter string) *http.Response {
+	header := make(http.Header)
+	if remaining >= 0 {
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader("{}"))}
+}
+
+func newTestRateLimiter(t *testing.T, responses ...*http.Response) (*rateLimitTransport, *[]time.Duration, *int) {
+	t.Helper()
+	saved, savedStats := logger, stats
+	logger = newLogger(logFormatText, io.Discard)
+	stats = runStats{filtered: make(map[string]int), started: time.Now()}
+	t.Cleanup(func() { logger, stats = saved, savedStats })
+
+	var sleeps []time.Duration
+	sent := 0
+	base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		resp := responses[sent]
+		sent++
+		return resp, nil
+	})
+	return &rateLimitTransport{base: base, sleep: func(d time.Duration) { sleeps = append(sleeps, d) }, remaining: -1}, &sleeps, &sent
+}
+
+func TestRateLimitPacing(t *testing.T) {
+	reset := time.Now().Add(100 * time.Second)
+	tests := []struct {
+		name      string
+		remaining int
+		// the least and most the second request waits, none when both are 0
+		min, max time.Duration
+	}{
+		{name: "plenty left", remaining: rateLimitLowWater},
+		{name: "running low", remaining: 50, min: time.Second, max: 2 * time.Second},
+		{name: "nearly exhausted", remaining: rateLimitReserve, min: 90 * time.Second, max: 100 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, sleeps, _ := newTestRateLimiter(t,
+				rateLimitResponse(http.StatusOK, tt.remaining, reset, ""), rateLimitResponse(http.StatusOK, tt.remaining-1, reset, ""))
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/org/repo/pulls/1/files", nil)
+				if _, err := limiter.RoundTrip(req); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			switch {
+			case tt.max == 0 && len(*sleeps) != 0:
+				t.Errorf("paused %v with %d requests left", *sleeps, tt.remaining)
+			case tt.max > 0 && (len(*sleeps) != 1 || (*sleeps)[0] < tt.min || (*sleeps)[0] > tt.max):
+				t.Errorf("paused %v with %d requests left, want once for %s to %s", *sleeps, tt.remaining, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		rejected *http.Response
+		wantWait time.Duration
+		retried  bool
+	}{
+		{name: "secondary rate limit", rejected: rateLimitResponse(http.StatusForbidden, -1, time.Time{}, "30"), wantWait: 30 * time.Second, retried: true},
+		{name: "primary rate limit", rejected: rateLimitResponse(http.StatusForbidden, 0, time.Now().Add(time.Minute), ""), wantWait: time.Minute, retried: true},
+		{name: "beyond the longest pause", rejected: rateLimitResponse(http.StatusTooManyRequests, -1, time.Time{}, "3600")},
+		{name: "forbidden", rejected: rateLimitResponse(http.StatusForbidden, 10, time.Now().Add(time.Minute), "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, sleeps, sent := newTestRateLimiter(t, tt.rejected, rateLimitResponse(http.StatusCreated, -1, time.Time{}, ""))
+			req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/org/repo/pulls/1/comments", strings.NewReader(`{"body":"comment"}`))
+
+			resp, err := limiter.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.retried {
+				if *sent != 1 || resp.StatusCode != tt.rejected.StatusCode || stats.retries != 0 {
+					t.Errorf("sent %d requests answered %d, want the rejection returned", *sent, resp.StatusCode)
+				}
+				return
+			}
+			if *sent != 2 || resp.StatusCode != http.StatusCreated || stats.retries != 1 {
+				t.Fatalf("sent %d requests answered %d with %d retries, want one retry", *sent, resp.StatusCode, stats.retries)
+			}
+			if len(*sleeps) != 1 || (*sleeps)[0] < tt.wantWait-2*time.Second || (*sleeps)[0] > tt.wantWait {
+				t.Errorf("paused %v, want %s", *sleeps, tt.wantWait)
+			}
+			if stats.apiCalls != 2 || stats.created != 1 {
+				t.Errorf("counted %d calls and %d comments, want 2 and 1", stats.apiCalls, stats.created)
+			}
+		})
+	}
+}
+
+func TestRateLimitMaxQPS(t *testing.T) {
+	limiter, sleeps, _ := newTestRateLimiter(t, rateLimitResponse(http.StatusOK, -1, time.Time{}, ""), rateLimitResponse(http.StatusOK, -1, time.Time{}, ""))
+	limiter.interval = time.Second
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
+		if _, err := limiter.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request goes right away, the second waits for its slot
+	if len(*sleeps) != 1 || (*sleeps)[0] <= 900*time.Millisecond {
+		t.Errorf("paused %v, want a second before the second request", *sleeps)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	// Docker Hub lists tags in pages, enough of them for the newest releases of an image
+	maxTagPages = 10
+)
+
+// manifestTypes are accepted when resolving a digest, the index first so a multi-platform
+// image is pinned as a whole
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// registryLookup finds newer tags of base images with anonymous access to their registry,
+// once per image however many findings are on it
+type registryLookup struct {
+	client *http.Client
+
+	mu       sync.Mutex
+	resolved map[string]registryResult
+}
+
+type registryResult struct {
+	image report.BaseImage
+	ok    bool
+}
+
+func newRegistryLookup() *registryLookup {
+	return &registryLookup{
+		client:   &http.Client{Transport: apiTransport, Timeout: 30 * time.Second},
+		resolved: make(map[string]registryResult),
+	}
+}
+
+// resolve returns the image on the newest tag shaped like its own, pinned to the digest of
+// that tag when the image was pinned to a digest. Lookup errors are logged and leave no
+// suggestion, the comment is still written.
+func (r *registryLookup) resolve(image report.BaseImage) (report.BaseImage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref := image.Reference()
+	if result, ok := r.resolved[ref]; ok {
+		return result.image, result.ok
+	}
+	newer, err := r.newer(image)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to look up newer tags of %s. %s", ref, err.Error()))
+	}
+	result := registryResult{image: newer, ok: err == nil && newer.Tag != ""}
+	r.resolved[ref] = result
+	return result.image, result.ok
+}
+
+func (r *registryLookup) newer(image report.BaseImage) (report.BaseImage, error) {
+	host, repository := registryRepository(image.Repository)
+	registry := &registrySession{client: r.client, base: fmt.Sprintf("%s://%s/v2/%s", registryScheme(host), host, repository)}
+	tags, err := registry.tags()
+	if err != nil {
+		return report.BaseImage{}, err
+	}
+	tag := report.NewerTag(image.Tag, tags)
+	if tag == "" {
+		return report.BaseImage{}, nil
+	}
+	newer := report.BaseImage{Line: image.Line, Repository: image.Repository, Tag: tag}
+	if image.Digest != "" {
+		if newer.Digest, err = registry.digest(tag); err != nil {
+			return report.BaseImage{}, err
+		}
+	}
+	return newer, nil
+}
+
+// registryRepository splits an image into its registry and repository the way docker does,
+// images without a registry host are on Docker Hub
+func registryRepository(image string) (string, string) {
+	host, repository, ok := strings.Cut(image, "/")
+	if !ok || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		repository = image
+		if !ok {
+			repository = "library/" + image
+		}
+		return dockerHubRegistry, repository
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubRegistry
+	}
+	return host, repository
+}
+
+func registryScheme(host string) string {
+	if host == "localhost" || strings.HasPrefix(host, "localhost:") || strings.HasPrefix(host, "127.0.0.1") {
+		return "http"
+	}
+	return "https"
+}
+
+// registrySession makes the requests of one repository, holding the anonymous token the
+// registry hands out on the first one
+type registrySession struct {
+	client *http.Client
+	base   string
+	token  string
+}
+
+func (s *registrySession) tags() ([]string, error) {
+	var tags []string
+	next := s.base + "/tags/list?n=1000"
+	for page := 0; page < maxTagPages && next != ""; page++ {
+		resp, err := s.get(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("the tag list is not valid: %w", err)
+		}
+		tags = append(tags, list.Tags...)
+		next = nextPage(resp.Request.URL, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+func (s *registrySession) digest(tag string) (string, error) {
+	resp, err := s.get(http.MethodHead, s.base+"/manifests/"+url.PathEscape(tag), map[string]string{"Accept": strings.Join(manifestTypes, ", ")})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("the registry returned no digest for %s", tag)
+	}
+	return digest, nil
+}
+
+// get makes the request, answering a bearer challenge with an anonymous token once
+func (s *registrySession) get(method, target string, headers map[string]string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if s.token, err = s.anonymousToken(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s %s returned %s", method, target, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func (s *registrySession) anonymousToken(challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("the registry requires %s authentication", scheme)
+	}
+	query := url.Values{}
+	var realm string
+	for _, m := range challengeParam.FindAllStringSubmatch(params, -1) {
+		if m[1] == "realm" {
+			realm = m[2]
+		} else {
+			query.Set(m[1], m[2])
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("the registry challenge has no realm: %s", challenge)
+	}
+	resp, err := s.client.Get(realm + "?" + query.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("the registry refused an anonymous token: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPage resolves the next page of a paginated list from its Link header
+func nextPage(current *url.URL, link string) string {
+	m := linkNext.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	next, err := current.Parse(m[1])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+// runRender writes every comment that would be posted to its own file, so the output of
+// templates can be snapshot tested in CI before it reaches a PR
+func runRender(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	reportFile := flags.String("report", resultsFile, "trivy JSON report to render")
+	templateFile := flags.String("template", "", "template rendering the comments, defaults to the configured formatter")
+	out := flags.String("out", "", "directory the comments and summary.md are written to")
+	profile := flags.String("pprof", "", "write CPU and heap profiles to <prefix>.cpu.pprof and <prefix>.heap.pprof")
+	strict := flags.Bool("strict-schema", strings.ToLower(os.Getenv("INPUT_STRICT_SCHEMA")) == "true", "fail when the report doesn't match the expected schema")
+	formatName := flags.String("format", reportFormat, reportFormatUsage)
+	_ = flags.Parse(args)
+	strictSchema = *strict
+	reportFormat = *formatName
+	setupLogger(*logFormat, os.Stderr)
+	if *profile != "" {
+		startProfiling(*profile)
+	}
+
+	if *out == "" {
+		fail("usage: commenter render --report <report> [--template <template>] --out <directory>")
+	}
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	if *templateFile != "" {
+		formatter, err := commenter.NewTemplateFormatter(*templateFile)
+		if err != nil {
+			fail(fmt.Sprintf("failed to parse the template. %s", err.Error()))
+		}
+		cfg.formatter = formatter
+	}
+
+	results, err := loadReport(*reportFile)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fail(fmt.Sprintf("failed to create the output directory. %s", err.Error()))
+	}
+
+	target := newReportTarget("", nil, cfg, results)
+	findings := target.findings
+	w := &fileCommenter{dir: *out}
+	outcome := commenter.Post(w, findings, commenter.Options{
+		MinSeverity: cfg.minSeverity,
+		MaxComments: cfg.maxComments,
+		Routes:      cfg.routes,
+		Formatter:   cfg.formatter,
+		Anchor:      workspaceAnchor(cfg),
+		Unified:     cfg.unifiedComments,
+	})
+	for _, err := range outcome.Errors {
+		logger.Error(err.Error(), "event", eventError)
+	}
+
+	formatter := cfg.formatter
+	if formatter == nil {
+		formatter = commenter.DefaultFormatter
+	}
+	summary, err := formatter.Summary(findings)
+	if err != nil {
+		fail(fmt.Sprintf("failed to render the summary. %s", err.Error()))
+	}
+	summary += dependencyChanges(results, findings, cfg)
+	summary += riskSummary(findings, cfg)
+	summary += ownerSections([]reportTarget{target})
+	if err := os.WriteFile(filepath.Join(*out, "summary.md"), []byte(summary), 0o644); err != nil {
+		fail(fmt.Sprintf("failed to write the summary. %s", err.Error()))
+	}
+
+	logger.Info(fmt.Sprintf("Rendered %d comments to %s", w.written, *out), "comments", w.written, "output", *out)
+	if len(outcome.Errors) > 0 {
+		exit(1)
+	}
+}
+
+// fileCommenter writes each comment to a numbered markdown file named after its location
+type fileCommenter struct {
+	dir     string
+	written int
+}
+
+func (c *fileCommenter) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	c.written++
+	location := strings.NewReplacer("/", "_", ":", "_").Replace(formatLocation(file, startLine, endLine))
+	name := fmt.Sprintf("%03d-%s.md", c.written, location)
+	return os.WriteFile(filepath.Join(c.dir, name), []byte(comment+"\n"), 0o644)
+}
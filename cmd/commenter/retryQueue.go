@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+// queued comments are dropped after this many failed attempts
+const maxRetryAttempts = 3
+
+// retryQueue persists comments that failed with a transient error, so the next run on the
+// same PR posts them before anything else. The file is kept between runs by the workflow,
+// e.g. with actions/cache.
+type retryQueue struct {
+	path     string
+	pr       int
+	queued   *commenter.Index
+	Comments []queuedComment `json:"comments"`
+}
+
+type queuedComment struct {
+	PR        int    `json:"pr"`
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Body      string `json:"body"`
+	Rule      string `json:"rule"`
+	Attempts  int    `json:"attempts"`
+}
+
+// retries collects the transient failures of the current run, nil when there is no queue
+var retries *retryQueue
+
+func loadRetryQueue(path string, prNo int) (*retryQueue, error) {
+	q := &retryQueue{path: path, pr: prNo, queued: commenter.NewIndex()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("retry queue %s is not valid: %w", path, err)
+	}
+	for _, qc := range q.Comments {
+		q.queued.Add(qc.fingerprint())
+	}
+	return q, nil
+}
+
+// retry posts the queued comments of the PR, keeping the ones that fail transiently again
+func (q *retryQueue) retry(p commenter.Provider) {
+	var kept []queuedComment
+	for _, qc := range q.Comments {
+		if qc.PR != q.pr || cancelled() {
+			kept = append(kept, qc)
+			continue
+		}
+		stats.retries++
+		err := p.WriteMultiLineComment(qc.File, qc.Body, qc.StartLine, qc.EndLine)
+		if err == nil {
+			logger.Info(fmt.Sprintf("Posted queued comment for rule %s in %s", qc.Rule, qc.File), "event", eventCommentPosted, "status", "retried", "rule", qc.Rule, "file", qc.File)
+			stats.posted++
+			continue
+		}
+		qc.Attempts++
+		if !isRetryable(err) {
+			logger.Info(fmt.Sprintf("Dropping queued comment for rule %s in %s (%s)", qc.Rule, qc.File, err.Error()), "rule", qc.Rule, "file", qc.File)
+			continue
+		}
+		if qc.Attempts >= maxRetryAttempts {
+			logger.Info(fmt.Sprintf("Dropping queued comment for rule %s in %s after %d attempts (%s)", qc.Rule, qc.File, qc.Attempts, err.Error()), "rule", qc.Rule, "file", qc.File)
+			continue
+		}
+		kept = append(kept, qc)
+	}
+	q.Comments = kept
+	q.queued = commenter.NewIndex()
+	for _, qc := range kept {
+		q.queued.Add(qc.fingerprint())
+	}
+}
+
+// add queues the comment when it failed, or was never attempted, because of a transient error
+func (q *retryQueue) add(c commenter.Comment, cause error) {
+	if cause == nil || !isRetryable(cause) {
+		return
+	}
+	q.push(c)
+}
+
+// push queues the comment unless it is queued already
+func (q *retryQueue) push(c commenter.Comment) {
+	qc := queuedComment{
+		PR:        q.pr,
+		File:      c.File,
+		StartLine: c.Finding.StartLine,
+		EndLine:   c.Finding.EndLine,
+		Body:      c.Body,
+		Rule:      c.Finding.ID,
+	}
+	if q.queued.Add(qc.fingerprint()) {
+		q.Comments = append(q.Comments, qc)
+	}
+}
+
+func (qc queuedComment) fingerprint() string {
+	return fmt.Sprintf("%d|%s", qc.PR, commenter.CommentFingerprint(qc.File, qc.Body, qc.StartLine, qc.EndLine))
+}
+
+func (q *retryQueue) save() error {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(q.path, data, 0o644)
+}
+
+func isRetryable(err error) bool {
+	switch commenter.ErrorClass(err) {
+	case commenter.ErrorClassServer, commenter.ErrorClassNetwork, commenter.ErrorClassRateLimit:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// failingProvider fails the comments on the files with their error, writing the others
+type failingProvider struct {
+	errs    map[string]error
+	written []string
+}
+
+func (p *failingProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	if err := p.errs[file]; err != nil {
+		return err
+	}
+	p.written = append(p.written, file)
+	return nil
+}
+
+var (
+	errBadGateway = errors.New("POST https://api.github.com/repos/org/repo/pulls/1/comments: 502 Bad Gateway []")
+	errValidation = errors.New("POST https://api.github.com/repos/org/repo/pulls/1/comments: 422 Validation Failed []")
+)
+
+func queuedOn(file string) commenter.Comment {
+	return commenter.Comment{File: file, Body: "comment on " + file, Finding: report.Finding{ID: "AVD-AWS-0086", Target: file, StartLine: 3, EndLine: 5}}
+}
+
+func TestRetryQueueAdd(t *testing.T) {
+	q, err := loadRetryQueue(filepath.Join(t.TempDir(), "retry.json"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.add(queuedOn("server.tf"), errBadGateway)
+	q.add(queuedOn("server.tf"), errBadGateway)
+	q.add(queuedOn("invalid.tf"), errValidation)
+	q.add(queuedOn("posted.tf"), nil)
+
+	if len(q.Comments) != 1 || q.Comments[0].File != "server.tf" || q.Comments[0].PR != 1 || q.Comments[0].StartLine != 3 {
+		t.Errorf("queued %+v, want the transient failure once", q.Comments)
+	}
+}
+
+func TestRetryQueueRetry(t *testing.T) {
+	saved, savedStats := logger, stats
+	logger = newLogger(logFormatText, io.Discard)
+	stats = runStats{filtered: make(map[string]int), started: time.Now()}
+	t.Cleanup(func() { logger, stats = saved, savedStats })
+
+	path := filepath.Join(t.TempDir(), "state", "retry.json")
+	q, err := loadRetryQueue(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"posted.tf", "invalid.tf", "flaky.tf", "exhausted.tf"} {
+		q.push(queuedOn(file))
+	}
+	q.Comments[3].Attempts = maxRetryAttempts - 1
+	other := &retryQueue{path: path, pr: 2, queued: commenter.NewIndex()}
+	other.push(queuedOn("other-pr.tf"))
+	q.Comments = append(q.Comments, other.Comments...)
+	if err := q.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// the next run on the PR
+	q, err = loadRetryQueue(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &failingProvider{errs: map[string]error{"invalid.tf": errValidation, "flaky.tf": errBadGateway, "exhausted.tf": errBadGateway}}
+	q.retry(p)
+
+	if strings.Join(p.written, ", ") != "posted.tf" || stats.posted != 1 || stats.retries != 4 {
+		t.Errorf("wrote %v with %d posted and %d retries, want posted.tf after 4 retries", p.written, stats.posted, stats.retries)
+	}
+	var kept []string
+	for _, qc := range q.Comments {
+		kept = append(kept, qc.File)
+	}
+	sort.Strings(kept)
+	// the comment of another PR waits for a run on it
+	if strings.Join(kept, ", ") != "flaky.tf, other-pr.tf" {
+		t.Errorf("kept %v in the queue, want the transient failure and the other PR's comment", kept)
+	}
+	for _, qc := range q.Comments {
+		if qc.File == "flaky.tf" && qc.Attempts != 1 {
+			t.Errorf("counted %d attempts of the failing comment, want 1", qc.Attempts)
+		}
+	}
+	if q.queued.Len() != 2 {
+		t.Errorf("the queue indexes %d comments, want the 2 it kept", q.queued.Len())
+	}
+}
+
+func TestLoadRetryQueueErrors(t *testing.T) {
+	q, err := loadRetryQueue(filepath.Join(t.TempDir(), "missing.json"), 1)
+	if err != nil || len(q.Comments) != 0 {
+		t.Errorf("got %v, %v for a queue that isn't there yet, want an empty one", q, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "retry.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRetryQueue(path, 1); err == nil || !strings.Contains(err.Error(), "is not valid") {
+		t.Errorf("got %v for an invalid queue, want it rejected", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for err, want := range map[error]bool{
+		errBadGateway: true,
+		errValidation: false,
+		errors.New("dial tcp: lookup api.github.com: i/o timeout"):                                                true,
+		errors.New("POST https://api.github.com/repos/org/repo/pulls/1/comments: 403 API rate limit exceeded []"): true,
+		errors.New("POST https://api.github.com/repos/org/repo/pulls/1/comments: 401 Bad credentials []"):         false,
+	} {
+		if got := isRetryable(err); got != want {
+			t.Errorf("isRetryable(%q) = %t, want %t", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+const defaultIgnoreFile = ".trivyignore"
+
+type reviewSession struct {
+	findings   []report.Finding
+	ignoreFile string
+	in         *bufio.Scanner
+	out        io.Writer
+
+	fileFilter     string
+	severityFilter string
+	suppressed     map[string]bool
+	pending        []report.Finding
+}
+
+// runReview starts an interactive terminal session for triaging a report locally
+func runReview(args []string) {
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+	ignoreFile := flags.String("ignore-file", defaultIgnoreFile, "ignore file suppressions are written to")
+	_ = flags.Parse(args)
+
+	results, err := loadReport(reportFileArg(flags))
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+
+	session := newReviewSession(results, *ignoreFile, os.Stdin, os.Stdout)
+	if err := session.loadIgnoreFile(); err != nil {
+		fail(fmt.Sprintf("failed to read %s. %s", *ignoreFile, err.Error()))
+	}
+	run := session.run
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		run = session.runTerminal
+	}
+	if err := run(); err != nil {
+		fail(err.Error())
+	}
+}
+
+// newReviewSession flattens the misconfigurations, vulnerabilities, secrets and licenses of the
+// results into the findings to triage, by file and line
+func newReviewSession(results []report.Result, ignoreFile string, in io.Reader, out io.Writer) *reviewSession {
+	return &reviewSession{
+		findings:   report.Findings(results),
+		ignoreFile: ignoreFile,
+		in:         bufio.NewScanner(in),
+		out:        out,
+		suppressed: make(map[string]bool),
+	}
+}
+
+func (s *reviewSession) loadIgnoreFile() error {
+	content, err := os.ReadFile(s.ignoreFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			s.suppressed[line] = true
+		}
+	}
+	return nil
+}
+
+// run is the line based session, used when the input or output isn't a terminal
+func (s *reviewSession) run() error {
+	s.printHelp()
+	s.printList()
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !s.in.Scan() {
+			break
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(s.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+			continue
+		case "l", "list":
+			s.printList()
+		case "f", "file":
+			s.fileFilter = arg
+			s.printList()
+		case "s", "severity":
+			s.severityFilter = strings.ToUpper(arg)
+			s.printList()
+		case "o", "open":
+			if finding, ok := s.lookup(arg); ok {
+				s.printFinding(finding)
+			}
+		case "i", "ignore":
+			if finding, ok := s.lookup(arg); ok {
+				fmt.Fprintln(s.out, s.suppress(finding))
+			}
+		case "w", "write":
+			message, err := s.writeIgnoreFile()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(s.out, message)
+		case "q", "quit":
+			if len(s.pending) > 0 {
+				fmt.Fprintf(s.out, "%d suppressions have not been written, use w to save them or Q to discard\n", len(s.pending))
+				continue
+			}
+			return nil
+		case "Q":
+			return nil
+		case "h", "help", "?":
+			s.printHelp()
+		default:
+			fmt.Fprintf(s.out, "unknown command %q\n", command)
+		}
+	}
+	return s.in.Err()
+}
+
+func (s *reviewSession) printHelp() {
+	fmt.Fprint(s.out, `Commands:
+  l            list findings matching the current filters
+  f [text]     filter by file path, empty to clear
+  s [severity] filter by severity, empty to clear
+  o <n>        open finding n with its code context
+  i <n>        suppress the rule of finding n
+  w            write suppressions to the ignore file
+  q            quit, Q to discard unwritten suppressions
+`)
+}
+
+// visible returns the indexes of the findings matching the current filters
+func (s *reviewSession) visible() []int {
+	var indexes []int
+	for i, finding := range s.findings {
+		if s.fileFilter != "" && !strings.Contains(finding.Target, s.fileFilter) {
+			continue
+		}
+		if s.severityFilter != "" && finding.Severity != s.severityFilter {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func (s *reviewSession) printList() {
+	indexes := s.visible()
+	fmt.Fprintf(s.out, "%d of %d findings\n", len(indexes), len(s.findings))
+	lastFile := ""
+	for _, i := range indexes {
+		finding := s.findings[i]
+		if finding.Target != lastFile {
+			fmt.Fprintf(s.out, "%s\n", finding.Target)
+			lastFile = finding.Target
+		}
+		fmt.Fprintf(s.out, "  %s\n", s.listEntry(i))
+	}
+}
+
+// listEntry is the line of finding i in the list, marked when its rule is suppressed
+func (s *reviewSession) listEntry(i int) string {
+	finding := s.findings[i]
+	marker := " "
+	if s.suppressed[finding.ID] {
+		marker = "x"
+	}
+	return fmt.Sprintf("[%s] %3d  %-8s %-14s %-5s  %s", marker, i+1, finding.Severity, finding.ID, lineLabel(finding), finding.Title)
+}
+
+// lineLabel is the line a finding starts on, "-" for one without lines, e.g. a vulnerability of
+// an image
+func lineLabel(finding report.Finding) string {
+	if finding.StartLine == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("L%d", finding.StartLine)
+}
+
+func (s *reviewSession) lookup(arg string) (report.Finding, bool) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(s.findings) {
+		fmt.Fprintf(s.out, "no finding %q\n", arg)
+		return report.Finding{}, false
+	}
+	return s.findings[n-1], true
+}
+
+func (s *reviewSession) printFinding(finding report.Finding) {
+	fmt.Fprintf(s.out, "%s %s - %s\n", finding.Severity, finding.ID, finding.Title)
+	fmt.Fprintf(s.out, "%s\n", formatLocation(finding.Target, finding.StartLine, finding.EndLine))
+	if finding.Message != "" {
+		fmt.Fprintf(s.out, "\n%s\n", finding.Message)
+	}
+	if finding.Resolution != "" {
+		fmt.Fprintf(s.out, "Resolution: %s\n", finding.Resolution)
+	}
+	fmt.Fprintln(s.out)
+	for _, line := range codeContext(finding) {
+		marker := " "
+		if line.IsCause {
+			marker = ">"
+		}
+		fmt.Fprintf(s.out, "%s %4d | %s\n", marker, line.Number, line.Content)
+	}
+	for _, ref := range finding.References {
+		fmt.Fprintf(s.out, "  %s\n", ref)
+	}
+}
+
+// codeContextLines is how many lines either side of the cause are shown when reading from disk
+const codeContextLines = 3
+
+// codeContext prefers the code embedded in the report, falling back to the file in the checkout.
+// A finding without lines, e.g. a vulnerability of an image, has none.
+func codeContext(finding report.Finding) []report.Line {
+	if len(finding.Code) > 0 {
+		return finding.Code
+	}
+	if finding.StartLine == 0 {
+		return nil
+	}
+	content, err := os.ReadFile(finding.Target)
+	if err != nil {
+		return nil
+	}
+	fileLines := strings.Split(string(content), "\n")
+	var lines []report.Line
+	for n := finding.StartLine - codeContextLines; n <= finding.EndLine+codeContextLines; n++ {
+		if n < 1 || n > len(fileLines) {
+			continue
+		}
+		lines = append(lines, report.Line{
+			Number:  n,
+			Content: fileLines[n-1],
+			IsCause: n >= finding.StartLine && n <= finding.EndLine,
+		})
+	}
+	return lines
+}
+
+// suppress marks the rule of the finding suppressed, returning what happened for the user
+func (s *reviewSession) suppress(finding report.Finding) string {
+	if s.suppressed[finding.ID] {
+		return fmt.Sprintf("%s is already suppressed", finding.ID)
+	}
+	s.suppressed[finding.ID] = true
+	s.pending = append(s.pending, finding)
+	return fmt.Sprintf("suppressed %s, use w to write it to %s", finding.ID, s.ignoreFile)
+}
+
+// writeIgnoreFile appends the pending suppressions to the ignore file, returning what happened
+// for the user
+func (s *reviewSession) writeIgnoreFile() (string, error) {
+	if len(s.pending) == 0 {
+		return "nothing to write", nil
+	}
+	// the first entry mustn't be glued onto a last line without a newline
+	var separator string
+	if content, err := os.ReadFile(s.ignoreFile); err == nil && len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		separator = "\n"
+	}
+	f, err := os.OpenFile(s.ignoreFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(f, separator); err != nil {
+		f.Close()
+		return "", err
+	}
+	for _, finding := range s.pending {
+		if _, err := fmt.Fprintf(f, "# %s %s\n%s\n", formatLocation(finding.Target, finding.StartLine, finding.EndLine),
+			finding.Title, finding.ID); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("wrote %d suppressions to %s", len(s.pending), s.ignoreFile)
+	s.pending = nil
+	return message, nil
+}
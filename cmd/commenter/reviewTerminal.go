@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// reviewSeverities are the severity filters s cycles through, the empty one showing everything
+var reviewSeverities = []string{"", "CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// isTerminal is whether the file is a terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// stty runs stty on the terminal of stdin, the standard library having no terminal handling
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalView is the state of the full screen session
+type terminalView struct {
+	keys *bufio.Reader
+	rows int
+	cols int
+
+	// cursor is the selected finding among the visible ones, top the first one on screen
+	cursor int
+	top    int
+	status string
+}
+
+// runTerminal is the full screen session: the findings are browsed with the arrow keys and
+// every command is a single key. Without stty it falls back to the line based session.
+func (s *reviewSession) runTerminal() error {
+	saved, err := stty("-g")
+	if err != nil {
+		return s.run()
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return s.run()
+	}
+	defer stty(saved)
+	// the alternate screen keeps the shell's scrollback as it was
+	fmt.Fprint(s.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(s.out, "\x1b[?25h\x1b[?1049l")
+
+	v := &terminalView{keys: bufio.NewReader(os.Stdin), rows: 24, cols: 80}
+	if size, err := stty("size"); err == nil {
+		// a terminal without a size reports 0 0
+		rows, cols, _ := strings.Cut(size, " ")
+		if r, err := strconv.Atoi(rows); err == nil && r > 0 {
+			v.rows = r
+		}
+		if c, err := strconv.Atoi(cols); err == nil && c > 0 {
+			v.cols = c
+		}
+	}
+	severity := 0
+
+	for {
+		visible := s.visible()
+		v.clamp(len(visible))
+		s.drawList(v, visible)
+
+		key, err := v.readKey()
+		if err != nil {
+			return err
+		}
+		v.status = ""
+		switch key {
+		case "up", "k":
+			v.cursor--
+		case "down", "j":
+			v.cursor++
+		case "pgup":
+			v.cursor -= v.listRows()
+		case "pgdown":
+			v.cursor += v.listRows()
+		case "enter", "o":
+			if len(visible) > 0 {
+				if err := s.showFinding(v, visible[v.cursor]); err != nil {
+					return err
+				}
+			}
+		case "i":
+			if len(visible) > 0 {
+				v.status = s.suppress(s.findings[visible[v.cursor]])
+			}
+		case "f":
+			filter, err := v.prompt(s, "file: ", s.fileFilter)
+			if err != nil {
+				return err
+			}
+			s.fileFilter, v.cursor = filter, 0
+		case "s":
+			severity = (severity + 1) % len(reviewSeverities)
+			s.severityFilter, v.cursor = reviewSeverities[severity], 0
+		case "w":
+			message, err := s.writeIgnoreFile()
+			if err != nil {
+				return err
+			}
+			v.status = message
+		case "q", "esc":
+			if len(s.pending) > 0 {
+				v.status = fmt.Sprintf("%d suppressions have not been written, use w to save them or Q to discard", len(s.pending))
+				continue
+			}
+			return nil
+		case "Q", "ctrl-c":
+			return nil
+		}
+	}
+}
+
+// listRows is how many findings fit on screen below the header and above the status and help
+func (v *terminalView) listRows() int {
+	if v.rows <= 4 {
+		return 1
+	}
+	return v.rows - 3
+}
+
+// clamp keeps the cursor on a visible finding and on screen
+func (v *terminalView) clamp(visible int) {
+	v.cursor = max(0, min(v.cursor, visible-1))
+	if v.cursor < v.top {
+		v.top = v.cursor
+	}
+	if v.cursor >= v.top+v.listRows() {
+		v.top = v.cursor - v.listRows() + 1
+	}
+	v.top = max(0, min(v.top, visible-v.listRows()))
+}
+
+func (s *reviewSession) drawList(v *terminalView, visible []int) {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	header := fmt.Sprintf("%d of %d findings", len(visible), len(s.findings))
+	if s.fileFilter != "" {
+		header += fmt.Sprintf("  file: %s", s.fileFilter)
+	}
+	if s.severityFilter != "" {
+		header += fmt.Sprintf("  severity: %s", s.severityFilter)
+	}
+	fmt.Fprintf(&sb, "%s\r\n", v.fit(header))
+
+	for row := 0; row < v.listRows(); row++ {
+		if v.top+row < len(visible) {
+			i := visible[v.top+row]
+			line := v.fit(fmt.Sprintf("%s  %s", s.listEntry(i), s.findings[i].Target))
+			if v.top+row == v.cursor {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			sb.WriteString(line)
+		}
+		sb.WriteString("\r\n")
+	}
+	fmt.Fprintf(&sb, "%s\r\n", v.fit(v.status))
+	sb.WriteString(v.fit("↑/↓ move  enter open  i ignore  f file  s severity  w write  q quit"))
+	fmt.Fprint(s.out, sb.String())
+}
+
+// showFinding shows the finding with its code context until it is closed, scrolling when it
+// doesn't fit
+func (s *reviewSession) showFinding(v *terminalView, i int) error {
+	var buf bytes.Buffer
+	out := s.out
+	s.out = &buf
+	s.printFinding(s.findings[i])
+	s.out = out
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+
+	top := 0
+	for {
+		page := v.rows - 1
+		top = max(0, min(top, len(lines)-page))
+		var sb strings.Builder
+		sb.WriteString("\x1b[H\x1b[2J")
+		for _, line := range lines[top:min(len(lines), top+page)] {
+			fmt.Fprintf(&sb, "%s\r\n", v.fit(line))
+		}
+		sb.WriteString(v.fit("↑/↓ scroll  any other key to go back"))
+		fmt.Fprint(s.out, sb.String())
+
+		key, err := v.readKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "up", "k":
+			top--
+		case "down", "j":
+			top++
+		case "pgup":
+			top -= page
+		case "pgdown":
+			top += page
+		default:
+			return nil
+		}
+	}
+}
+
+// prompt reads a line on the status line, enter accepting it and escape keeping the value
+func (v *terminalView) prompt(s *reviewSession, label, value string) (string, error) {
+	input := value
+	for {
+		v.status = label + input
+		s.drawList(v, s.visible())
+		key, err := v.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case "enter":
+			v.status = ""
+			return input, nil
+		case "esc", "ctrl-c":
+			v.status = ""
+			return value, nil
+		case "backspace":
+			if input != "" {
+				_, size := utf8.DecodeLastRuneInString(input)
+				input = input[:len(input)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				input += key
+			}
+		}
+	}
+}
+
+// readKey reads a key press, naming the keys that aren't a character
+func (v *terminalView) readKey() (string, error) {
+	r, _, err := v.keys.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		if v.keys.Buffered() == 0 {
+			return "esc", nil
+		}
+		sequence := make([]byte, 0, 4)
+		for v.keys.Buffered() > 0 && len(sequence) < cap(sequence) {
+			b, _ := v.keys.ReadByte()
+			sequence = append(sequence, b)
+			if len(sequence) > 1 && (b >= 'A' && b <= 'Z' || b == '~') {
+				break
+			}
+		}
+		switch string(sequence) {
+		case "[A", "OA":
+			return "up", nil
+		case "[B", "OB":
+			return "down", nil
+		case "[5~":
+			return "pgup", nil
+		case "[6~":
+			return "pgdown", nil
+		}
+		return "esc", nil
+	}
+	return string(r), nil
+}
+
+// fit cuts a line to the width of the terminal
+func (v *terminalView) fit(line string) string {
+	if runes := []rune(line); v.cols > 0 && len(runes) > v.cols {
+		return string(runes[:v.cols])
+	}
+	return line
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// riskScore is the score of the unique findings at the minimum severity, see commenter.Dedupe
+func riskScore(unique []report.Finding, cfg settings) int {
+	return report.RiskScore(report.FilterBySeverity(unique, cfg.minSeverity), cfg.riskWeights)
+}
+
+// riskSummary renders the risk score of the findings at the minimum severity and what adds to
+// it, for the end of the summary
+func riskSummary(findings []report.Finding, cfg settings) string {
+	findings = report.FilterBySeverity(commenter.Dedupe(findings), cfg.minSeverity)
+	counts := make(map[string]int)
+	for _, f := range findings {
+		if !f.Suppressed {
+			counts[strings.ToUpper(f.Severity)]++
+		}
+	}
+	var terms []string
+	for i := len(report.Severities) - 1; i >= 0; i-- {
+		severity := report.Severities[i]
+		if counts[severity] > 0 && cfg.riskWeights[severity] > 0 {
+			terms = append(terms, fmt.Sprintf("%d %s × %d", counts[severity], severity, cfg.riskWeights[severity]))
+		}
+	}
+	line := fmt.Sprintf("\n**Risk score:** %d", report.RiskScore(findings, cfg.riskWeights))
+	if len(terms) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(terms, " + "))
+	}
+	return line + "\n"
+}
+
+// recordRiskScore sets the risk_score output to the score of the findings of every target
+// and writes the badge of it when INPUT_RISK_BADGE is set
+func recordRiskScore(targets []reportTarget) {
+	for _, t := range targets {
+		stats.riskScore += riskScore(t.unique, t.cfg)
+	}
+	if len(targets) > 0 {
+		writeRiskBadge(stats.riskScore, targets[0].cfg)
+	}
+}
+
+// writeRiskBadge writes the SVG badge of the score, a failure is logged
+func writeRiskBadge(score int, cfg settings) {
+	if cfg.riskBadge == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.riskBadge), 0o755); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the risk badge. %s", err.Error()))
+		return
+	}
+	if err := os.WriteFile(cfg.riskBadge, []byte(commenter.RiskBadge(score)), 0o644); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the risk badge. %s", err.Error()))
+		return
+	}
+	logger.Info(fmt.Sprintf("Risk badge of score %d written to %s", score, cfg.riskBadge), "risk_score", score, "risk_badge", cfg.riskBadge)
+}
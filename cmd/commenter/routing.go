@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/google/go-github/v32/github"
+	"gopkg.in/yaml.v3"
+)
+
+// routingFile routes findings to the reviewers who own them, e.g.
+//
+//	routes:
+//	  - service: s3
+//	    reviewers: ['@acme/storage']
+//	  - provider: aws
+//	    service: iam
+//	    severity: high
+//	    reviewers: ['@acme/iam', '@alice']
+//	  - path: services/payments/
+//	    reviewers: ['@acme/payments']
+type routingFile struct {
+	Routes []routingEntry `yaml:"routes"`
+}
+
+type routingEntry struct {
+	Severity  string   `yaml:"severity"`
+	Provider  string   `yaml:"provider"`
+	Service   string   `yaml:"service"`
+	Path      string   `yaml:"path"`
+	Reviewers []string `yaml:"reviewers"`
+}
+
+func loadRouting(path string) ([]commenter.Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file routingFile
+	if err := yaml.Unmarshal([]byte(commenter.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	routes := make([]commenter.Route, 0, len(file.Routes))
+	for i, entry := range file.Routes {
+		if len(entry.Reviewers) == 0 {
+			return nil, fmt.Errorf("route %d of %s has no reviewers", i+1, path)
+		}
+		route := commenter.Route{Provider: entry.Provider, Service: entry.Service, Path: entry.Path}
+		if entry.Severity != "" {
+			severity, err := report.ParseSeverity(entry.Severity)
+			if err != nil {
+				return nil, fmt.Errorf("route %d of %s: %w", i+1, path, err)
+			}
+			route.Severity = severity
+		}
+		for _, reviewer := range entry.Reviewers {
+			if !strings.HasPrefix(reviewer, "@") || len(reviewer) == 1 {
+				return nil, fmt.Errorf("reviewer %q of route %d of %s must be @login or @org/team", reviewer, i+1, path)
+			}
+			route.Reviewers = append(route.Reviewers, reviewer)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routedReviewers collects the reviewers of the routed findings commented on the PR, they are
+// requested once every target is done
+var routedReviewers = &reviewerRequests{seen: make(map[string]bool)}
+
+type reviewerRequests struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (r *reviewerRequests) add(reviewers []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reviewer := range reviewers {
+		r.seen[strings.ToLower(reviewer)] = true
+	}
+}
+
+// request asks the collected users and teams for a review of the PR, leaving out its author,
+// whom GitHub doesn't accept as a reviewer
+func (r *reviewerRequests) request(client *github.Client, owner, repo string, pr *github.PullRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var request github.ReviewersRequest
+	for reviewer := range r.seen {
+		name := strings.TrimPrefix(reviewer, "@")
+		if _, team, ok := strings.Cut(name, "/"); ok {
+			request.TeamReviewers = append(request.TeamReviewers, team)
+		} else if !strings.EqualFold(name, pr.GetUser().GetLogin()) {
+			request.Reviewers = append(request.Reviewers, name)
+		}
+	}
+	if len(request.Reviewers)+len(request.TeamReviewers) == 0 {
+		return nil
+	}
+	sort.Strings(request.Reviewers)
+	sort.Strings(request.TeamReviewers)
+	// the comments written before a shutdown still mention the reviewers
+	ctx, cancel := flushContext()
+	defer cancel()
+	if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, pr.GetNumber(), request); err != nil {
+		return fmt.Errorf("failed to request reviews from %s: %w", strings.Join(append(request.Reviewers, request.TeamReviewers...), ", "), err)
+	}
+	logger.Info(fmt.Sprintf("Requested reviews from %d users and %d teams", len(request.Reviewers), len(request.TeamReviewers)),
+		"reviewers", request.Reviewers, "teams", request.TeamReviewers)
+	return nil
+}
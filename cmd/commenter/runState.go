@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// runState records the comments written for a commit of a PR as they are written, so a run
+// re-started after a crash or cancellation skips them instead of posting everything again.
+// The file is kept between runs by the workflow, e.g. with actions/cache.
+type runState struct {
+	path string
+
+	mu        sync.Mutex
+	PR        int             `json:"pr"`
+	SHA       string          `json:"sha"`
+	Completed map[string]bool `json:"completed"`
+}
+
+// loadRunState reads the state of an earlier run, starting afresh when it was for another
+// PR or commit since its findings may no longer apply
+func loadRunState(path string, prNo int, sha string) (*runState, error) {
+	s := &runState{path: path, PR: prNo, SHA: sha, Completed: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var earlier runState
+	if err := json.Unmarshal(data, &earlier); err != nil {
+		return nil, fmt.Errorf("run state %s is not valid: %w", path, err)
+	}
+	if earlier.PR == prNo && earlier.SHA == sha && earlier.Completed != nil {
+		s.Completed = earlier.Completed
+	}
+	return s, nil
+}
+
+// wrap skips the comments completed by an earlier run and records the ones written by this one
+func (s *runState) wrap(p commenter.Provider) commenter.Provider {
+	return &resumingProvider{Provider: p, state: s}
+}
+
+type resumingProvider struct {
+	commenter.Provider
+	state *runState
+}
+
+func (r *resumingProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	key := commenter.CommentFingerprint(file, comment, startLine, endLine)
+	if r.state.completed(key) {
+		return prcommenter.CommentAlreadyWrittenError{}
+	}
+	if err := r.Provider.WriteMultiLineComment(file, comment, startLine, endLine); err != nil {
+		return err
+	}
+	if err := r.state.complete(key); err != nil {
+		logger.Error(fmt.Sprintf("failed to save the run state. %s", err.Error()))
+	}
+	return nil
+}
+
+func (s *runState) completed(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Completed[key]
+}
+
+// complete records the comment and saves the state straight away, a crash can come at any time
+func (s *runState) complete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Completed[key] = true
+	return s.save()
+}
+
+func (s *runState) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// written aside and renamed, so an interrupted save leaves the previous state intact
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
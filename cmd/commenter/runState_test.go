@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+func TestRunStateResumes(t *testing.T) {
+	saved := logger
+	logger = newLogger(logFormatText, io.Discard)
+	t.Cleanup(func() { logger = saved })
+
+	path := filepath.Join(t.TempDir(), "state", "run.json")
+	s, err := loadRunState(path, 1, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &failingProvider{errs: map[string]error{"flaky.tf": errBadGateway}}
+	wrapped := s.wrap(p)
+	for _, file := range []string{"main.tf", "flaky.tf"} {
+		_ = wrapped.WriteMultiLineComment(file, "comment on "+file, 3, 5)
+	}
+
+	// the re-started run skips what the first one wrote and retries what failed
+	s, err = loadRunState(path, 1, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = &failingProvider{}
+	wrapped = s.wrap(p)
+	var written prcommenter.CommentAlreadyWrittenError
+	if err := wrapped.WriteMultiLineComment("main.tf", "comment on main.tf", 3, 5); !errors.As(err, &written) {
+		t.Errorf("got %v for a comment written by the earlier run, want it skipped as already written", err)
+	}
+	if err := wrapped.WriteMultiLineComment("flaky.tf", "comment on flaky.tf", 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(p.written, ", ") != "flaky.tf" || len(s.Completed) != 2 {
+		t.Errorf("wrote %v with %d comments completed, want the failed comment posted and both completed", p.written, len(s.Completed))
+	}
+	// a comment on other lines is a different one
+	if err := wrapped.WriteMultiLineComment("main.tf", "comment on main.tf", 7, 9); err != nil || len(p.written) != 2 {
+		t.Errorf("got %v and wrote %v for a comment on other lines, want it written", err, p.written)
+	}
+}
+
+func TestLoadRunState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	s, err := loadRunState(path, 1, "abc123")
+	if err != nil || len(s.Completed) != 0 {
+		t.Fatalf("got %v, %v for a state that isn't there yet, want an empty one", s, err)
+	}
+	if err := s.complete("main.tf|1"); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the save left its temporary file behind: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pr   int
+		sha  string
+		want int
+	}{
+		{name: "same commit", pr: 1, sha: "abc123", want: 1},
+		{name: "new commit", pr: 1, sha: "def456"},
+		{name: "other PR", pr: 2, sha: "abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadRunState(path, tt.pr, tt.sha)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Completed) != tt.want || s.PR != tt.pr || s.SHA != tt.sha {
+				t.Errorf("loaded %d completed comments for PR %d at %s, want %d", len(s.Completed), s.PR, s.SHA, tt.want)
+			}
+		})
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRunState(path, 1, "abc123"); err == nil || !strings.Contains(err.Error(), "is not valid") {
+		t.Errorf("got %v for an invalid state, want it rejected", err)
+	}
+}
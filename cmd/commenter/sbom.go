@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// loadSBOM reads the dependencies of an SBOM or a trivy report listing every package
+func loadSBOM(path string) ([]report.Dependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := report.ParseSBOM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	logger.Info(fmt.Sprintf("Read %d dependencies from %s", len(deps), path), "sbom", path, "dependencies", len(deps))
+	return deps, nil
+}
+
+// dependencyChanges renders the dependencies changed between the base SBOM and the head one,
+// which is the report itself unless another is given. Its vulnerabilities are then taken from
+// the findings, VEX statements applied.
+func dependencyChanges(results []report.Result, findings []report.Finding, cfg settings) string {
+	if cfg.sbomBase == nil {
+		return ""
+	}
+	head := cfg.sbomHead
+	if head == nil {
+		var listed bool
+		for _, result := range results {
+			listed = listed || len(result.Packages) > 0
+		}
+		if !listed {
+			logger.Warn("The report lists no packages to compare with the base SBOM, scan with --list-all-pkgs for the dependency changes")
+			return ""
+		}
+		head = report.SetDependencyVulnerabilities(report.Dependencies(results), findings)
+	}
+	return commenter.DependencyChanges(report.DiffDependencies(cfg.sbomBase, head))
+}
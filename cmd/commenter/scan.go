@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// trivy commands that take a target, anything else is run as trivy fs
+var trivyCommands = map[string]bool{
+	"config": true, "filesystem": true, "fs": true, "image": true, "repository": true,
+	"repo": true, "rootfs": true, "sbom": true, "vm": true,
+}
+
+type scanOptions struct {
+	logFormat string
+	local     bool
+	quiet     bool
+	strict    bool
+	output    string
+	trivy     string
+	pprof     string
+	trivyArgs []string
+}
+
+// runScan runs trivy and comments on its results in one step, without handing a report file between steps.
+// The commenter's own flags are picked out and everything else is passed to trivy.
+func runScan(args []string) {
+	opts, err := parseScanArgs(args)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	logOutput := os.Stdout
+	if opts.local && opts.output == "" {
+		logOutput = os.Stderr
+	}
+	quietLogging = opts.quiet
+	strictSchema = opts.strict
+	setupLogger(opts.logFormat, logOutput)
+	if opts.pprof != "" {
+		startProfiling(opts.pprof)
+	}
+	logger.Info(fmt.Sprintf("Starting the GitHub commenter - %s", versionString()), "version", version, "commit", commit, "date", date)
+
+	commentOnResults(func(cfg settings) []reportTarget {
+		return singleTarget(checkResults(runTrivy(opts.trivy, opts.trivyArgs)), cfg)
+	}, opts.local, opts.output)
+}
+
+func parseScanArgs(args []string) (scanOptions, error) {
+	opts := scanOptions{
+		logFormat: os.Getenv("INPUT_LOG_FORMAT"),
+		quiet:     strings.ToLower(os.Getenv("INPUT_QUIET")) == "true",
+		strict:    strings.ToLower(os.Getenv("INPUT_STRICT_SCHEMA")) == "true",
+		trivy:     "trivy",
+	}
+	stringFlags := map[string]*string{
+		"--log-format": &opts.logFormat,
+		"--output":     &opts.output,
+		"--trivy":      &opts.trivy,
+		"--pprof":      &opts.pprof,
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--local" {
+			opts.local = true
+			continue
+		}
+		if arg == "--quiet" {
+			opts.quiet = true
+			continue
+		}
+		if arg == "--strict-schema" {
+			opts.strict = true
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if target, ok := stringFlags[name]; ok {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("flag %s needs a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			*target = value
+			continue
+		}
+		opts.trivyArgs = append(opts.trivyArgs, arg)
+	}
+
+	if len(opts.trivyArgs) == 0 || !trivyCommands[opts.trivyArgs[0]] {
+		opts.trivyArgs = append([]string{"fs"}, opts.trivyArgs...)
+	}
+	if len(opts.trivyArgs) == 1 {
+		opts.trivyArgs = append(opts.trivyArgs, ".")
+	}
+	return opts, nil
+}
+
+// runTrivy runs the scan with JSON output captured in memory, trivy's own logging goes to stderr
+func runTrivy(binary string, args []string) ([]report.Result, error) {
+	args = append([]string{args[0], "--format", "json", "--quiet"}, args[1:]...)
+	logger.Info(fmt.Sprintf("Running %s %s", binary, strings.Join(args, " ")))
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("trivy failed: %w", err)
+	}
+	r, err := report.ParseReport(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDrift("trivy output", r); err != nil {
+		return nil, err
+	}
+	return r.Results, nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// settings are the tuning knobs of a comment run. A profile provides the defaults
+// and any input that is set explicitly overrides the profile's value.
+type settings struct {
+	// lowest severity that gets a comment
+	minSeverity string
+	// maximum number of comments written per run, 0 for no limit
+	maxComments int
+	// one comment per file covering all of its findings rather than only the first
+	unifiedComments bool
+	// suppress the findings on generated and vendored files
+	skipGenerated bool
+	// commit the suggested fixes, to a companion PR or the PR's branch, empty to only suggest them
+	autofix string
+	// lowest severity of a written comment that fails the run
+	gateSeverity string
+	// never fail the run because of the comments written
+	softFail bool
+	// directories report targets are resolved against
+	workingDirectories []workingDirectory
+	// renders the comment bodies, nil for the default
+	formatter commenter.Formatter
+	// comments written at once, 0 or 1 writes them one by one
+	maxParallel int
+	// most API requests per second, 0 for no limit beyond GitHub's own
+	maxQPS float64
+	// how long a run may post comments before it stops with partial results, 0 for no limit
+	maxRuntime time.Duration
+	// above this many changed files, or findings, the PR gets check run annotations instead
+	// of inline comments, 0 for no limit
+	largePRFiles    int
+	largePRFindings int
+	// the Dockerfile the vulnerabilities of an image scan are commented on, and whether its
+	// registry is asked for a newer base image to suggest
+	dockerfile     string
+	registryLookup bool
+	// rendered Helm output by path, with the directory of the chart it was rendered from
+	helmCharts map[string]string
+	// map the targets of built templates back onto the authored files
+	sourceRules []report.SourceRule
+	// remediation added to the comments on secrets
+	secretActions report.SecretActions
+	// statements of VEX documents, applied to the vulnerabilities they cover with vexAction,
+	// to those of vexProducts as well as to the packages they name
+	vexStatements []report.VEXStatement
+	vexProducts   []string
+	vexAction     string
+	// dependencies of the base and head of the PR, listed in the summary when they changed.
+	// A nil head is the report's own packages.
+	sbomBase []report.Dependency
+	sbomHead []report.Dependency
+	// reviewers requested and mentioned for the findings they own
+	routes []commenter.Route
+	// categories of the licenses found, and whether the policy applies at all
+	licensePolicy *report.LicensePolicy
+	// name of the artifact the filtered report is uploaded as and linked from the summary
+	reportArtifact string
+	// path the standalone HTML report of the findings is written to
+	htmlReport string
+	// what a finding of each severity adds to the risk score, and the path of its badge
+	riskWeights map[string]int
+	riskBadge   string
+	// whether the summary has a section of findings for each owner
+	ownerSections bool
+	// whether the findings are commented on their lines or listed in a single summary comment
+	commentMode string
+	// whether inline runs write the summary comment as well
+	summaryComment bool
+	// resolve or delete the comments of fixed findings, empty to leave them
+	staleComments string
+	// the scope the comments are written with, only its stale comments are cleaned up
+	commentScope string
+}
+
+var profiles = map[string]settings{
+	"strict": {
+		minSeverity:  "UNKNOWN",
+		gateSeverity: "LOW",
+	},
+	"balanced": {
+		minSeverity:  "MEDIUM",
+		maxComments:  25,
+		gateSeverity: "HIGH",
+	},
+	"lenient": {
+		minSeverity:  "HIGH",
+		maxComments:  10,
+		gateSeverity: "CRITICAL",
+		softFail:     true,
+	},
+}
+
+// defaultSettings keeps the original behaviour when no profile is selected:
+// comment on everything and fail when any comment is written
+var defaultSettings = settings{
+	minSeverity:  "UNKNOWN",
+	gateSeverity: "UNKNOWN",
+	commentMode:  commentModeInline,
+}
+
+// parseSecretActions reads a comma separated list of gitignore, rotation and history, or all
+func parseSecretActions(input string) (report.SecretActions, error) {
+	var actions report.SecretActions
+	for _, action := range strings.Split(input, ",") {
+		switch strings.ToLower(strings.TrimSpace(action)) {
+		case "":
+		case "all", "true":
+			actions = report.SecretActions{Gitignore: true, Rotation: true, History: true}
+		case "gitignore":
+			actions.Gitignore = true
+		case "rotation":
+			actions.Rotation = true
+		case "history":
+			actions.History = true
+		default:
+			return actions, fmt.Errorf("unknown action %q, expected gitignore, rotation, history or all", action)
+		}
+	}
+	return actions, nil
+}
+
+// parseRiskWeights reads severity=weight entries separated by commas, e.g. critical=10,high=5,
+// the severities left out weigh nothing
+func parseRiskWeights(input string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, entry := range strings.Split(input, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a severity=weight entry", strings.TrimSpace(entry))
+		}
+		severity, err := report.ParseSeverity(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("the weight of %s is not a valid number: %q", severity, strings.TrimSpace(value))
+		}
+		weights[severity] = weight
+	}
+	return weights, nil
+}
+
+// parseRuntime reads a duration such as 10m or 1h30m, or a number of seconds
+func parseRuntime(input string) (time.Duration, error) {
+	input = strings.TrimSpace(input)
+	if seconds, err := strconv.Atoi(input); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(input)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q is not a valid duration, e.g. 10m or 600", input)
+	}
+	return d, nil
+}
+
+// parseHelmCharts reads rendered=chart entries, separated by commas like the working
+// directories
+func parseHelmCharts(input string) map[string]string {
+	charts := make(map[string]string)
+	for _, entry := range strings.Split(input, ",") {
+		rendered, chart, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		charts[strings.TrimPrefix(strings.TrimSpace(rendered), "./")] = strings.TrimSuffix(normaliseDirectory(chart), "/")
+	}
+	return charts
+}
+
+func loadSettings() (settings, error) {
+	s := defaultSettings
+	if name := os.Getenv("INPUT_PROFILE"); name != "" {
+		p, ok := profiles[strings.ToLower(name)]
+		if !ok {
+			return s, fmt.Errorf("unknown profile %q, expected strict, balanced or lenient", name)
+		}
+		s = p
+	}
+
+	if value := os.Getenv("INPUT_MIN_SEVERITY"); value != "" {
+		severity, err := report.ParseSeverity(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_MIN_SEVERITY: %w", err)
+		}
+		s.minSeverity = severity
+	}
+	if value := os.Getenv("INPUT_GATE_SEVERITY"); value != "" {
+		severity, err := report.ParseSeverity(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_GATE_SEVERITY: %w", err)
+		}
+		s.gateSeverity = severity
+	}
+	if value := os.Getenv("INPUT_MAX_COMMENTS"); value != "" {
+		maxComments, err := strconv.Atoi(value)
+		if err != nil || maxComments < 0 {
+			return s, fmt.Errorf("INPUT_MAX_COMMENTS is not a valid number: %q", value)
+		}
+		s.maxComments = maxComments
+	}
+	if value := os.Getenv("INPUT_MAX_PARALLEL"); value != "" {
+		maxParallel, err := strconv.Atoi(value)
+		if err != nil || maxParallel < 1 {
+			return s, fmt.Errorf("INPUT_MAX_PARALLEL is not a valid number: %q", value)
+		}
+		s.maxParallel = maxParallel
+	}
+	if value := os.Getenv("INPUT_MAX_QPS"); value != "" {
+		maxQPS, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxQPS < 0 {
+			return s, fmt.Errorf("INPUT_MAX_QPS is not a valid number: %q", value)
+		}
+		s.maxQPS = maxQPS
+	}
+	if value := os.Getenv("INPUT_MAX_RUNTIME"); value != "" {
+		maxRuntime, err := parseRuntime(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_MAX_RUNTIME: %w", err)
+		}
+		s.maxRuntime = maxRuntime
+	}
+	if value := os.Getenv("INPUT_LARGE_PR_FILES"); value != "" {
+		largePRFiles, err := strconv.Atoi(value)
+		if err != nil || largePRFiles < 0 {
+			return s, fmt.Errorf("INPUT_LARGE_PR_FILES is not a valid number: %q", value)
+		}
+		s.largePRFiles = largePRFiles
+	}
+	if value := os.Getenv("INPUT_LARGE_PR_FINDINGS"); value != "" {
+		largePRFindings, err := strconv.Atoi(value)
+		if err != nil || largePRFindings < 0 {
+			return s, fmt.Errorf("INPUT_LARGE_PR_FINDINGS is not a valid number: %q", value)
+		}
+		s.largePRFindings = largePRFindings
+	}
+	if value, ok := os.LookupEnv("INPUT_SOFT_FAIL_COMMENTER"); ok && value != "" {
+		s.softFail = strings.ToLower(value) == "true"
+	}
+	if value := os.Getenv("INPUT_FORMATTER"); value != "" {
+		formatter, err := commenter.LookupFormatter(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_FORMATTER: %w", err)
+		}
+		s.formatter = formatter
+	}
+	if value := os.Getenv("INPUT_COMMENT_TEMPLATE"); strings.TrimSpace(value) != "" {
+		if name := os.Getenv("INPUT_FORMATTER"); name != "" {
+			return s, fmt.Errorf("INPUT_COMMENT_TEMPLATE: can't be combined with the formatter %q", name)
+		}
+		formatter, err := commenter.ParseTemplate("comment_template", value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_COMMENT_TEMPLATE: %w", err)
+		}
+		s.formatter = formatter
+	}
+	s.dockerfile = "Dockerfile"
+	if value := os.Getenv("INPUT_DOCKERFILE"); value != "" {
+		s.dockerfile = value
+	}
+	if value := os.Getenv("INPUT_SOURCE_MAP"); value != "" {
+		rules, err := loadSourceMap(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_SOURCE_MAP: %w", err)
+		}
+		s.sourceRules = rules
+	}
+	if value := os.Getenv("INPUT_SECRET_REMEDIATION"); value != "" {
+		actions, err := parseSecretActions(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_SECRET_REMEDIATION: %w", err)
+		}
+		s.secretActions = actions
+	}
+	if value := os.Getenv("INPUT_VEX"); value != "" {
+		statements, err := loadVEX(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_VEX: %w", err)
+		}
+		s.vexStatements = statements
+	}
+	for _, product := range strings.Split(os.Getenv("INPUT_VEX_PRODUCTS"), ",") {
+		if product = strings.TrimSpace(product); product != "" {
+			s.vexProducts = append(s.vexProducts, product)
+		}
+	}
+	s.vexAction = report.VEXSuppress
+	if value := os.Getenv("INPUT_VEX_ACTION"); value != "" {
+		if value != report.VEXSuppress && value != report.VEXDowngrade {
+			return s, fmt.Errorf("INPUT_VEX_ACTION must be %s or %s, not %q", report.VEXSuppress, report.VEXDowngrade, value)
+		}
+		s.vexAction = value
+	}
+	if value := os.Getenv("INPUT_REVIEWER_ROUTING"); value != "" {
+		routes, err := loadRouting(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_REVIEWER_ROUTING: %w", err)
+		}
+		s.routes = routes
+	}
+	if value := os.Getenv("INPUT_AUTOFIX"); value != "" {
+		mode, err := parseAutofix(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_AUTOFIX: %w", err)
+		}
+		s.autofix = mode
+	}
+	if value := os.Getenv("INPUT_STALE_COMMENTS"); value != "" {
+		mode, err := parseStaleComments(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_STALE_COMMENTS: %w", err)
+		}
+		s.staleComments = mode
+	}
+	s.commentScope = os.Getenv("INPUT_COMMENT_SCOPE")
+	if s.commentScope == "" && os.Getenv("GITHUB_JOB") != "" {
+		s.commentScope = os.Getenv("GITHUB_WORKFLOW") + "/" + os.Getenv("GITHUB_JOB")
+	}
+	if value := os.Getenv("INPUT_COMMENT_MODE"); value != "" {
+		mode, err := parseCommentMode(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_COMMENT_MODE: %w", err)
+		}
+		s.commentMode = mode
+	}
+	if value := os.Getenv("INPUT_LICENSE_POLICY"); value != "" {
+		policy, err := loadLicensePolicy(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_LICENSE_POLICY: %w", err)
+		}
+		s.licensePolicy = policy
+	}
+	if value := os.Getenv("INPUT_SBOM_BASE"); value != "" {
+		deps, err := loadSBOM(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_SBOM_BASE: %w", err)
+		}
+		s.sbomBase = deps
+	}
+	if value := os.Getenv("INPUT_SBOM_HEAD"); value != "" {
+		deps, err := loadSBOM(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_SBOM_HEAD: %w", err)
+		}
+		s.sbomHead = deps
+	}
+	s.reportArtifact = strings.TrimSpace(os.Getenv("INPUT_REPORT_ARTIFACT"))
+	s.htmlReport = strings.TrimSpace(os.Getenv("INPUT_HTML_REPORT"))
+	s.riskWeights = report.DefaultRiskWeights
+	if value := os.Getenv("INPUT_RISK_WEIGHTS"); value != "" {
+		weights, err := parseRiskWeights(value)
+		if err != nil {
+			return s, fmt.Errorf("INPUT_RISK_WEIGHTS: %w", err)
+		}
+		s.riskWeights = weights
+	}
+	s.riskBadge = strings.TrimSpace(os.Getenv("INPUT_RISK_BADGE"))
+	s.ownerSections = strings.ToLower(os.Getenv("INPUT_OWNER_SECTIONS")) == "true"
+	s.helmCharts = parseHelmCharts(os.Getenv("INPUT_HELM_RENDERED"))
+	s.skipGenerated = strings.ToLower(os.Getenv("INPUT_SKIP_GENERATED")) != "false"
+	s.unifiedComments = strings.ToLower(os.Getenv("INPUT_UNIFIED_COMMENTS")) == "true"
+	s.summaryComment = strings.ToLower(os.Getenv("INPUT_SUMMARY_COMMENT")) == "true"
+	s.registryLookup = strings.ToLower(os.Getenv("INPUT_REGISTRY_LOOKUP")) == "true"
+	s.workingDirectories = parseWorkingDirectories(os.Getenv("INPUT_WORKING_DIRECTORY"))
+	return s, nil
+}
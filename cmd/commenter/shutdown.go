@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// exitCancelled is the exit code of a run stopped by SIGINT or SIGTERM, e.g. a cancelled job
+const exitCancelled = 130
+
+// shutdown is done once a shutdown signal arrives. No new comments are started and the requests
+// in flight are cancelled, the run then records what was posted, see flushContext.
+var shutdown = context.Background()
+
+func handleShutdownSignals() {
+	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	shutdown = ctx
+	go func() {
+		<-ctx.Done()
+		// the gate decision is logged once the progress is saved, see exitCancelledRun
+		logger.Info("Received a shutdown signal, cancelling the requests in flight and saving the progress")
+	}()
+}
+
+func cancelled() bool {
+	return shutdown.Err() != nil
+}
+
+// flushTimeout bounds the requests recording the progress of a run after a shutdown signal
+const flushTimeout = 5 * time.Second
+
+// flushContext is for the requests recording the progress of the run, such as submitting the
+// review of the comments queued so far. The shutdown doesn't cancel them, but once it arrived
+// they only get flushTimeout.
+func flushContext() (context.Context, context.CancelFunc) {
+	if cancelled() {
+		return context.WithTimeout(context.Background(), flushTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// shutdownTransport cancels the requests in flight on shutdown. The commenter library sends its
+// requests with a context that can't be cancelled, so any such request is tied to the shutdown
+// instead. A request with a context of its own, e.g. from flushContext, is left to it.
+type shutdownTransport struct {
+	base http.RoundTripper
+}
+
+func (t *shutdownTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Done() != nil {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(shutdown, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+	// the body is read after RoundTrip returns, the request is only done once it is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() {
+		stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// exitPartial is the exit code of a run that ran out of INPUT_MAX_RUNTIME before writing every
+// comment, telling it apart from a failing gate and from a cancelled job
+const exitPartial = 75
+
+// budget is done once the run has been going for the maximum runtime, or on shutdown. Like
+// on shutdown, the comment in flight finishes and no new ones are started.
+var (
+	budget     context.Context
+	stopBudget context.CancelFunc
+)
+
+// startRuntimeBudget starts the maximum runtime of the run, counted from its start
+func startRuntimeBudget(maxRuntime time.Duration) {
+	if maxRuntime <= 0 {
+		return
+	}
+	budget, stopBudget = context.WithDeadline(shutdown, stats.started.Add(maxRuntime))
+}
+
+// postingContext is done once no new comments may be started
+func postingContext() context.Context {
+	if budget != nil {
+		return budget
+	}
+	return shutdown
+}
+
+func outOfTime() bool {
+	return budget != nil && errors.Is(budget.Err(), context.DeadlineExceeded)
+}
+
+// sleepUnlessCancelled waits for the duration, returning early on shutdown
+func sleepUnlessCancelled(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdown.Done():
+	}
+}
+
+// exitCancelledRun records the progress of an interrupted run and exits
+func exitCancelledRun(errMessages []string) {
+	stats.errors = len(errMessages)
+	for _, err := range errMessages {
+		logger.Error(err, "event", eventError)
+	}
+	logger.Error("Run cancelled before all comments were written", "event", eventGateDecision, "decision", "cancelled", "reason", "signal")
+	logRunSummary("cancelled")
+	exit(exitCancelled)
+}
+
+// exitPartialRun ends a run out of time. The comments it didn't write are in the job summary
+// and the retry queue, for the next run to pick up.
+func exitPartialRun(errMessages []string, failingTargets []string) {
+	stopBudget()
+	stats.errors = len(errMessages)
+	for _, err := range errMessages {
+		logger.Error(err, "event", eventError)
+	}
+	logger.Error("Ran out of the maximum runtime before all comments were written", "event", eventGateDecision, "decision", "partial", "reason", "max_runtime", "targets", failingTargets)
+	logRunSummary("partial")
+	exit(exitPartial)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestProcessResultsCountsTheCommentsLeftByTheDeadline(t *testing.T) {
+	saved, savedStats := logger, stats
+	logger = newLogger(logFormatText, io.Discard)
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	budget, stopBudget = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	t.Cleanup(func() {
+		stopBudget()
+		budget, stopBudget = nil, nil
+		logger, stats = saved, savedStats
+	})
+
+	results := []report.Result{{
+		Target: "main.tf", Class: "config", Type: "terraform",
+		Misconfigurations: []report.Misconfiguration{{ID: "AVD-AWS-0086", Severity: "HIGH", CauseMetadata: report.CauseMetadata{StartLine: 3, EndLine: 5}}},
+	}}
+	tests := []struct {
+		name    string
+		results []report.Result
+		want    int
+	}{
+		{name: "comments left", results: results, want: 1},
+		{name: "nothing left", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats = runStats{filtered: make(map[string]int), started: time.Now()}
+			p := &recordingProvider{}
+
+			processResults(p, singleTarget(tt.results, defaultSettings)[0])
+
+			if !outOfTime() || stats.timedOut != tt.want || len(p.written) != 0 {
+				t.Errorf("out of time %t with %d comments left and %d written, want %d left", outOfTime(), stats.timedOut, len(p.written), tt.want)
+			}
+		})
+	}
+}
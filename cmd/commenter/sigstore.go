@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the public good Sigstore instance, its certificate authority and transparency log
+var (
+	fulcioURL = "https://fulcio.sigstore.dev"
+	rekorURL  = "https://rekor.sigstore.dev"
+)
+
+const (
+	inTotoPayloadType = "application/vnd.in-toto+json"
+	sigstoreBundle    = "application/vnd.dev.sigstore.bundle.v0.3+json"
+)
+
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	Sig   string `json:"sig"`
+	KeyID string `json:"keyid"`
+}
+
+// signStatement signs the in-toto statement keyless: an ephemeral key gets a certificate for the
+// workflow's OIDC identity from Fulcio, signs the statement as a DSSE envelope, and the
+// signature is logged in Rekor. The Sigstore bundle returned verifies with
+// cosign verify-blob-attestation. The job needs the id-token: write permission.
+func signStatement(statement []byte) ([]byte, error) {
+	client := &http.Client{Transport: apiTransport, Timeout: 30 * time.Second}
+	token, err := workflowIDToken(client)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := signingCertificate(client, key, token)
+	if err != nil {
+		return nil, err
+	}
+
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(inTotoPayloadType), inTotoPayloadType, len(statement), statement)
+	digest := sha256.Sum256([]byte(pae))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	envelope := dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []dsseSignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}
+	entry, err := logEnvelope(client, envelope, chain[0])
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, _ := pem.Decode([]byte(chain[0]))
+	if leaf == nil {
+		return nil, errors.New("Fulcio returned a certificate that isn't PEM")
+	}
+	return json.MarshalIndent(map[string]any{
+		"mediaType": sigstoreBundle,
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(leaf.Bytes)},
+			"tlogEntries": []any{entry},
+		},
+		"dsseEnvelope": envelope,
+	}, "", "  ")
+}
+
+// workflowIDToken requests an OIDC token of the workflow run for Sigstore
+func workflowIDToken(client *http.Client) (string, error) {
+	url, token := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if url == "" || token == "" {
+		return "", errors.New("no OIDC token can be requested, the job needs the id-token: write permission")
+	}
+	req, err := http.NewRequest(http.MethodGet, url+"&audience=sigstore", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var response struct {
+		Value string `json:"value"`
+	}
+	if err := sigstoreCall(client, req, &response); err != nil {
+		return "", fmt.Errorf("failed to request the OIDC token: %w", err)
+	}
+	return response.Value, nil
+}
+
+// signingCertificate requests a short-lived certificate of the key for the token's identity,
+// returning the PEM chain with the key's certificate first
+func signingCertificate(client *http.Client, key *ecdsa.PrivateKey, token string) ([]string, error) {
+	subject, err := tokenSubject(token)
+	if err != nil {
+		return nil, err
+	}
+	// proof the key is ours, a signature of the token's subject
+	digest := sha256.Sum256([]byte(subject))
+	proof, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]any{
+		"credentials": map[string]string{"oidcIdentityToken": token},
+		"publicKeyRequest": map[string]any{
+			"publicKey":         map[string]string{"algorithm": "ECDSA", "content": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+			"proofOfPossession": base64.StdEncoding.EncodeToString(proof),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fulcioURL+"/api/v2/signingCert", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	type chain struct {
+		Chain struct {
+			Certificates []string `json:"certificates"`
+		} `json:"chain"`
+	}
+	var response struct {
+		Embedded *chain `json:"signedCertificateEmbeddedSct"`
+		Detached *chain `json:"signedCertificateDetachedSct"`
+	}
+	if err := sigstoreCall(client, req, &response); err != nil {
+		return nil, fmt.Errorf("Fulcio didn't issue a certificate: %w", err)
+	}
+	for _, c := range []*chain{response.Embedded, response.Detached} {
+		if c != nil && len(c.Chain.Certificates) > 0 {
+			return c.Chain.Certificates, nil
+		}
+	}
+	return nil, errors.New("Fulcio returned no certificate")
+}
+
+func tokenSubject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("the OIDC token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("the OIDC token can't be decoded: %w", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return "", errors.New("the OIDC token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// logEnvelope adds the signed envelope to the transparency log, returning the entry as the
+// bundle lists it
+func logEnvelope(client *http.Client, envelope dsseEnvelope, certificate string) (map[string]any, error) {
+	signed, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]any{
+			"proposedContent": map[string]any{
+				"envelope":  string(signed),
+				"verifiers": []string{base64.StdEncoding.EncodeToString([]byte(certificate))},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, rekorURL+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var entries map[string]struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+		Verification   struct {
+			SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+			InclusionProof       *struct {
+				Checkpoint string   `json:"checkpoint"`
+				Hashes     []string `json:"hashes"`
+				LogIndex   int64    `json:"logIndex"`
+				RootHash   string   `json:"rootHash"`
+				TreeSize   int64    `json:"treeSize"`
+			} `json:"inclusionProof"`
+		} `json:"verification"`
+	}
+	if err := sigstoreCall(client, req, &entries); err != nil {
+		return nil, fmt.Errorf("Rekor didn't log the attestation: %w", err)
+	}
+	for _, e := range entries {
+		logID, err := hex.DecodeString(e.LogID)
+		if err != nil {
+			return nil, fmt.Errorf("Rekor returned an invalid log ID: %w", err)
+		}
+		entry := map[string]any{
+			"logIndex":          strconv.FormatInt(e.LogIndex, 10),
+			"logId":             map[string]string{"keyId": base64.StdEncoding.EncodeToString(logID)},
+			"kindVersion":       map[string]string{"kind": "dsse", "version": "0.0.1"},
+			"integratedTime":    strconv.FormatInt(e.IntegratedTime, 10),
+			"inclusionPromise":  map[string]string{"signedEntryTimestamp": e.Verification.SignedEntryTimestamp},
+			"canonicalizedBody": e.Body,
+		}
+		if p := e.Verification.InclusionProof; p != nil {
+			hashes := make([]string, 0, len(p.Hashes))
+			for _, h := range p.Hashes {
+				b, err := hex.DecodeString(h)
+				if err != nil {
+					return nil, fmt.Errorf("Rekor returned an invalid inclusion proof: %w", err)
+				}
+				hashes = append(hashes, base64.StdEncoding.EncodeToString(b))
+			}
+			root, err := hex.DecodeString(p.RootHash)
+			if err != nil {
+				return nil, fmt.Errorf("Rekor returned an invalid inclusion proof: %w", err)
+			}
+			entry["inclusionProof"] = map[string]any{
+				"logIndex":   strconv.FormatInt(p.LogIndex, 10),
+				"rootHash":   base64.StdEncoding.EncodeToString(root),
+				"treeSize":   strconv.FormatInt(p.TreeSize, 10),
+				"hashes":     hashes,
+				"checkpoint": map[string]string{"envelope": p.Checkpoint},
+			}
+		}
+		return entry, nil
+	}
+	return nil, errors.New("Rekor returned no entry")
+}
+
+func sigstoreCall(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
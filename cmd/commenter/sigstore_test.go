@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sigstoreSubject = "repo:org/repo:ref:refs/heads/main"
+
+// fakeSigstore is a Fulcio issuing certificates of its own CA, a Rekor logging the envelopes it
+// verifies, and the OIDC token endpoint of Actions
+type fakeSigstore struct {
+	caKey  *ecdsa.PrivateKey
+	ca     *x509.Certificate
+	leaf   []byte
+	logged dsseEnvelope
+	// the status Fulcio answers with, 0 issuing the certificate
+	fulcioStatus int
+}
+
+func newFakeSigstore(t *testing.T) *fakeSigstore {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigstore"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSigstore{caKey: caKey, ca: ca}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /token", s.token)
+	mux.HandleFunc("POST /api/v2/signingCert", s.signingCert)
+	mux.HandleFunc("POST /api/v1/log/entries", s.logEntry)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	savedFulcio, savedRekor := fulcioURL, rekorURL
+	fulcioURL, rekorURL = server.URL, server.URL
+	t.Cleanup(func() { fulcioURL, rekorURL = savedFulcio, savedRekor })
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", server.URL+"/token?api-version=2.0")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+	return s
+}
+
+func (s *fakeSigstore) token(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer request-token" || r.URL.Query().Get("audience") != "sigstore" {
+		http.Error(w, "bad token request", http.StatusUnauthorized)
+		return
+	}
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sigstoreSubject + `"}`))
+	_ = json.NewEncoder(w).Encode(map[string]string{"value": "eyJhbGciOiJSUzI1NiJ9." + claims + ".c2ln"})
+}
+
+func (s *fakeSigstore) signingCert(w http.ResponseWriter, r *http.Request) {
+	if s.fulcioStatus != 0 {
+		http.Error(w, `{"message":"invalid identity token"}`, s.fulcioStatus)
+		return
+	}
+	var request struct {
+		Credentials struct {
+			OIDCIdentityToken string `json:"oidcIdentityToken"`
+		} `json:"credentials"`
+		PublicKeyRequest struct {
+			PublicKey struct {
+				Algorithm string `json:"algorithm"`
+				Content   string `json:"content"`
+			} `json:"publicKey"`
+			ProofOfPossession string `json:"proofOfPossession"`
+		} `json:"publicKeyRequest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if subject, err := tokenSubject(request.Credentials.OIDCIdentityToken); err != nil || subject != sigstoreSubject {
+		http.Error(w, "not the workflow's token", http.StatusUnauthorized)
+		return
+	}
+	block, _ := pem.Decode([]byte(request.PublicKeyRequest.PublicKey.Content))
+	if request.PublicKeyRequest.PublicKey.Algorithm != "ECDSA" || block == nil || block.Type != "PUBLIC KEY" {
+		http.Error(w, "the public key isn't a PEM ECDSA key", http.StatusBadRequest)
+		return
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	proof, _ := base64.StdEncoding.DecodeString(request.PublicKeyRequest.ProofOfPossession)
+	digest := sha256.Sum256([]byte(sigstoreSubject))
+	if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], proof) {
+		http.Error(w, "the proof of possession doesn't verify", http.StatusBadRequest)
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	s.leaf, err = x509.CreateCertificate(rand.Reader, template, s.ca, key, s.caKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chain := []string{
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.leaf})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw})),
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"signedCertificateEmbeddedSct": map[string]any{"chain": map[string]any{"certificates": chain}}})
+}
+
+func (s *fakeSigstore) logEntry(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Spec       struct {
+			ProposedContent struct {
+				Envelope  string   `json:"envelope"`
+				Verifiers []string `json:"verifiers"`
+			} `json:"proposedContent"`
+		} `json:"spec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Kind != "dsse" || request.APIVersion != "0.0.1" || len(request.Spec.ProposedContent.Verifiers) != 1 {
+		http.Error(w, "not a dsse entry", http.StatusBadRequest)
+		return
+	}
+	verifier, _ := base64.StdEncoding.DecodeString(request.Spec.ProposedContent.Verifiers[0])
+	block, _ := pem.Decode(verifier)
+	if block == nil || string(block.Bytes) != string(s.leaf) {
+		http.Error(w, "the verifier isn't the issued certificate", http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal([]byte(request.Spec.ProposedContent.Envelope), &s.logged); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := verifyEnvelope(s.logged, s.leaf); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"24296fb24b8ad77a": map[string]any{
+		"body":           base64.StdEncoding.EncodeToString([]byte(`{"kind":"dsse"}`)),
+		"integratedTime": 1760400000,
+		"logID":          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+		"logIndex":       42,
+		"verification": map[string]any{
+			"signedEntryTimestamp": "MEUCIQ==",
+			"inclusionProof": map[string]any{
+				"checkpoint": "rekor.sigstore.dev - 1193050959916656506\n43\n", "hashes": []string{"aa", "bb"},
+				"logIndex": 42, "rootHash": "cc", "treeSize": 43,
+			},
+		},
+	}})
+}
+
+// verifyEnvelope checks the DSSE signature of the envelope with the certificate's key
+func verifyEnvelope(envelope dsseEnvelope, certificate []byte) error {
+	cert, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return err
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return err
+	}
+	if len(envelope.Signatures) != 1 {
+		return fmt.Errorf("the envelope has %d signatures", len(envelope.Signatures))
+	}
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	if err != nil {
+		return err
+	}
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(envelope.PayloadType), envelope.PayloadType, len(payload), payload)
+	digest := sha256.Sum256([]byte(pae))
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+		return fmt.Errorf("the envelope's signature doesn't verify")
+	}
+	return nil
+}
+
+func TestSignStatement(t *testing.T) {
+	s := newFakeSigstore(t)
+	statement := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+
+	out, err := signStatement(statement)
+	if err != nil {
+		t.Fatalf("signStatement: %v", err)
+	}
+
+	var bundle struct {
+		MediaType            string `json:"mediaType"`
+		VerificationMaterial struct {
+			Certificate struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificate"`
+			TlogEntries []struct {
+				LogIndex string `json:"logIndex"`
+				LogID    struct {
+					KeyID string `json:"keyId"`
+				} `json:"logId"`
+				KindVersion       map[string]string `json:"kindVersion"`
+				IntegratedTime    string            `json:"integratedTime"`
+				InclusionPromise  map[string]string `json:"inclusionPromise"`
+				CanonicalizedBody string            `json:"canonicalizedBody"`
+				InclusionProof    struct {
+					LogIndex   string            `json:"logIndex"`
+					RootHash   string            `json:"rootHash"`
+					TreeSize   string            `json:"treeSize"`
+					Hashes     []string          `json:"hashes"`
+					Checkpoint map[string]string `json:"checkpoint"`
+				} `json:"inclusionProof"`
+			} `json:"tlogEntries"`
+		} `json:"verificationMaterial"`
+		DSSEEnvelope dsseEnvelope `json:"dsseEnvelope"`
+	}
+	if err := json.Unmarshal(out, &bundle); err != nil {
+		t.Fatalf("the bundle isn't JSON: %v", err)
+	}
+
+	if bundle.MediaType != sigstoreBundle {
+		t.Errorf("got the media type %q, want %q", bundle.MediaType, sigstoreBundle)
+	}
+	if got := bundle.VerificationMaterial.Certificate.RawBytes; got != base64.StdEncoding.EncodeToString(s.leaf) {
+		t.Error("the bundle doesn't have the certificate Fulcio issued")
+	}
+	if got, _ := base64.StdEncoding.DecodeString(bundle.DSSEEnvelope.Payload); string(got) != string(statement) || bundle.DSSEEnvelope.PayloadType != inTotoPayloadType {
+		t.Errorf("the envelope has the %s payload %q, want the statement", bundle.DSSEEnvelope.PayloadType, got)
+	}
+	if err := verifyEnvelope(bundle.DSSEEnvelope, s.leaf); err != nil {
+		t.Errorf("the bundle's envelope: %v", err)
+	}
+	if bundle.DSSEEnvelope.Signatures[0] != s.logged.Signatures[0] {
+		t.Error("the bundle's signature isn't the one logged in Rekor")
+	}
+
+	if len(bundle.VerificationMaterial.TlogEntries) != 1 {
+		t.Fatalf("the bundle has %d log entries, want 1", len(bundle.VerificationMaterial.TlogEntries))
+	}
+	entry := bundle.VerificationMaterial.TlogEntries[0]
+	logID, _ := hex.DecodeString("c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d")
+	for name, got := range map[string][2]string{
+		"log index":          {entry.LogIndex, "42"},
+		"log ID":             {entry.LogID.KeyID, base64.StdEncoding.EncodeToString(logID)},
+		"kind":               {entry.KindVersion["kind"] + "/" + entry.KindVersion["version"], "dsse/0.0.1"},
+		"integrated time":    {entry.IntegratedTime, "1760400000"},
+		"signed timestamp":   {entry.InclusionPromise["signedEntryTimestamp"], "MEUCIQ=="},
+		"body":               {entry.CanonicalizedBody, base64.StdEncoding.EncodeToString([]byte(`{"kind":"dsse"}`))},
+		"proof's log index":  {entry.InclusionProof.LogIndex, "42"},
+		"proof's tree size":  {entry.InclusionProof.TreeSize, "43"},
+		"proof's root hash":  {entry.InclusionProof.RootHash, base64.StdEncoding.EncodeToString([]byte{0xcc})},
+		"proof's hashes":     {strings.Join(entry.InclusionProof.Hashes, ","), "qg==,uw=="},
+		"proof's checkpoint": {entry.InclusionProof.Checkpoint["envelope"], "rekor.sigstore.dev - 1193050959916656506\n43\n"},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("got the %s %q, want %q", name, got[0], got[1])
+		}
+	}
+}
+
+func TestSignStatementFailures(t *testing.T) {
+	statement := []byte(`{}`)
+
+	t.Run("without the id-token permission", func(t *testing.T) {
+		newFakeSigstore(t)
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "")
+		if _, err := signStatement(statement); err == nil || !strings.Contains(err.Error(), "id-token: write") {
+			t.Errorf("got the error %v, want the permission to be named", err)
+		}
+	})
+
+	t.Run("without a certificate", func(t *testing.T) {
+		s := newFakeSigstore(t)
+		s.fulcioStatus = http.StatusUnauthorized
+		if _, err := signStatement(statement); err == nil || !strings.Contains(err.Error(), "Fulcio didn't issue a certificate: 401") {
+			t.Errorf("got the error %v, want Fulcio's", err)
+		}
+	})
+}
+
+func TestTokenSubject(t *testing.T) {
+	claims := func(json string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(json)) + ".c2ln"
+	}
+	if got, err := tokenSubject(claims(`{"sub":"repo:org/repo"}`)); err != nil || got != "repo:org/repo" {
+		t.Errorf("tokenSubject = %q, %v, want the subject", got, err)
+	}
+	for name, token := range map[string]string{
+		"not a JWT":       "token",
+		"not base64":      "e30.!!.c2ln",
+		"without subject": claims(`{"iss":"https://token.actions.githubusercontent.com"}`),
+	} {
+		if _, err := tokenSubject(token); err == nil {
+			t.Errorf("got the subject of a token %s", name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// sourceMapFile lists the rules mapping built templates back onto their sources, e.g.
+//
+//	sources:
+//	  - target: 'packaged\.yaml'
+//	    source: template.yaml
+//	  - target: 'build/(.*)\.json'
+//	    source: 'infra/$1.bicep'
+//	    lines: resource
+type sourceMapFile struct {
+	Sources []sourceMapEntry `yaml:"sources"`
+}
+
+type sourceMapEntry struct {
+	Target string `yaml:"target"`
+	Source string `yaml:"source"`
+	// Lines is same, keeping the lines of the build, or resource, finding the resource in the source
+	Lines string `yaml:"lines"`
+}
+
+func loadSourceMap(path string) ([]report.SourceRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file sourceMapFile
+	if err := yaml.Unmarshal([]byte(commenter.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("%s is not valid: %w", path, err)
+	}
+	rules := make([]report.SourceRule, 0, len(file.Sources))
+	for i, entry := range file.Sources {
+		if entry.Target == "" || entry.Source == "" {
+			return nil, fmt.Errorf("source %d of %s needs a target and a source", i+1, path)
+		}
+		target, err := regexp.Compile("^(?:" + entry.Target + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("target %q of %s is not a valid regular expression: %w", entry.Target, path, err)
+		}
+		if entry.Lines != "" && entry.Lines != "same" && entry.Lines != "resource" {
+			return nil, fmt.Errorf("lines of target %q of %s must be same or resource, not %q", entry.Target, path, entry.Lines)
+		}
+		rules = append(rules, report.SourceRule{Target: target, Source: entry.Source, ByResource: entry.Lines == "resource"})
+	}
+	return rules, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/google/go-github/v32/github"
+)
+
+// What happens to the comments of findings no longer in the report: their review threads are
+// resolved, or the comments deleted
+const (
+	staleResolve = "resolve"
+	staleDelete  = "delete"
+)
+
+func parseStaleComments(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", staleResolve, staleDelete:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown stale comments mode %q, expected %s or %s", value, staleResolve, staleDelete)
+}
+
+// cleansStaleComments reports whether the comments of fixed findings are cleaned up, when a
+// report without findings still has to be commented on
+func cleansStaleComments() bool {
+	return os.Getenv("INPUT_STALE_COMMENTS") != ""
+}
+
+// targetScope is the scope the comments of the target are written with, the run's with the
+// target's name, so a job or a target only cleans up the stale comments it wrote
+func targetScope(t reportTarget) string {
+	if t.name == "" {
+		return t.cfg.commentScope
+	}
+	return t.cfg.commentScope + "/" + t.name
+}
+
+// reportedFingerprints are the fingerprints of every finding of the reports, whatever its
+// severity, so a comment is only stale once its finding is fixed
+func reportedFingerprints(targets []reportTarget) *commenter.Index {
+	fingerprints := commenter.NewIndex()
+	for _, t := range targets {
+		for _, f := range t.findings {
+			fingerprints.Add(commenter.StableFingerprint(f))
+		}
+	}
+	return fingerprints
+}
+
+// cleanUpStaleComments resolves the review threads, or deletes the comments, of the earlier
+// comments whose finding is no longer in the reports. Only the comments of the token's user
+// with a fingerprint of one of the targets' scopes are looked at, those of other jobs and
+// users are left alone. Comments written before the scopes were cleaned up by any job, a
+// comment without a scope still is.
+func cleanUpStaleComments(client *github.Client, owner, repo string, prNo int, targets []reportTarget, mode string) []string {
+	fingerprints := reportedFingerprints(targets)
+	scopes := make(map[string]bool)
+	for _, t := range targets {
+		scopes[targetScope(t)] = true
+	}
+	login := tokenLogin(shutdown, client)
+	stale := func(author, body string) bool {
+		fp := commenter.WrittenFingerprint(body)
+		if fp == "" || fingerprints.Has(fp) || !sameLogin(author, login) {
+			return false
+		}
+		scope := commenter.WrittenScope(body)
+		return scope == "" || scopes[scope]
+	}
+	if mode == staleDelete {
+		return deleteStaleComments(client, owner, repo, prNo, stale)
+	}
+	return resolveStaleThreads(client, owner, repo, prNo, stale)
+}
+
+// sameLogin reports whether the logins are of the same user. GraphQL names a bot without
+// the [bot] suffix the REST API gives it.
+func sameLogin(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "[bot]"), strings.TrimSuffix(b, "[bot]"))
+}
+
+func deleteStaleComments(client *github.Client, owner, repo string, prNo int, stale func(author, body string) bool) []string {
+	ctx := shutdown
+	var ids []int64
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, prNo, opts)
+		if err != nil {
+			return []string{fmt.Sprintf("failed to list the comments to delete the stale ones. %s", err.Error())}
+		}
+		for _, c := range comments {
+			if stale(c.GetUser().GetLogin(), c.GetBody()) {
+				ids = append(ids, c.GetID())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	var errMessages []string
+	deleted := 0
+	for _, id := range ids {
+		if _, err := client.PullRequests.DeleteComment(ctx, owner, repo, id); err != nil {
+			errMessages = append(errMessages, fmt.Sprintf("failed to delete the stale comment %d. %s", id, err.Error()))
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		logger.Info(fmt.Sprintf("Deleted %d comments of fixed findings", deleted), "deleted", deleted)
+	}
+	return errMessages
+}
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { id isResolved comments(first: 1) { nodes { body author { login } } } }
+      }
+    }
+  }
+}`
+
+type reviewThreadsData struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []struct {
+					ID         string `json:"id"`
+					IsResolved bool   `json:"isResolved"`
+					Comments   struct {
+						Nodes []struct {
+							Body   string `json:"body"`
+							Author struct {
+								Login string `json:"login"`
+							} `json:"author"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"nodes"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+// resolveStaleThreads resolves the open review threads started by a stale comment. The REST
+// API has no notion of threads, they are listed and resolved through GraphQL.
+func resolveStaleThreads(client *github.Client, owner, repo string, prNo int, stale func(author, body string) bool) []string {
+	var mutations []graphQLMutation
+	variables := map[string]any{"owner": owner, "repo": repo, "number": prNo}
+	for {
+		var data reviewThreadsData
+		if err := runQuery(client, reviewThreadsQuery, variables, &data); err != nil {
+			return []string{fmt.Sprintf("failed to list the review threads to resolve the stale ones. %s", err.Error())}
+		}
+		threads := data.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if !thread.IsResolved && len(thread.Comments.Nodes) > 0 && stale(thread.Comments.Nodes[0].Author.Login, thread.Comments.Nodes[0].Body) {
+				mutations = append(mutations, resolveThreadMutation(thread.ID))
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = threads.PageInfo.EndCursor
+	}
+
+	var errMessages []string
+	for _, err := range runMutations(client, mutations) {
+		errMessages = append(errMessages, fmt.Sprintf("failed to resolve a stale review thread. %s", err.Error()))
+	}
+	if resolved := len(mutations) - len(errMessages); resolved > 0 {
+		logger.Info(fmt.Sprintf("Resolved %d review threads of fixed findings", resolved), "resolved", resolved)
+	}
+	return errMessages
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestCleanUpStaleComments(t *testing.T) {
+	reported := report.Finding{ID: "AVD-AWS-0086", Target: "main.tf", StartLine: 3, EndLine: 5}
+	fixed := report.Finding{ID: "AVD-AWS-0087", Target: "main.tf", StartLine: 7, EndLine: 7}
+	marker := func(f report.Finding, scope string) string {
+		if scope == "" {
+			return "\n\n<!-- trivy-fingerprint " + commenter.StableFingerprint(f) + " -->"
+		}
+		return "\n\n<!-- trivy-fingerprint " + commenter.StableFingerprint(f) + " scope=" + url.PathEscape(scope) + " -->"
+	}
+	comments := []struct {
+		login string
+		body  string
+	}{
+		{login: "github-actions[bot]", body: "fixed" + marker(fixed, "ci/scan")},
+		{login: "github-actions[bot]", body: "before scopes" + marker(fixed, "")},
+		{login: "github-actions[bot]", body: "named target" + marker(fixed, "ci/scan/network")},
+		{login: "github-actions[bot]", body: "still reported" + marker(reported, "ci/scan")},
+		{login: "github-actions[bot]", body: "another job" + marker(fixed, "ci/other")},
+		{login: "reviewer", body: "quoting the marker" + marker(fixed, "ci/scan")},
+		{login: "github-actions[bot]", body: "without a fingerprint"},
+	}
+	cfg := defaultSettings
+	cfg.commentScope = "ci/scan"
+	targets := []reportTarget{
+		{cfg: cfg, findings: []report.Finding{reported}},
+		{name: "network", cfg: cfg},
+	}
+	want := []string{"before scopes", "fixed", "named target"}
+
+	for _, mode := range []string{staleResolve, staleDelete} {
+		t.Run(mode, func(t *testing.T) {
+			gh, client := newFakeClient(t)
+			ids := make(map[int64]string)
+			for i, c := range comments {
+				added := gh.AddComment(1, c.login, "main.tf", i+1, c.body)
+				ids[added.GetID()] = strings.SplitN(c.body, "\n", 2)[0]
+			}
+
+			if errs := cleanUpStaleComments(client, "org", "repo", 1, targets, mode); len(errs) != 0 {
+				t.Fatalf("cleanUpStaleComments: %v", errs)
+			}
+
+			remaining := make(map[int64]bool)
+			for _, c := range gh.Comments() {
+				remaining[c.GetID()] = true
+			}
+			var cleaned []string
+			for id, name := range ids {
+				if mode == staleResolve && gh.Resolved(id) || mode == staleDelete && !remaining[id] {
+					cleaned = append(cleaned, name)
+				}
+			}
+			sort.Strings(cleaned)
+			if strings.Join(cleaned, ", ") != strings.Join(want, ", ") {
+				t.Errorf("cleaned up %q, want %q", cleaned, want)
+			}
+		})
+	}
+}
+
+func TestParseStaleComments(t *testing.T) {
+	for value, want := range map[string]string{"": "", "Resolve": staleResolve, " delete ": staleDelete} {
+		if got, err := parseStaleComments(value); err != nil || got != want {
+			t.Errorf("parseStaleComments(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseStaleComments("hide"); err == nil {
+		t.Error("parsed an unknown mode")
+	}
+}
+
+func TestSameLogin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "github-actions[bot]", b: "github-actions", want: true},
+		{a: "Trivy-Bot", b: "trivy-bot", want: true},
+		{a: "github-actions[bot]", b: "reviewer"},
+	}
+	for _, tt := range tests {
+		if got := sameLogin(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameLogin(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runStats counts what happened to the findings of a comment run
+type runStats struct {
+	posted  int
+	skipped int
+	errors  int
+
+	// API usage, counted by the rateLimitTransport
+	apiCalls    int
+	notModified int
+	retries     int
+	created     int
+	updated     int
+	deleted     int
+	annotations int
+
+	// the risk score of the findings commented on, see recordRiskScore
+	riskScore int
+
+	// comments not started because the run ran out of its maximum runtime, see exitPartialRun
+	timedOut int
+
+	// findings left out by each filter
+	filtered map[string]int
+	started  time.Time
+}
+
+var stats = runStats{filtered: make(map[string]int), started: time.Now()}
+
+// statsMu guards the API usage counters, which are updated from concurrent requests
+var statsMu sync.Mutex
+
+type metric struct {
+	name  string
+	value any
+}
+
+// metrics are the run statistics in the order they are logged and written as step outputs
+func (s runStats) metrics(gate string) []metric {
+	metrics := []metric{
+		{"posted", s.posted},
+		{"skipped", s.skipped},
+		{"errors", s.errors},
+		{"gate", gate},
+		{"api_calls", s.apiCalls},
+		{"api_not_modified", s.notModified},
+		{"retries", s.retries},
+		{"comments_created", s.created},
+		{"comments_updated", s.updated},
+		{"comments_deleted", s.deleted},
+		{"annotations", s.annotations},
+		{"risk_score", s.riskScore},
+	}
+	filters := make([]string, 0, len(s.filtered))
+	for name := range s.filtered {
+		filters = append(filters, name)
+	}
+	sort.Strings(filters)
+	for _, name := range filters {
+		metrics = append(metrics, metric{"filtered_" + name, s.filtered[name]})
+	}
+	return append(metrics, metric{"duration_seconds", math.Round(time.Since(s.started).Seconds()*10) / 10})
+}
+
+func logRunSummary(gate string) {
+	metrics := stats.metrics(gate)
+	fields := make([]string, 0, len(metrics))
+	attrs := []any{"event", eventRunSummary}
+	for _, m := range metrics {
+		fields = append(fields, fmt.Sprintf("%s=%v", m.name, m.value))
+		attrs = append(attrs, m.name, m.value)
+	}
+	logger.Info(strings.Join(fields, " "), attrs...)
+
+	if output := os.Getenv("GITHUB_OUTPUT"); output != "" {
+		var sb strings.Builder
+		for _, m := range metrics {
+			fmt.Fprintf(&sb, "%s=%v\n", m.name, m.value)
+		}
+		if err := appendToFile(output, sb.String()); err != nil {
+			logger.Error(fmt.Sprintf("failed to write the step outputs. %s", err.Error()))
+		}
+	}
+	writeAttestation(gate)
+}
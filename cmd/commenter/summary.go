@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+)
+
+// runSummary renders a markdown summary of the report, appending it to the job summary when running in Actions
+func runSummary(args []string) {
+	flags := flag.NewFlagSet("summary", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	formatterName := flags.String("formatter", os.Getenv("INPUT_FORMATTER"), "formatter rendering the summary, a registered name or exec:<command>")
+	_ = flags.Parse(args)
+	setupLogger(*logFormat, os.Stderr)
+
+	formatter, err := commenter.LookupFormatter(*formatterName)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	results, err := loadReport(reportFileArg(flags))
+	if err != nil {
+		fail(fmt.Sprintf("failed to load results. %s", err.Error()))
+	}
+
+	cfg, err := loadSettings()
+	if err != nil {
+		fail(err.Error())
+	}
+	target := newReportTarget("", nil, cfg, results)
+	findings := target.findings
+	summary, err := formatter.Summary(findings)
+	if err != nil {
+		fail(fmt.Sprintf("failed to render the summary. %s", err.Error()))
+	}
+	summary += dependencyChanges(results, findings, cfg)
+	summary += riskSummary(findings, cfg)
+	summary += ownerSections([]reportTarget{target})
+	summary += reportArtifactLink(results, cfg)
+	fmt.Print(summary)
+	writeRiskBadge(riskScore(commenter.Dedupe(findings), cfg), cfg)
+
+	if stepSummary := os.Getenv("GITHUB_STEP_SUMMARY"); stepSummary != "" {
+		if err := appendToFile(stepSummary, summary); err != nil {
+			fail(fmt.Sprintf("failed to write the job summary. %s", err.Error()))
+		}
+		logger.Info("Summary added to the job summary")
+	}
+}
+
+func appendToFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/google/go-github/v32/github"
+)
+
+const (
+	// commentModeInline comments on the lines of each file, the default
+	commentModeInline = "inline"
+	// commentModeReview comments on the lines of each file in a single review of the PR
+	commentModeReview = "review"
+	// commentModeSummary writes a single comment on the PR listing every finding
+	commentModeSummary = "summary"
+)
+
+const truncatedSummaryComment = "\n\n_The summary was truncated, see the job summary or the report for every finding._\n"
+
+func parseCommentMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case commentModeInline, commentModeReview, commentModeSummary:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown comment mode %q, expected %s, %s or %s", value, commentModeInline, commentModeReview, commentModeSummary)
+}
+
+// summaryCommentMarker ends the summary comment, so a later run finds it to update. A run with
+// a comment scope has it in the marker, see summaryMarker.
+const summaryCommentMarker = "<!-- trivy-pr-commenter summary -->"
+
+var summaryMarkerPattern = regexp.MustCompile(`<!-- trivy-pr-commenter summary(?: scope=(\S+))? -->`)
+
+// summaryMarker is the marker of the summary comment written by the scope, so the shards of a
+// matrix each update their own
+func summaryMarker(scope string) string {
+	if scope == "" {
+		return summaryCommentMarker
+	}
+	return fmt.Sprintf("<!-- trivy-pr-commenter summary scope=%s -->", url.PathEscape(scope))
+}
+
+// summaryScope is the scope of the summary marker in the body, false when it has none
+func summaryScope(body string) (string, bool) {
+	m := summaryMarkerPattern.FindStringSubmatch(body)
+	if m == nil {
+		return "", false
+	}
+	scope, err := url.PathUnescape(m[1])
+	return scope, err == nil
+}
+
+// postSummaryComment writes the findings of every target as a single comment on the PR, the
+// summary's table of their files, lines, rules and severities, instead of a comment on the
+// lines of each file. It returns the errors and the failing targets like processTargets.
+func postSummaryComment(client *github.Client, owner, repo string, prNo int, targets []reportTarget, formatter commenter.Formatter, scope string) ([]string, []string) {
+	findings := annotationFindings(targets)
+	body, err := summaryCommentBody(targets, findings, formatter, scope)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	for _, t := range targets {
+		for _, a := range annotationFindings([]reportTarget{t}) {
+			routedReviewers.add(commenter.Reviewers(t.cfg.routes, a.finding, a.path))
+		}
+	}
+
+	written, err := writeSummaryComment(client, owner, repo, prNo, body)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	if written {
+		stats.posted++
+	}
+	return nil, gateFailingTargets(targets)
+}
+
+// summaryCommentBody renders the summary comment, ending with the marker of the scope
+func summaryCommentBody(targets []reportTarget, findings []annotatedFinding, formatter commenter.Formatter, scope string) (string, error) {
+	marker := summaryMarker(scope)
+	body, err := targetsSummary(targets, findings, formatter, commenter.MaxCommentLength-len(marker)-1, truncatedSummaryComment)
+	if err != nil {
+		return "", err
+	}
+	return body + "\n" + marker, nil
+}
+
+// writeSummaryComment updates the summary comment of an earlier run in place, so the PR has
+// one however often it's pushed to, and writes it when there is none yet. An unchanged
+// summary isn't written again, false is returned then. The comments written before a shutdown
+// are still summarized.
+func writeSummaryComment(client *github.Client, owner, repo string, prNo int, body string) (bool, error) {
+	ctx, cancel := flushContext()
+	defer cancel()
+	scope, _ := summaryScope(body)
+	existing, err := findSummaryComment(ctx, client, owner, repo, prNo, scope)
+	if err != nil {
+		// a duplicate summary is better than none
+		logger.Warn(fmt.Sprintf("Writing a new summary comment, the earlier one can't be looked for. %s", err.Error()))
+	}
+	switch {
+	case existing != nil && existing.GetBody() == body:
+		logger.Info(fmt.Sprintf("The summary comment %s is up to date", existing.GetHTMLURL()), "comment", existing.GetID())
+		return false, nil
+	case existing != nil:
+		comment, _, err := client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+		if err == nil {
+			logger.Info(fmt.Sprintf("Updated the summary comment %s", comment.GetHTMLURL()), "comment", comment.GetID())
+			return true, nil
+		}
+		// e.g. deleted since it was listed, the PR still gets its summary
+		logger.Warn(fmt.Sprintf("Writing a new summary comment, the summary comment %d can't be updated. %s", existing.GetID(), err.Error()))
+	}
+	comment, _, err := client.Issues.CreateComment(ctx, owner, repo, prNo, &github.IssueComment{Body: &body})
+	if err != nil {
+		return false, fmt.Errorf("failed to write the summary comment, the token needs the pull-requests: write permission (%s)", err.Error())
+	}
+	logger.Info(fmt.Sprintf("Wrote the summary comment %s", comment.GetHTMLURL()), "comment", comment.GetID())
+	return true, nil
+}
+
+// findSummaryComment returns the newest comment of the token's user on the PR with the summary
+// marker of the scope, nil when there is none. A comment of someone else quoting the marker
+// isn't one, nor is the summary of another scope. A summary written before summaries had
+// scopes is taken over when the scope has none yet.
+func findSummaryComment(ctx context.Context, client *github.Client, owner, repo string, prNo int, scope string) (*github.IssueComment, error) {
+	login := tokenLogin(ctx, client)
+	var found, unscoped *github.IssueComment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, prNo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range comments {
+			if !sameLogin(c.GetUser().GetLogin(), login) {
+				continue
+			}
+			switch written, ok := summaryScope(c.GetBody()); {
+			case ok && written == scope:
+				found = c
+			case ok && written == "":
+				unscoped = c
+			}
+		}
+		if resp.NextPage == 0 {
+			if found == nil {
+				found = unscoped
+			}
+			return found, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// runLocalSummary renders the summary comment instead of posting it
+func runLocalSummary(targets []reportTarget, formatter commenter.Formatter, output, scope string) {
+	var w io.WriteCloser = os.Stdout
+	if output != "" && output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fail(fmt.Sprintf("failed to create output file. %s", err.Error()))
+		}
+		w = f
+	}
+	findings := annotationFindings(targets)
+	body, err := summaryCommentBody(targets, findings, formatter, scope)
+	var errMessages []string
+	if err != nil {
+		errMessages = append(errMessages, err.Error())
+	} else if _, err := io.WriteString(w, body); err != nil {
+		errMessages = append(errMessages, err.Error())
+	} else {
+		stats.posted++
+	}
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			errMessages = append(errMessages, err.Error())
+		}
+		logger.Info(fmt.Sprintf("Rendered summary comment written to %s", output), "output", output)
+	}
+	exitWithGateDecision(errMessages, gateFailingTargets(targets))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+	"github.com/google/go-github/v32/github"
+)
+
+// newFakeClient is a client of a fake with PR 1 open, logging nowhere and reading the token's
+// user afresh
+func newFakeClient(t *testing.T) (*testutil.FakeGitHub, *github.Client) {
+	t.Helper()
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, testutil.AddedFile("main.tf", 20))
+	gh.Setenv(t, 1)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+
+	saved := logger
+	logger = newLogger(logFormatText, io.Discard)
+	tokenLoginOnce = sync.Once{}
+	t.Cleanup(func() { logger = saved })
+	return gh, client
+}
+
+func TestWriteSummaryComment(t *testing.T) {
+	body := "the summary\n" + summaryCommentMarker
+	tests := []struct {
+		name        string
+		existing    []string
+		login       string
+		fail        string
+		body        string
+		wantWritten bool
+		wantBodies  []string
+	}{
+		{name: "first run", body: body, wantWritten: true, wantBodies: []string{body}},
+		{name: "unchanged", existing: []string{body}, body: body, wantBodies: []string{body}},
+		{name: "changed", existing: []string{body}, body: "new\n" + summaryCommentMarker, wantWritten: true, wantBodies: []string{"new\n" + summaryCommentMarker}},
+		{
+			name: "another user quoting the marker", existing: []string{body}, login: "reviewer", body: body,
+			wantWritten: true, wantBodies: []string{body, body},
+		},
+		{
+			name: "failed edit", existing: []string{body}, fail: "PATCH /repos/org/repo/issues/comments/1", body: "new\n" + summaryCommentMarker,
+			wantWritten: true, wantBodies: []string{body, "new\n" + summaryCommentMarker},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, client := newFakeClient(t)
+			login := tt.login
+			if login == "" {
+				login = "github-actions[bot]"
+			}
+			for _, existing := range tt.existing {
+				gh.AddIssueComment(login, existing)
+			}
+			if tt.fail != "" {
+				gh.Fail(tt.fail, 404, 1)
+			}
+
+			written, err := writeSummaryComment(client, "org", "repo", 1, tt.body)
+			if err != nil {
+				t.Fatalf("writeSummaryComment: %v", err)
+			}
+
+			if written != tt.wantWritten {
+				t.Errorf("written %t, want %t", written, tt.wantWritten)
+			}
+			var bodies []string
+			for _, c := range gh.IssueComments() {
+				bodies = append(bodies, c.GetBody())
+			}
+			if strings.Join(bodies, "|") != strings.Join(tt.wantBodies, "|") {
+				t.Errorf("got the comments %q, want %q", bodies, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestWriteSummaryCommentOfTheTokensUser(t *testing.T) {
+	gh, client := newFakeClient(t)
+	gh.Login = "trivy-bot"
+	gh.AddIssueComment("github-actions[bot]", "old\n"+summaryCommentMarker)
+	gh.AddIssueComment("trivy-bot", "mine\n"+summaryCommentMarker)
+
+	if _, err := writeSummaryComment(client, "org", "repo", 1, "new\n"+summaryCommentMarker); err != nil {
+		t.Fatalf("writeSummaryComment: %v", err)
+	}
+
+	comments := gh.IssueComments()
+	if len(comments) != 2 || comments[0].GetBody() != "old\n"+summaryCommentMarker || comments[1].GetBody() != "new\n"+summaryCommentMarker {
+		t.Errorf("got the comments %v, want the token user's updated", comments)
+	}
+}
+
+func TestParseCommentMode(t *testing.T) {
+	for value, want := range map[string]string{"inline": commentModeInline, " Review ": commentModeReview, "SUMMARY": commentModeSummary} {
+		if got, err := parseCommentMode(value); err != nil || got != want {
+			t.Errorf("parseCommentMode(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseCommentMode("thread"); err == nil {
+		t.Error("parsed an unknown comment mode")
+	}
+}
+
+func TestWriteSummaryCommentAfterAShutdown(t *testing.T) {
+	gh, client := newFakeClient(t)
+	saved := shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	shutdown = ctx
+	t.Cleanup(func() { shutdown = saved })
+
+	written, err := writeSummaryComment(client, "org", "repo", 1, "the summary\n"+summaryCommentMarker)
+
+	if err != nil || !written || len(gh.IssueComments()) != 1 {
+		t.Errorf("written %t (%v) after a shutdown, want the summary flushed", written, err)
+	}
+}
+
+func TestWriteSummaryCommentOfTheScope(t *testing.T) {
+	shardA := "A\n" + summaryMarker("CI/scan (a)")
+	shardB := "B\n" + summaryMarker("CI/scan (b)")
+	tests := []struct {
+		name       string
+		existing   []string
+		body       string
+		wantBodies []string
+	}{
+		{name: "another shard's", existing: []string{shardA}, body: shardB, wantBodies: []string{shardA, shardB}},
+		{name: "its own", existing: []string{shardA, shardB}, body: "B2\n" + summaryMarker("CI/scan (b)"), wantBodies: []string{shardA, "B2\n" + summaryMarker("CI/scan (b)")}},
+		{name: "one without a scope", existing: []string{"old\n" + summaryCommentMarker}, body: shardA, wantBodies: []string{shardA}},
+		{name: "one without a scope next to its own", existing: []string{shardA, "old\n" + summaryCommentMarker}, body: "A2\n" + summaryMarker("CI/scan (a)"), wantBodies: []string{"A2\n" + summaryMarker("CI/scan (a)"), "old\n" + summaryCommentMarker}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, client := newFakeClient(t)
+			for _, existing := range tt.existing {
+				gh.AddIssueComment("github-actions[bot]", existing)
+			}
+
+			if _, err := writeSummaryComment(client, "org", "repo", 1, tt.body); err != nil {
+				t.Fatalf("writeSummaryComment: %v", err)
+			}
+
+			var bodies []string
+			for _, c := range gh.IssueComments() {
+				bodies = append(bodies, c.GetBody())
+			}
+			if strings.Join(bodies, "|") != strings.Join(tt.wantBodies, "|") {
+				t.Errorf("got the comments %q, want %q", bodies, tt.wantBodies)
+			}
+		})
+	}
+	if scope, ok := summaryScope(shardA); !ok || scope != "CI/scan (a)" {
+		t.Errorf("got the scope %q (%t), want the shard's", scope, ok)
+	}
+}
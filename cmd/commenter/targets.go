@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/commenter"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// reportTarget is a set of results commented on with its own settings. A run has one per
+// component when a targets file is used, and a single unnamed one otherwise.
+type reportTarget struct {
+	name    string
+	owners  []string
+	cfg     settings
+	results []report.Result
+
+	// findings are the located findings of the results, see locatedFindings, and unique those
+	// of them no VEX statement suppressed, each issue once. Both are built with the target, so
+	// the pipeline runs once per target and run.
+	findings []report.Finding
+	unique   []report.Finding
+}
+
+func newReportTarget(name string, owners []string, cfg settings, results []report.Result) reportTarget {
+	findings := locatedFindings(results, cfg)
+	exploitable := report.Filter(findings, func(f report.Finding) bool { return !f.Suppressed })
+	return reportTarget{
+		name:     name,
+		owners:   owners,
+		cfg:      cfg,
+		results:  results,
+		findings: findings,
+		unique:   commenter.Dedupe(exploitable),
+	}
+}
+
+type targetsFile struct {
+	Targets []targetEntry `yaml:"targets"`
+}
+
+type targetEntry struct {
+	Name             string     `yaml:"name"`
+	Path             string     `yaml:"path"`
+	Report           string     `yaml:"report"`
+	WorkingDirectory string     `yaml:"working_directory"`
+	Owners           []string   `yaml:"owners"`
+	Gate             targetGate `yaml:"gate"`
+}
+
+// targetGate overrides the run's settings for a single target
+type targetGate struct {
+	Severity    string `yaml:"severity"`
+	MinSeverity string `yaml:"min_severity"`
+	MaxComments *int   `yaml:"max_comments"`
+	SoftFail    *bool  `yaml:"soft_fail"`
+}
+
+func singleTarget(results []report.Result, cfg settings) []reportTarget {
+	return []reportTarget{newReportTarget("", nil, cfg, results)}
+}
+
+// loadTargets reads the targets file and the report of every target in it
+func loadTargets(path string, cfg settings) []reportTarget {
+	entries, err := parseTargetsFile(path)
+	if err != nil {
+		fail(fmt.Sprintf("failed to load targets. %s", err.Error()))
+	}
+
+	var targets []reportTarget
+	total := 0
+	for _, entry := range entries {
+		results, err := loadReport(entry.Report)
+		if err != nil {
+			fail(fmt.Sprintf("failed to load results for target %s. %s", entry.Name, err.Error()))
+		}
+		targetCfg, err := entry.settings(cfg)
+		if err != nil {
+			fail(fmt.Sprintf("invalid settings for target %s. %s", entry.Name, err.Error()))
+		}
+		issues := len(report.Findings(results))
+		logger.Info(fmt.Sprintf("trivy found %s in target %s", commenter.IssueCount(issues), entry.Name), "target", entry.Name, "issues", issues)
+		total += issues
+		targets = append(targets, newReportTarget(entry.Name, entry.Owners, targetCfg, results))
+	}
+
+	if total == 0 && !cleansStaleComments() {
+		logger.Info("No issues found.", "event", eventGateDecision, "decision", "pass", "reason", "no_issues")
+		logRunSummary("pass")
+		exit(0)
+	}
+	return targets
+}
+
+func parseTargetsFile(path string) ([]targetEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file targetsFile
+	if err := yaml.Unmarshal([]byte(commenter.ExpandEnv(string(content))), &file); err != nil {
+		return nil, err
+	}
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("%s has no targets", path)
+	}
+
+	for i := range file.Targets {
+		entry := &file.Targets[i]
+		if entry.Name == "" {
+			entry.Name = entry.Path
+		}
+		if entry.Name == "" {
+			entry.Name = entry.Report
+		}
+		if entry.Report == "" {
+			return nil, fmt.Errorf("target %d has no report", i+1)
+		}
+	}
+	return file.Targets, nil
+}
+
+// settings applies the target's overrides to the run settings. Reports are usually produced
+// by scanning the target's path, so that is the default working directory.
+func (e targetEntry) settings(base settings) (settings, error) {
+	s := base
+	if dir := e.WorkingDirectory; dir != "" {
+		s.workingDirectories = parseWorkingDirectories(dir)
+	} else if e.Path != "" {
+		s.workingDirectories = parseWorkingDirectories(e.Path)
+	}
+
+	if e.Gate.Severity != "" {
+		severity, err := report.ParseSeverity(e.Gate.Severity)
+		if err != nil {
+			return s, fmt.Errorf("gate severity: %w", err)
+		}
+		s.gateSeverity = severity
+	}
+	if e.Gate.MinSeverity != "" {
+		severity, err := report.ParseSeverity(e.Gate.MinSeverity)
+		if err != nil {
+			return s, fmt.Errorf("min severity: %w", err)
+		}
+		s.minSeverity = severity
+	}
+	if e.Gate.MaxComments != nil {
+		s.maxComments = *e.Gate.MaxComments
+	}
+	if e.Gate.SoftFail != nil {
+		s.softFail = *e.Gate.SoftFail
+	}
+	return s, nil
+}
+
+func targetNames(targets []string) string {
+	var named []string
+	for _, t := range targets {
+		if t != "" {
+			named = append(named, t)
+		}
+	}
+	return strings.Join(named, ", ")
+}
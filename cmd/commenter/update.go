@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	releaseOwner = "XiaxueTech"
+	releaseRepo  = "trivy-terraform-pr-commenter"
+)
+
+const (
+	// the release workflow signs the checksums keyless, its certificate is issued to the
+	// workflow's identity at the release tag
+	releaseWorkflow = "https://github.com/" + releaseOwner + "/" + releaseRepo + "/.github/workflows/release.yml"
+	releaseIssuer   = "https://token.actions.githubusercontent.com"
+	// the suffix of the Sigstore bundle of the checksums signature, next to the checksums
+	signatureBundleSuffix = ".sigstore.json"
+)
+
+// runUpdate replaces the running binary with the latest release after verifying its checksum,
+// and the checksums' Sigstore signature by the release workflow with cosign. The binary isn't
+// replaced when the signature is missing or doesn't verify, as the checksums of a tampered
+// release would match its binary.
+func runUpdate(args []string) {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	checkOnly := flags.Bool("check", false, "only report whether a newer release is available")
+	cosign := flags.String("cosign", "cosign", "cosign binary verifying the signature of the release's checksums")
+	_ = flags.Parse(args)
+
+	ctx := shutdown
+	client := newReleaseClient(ctx, githubToken())
+	release, _, err := client.Repositories.GetLatestRelease(ctx, releaseOwner, releaseRepo)
+	if err != nil {
+		fail(fmt.Sprintf("failed to look up the latest release. %s", err.Error()))
+	}
+
+	latest := release.GetTagName()
+	if strings.TrimPrefix(latest, "v") == strings.TrimPrefix(version, "v") {
+		logger.Info(fmt.Sprintf("Already running the latest release %s", latest))
+		return
+	}
+	logger.Info(fmt.Sprintf("Release %s is available, running %s", latest, version))
+	if *checkOnly {
+		return
+	}
+
+	// the name the release workflow publishes the binary under and entrypoint.sh installs
+	binaryName := fmt.Sprintf("%s-%s-%s", releaseRepo, runtime.GOOS, runtime.GOARCH)
+	binaryAsset := findReleaseAsset(release, func(name string) bool { return name == binaryName })
+	checksumAsset := findReleaseAsset(release, func(name string) bool { return strings.HasSuffix(name, "checksums.txt") })
+	if binaryAsset == nil || checksumAsset == nil {
+		fail(fmt.Sprintf("release %s has no %s binary with checksums", latest, binaryName))
+	}
+
+	bundleAsset := findReleaseAsset(release, func(name string) bool { return name == checksumAsset.GetName()+signatureBundleSuffix })
+	if bundleAsset == nil {
+		fail(fmt.Sprintf("release %s has no signature of its checksums, not updating", latest))
+	}
+
+	checksums, err := download(checksumAsset.GetBrowserDownloadURL())
+	if err != nil {
+		fail(fmt.Sprintf("failed to download the checksums. %s", err.Error()))
+	}
+	bundle, err := download(bundleAsset.GetBrowserDownloadURL())
+	if err != nil {
+		fail(fmt.Sprintf("failed to download the signature of the checksums. %s", err.Error()))
+	}
+	if err := verifyChecksumsSignature(*cosign, latest, checksums, bundle); err != nil {
+		fail(fmt.Sprintf("the checksums of release %s aren't signed by its release workflow, not updating. %s", latest, err.Error()))
+	}
+	expected, err := findChecksum(checksums, binaryName)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	binary, err := download(binaryAsset.GetBrowserDownloadURL())
+	if err != nil {
+		fail(fmt.Sprintf("failed to download %s. %s", binaryName, err.Error()))
+	}
+	sum := sha256.Sum256(binary)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		fail(fmt.Sprintf("checksum mismatch for %s, expected %s but got %s", binaryName, expected, actual))
+	}
+
+	if err := replaceExecutable(binary); err != nil {
+		fail(fmt.Sprintf("failed to replace the binary. %s", err.Error()))
+	}
+	logger.Info(fmt.Sprintf("Updated to %s", latest))
+}
+
+// newReleaseClient talks to github.com regardless of GITHUB_API_URL, since that is where releases
+// are published. The token is only sent along when it is a github.com one, an Enterprise
+// server's token has no business there.
+func newReleaseClient(ctx context.Context, token string) *github.Client {
+	if token == "" || !isGithubDotCom(os.Getenv("GITHUB_API_URL")) {
+		return github.NewClient(nil)
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return github.NewClient(oauth2.NewClient(ctx, ts))
+}
+
+// isGithubDotCom is whether the API URL is github.com's, unset meaning github.com
+func isGithubDotCom(apiURL string) bool {
+	if apiURL == "" {
+		return true
+	}
+	u, err := url.Parse(apiURL)
+	return err == nil && strings.EqualFold(u.Hostname(), "api.github.com")
+}
+
+func findReleaseAsset(release *github.RepositoryRelease, match func(name string) bool) *github.ReleaseAsset {
+	for _, asset := range release.Assets {
+		if match(asset.GetName()) {
+			return asset
+		}
+	}
+	return nil
+}
+
+// downloadTimeout bounds a download, so an update never hangs on a stalled connection
+const downloadTimeout = 5 * time.Minute
+
+func download(url string) ([]byte, error) {
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyChecksumsSignature verifies the Sigstore bundle is a signature of the checksums by the
+// release workflow run of the tag, with cosign verify-blob
+func verifyChecksumsSignature(cosign, tag string, checksums, bundle []byte) error {
+	if _, err := exec.LookPath(cosign); err != nil {
+		return fmt.Errorf("cosign is needed to verify it, see https://docs.sigstore.dev/cosign/system_config/installation/ (%w)", err)
+	}
+	dir, err := os.MkdirTemp("", "commenter-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	checksumsFile, bundleFile := filepath.Join(dir, "checksums.txt"), filepath.Join(dir, "checksums.txt"+signatureBundleSuffix)
+	if err := os.WriteFile(checksumsFile, checksums, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(bundleFile, bundle, 0o600); err != nil {
+		return err
+	}
+
+	out, err := exec.Command(cosign, cosignVerifyArgs(tag, checksumsFile, bundleFile)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func cosignVerifyArgs(tag, checksumsFile, bundleFile string) []string {
+	return []string{
+		"verify-blob",
+		"--bundle", bundleFile,
+		"--certificate-identity", releaseWorkflow + "@refs/tags/" + tag,
+		"--certificate-oidc-issuer", releaseIssuer,
+		checksumsFile,
+	}
+}
+
+// findChecksum reads a sha256sum formatted checksums file
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(checksums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum found for %s", name)
+}
+
+// replaceExecutable writes the new binary alongside the current one and renames it into place
+func replaceExecutable(binary []byte) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(executable), ".commenter-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		return fmt.Errorf("%w, check the binary's directory is writable", err)
+	}
+	return nil
+}
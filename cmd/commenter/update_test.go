@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCosign writes a cosign recording its arguments and the files it is given, exiting with
+// the code
+func fakeCosign(t *testing.T, code string) (binary, recorded string) {
+	t.Helper()
+	dir := t.TempDir()
+	binary, recorded = filepath.Join(dir, "cosign"), filepath.Join(dir, "recorded")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > " + recorded + "\n" +
+		"cat \"$3\" \"$8\" >> " + recorded + "\n" +
+		"echo 'Error: none of the expected identities matched' >&2\n" +
+		"exit " + code + "\n"
+	if err := os.WriteFile(binary, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return binary, recorded
+}
+
+func TestVerifyChecksumsSignature(t *testing.T) {
+	checksums, bundle := []byte("abc  trivy-terraform-pr-commenter-linux-amd64\n"), []byte(`{"mediaType":"bundle"}`)
+
+	t.Run("signed by the release workflow", func(t *testing.T) {
+		cosign, recorded := fakeCosign(t, "0")
+		if err := verifyChecksumsSignature(cosign, "v1.2.0", checksums, bundle); err != nil {
+			t.Fatalf("verifyChecksumsSignature: %v", err)
+		}
+		got, err := os.ReadFile(recorded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"verify-blob --bundle ",
+			"--certificate-identity https://github.com/XiaxueTech/trivy-terraform-pr-commenter/.github/workflows/release.yml@refs/tags/v1.2.0",
+			"--certificate-oidc-issuer https://token.actions.githubusercontent.com",
+			string(bundle), string(checksums),
+		} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("cosign was run with\n%s\nwant %q in it", got, want)
+			}
+		}
+	})
+
+	t.Run("not verifying", func(t *testing.T) {
+		cosign, _ := fakeCosign(t, "1")
+		err := verifyChecksumsSignature(cosign, "v1.2.0", checksums, bundle)
+		if err == nil || !strings.Contains(err.Error(), "none of the expected identities matched") {
+			t.Errorf("got the error %v, want cosign's", err)
+		}
+	})
+
+	t.Run("without cosign", func(t *testing.T) {
+		err := verifyChecksumsSignature(filepath.Join(t.TempDir(), "cosign"), "v1.2.0", checksums, bundle)
+		if err == nil || !strings.Contains(err.Error(), "cosign is needed") {
+			t.Errorf("got the error %v, want cosign to be needed", err)
+		}
+	})
+}
+
+func TestFindChecksum(t *testing.T) {
+	checksums := []byte("abc  trivy-terraform-pr-commenter-linux-amd64\ndef *trivy-terraform-pr-commenter-linux-arm64\n")
+	for name, want := range map[string]string{
+		"trivy-terraform-pr-commenter-linux-amd64": "abc",
+		"trivy-terraform-pr-commenter-linux-arm64": "def",
+	} {
+		if got, err := findChecksum(checksums, name); err != nil || got != want {
+			t.Errorf("findChecksum(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := findChecksum(checksums, "trivy-terraform-pr-commenter-darwin-amd64"); err == nil {
+		t.Error("found the checksum of a binary the release doesn't have")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runValidate checks the configuration and environment up front, reporting every problem found
+// rather than stopping at the first, so misconfiguration doesn't silently produce zero comments
+func runValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	logFormat := flags.String("log-format", os.Getenv("INPUT_LOG_FORMAT"), "log output format, text or json")
+	strict := flags.Bool("strict-schema", strings.ToLower(os.Getenv("INPUT_STRICT_SCHEMA")) == "true", "report any drift from the expected report schema as a problem")
+	formatName := flags.String("format", reportFormat, reportFormatUsage)
+	_ = flags.Parse(args)
+	strictSchema = *strict
+	reportFormat = *formatName
+
+	// an invalid format is reported as a problem below rather than aborting
+	format, err := parseLogFormat(*logFormat)
+	if err != nil {
+		format = logFormatText
+	}
+	logger = newLogger(format, os.Stdout)
+
+	problems := validateConfiguration(reportFileArg(flags), *logFormat)
+	if len(problems) > 0 {
+		logger.Info(fmt.Sprintf("Validation found %d problems:", len(problems)), "problems", len(problems))
+		for _, problem := range problems {
+			logger.Info(fmt.Sprintf("  - %s", problem), "event", eventError)
+		}
+		exit(1)
+	}
+	logger.Info("Configuration is valid")
+}
+
+func validateConfiguration(reportFile, logFormat string) []string {
+	var problems []string
+	addProblem := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if targets := os.Getenv("INPUT_TARGETS_FILE"); targets != "" {
+		addProblem(checkTargets(targets))
+	} else {
+		addProblem(checkReport(reportFile))
+	}
+
+	if _, err := parseLogFormat(logFormat); err != nil {
+		addProblem(fmt.Errorf("log format: %w", err))
+	}
+	if input := os.Getenv("INPUT_PR_NUMBER"); input != "" {
+		if prNo, err := strconv.Atoi(strings.TrimSpace(input)); err != nil || prNo <= 0 {
+			addProblem(fmt.Errorf("INPUT_PR_NUMBER is not a valid PR number: %q", input))
+		}
+	}
+	addProblem(checkWorkingDirectories())
+	if _, err := loadSettings(); err != nil {
+		addProblem(err)
+	}
+
+	owner, repo, err := parseRepository()
+	addProblem(err)
+	if err == nil {
+		addProblem(checkToken(owner, repo))
+	}
+	return problems
+}
+
+func checkReport(reportFile string) error {
+	if _, err := loadReport(reportFile); err != nil {
+		return fmt.Errorf("report %s could not be read: %w", reportFile, err)
+	}
+	return nil
+}
+
+func checkTargets(path string) error {
+	entries, err := parseTargetsFile(path)
+	if err != nil {
+		return fmt.Errorf("targets file %s could not be read: %w", path, err)
+	}
+	var errs []string
+	for _, entry := range entries {
+		if err := checkReport(entry.Report); err != nil {
+			errs = append(errs, fmt.Sprintf("target %s: %s", entry.Name, err.Error()))
+		}
+		if _, err := entry.settings(defaultSettings); err != nil {
+			errs = append(errs, fmt.Sprintf("target %s: %s", entry.Name, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func checkWorkingDirectories() error {
+	root := os.Getenv("GITHUB_WORKSPACE")
+	if root == "" {
+		root = "."
+	}
+	var missing []string
+	for _, wd := range parseWorkingDirectories(os.Getenv("INPUT_WORKING_DIRECTORY")) {
+		if wd.dir == "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(root, wd.dir)); err != nil || !info.IsDir() {
+			missing = append(missing, wd.dir)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("INPUT_WORKING_DIRECTORY references directories that don't exist: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkToken verifies the token is set and can comment on the repository's PRs
+func checkToken(owner, repo string) error {
+	token := githubToken()
+	if token == "" {
+		return fmt.Errorf("neither INPUT_GITHUB_TOKEN nor GITHUB_TOKEN has been set")
+	}
+
+	client, err := newGithubClient(token)
+	if err != nil {
+		return fmt.Errorf("could not connect to GitHub (%s)", err.Error())
+	}
+	return checkRepositoryAccess(client, owner, repo)
+}
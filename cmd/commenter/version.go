@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// set at build time via -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+func versionString() string {
+	return fmt.Sprintf("trivy-pr-commenter %s (commit %s, built %s)", version, commit, date)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// the largest VEX document read from a URL
+const maxVEXDocument = 32 << 20
+
+// loadVEX reads the statements of the comma separated VEX documents, each a path or an
+// http(s) URL
+func loadVEX(sources string) ([]report.VEXStatement, error) {
+	var statements []report.VEXStatement
+	for _, source := range strings.Split(sources, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		data, err := readVEX(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		parsed, err := report.ParseVEX(data, source)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid VEX document: %w", source, err)
+		}
+		logger.Info(fmt.Sprintf("Read %d not_affected and fixed statements from %s", len(parsed), source), "vex", source, "statements", len(parsed))
+		statements = append(statements, parsed...)
+	}
+	return statements, nil
+}
+
+func readVEX(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "https://") && !strings.HasPrefix(source, "http://") {
+		return os.ReadFile(source)
+	}
+	client := &http.Client{Transport: apiTransport, Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxVEXDocument))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workingDirectory maps report targets onto a directory relative to the repo root.
+// Entries are either a plain directory or a prefix=directory mapping.
+type workingDirectory struct {
+	prefix string
+	dir    string
+}
+
+func parseWorkingDirectories(input string) []workingDirectory {
+	var dirs []workingDirectory
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var wd workingDirectory
+		if prefix, dir, ok := strings.Cut(entry, "="); ok {
+			wd.prefix = normaliseDirectory(prefix)
+			wd.dir = normaliseDirectory(dir)
+		} else {
+			wd.dir = normaliseDirectory(entry)
+		}
+		dirs = append(dirs, wd)
+	}
+	return dirs
+}
+
+// normaliseDirectory returns the directory with a trailing slash, or an empty string for the repo root
+func normaliseDirectory(dir string) string {
+	dir = strings.TrimSpace(dir)
+	dir = strings.TrimPrefix(dir, "./")
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" || dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
+
+// resolveFilename works out the repository relative path for a report target.
+// Prefix mappings win, then the first plain directory containing the file in the checkout,
+// falling back to the first plain directory when none of them contain it.
+func resolveFilename(target string, dirs []workingDirectory, root string) string {
+	for _, wd := range dirs {
+		if wd.prefix != "" && strings.HasPrefix(target, wd.prefix) {
+			return wd.dir + strings.TrimPrefix(target, wd.prefix)
+		}
+	}
+
+	var plain []workingDirectory
+	for _, wd := range dirs {
+		if wd.prefix == "" {
+			plain = append(plain, wd)
+		}
+	}
+	if len(plain) == 0 {
+		return target
+	}
+	if len(plain) > 1 {
+		for _, wd := range plain {
+			if _, err := os.Stat(filepath.Join(root, wd.dir, target)); err == nil {
+				return wd.dir + target
+			}
+		}
+	}
+	return plain[0].dir + target
+}
@@ -1,6 +1,9 @@
 #!/usr/bin/env bash
 
-set -xe
+# no xtrace, it would print the token in the fallback below and in the release lookup
+set -e
+
+INPUT_GITHUB_TOKEN="${INPUT_GITHUB_TOKEN:-${GITHUB_TOKEN}}"
 
 if [ -z "${INPUT_GITHUB_TOKEN}" ] ; then
   echo "Consider setting a GITHUB_TOKEN to prevent GitHub api rate limits." >&2
@@ -37,4 +40,5 @@ function install_release {
 install_release XiaxueTech/trivy-terraform-pr-commenter "/latest" trivy-terraform-pr-commenter checksums.txt
 
 ls -l /usr/local/bin/
-trivy-terraform-pr-commenter ${INPUT_REPORT_FILE}
\ No newline at end of file
+# exec so the signals of a cancelled job reach the commenter rather than bash
+exec trivy-terraform-pr-commenter "${INPUT_REPORT_FILE}"
\ No newline at end of file
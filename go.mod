@@ -6,10 +6,11 @@ require github.com/aquasecurity/trivy v0.49.1
 
 require (
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/google/go-github/v32 v32.1.0 // indirect
+	github.com/google/go-github/v32 v32.1.0
 	github.com/google/go-querystring v1.0.0 // indirect
 	golang.org/x/crypto v0.18.0 // indirect
-	golang.org/x/oauth2 v0.15.0 // indirect
+	golang.org/x/oauth2 v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
 )
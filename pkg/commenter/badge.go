@@ -0,0 +1,36 @@
+package commenter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RiskBadge renders the risk score as an SVG badge in the style of shields.io: green without
+// any risk, then yellow, orange and red from the score of a HIGH, a CRITICAL and several
+// CRITICAL findings at the default weights
+func RiskBadge(score int) string {
+	color := "#4c1"
+	switch {
+	case score >= 25:
+		color = "#e05d44"
+	case score >= 10:
+		color = "#fe7d37"
+	case score > 0:
+		color = "#dfb317"
+	}
+	label, value := "trivy risk", strconv.Itoa(score)
+	// an approximation of the text widths of Verdana at 11px, as shields.io uses
+	labelWidth, valueWidth := 7*len(label)+10, 7*len(value)+10
+	width := labelWidth + valueWidth
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[2]s: %[3]s">
+<title>%[2]s: %[3]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[4]d" height="20" fill="#555"/><rect x="%[4]d" width="%[5]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[2]s</text>
+<text x="%[8]d" y="14">%[3]s</text>
+</g>
+</svg>
+`, width, label, value, labelWidth, valueWidth, color, labelWidth/2, labelWidth+valueWidth/2)
+}
@@ -0,0 +1,188 @@
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/google/go-github/v32/github"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// hunkHeader is the header of a hunk of a unified diff, with the first line and the number of
+// lines of the hunk in the new file
+var hunkHeader = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// Review is a Provider batching the comments into a single review of a pull request, one API
+// call and one notification however many comments there are. WriteMultiLineComment queues the
+// comment, nothing is on the pull request until Submit.
+type Review struct {
+	client   *github.Client
+	owner    string
+	repo     string
+	prNo     int
+	commitID string
+	// hunks are the lines of the new file each hunk of a changed file covers
+	hunks map[string][][2]int
+
+	mu sync.Mutex
+	// written are the comments already on the pull request or queued, by file and body
+	written  map[string]bool
+	comments []*github.DraftReviewComment
+}
+
+// NewReview reads the head commit, the changed files and the comments of the pull request to
+// batch comments into a review of
+func NewReview(ctx context.Context, client *github.Client, owner, repo string, prNo int) (*Review, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the pull request: %w", err)
+	}
+	r := &Review{
+		client:   client,
+		owner:    owner,
+		repo:     repo,
+		prNo:     prNo,
+		commitID: pr.GetHead().GetSHA(),
+		hunks:    make(map[string][][2]int),
+		written:  make(map[string]bool),
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, prNo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the files of the pull request: %w", err)
+		}
+		for _, f := range files {
+			r.hunks[f.GetFilename()] = hunks(f.GetPatch())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	commentOpts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, prNo, commentOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the comments of the pull request: %w", err)
+		}
+		for _, c := range comments {
+			r.written[c.GetPath()+"\x00"+c.GetBody()] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.Page = resp.NextPage
+	}
+	return r, nil
+}
+
+// hunks are the ranges of lines of the new file the hunks of a patch cover
+func hunks(patch string) [][2]int {
+	var ranges [][2]int
+	for _, m := range hunkHeader.FindAllStringSubmatch(patch, -1) {
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count > 0 {
+			ranges = append(ranges, [2]int{start, start + count - 1})
+		}
+	}
+	return ranges
+}
+
+// WriteMultiLineComment queues the comment for the review. A comment on lines outside of the
+// PR's changes is rejected with the error the GitHub provider gives, as GitHub would reject the
+// whole review for it, and so is one spanning several hunks.
+func (r *Review) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	inHunk := false
+	for _, h := range r.hunks[file] {
+		if startLine >= h[0] && endLine <= h[1] {
+			inHunk = true
+			break
+		}
+	}
+	if !inHunk {
+		return prcommenter.CommentNotValidError{}
+	}
+
+	side := "RIGHT"
+	draft := &github.DraftReviewComment{Path: &file, Body: &comment, Line: &endLine, Side: &side}
+	if startLine < endLine {
+		draft.StartLine, draft.StartSide = &startLine, &side
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.written[file+"\x00"+comment] {
+		return prcommenter.CommentAlreadyWrittenError{}
+	}
+	r.comments = append(r.comments, draft)
+	r.written[file+"\x00"+comment] = true
+	return nil
+}
+
+// Len is the number of comments queued for the review
+func (r *Review) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.comments)
+}
+
+// Submit writes the queued comments as a single review with the body, e.g. ReviewBody's. Nothing
+// is written when no comment is queued.
+func (r *Review) Submit(ctx context.Context, body string) (*github.PullRequestReview, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.comments) == 0 {
+		return nil, nil
+	}
+	body = Truncate(body, MaxCommentLength, TruncatedMarker)
+	event := "COMMENT"
+	review, _, err := r.client.PullRequests.CreateReview(ctx, r.owner, r.repo, r.prNo, &github.PullRequestReviewRequest{
+		CommitID: &r.commitID,
+		Body:     &body,
+		Event:    &event,
+		Comments: r.comments,
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.comments = nil
+	return review, nil
+}
+
+// CommentURLs are the links of the comments of the submitted review, keyed by their file and
+// body, for ReviewBody to link each finding to its inline comment
+func (r *Review) CommentURLs(ctx context.Context, review *github.PullRequestReview) (map[string]string, error) {
+	urls := make(map[string]string)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		comments, resp, err := r.client.PullRequests.ListReviewComments(ctx, r.owner, r.repo, r.prNo, review.GetID(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the comments of the review: %w", err)
+		}
+		for _, c := range comments {
+			urls[c.GetPath()+"\x00"+c.GetBody()] = c.GetHTMLURL()
+		}
+		if resp.NextPage == 0 {
+			return urls, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// EditBody replaces the body of the submitted review
+func (r *Review) EditBody(ctx context.Context, review *github.PullRequestReview, body string) error {
+	body = Truncate(body, MaxCommentLength, TruncatedMarker)
+	if _, _, err := r.client.PullRequests.UpdateReview(ctx, r.owner, r.repo, r.prNo, review.GetID(), body); err != nil {
+		return fmt.Errorf("failed to edit the body of the review: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package commenter
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+	"github.com/google/go-github/v32/github"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+func newFakeReview(t *testing.T, files ...testutil.File) (*testutil.FakeGitHub, *Review) {
+	t.Helper()
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, files...)
+	return gh, newReviewOn(t, gh)
+}
+
+// newReviewOn starts a review of PR 1 of the fake
+func newReviewOn(t *testing.T, gh *testutil.FakeGitHub) *Review {
+	t.Helper()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+	r, err := NewReview(context.Background(), client, "org", "repo", 1)
+	if err != nil {
+		t.Fatalf("NewReview: %v", err)
+	}
+	return r
+}
+
+func TestNewReviewIsCancelled(t *testing.T) {
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, testutil.AddedFile("main.tf", 20))
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(gh.URL + "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewReview(ctx, client, "org", "repo", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v starting a review on a cancelled context, want it cancelled", err)
+	}
+}
+
+func TestReviewBatchesTheComments(t *testing.T) {
+	gh, r := newFakeReview(t, testutil.AddedFile("main.tf", 20))
+	if err := r.WriteMultiLineComment("main.tf", "first", 1, 3); err != nil {
+		t.Fatalf("WriteMultiLineComment: %v", err)
+	}
+	if err := r.WriteMultiLineComment("main.tf", "second", 5, 5); err != nil {
+		t.Fatalf("WriteMultiLineComment: %v", err)
+	}
+	if len(gh.Comments()) != 0 {
+		t.Fatalf("got %d comments before the review was submitted, want none", len(gh.Comments()))
+	}
+
+	review, err := r.Submit(context.Background(), "the body")
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if reviews := gh.Reviews(); len(reviews) != 1 || reviews[0].GetBody() != "the body" {
+		t.Fatalf("got the reviews %v, want one with the body", reviews)
+	}
+	if gh.Requests("POST /repos/org/repo/pulls/1/reviews") != 1 || len(gh.Comments()) != 2 {
+		t.Errorf("got %d comments, want the 2 written by one request", len(gh.Comments()))
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d comments still queued after submitting", r.Len())
+	}
+
+	urls, err := r.CommentURLs(context.Background(), review)
+	if err != nil {
+		t.Fatalf("CommentURLs: %v", err)
+	}
+	if link := urls["main.tf\x00second"]; !strings.Contains(link, "#discussion_r") {
+		t.Errorf("got the link %q of the comment, want its discussion", link)
+	}
+	if err := r.EditBody(context.Background(), review, "linked"); err != nil {
+		t.Fatalf("EditBody: %v", err)
+	}
+	if body := gh.Reviews()[0].GetBody(); body != "linked" {
+		t.Errorf("got the review body %q, want the edited one", body)
+	}
+}
+
+func TestReviewRejectsCommentsItCantWrite(t *testing.T) {
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, testutil.AddedFile("main.tf", 20))
+	gh.AddComment(1, "github-actions[bot]", "main.tf", 2, "earlier")
+	r := newReviewOn(t, gh)
+
+	tests := []struct {
+		name      string
+		file      string
+		body      string
+		startLine int
+		endLine   int
+		want      error
+	}{
+		{name: "outside of the PR", file: "other.tf", body: "new", startLine: 1, endLine: 1, want: prcommenter.CommentNotValidError{}},
+		{name: "outside of the hunks", file: "main.tf", body: "new", startLine: 19, endLine: 21, want: prcommenter.CommentNotValidError{}},
+		{name: "already on the PR", file: "main.tf", body: "earlier", startLine: 2, endLine: 2, want: prcommenter.CommentAlreadyWrittenError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.WriteMultiLineComment(tt.file, tt.body, tt.startLine, tt.endLine); err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if err := r.WriteMultiLineComment("main.tf", "new", 1, 1); err != nil {
+		t.Fatalf("WriteMultiLineComment: %v", err)
+	}
+	if err := r.WriteMultiLineComment("main.tf", "new", 1, 1); err != (prcommenter.CommentAlreadyWrittenError{}) {
+		t.Errorf("got %v queueing a comment twice, want it already written", err)
+	}
+}
+
+func TestReviewSubmitsNothingWithoutComments(t *testing.T) {
+	gh, r := newFakeReview(t, testutil.AddedFile("main.tf", 20))
+
+	review, err := r.Submit(context.Background(), "the body")
+
+	if err != nil || review != nil || len(gh.Reviews()) != 0 {
+		t.Errorf("got the review %v (%v), want none", review, err)
+	}
+}
@@ -0,0 +1,102 @@
+package commenter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// Error classes the circuit breaker opens on, other errors are specific to a comment
+const (
+	ErrorClassRateLimit = "rate_limit"
+	ErrorClassAuth      = "auth"
+	ErrorClassServer    = "server"
+	ErrorClassNetwork   = "network"
+	ErrorClassOther     = "other"
+)
+
+// the commenter library flattens API errors into strings, so the status is matched in the message
+var (
+	rateLimit    = regexp.MustCompile(`(?i)rate limit`)
+	authStatus   = regexp.MustCompile(` 40[13] `)
+	serverStatus = regexp.MustCompile(` 5\d\d `)
+	networkError = regexp.MustCompile(`connection refused|connection reset|no such host|i/o timeout|EOF$`)
+)
+
+// ErrorClass groups API errors by their cause
+func ErrorClass(err error) string {
+	msg := err.Error()
+	switch {
+	case rateLimit.MatchString(msg):
+		return ErrorClassRateLimit
+	case authStatus.MatchString(msg):
+		return ErrorClassAuth
+	case serverStatus.MatchString(msg):
+		return ErrorClassServer
+	case networkError.MatchString(msg):
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// CircuitOpenError replaces the individual errors of the run of failures that stopped posting
+type CircuitOpenError struct {
+	Class    string
+	Failures int
+	Last     error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("stopped commenting after %d consecutive %s errors, the last was: %s", e.Failures, e.Class, e.Last.Error())
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Last
+}
+
+// circuitBreaker tracks the current run of failures of the same class
+type circuitBreaker struct {
+	class  string
+	streak []Comment
+}
+
+// record adds the comment to the run of failures, reporting whether the breaker opened
+func (b *circuitBreaker) record(c Comment, threshold int) bool {
+	if c.Status != StatusFailed {
+		b.class, b.streak = "", nil
+		return false
+	}
+	class := ErrorClass(c.Err)
+	if class == ErrorClassOther {
+		b.class, b.streak = "", nil
+		return false
+	}
+	if class != b.class {
+		b.class, b.streak = class, nil
+	}
+	b.streak = append(b.streak, c)
+	return threshold > 0 && len(b.streak) >= threshold
+}
+
+// remaining renders the comments that would have followed, up to the comment limit
+func remaining(groups [][]report.Finding, opts Options, written int) []Comment {
+	var comments []Comment
+	for _, group := range groups {
+		if opts.MaxComments > 0 && written >= opts.MaxComments {
+			break
+		}
+		finding, related, ok := commentOn(opts, group)
+		if !ok {
+			continue
+		}
+		c := Comment{Finding: finding, Related: related, File: anchor(opts, finding.Target), Status: StatusNotAttempted}
+		var err error
+		if c.Body, err = body(opts, finding, c.Related); err != nil {
+			c.Body = Message(finding) + relatedFindings(c.Related, opts.Unified)
+		}
+		comments = append(comments, c)
+		written++
+	}
+	return comments
+}
@@ -0,0 +1,93 @@
+package commenter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{err: "POST https://api.github.com/repos/org/repo/pulls/1/comments: 403 API rate limit exceeded []", want: ErrorClassRateLimit},
+		{err: "POST https://api.github.com/repos/org/repo/pulls/1/comments: 401 Bad credentials []", want: ErrorClassAuth},
+		{err: "POST https://api.github.com/repos/org/repo/pulls/1/comments: 403 Resource not accessible by integration []", want: ErrorClassAuth},
+		{err: "POST https://api.github.com/repos/org/repo/pulls/1/comments: 502 Bad Gateway []", want: ErrorClassServer},
+		{err: "dial tcp: lookup api.github.com: no such host", want: ErrorClassNetwork},
+		{err: "POST https://api.github.com/repos/org/repo/pulls/1/comments: 422 Validation Failed []", want: ErrorClassOther},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(errors.New(tt.err)); got != tt.want {
+			t.Errorf("ErrorClass(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreakerStreak(t *testing.T) {
+	failed := func(status int) Comment {
+		return Comment{Status: StatusFailed, Err: fmt.Errorf("POST https://api.github.com/repos/org/repo/pulls/1/comments: %d error []", status)}
+	}
+	var b circuitBreaker
+	for i, c := range []Comment{failed(502), failed(401), failed(502), {Status: StatusPosted}, failed(502), failed(422), failed(502)} {
+		if b.record(c, 2) {
+			t.Fatalf("opened on comment %d, a run of the same class was broken by another", i)
+		}
+	}
+	if !b.record(failed(503), 2) || b.class != ErrorClassServer || len(b.streak) != 2 {
+		t.Errorf("didn't open on two server errors in a row, the streak is %d %s errors", len(b.streak), b.class)
+	}
+
+	var disabled circuitBreaker
+	for i := 0; i < 10; i++ {
+		if disabled.record(failed(502), 0) {
+			t.Fatal("opened without a threshold")
+		}
+	}
+}
+
+func TestPostStopsAfterRepeatedFailures(t *testing.T) {
+	// a comment per file, the findings of each file are grouped
+	var files []testutil.File
+	var findings []report.Finding
+	for i := 0; i < 5; i++ {
+		file := fmt.Sprintf("module%d/main.tf", i)
+		files = append(files, testutil.AddedFile(file, 20))
+		findings = append(findings, misconfiguration("AVD-AWS-0086", file, 3, 5, "HIGH"))
+	}
+	gh, p := newFakeProvider(t, files...)
+	gh.Fail("POST /repos/org/repo/pulls/1/comments", http.StatusBadGateway, 100)
+
+	outcome := Post(p, findings, Options{BreakAfter: 3})
+
+	var open *CircuitOpenError
+	if !errors.As(outcome.Aborted, &open) || open.Class != ErrorClassServer || open.Failures != 3 {
+		t.Fatalf("aborted with %v, want the breaker open after 3 server errors", outcome.Aborted)
+	}
+	if len(outcome.Errors) != 1 || !errors.As(outcome.Errors[0], &open) {
+		t.Errorf("got the errors %v, want the failures replaced by a single one", outcome.Errors)
+	}
+	if n := gh.Requests("POST /repos/org/repo/pulls/1/comments"); n != 3 {
+		t.Errorf("sent %d comments, want 3 before the breaker opened", n)
+	}
+	var failed, notAttempted int
+	for _, c := range outcome.Unposted {
+		switch c.Status {
+		case StatusFailed:
+			failed++
+		case StatusNotAttempted:
+			notAttempted++
+			if c.Body == "" {
+				t.Errorf("the comment on %s left unposted has no body", c.Finding.ID)
+			}
+		}
+	}
+	if failed != 3 || notAttempted != 2 {
+		t.Errorf("left %d failed and %d not attempted comments unposted, want 3 and 2", failed, notAttempted)
+	}
+}
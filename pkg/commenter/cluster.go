@@ -0,0 +1,73 @@
+package commenter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// maxComponentVulnerabilities caps the vulnerabilities listed for a component
+const maxComponentVulnerabilities = 3
+
+// ClusterSummary renders the vulnerable control plane and node components of a trivy k8s
+// report as a table, the control plane first, with the version each has to be upgraded to
+func ClusterSummary(r *report.ClusterReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Cluster `%s`\n\n", r.Name)
+	if r.Version != "" {
+		fmt.Fprintf(&sb, "Kubernetes %s. ", r.Version)
+	}
+	vulnerable := r.Vulnerable()
+	fmt.Fprintf(&sb, "%d of %d components are vulnerable", len(vulnerable), len(r.Components))
+	if r.Workloads > 0 {
+		fmt.Fprintf(&sb, ", the %d vulnerable workloads aren't listed", r.Workloads)
+	}
+	sb.WriteString(".\n")
+	if len(vulnerable) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString("\n| Component | Role | Version | CRITICAL | HIGH | MEDIUM | LOW | Vulnerabilities | Upgrade to |\n|---|---|---|---|---|---|---|---|---|\n")
+	for _, c := range vulnerable {
+		counts := make(map[string]int)
+		for _, f := range c.Findings {
+			counts[strings.ToUpper(f.Severity)]++
+		}
+		name := fmt.Sprintf("`%s`", escapeTableCell(c.Name))
+		if c.Namespace != "" {
+			name = fmt.Sprintf("`%s/%s`", escapeTableCell(c.Namespace), escapeTableCell(c.Name))
+		}
+		upgrade := c.UpgradeTo
+		if upgrade == "" {
+			upgrade = "no fix"
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %d | %d | %d | %d | %s | %s |\n", name, c.Role, c.Version,
+			counts["CRITICAL"], counts["HIGH"], counts["MEDIUM"], counts["LOW"], componentVulnerabilities(c), upgrade)
+	}
+	return sb.String()
+}
+
+func componentVulnerabilities(c report.ClusterComponent) string {
+	var unique []report.Finding
+	seen := make(map[string]bool)
+	for _, f := range c.Findings {
+		if !seen[f.ID] {
+			seen[f.ID] = true
+			unique = append(unique, f)
+		}
+	}
+	var ids []string
+	for i, f := range unique {
+		if i == maxComponentVulnerabilities {
+			ids = append(ids, fmt.Sprintf("and %d more", len(unique)-i))
+			break
+		}
+		id := fmt.Sprintf("`%s`", f.ID)
+		if f.PrimaryURL != "" {
+			id = fmt.Sprintf("[%s](%s)", id, f.PrimaryURL)
+		}
+		ids = append(ids, id)
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,507 @@
+// Package commenter turns report findings into pull request comments: it deduplicates and
+// groups the findings, anchors them onto repository paths and posts them through a Provider.
+//
+// It is the orchestration layer behind the commenter binary and can be embedded in other
+// services, such as a GitHub App, with their own Provider.
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// Provider writes a comment against a range of lines of a file in the pull request
+type Provider interface {
+	WriteMultiLineComment(file, comment string, startLine, endLine int) error
+}
+
+// Status is what happened to the comment for a group of findings
+type Status string
+
+const (
+	StatusPosted         Status = "written"
+	StatusAlreadyWritten Status = "already_written"
+	StatusNotInPR        Status = "not_in_pr"
+	StatusFailed         Status = "failed"
+	StatusNotAttempted   Status = "not_attempted"
+)
+
+// Filters that leave findings out of the comments, as counted in Outcome.Filtered
+const (
+	FilterDuplicate   = "duplicate"
+	FilterMinSeverity = "min_severity"
+	FilterGrouped     = "grouped"
+	FilterMaxComments = "max_comments"
+	FilterNotInPR     = "not_in_pr"
+	FilterVEX         = "vex"
+	FilterLicense     = "license_allowed"
+	FilterGenerated   = "generated"
+)
+
+// Options controls which findings are commented on and how
+type Options struct {
+	// Context stops posting once done, the comments not attempted are returned in Unposted
+	Context context.Context
+	// MinSeverity is the lowest severity commented on, defaults to every severity
+	MinSeverity string
+	// GateSeverity is the lowest severity that makes the outcome blocking
+	GateSeverity string
+	// MaxComments caps the comments per call, zero means no limit
+	MaxComments int
+	// Owners are mentioned at the end of every comment
+	Owners []string
+	// Routes add the reviewers of the routes matching a finding to the owners mentioned in its
+	// comment
+	Routes []Route
+	// Anchor maps a report target onto the path in the repository, defaults to the target itself
+	Anchor func(target string) string
+	// Formatter renders the comment body, defaults to DefaultFormatter
+	Formatter Formatter
+	// Fatal reports errors after which there is no point posting further comments
+	Fatal func(err error) bool
+	// BreakAfter stops posting after this many consecutive failures of the same ErrorClass,
+	// zero never stops
+	BreakAfter int
+	// OnPrepare is called before a comment is written
+	OnPrepare func(c Comment)
+	// OnResult is called once a comment has been written or rejected
+	OnResult func(c Comment)
+	// Parallel is how many comments are written at once, defaults to one at a time. The
+	// provider must then be safe for concurrent use.
+	Parallel int
+	// Unified comments on a target cover every finding of it at the minimum severity, the
+	// misconfigurations, secrets, vulnerabilities and licenses each in their own section,
+	// rather than only its first finding
+	Unified bool
+	// Scope is written along with the fingerprint of every comment, e.g. the job and target,
+	// so cleaning up the stale comments of one scope leaves those of the others alone
+	Scope string
+}
+
+// Comment is a single comment and what happened when posting it
+type Comment struct {
+	Finding report.Finding
+	// Related are the other findings the comment covers, those of the target for a unified
+	// comment and those on the same lines otherwise
+	Related []report.Finding
+	File    string
+	Body    string
+	Status  Status
+	Err     error
+}
+
+// Outcome summarises a Post call
+type Outcome struct {
+	Comments []Comment
+	Posted   int
+	Skipped  int
+	Errors   []error
+	// Blocking is set when a comment at or above the gate severity is on the PR
+	Blocking bool
+	// Truncated is set when MaxComments stopped further comments
+	Truncated bool
+	// Aborted holds the error that stopped posting, when Fatal matched, the circuit breaker
+	// opened or the Context was done
+	Aborted error
+	// Filtered counts the findings left out by each filter, keyed by the Filter constants
+	Filtered map[string]int
+	// Unposted are the comments never attempted because posting stopped early, along with the
+	// failures that opened the circuit breaker, so they can be reported elsewhere
+	Unposted []Comment
+}
+
+// Post comments on the findings through the provider. Findings are sorted and grouped by
+// target, and the first finding of each target at or above the minimum severity is commented on.
+func Post(p Provider, findings []report.Finding, opts Options) Outcome {
+	// the same rule on many resources usually renders the same comment
+	opts.Formatter = Memoize(formatter(opts))
+	outcome := Outcome{Filtered: map[string]int{
+		FilterDuplicate: 0, FilterMinSeverity: 0, FilterGrouped: 0, FilterMaxComments: 0, FilterNotInPR: 0, FilterVEX: 0,
+		FilterLicense: 0, FilterGenerated: 0,
+	}}
+	// a VEX statement says the vulnerability can't be exploited, or the license policy allows
+	// the license, the finding is only listed in the summary. One on a generated file isn't.
+	for _, f := range findings {
+		switch {
+		case !f.Suppressed:
+		case f.Generated != "":
+			outcome.Filtered[FilterGenerated]++
+		case f.LicenseCategory == report.LicenseAllowed:
+			outcome.Filtered[FilterLicense]++
+		default:
+			outcome.Filtered[FilterVEX]++
+		}
+	}
+	findings = report.Filter(findings, func(f report.Finding) bool { return !f.Suppressed })
+	unique := Dedupe(sorted(findings))
+	outcome.Filtered[FilterDuplicate] = len(findings) - len(unique)
+	groups := Group(unique)
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	var written int
+	var breaker circuitBreaker
+	i := 0
+posting:
+	for i < len(groups) {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			// nothing new is started, only the comments already written are kept
+			outcome.Aborted = opts.Context.Err()
+			outcome.Unposted = remaining(groups[i:], opts, written)
+			break
+		}
+
+		// a window of comments is written at once, never more than the limit still allows
+		var window []Comment
+		for i < len(groups) && len(window) < parallel {
+			group := groups[i]
+			finding, related, ok := commentOn(opts, group)
+			atSeverity := countAtSeverity(group, opts.MinSeverity)
+			if ok && opts.MaxComments > 0 && written+len(window) >= opts.MaxComments {
+				if len(window) > 0 {
+					// comments of the window that aren't part of the PR don't count towards the limit
+					break
+				}
+				outcome.Truncated = true
+				outcome.Skipped += len(groups) - i
+				for _, rest := range groups[i:] {
+					outcome.Filtered[FilterMinSeverity] += len(rest) - countAtSeverity(rest, opts.MinSeverity)
+					outcome.Filtered[FilterMaxComments] += countAtSeverity(rest, opts.MinSeverity)
+				}
+				break posting
+			}
+			i++
+			outcome.Filtered[FilterMinSeverity] += len(group) - atSeverity
+			if !ok {
+				outcome.Skipped++
+				continue
+			}
+			c := Comment{
+				Finding: finding,
+				Related: related,
+				File:    anchor(opts, finding.Target),
+			}
+			if !opts.Unified {
+				// the findings on the lines of the comment are listed in it, the rest left out
+				outcome.Filtered[FilterGrouped] += atSeverity - 1 - len(c.Related)
+			}
+			if opts.OnPrepare != nil {
+				opts.OnPrepare(c)
+			}
+			window = append(window, c)
+		}
+
+		errs := make([]error, len(window))
+		var wg sync.WaitGroup
+		for j := range window {
+			wg.Add(1)
+			go func(c *Comment) {
+				defer wg.Done()
+				var err error
+				c.Body, err = body(opts, c.Finding, c.Related)
+				if err == nil {
+					err = p.WriteMultiLineComment(c.File, c.Body, c.Finding.StartLine, c.Finding.EndLine)
+				}
+				errs[j] = err
+			}(&window[j])
+		}
+		wg.Wait()
+
+		// the results are handled in order, as if the comments had been written one by one
+		var stop bool
+		for j, c := range window {
+			blocking := countAtSeverity(append([]report.Finding{c.Finding}, c.Related...), opts.GateSeverity) > 0
+			switch err := errs[j]; err.(type) {
+			case nil:
+				c.Status = StatusPosted
+				outcome.Blocking = outcome.Blocking || blocking
+				outcome.Posted++
+				written++
+			case prcommenter.CommentAlreadyWrittenError:
+				c.Status = StatusAlreadyWritten
+				outcome.Blocking = outcome.Blocking || blocking
+				outcome.Skipped++
+				written++
+			case prcommenter.CommentNotValidError:
+				// the change isn't part of the PR, so it can't be commented on
+				c.Status = StatusNotInPR
+				outcome.Skipped++
+				outcome.Filtered[FilterNotInPR]++
+			default:
+				c.Status = StatusFailed
+				c.Err = err
+				outcome.Errors = append(outcome.Errors, err)
+			}
+
+			outcome.Comments = append(outcome.Comments, c)
+			if opts.OnResult != nil {
+				opts.OnResult(c)
+			}
+			if stop {
+				// written alongside the comment that stopped the run
+				continue
+			}
+			if c.Err != nil && opts.Fatal != nil && opts.Fatal(c.Err) {
+				outcome.Aborted = c.Err
+				stop = true
+				continue
+			}
+			if breaker.record(c, opts.BreakAfter) {
+				open := &CircuitOpenError{Class: breaker.class, Failures: len(breaker.streak), Last: c.Err}
+				outcome.Aborted = open
+				outcome.Errors = append(outcome.Errors[:len(outcome.Errors)-len(breaker.streak)], open)
+				outcome.Unposted = append(breaker.streak, remaining(groups[i:], opts, written)...)
+				stop = true
+			}
+		}
+		if stop {
+			break
+		}
+	}
+	return outcome
+}
+
+// Dedupe drops findings repeating the rule and location of an earlier finding
+func Dedupe(findings []report.Finding) []report.Finding {
+	seen := NewIndex()
+	var unique []report.Finding
+	for _, f := range findings {
+		if seen.Add(Fingerprint(f)) {
+			unique = append(unique, f)
+		}
+	}
+	return unique
+}
+
+// Group collects the findings by target, keeping the order targets first appear in
+func Group(findings []report.Finding) [][]report.Finding {
+	index := make(map[string]int)
+	var groups [][]report.Finding
+	for _, f := range findings {
+		i, ok := index[f.Target]
+		if !ok {
+			i = len(groups)
+			index[f.Target] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], f)
+	}
+	return groups
+}
+
+// Message is the default comment body for a finding
+func Message(f report.Finding) string {
+	var pkg string
+	if f.PkgName != "" {
+		pkg = fmt.Sprintf("\n\nAffects `%s` version `%s`", f.PkgName, f.InstalledVersion)
+		if f.FixedVersion != "" {
+			pkg += fmt.Sprintf(", fixed in `%s`", f.FixedVersion)
+		}
+	} else {
+		// a vulnerability's lines are the lockfile entry, the package says more
+		pkg = codeSnippet(f)
+	}
+	if f.ModuleResource != "" {
+		pkg += fmt.Sprintf("\n\nRaised on `%s` in `%s`, which this module call creates", f.ModuleResource, f.ModuleLocation)
+	}
+	if len(f.ValuesKeys) > 0 {
+		pkg += fmt.Sprintf("\n\nSet by `%s` in `%s`", strings.Join(f.ValuesKeys, "`, `"), f.ValuesFile)
+	}
+	if f.VEXSeverity != "" {
+		pkg += fmt.Sprintf("\n\nDowngraded from %s, %s according to %s", f.VEXSeverity, f.VEX.Status, f.VEX.Document)
+		if reason := f.VEX.Reason(); reason != "" {
+			pkg += ": " + reason
+		}
+	}
+	if f.LicenseCategory != "" {
+		pkg += fmt.Sprintf("\n\nThe license policy lists `%s` as %s", f.License, f.LicenseCategory)
+	}
+	if f.SecretCategory != "" {
+		pkg += fmt.Sprintf("\n\nTrivy classifies the secret as `%s`, its value is left out of this comment", f.SecretCategory)
+	}
+	if r := f.SecretRemediation; r != nil {
+		pkg += secretRemediation(r)
+	}
+	var suggestion string
+	if f.Suggestion != "" {
+		suggestion = fmt.Sprintf("\n\n```suggestion\n%s\n```", f.Suggestion)
+	}
+	return fmt.Sprintf(`:warning: trivy found a **%s** severity issue from rule `+"`%s`"+`:
+> %s%s%s
+
+More information available %s`,
+		f.Severity, f.ID, f.Description, pkg, suggestion, formatUrls(f.References))
+}
+
+// codeSnippet is a fenced block of the lines of the report the finding is caused by, with the
+// cause lines marked, so the comment shows the problem without scrolling. The lines of a secret
+// are left out, like its value.
+func codeSnippet(f report.Finding) string {
+	if len(f.Code) == 0 || f.Type == "secret" {
+		return ""
+	}
+	fence := "```"
+	for _, line := range f.Code {
+		for strings.Contains(line.Content, fence) {
+			fence += "`"
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\n%s\n", fence)
+	for _, line := range f.Code {
+		marker := " "
+		if line.IsCause {
+			marker = ">"
+		}
+		content := line.Content
+		if line.Truncated {
+			content = "..."
+		}
+		fmt.Fprintf(&sb, "%s %4d | %s\n", marker, line.Number, content)
+	}
+	sb.WriteString(fence)
+	return sb.String()
+}
+
+func secretRemediation(r *report.SecretRemediation) string {
+	var sb strings.Builder
+	if r.Rotation != "" {
+		fmt.Fprintf(&sb, "\n\n**Rotate the secret:** %s", r.Rotation)
+	}
+	if r.Gitignore != "" {
+		fmt.Fprintf(&sb, "\n\nKeep files like this one out of the repo by adding to `.gitignore`:\n```gitignore\n%s\n```", r.Gitignore)
+	}
+	if r.RewriteHistory {
+		sb.WriteString("\n\nDeleting the secret in a later commit leaves it in the git history, so rotate it, and rewrite the history if it must not contain it.")
+	}
+	return sb.String()
+}
+
+// sorted returns a sorted copy, leaving the caller's slice alone
+func sorted(findings []report.Finding) []report.Finding {
+	sorted := append([]report.Finding(nil), findings...)
+	report.SortFindings(sorted)
+	return sorted
+}
+
+func countAtSeverity(findings []report.Finding, minSeverity string) int {
+	var count int
+	for _, f := range findings {
+		if report.SeverityRank(f.Severity) >= report.SeverityRank(minSeverity) {
+			count++
+		}
+	}
+	return count
+}
+
+func firstAtSeverity(findings []report.Finding, minSeverity string) (report.Finding, bool) {
+	for _, f := range findings {
+		if report.SeverityRank(f.Severity) >= report.SeverityRank(minSeverity) {
+			return f, true
+		}
+	}
+	return report.Finding{}, false
+}
+
+func anchor(opts Options, target string) string {
+	if opts.Anchor == nil {
+		return target
+	}
+	return opts.Anchor(target)
+}
+
+func formatter(opts Options) Formatter {
+	if opts.Formatter == nil {
+		return DefaultFormatter
+	}
+	return opts.Formatter
+}
+
+func body(opts Options, f report.Finding, related []report.Finding) (string, error) {
+	comment, err := formatter(opts).Comment(f)
+	if err != nil {
+		return "", err
+	}
+	comment += relatedFindings(related, opts.Unified)
+	// added whatever the formatter, outside of what MemoFormatter caches
+	if f.Permalink != "" {
+		comment += fmt.Sprintf(permalinkLine, f.Permalink)
+	}
+	mentioned := append([]string(nil), opts.Owners...)
+	for _, finding := range append([]report.Finding{f}, related...) {
+		for _, reviewer := range Reviewers(opts.Routes, finding, anchor(opts, finding.Target)) {
+			if !containsFold(mentioned, reviewer) {
+				mentioned = append(mentioned, reviewer)
+			}
+		}
+	}
+	var cc string
+	if len(mentioned) > 0 {
+		cc = fmt.Sprintf("\n\ncc %s", strings.Join(mentioned, " "))
+	}
+	// whatever the formatter, the comment has to fit and the owners are still mentioned, and
+	// later runs still find its fingerprint
+	fingerprint := fingerprintComment(f, opts.Scope)
+	return Truncate(comment, MaxCommentLength-len(cc)-len(fingerprint), TruncatedMarker) + cc + fingerprint, nil
+}
+
+func formatUrls(urls []string) string {
+	urlList := ""
+	for _, url := range urls {
+		if urlList != "" {
+			urlList += " and "
+		}
+		urlList += fmt.Sprintf("[here](%s)", url)
+	}
+	return urlList
+}
+
+// Once wraps the provider so repeating a comment already written through it is reported as
+// already written, for callers posting to the same PR more than once in a run. It's safe for
+// concurrent use, a comment written twice at once waits for the first write.
+func Once(p Provider) Provider {
+	o := &onceProvider{Provider: p, written: NewIndex(), inFlight: make(map[string]bool)}
+	o.done = sync.NewCond(&o.mu)
+	return o
+}
+
+type onceProvider struct {
+	Provider
+	written *Index
+
+	mu sync.Mutex
+	// inFlight are the comments being written, done is signalled when one is
+	inFlight map[string]bool
+	done     *sync.Cond
+}
+
+func (o *onceProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	fp := CommentFingerprint(file, comment, startLine, endLine)
+	o.mu.Lock()
+	for o.inFlight[fp] {
+		o.done.Wait()
+	}
+	if o.written.Has(fp) {
+		o.mu.Unlock()
+		return prcommenter.CommentAlreadyWrittenError{}
+	}
+	o.inFlight[fp] = true
+	o.mu.Unlock()
+
+	err := o.Provider.WriteMultiLineComment(file, comment, startLine, endLine)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inFlight, fp)
+	if err == nil {
+		o.written.Add(fp)
+	}
+	o.done.Broadcast()
+	return err
+}
@@ -0,0 +1,207 @@
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+func newFakeProvider(t *testing.T, files ...testutil.File) (*testutil.FakeGitHub, Provider) {
+	t.Helper()
+	gh := testutil.NewFakeGitHub("org", "repo")
+	t.Cleanup(gh.Close)
+	gh.AddPullRequest(1, files...)
+	p, err := NewGitHub("fake-token", "org", "repo", 1, gh.URL)
+	if err != nil {
+		t.Fatalf("NewGitHub: %v", err)
+	}
+	return gh, p
+}
+
+func misconfiguration(id, target string, startLine, endLine int, severity string) report.Finding {
+	return report.Finding{
+		ID: id, Target: target, StartLine: startLine, EndLine: endLine, Severity: severity,
+		Title: id + " title", Description: id + " description", Message: id + " message",
+	}
+}
+
+func TestPostWritesAComment(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+
+	outcome := Post(p, []report.Finding{misconfiguration("AVD-AWS-0086", "main.tf", 3, 5, "HIGH")}, Options{})
+
+	if outcome.Posted != 1 || len(outcome.Errors) != 0 {
+		t.Fatalf("posted %d with errors %v, want 1 without errors", outcome.Posted, outcome.Errors)
+	}
+	comments := gh.Comments()
+	if len(comments) != 1 {
+		t.Fatalf("got %d comments on the PR, want 1", len(comments))
+	}
+	c := comments[0]
+	if c.GetPath() != "main.tf" || c.GetStartLine() != 3 || c.GetLine() != 5 {
+		t.Errorf("comment on %s lines %d-%d, want main.tf lines 3-5", c.GetPath(), c.GetStartLine(), c.GetLine())
+	}
+	if !strings.Contains(c.GetBody(), "AVD-AWS-0086") || WrittenFingerprint(c.GetBody()) == "" {
+		t.Errorf("comment body lacks the rule or the fingerprint:\n%s", c.GetBody())
+	}
+}
+
+func TestPostSkipsFilesOutsideThePR(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+
+	outcome := Post(p, []report.Finding{misconfiguration("AVD-AWS-0086", "other.tf", 3, 5, "HIGH")}, Options{})
+
+	if outcome.Posted != 0 || outcome.Filtered[FilterNotInPR] != 1 {
+		t.Errorf("posted %d and filtered %d as not in the PR, want 0 and 1", outcome.Posted, outcome.Filtered[FilterNotInPR])
+	}
+	if len(gh.Comments()) != 0 {
+		t.Errorf("got %d comments on the PR, want none", len(gh.Comments()))
+	}
+}
+
+func TestPostDedupesRepeatedFindings(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+	f := misconfiguration("AVD-AWS-0086", "main.tf", 3, 5, "HIGH")
+
+	outcome := Post(p, []report.Finding{f, f, f}, Options{})
+
+	if outcome.Posted != 1 || outcome.Filtered[FilterDuplicate] != 2 {
+		t.Errorf("posted %d and filtered %d duplicates, want 1 and 2", outcome.Posted, outcome.Filtered[FilterDuplicate])
+	}
+	if len(gh.Comments()) != 1 {
+		t.Errorf("got %d comments on the PR, want 1", len(gh.Comments()))
+	}
+}
+
+func TestPostUpdatesTheCommentOfAnEarlierRun(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+	findings := []report.Finding{misconfiguration("AVD-AWS-0086", "main.tf", 3, 5, "HIGH")}
+	Post(p, findings, Options{})
+
+	again, err := NewGitHub("fake-token", "org", "repo", 1, gh.URL)
+	if err != nil {
+		t.Fatalf("NewGitHub: %v", err)
+	}
+	Post(again, findings, Options{})
+
+	comments := gh.Comments()
+	if len(comments) != 1 {
+		t.Fatalf("got %d comments on the PR, want the earlier one only", len(comments))
+	}
+	if n := gh.Requests(fmt.Sprintf("PATCH /repos/org/repo/pulls/comments/%d", comments[0].GetID())); n != 1 {
+		t.Errorf("the earlier comment was edited %d times, want once", n)
+	}
+}
+
+func TestPostFiltersBySeverityAndLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		wantPosted  int
+		wantBlocked bool
+	}{
+		{name: "every severity", opts: Options{GateSeverity: "CRITICAL"}, wantPosted: 3, wantBlocked: true},
+		{name: "min severity", opts: Options{MinSeverity: "HIGH", GateSeverity: "CRITICAL"}, wantPosted: 2, wantBlocked: true},
+		{name: "below the gate", opts: Options{MaxComments: 1, GateSeverity: "CRITICAL"}, wantPosted: 1},
+		{name: "no gate", opts: Options{MinSeverity: "CRITICAL"}, wantPosted: 1, wantBlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, p := newFakeProvider(t, testutil.AddedFile("a.tf", 10), testutil.AddedFile("b.tf", 10), testutil.AddedFile("c.tf", 10))
+			findings := []report.Finding{
+				misconfiguration("A", "a.tf", 1, 1, "LOW"),
+				misconfiguration("B", "b.tf", 1, 1, "HIGH"),
+				misconfiguration("C", "c.tf", 1, 1, "CRITICAL"),
+			}
+
+			outcome := Post(p, findings, tt.opts)
+
+			if outcome.Posted != tt.wantPosted {
+				t.Errorf("posted %d, want %d", outcome.Posted, tt.wantPosted)
+			}
+			if outcome.Blocking != tt.wantBlocked {
+				t.Errorf("blocking %t, want %t", outcome.Blocking, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestPostLeavesSuppressedFindingsOut(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+	suppressed := misconfiguration("CVE-2024-0001", "main.tf", 3, 3, "CRITICAL")
+	suppressed.Suppressed = true
+
+	outcome := Post(p, []report.Finding{suppressed}, Options{})
+
+	if outcome.Posted != 0 || outcome.Filtered[FilterVEX] != 1 || len(gh.Comments()) != 0 {
+		t.Errorf("posted %d and filtered %d by VEX, want 0 and 1", outcome.Posted, outcome.Filtered[FilterVEX])
+	}
+}
+
+func TestPostStopsOnAFatalError(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("a.tf", 10), testutil.AddedFile("b.tf", 10))
+	gh.Fail("POST /repos/org/repo/pulls/1/comments", 403, 10)
+	findings := []report.Finding{misconfiguration("A", "a.tf", 1, 1, "HIGH"), misconfiguration("B", "b.tf", 1, 1, "HIGH")}
+
+	outcome := Post(p, findings, Options{Fatal: func(error) bool { return true }})
+
+	if outcome.Aborted == nil || len(outcome.Errors) != 1 {
+		t.Errorf("aborted %v with %d errors, want aborted after the first error", outcome.Aborted, len(outcome.Errors))
+	}
+}
+
+func TestPostStopsWhenTheContextIsDone(t *testing.T) {
+	_, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outcome := Post(p, []report.Finding{misconfiguration("A", "main.tf", 1, 1, "HIGH")}, Options{Context: ctx})
+
+	if !errors.Is(outcome.Aborted, context.Canceled) || len(outcome.Unposted) != 1 {
+		t.Errorf("aborted %v with %d unposted comments, want cancelled with 1", outcome.Aborted, len(outcome.Unposted))
+	}
+}
+
+// countingProvider records the bodies of the comments written through it
+type countingProvider struct {
+	written chan string
+}
+
+func (p *countingProvider) WriteMultiLineComment(file, comment string, startLine, endLine int) error {
+	p.written <- comment
+	return nil
+}
+
+func (p *countingProvider) WriteLineComment(file, comment string, line int) error {
+	return p.WriteMultiLineComment(file, comment, line, line)
+}
+
+func TestOnceWritesAConcurrentDuplicateOnce(t *testing.T) {
+	p := &countingProvider{written: make(chan string, 10)}
+	once := Once(p)
+
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func() { errs <- once.WriteMultiLineComment("main.tf", "body", 1, 2) }()
+	}
+	var written, already int
+	for i := 0; i < 10; i++ {
+		switch err := <-errs; err.(type) {
+		case nil:
+			written++
+		case prcommenter.CommentAlreadyWrittenError:
+			already++
+		default:
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if written != 1 || already != 9 || len(p.written) != 1 {
+		t.Errorf("written %d and already written %d, want 1 and 9", written, already)
+	}
+}
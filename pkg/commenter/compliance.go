@@ -0,0 +1,81 @@
+package commenter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// maxControlResources caps the failing resources listed for a control
+const maxControlResources = 5
+
+// ComplianceSummary renders the controls of a compliance report as a pass/fail table, the
+// failing ones first. Each failing resource links to wherever link points for its finding,
+// e.g. its lines in the repo, or is shown without a link when link returns nothing.
+func ComplianceSummary(r *report.ComplianceReport, link func(f report.Finding) string) string {
+	var sb strings.Builder
+	title := r.Title
+	if title == "" {
+		title = r.ID
+	}
+	fmt.Fprintf(&sb, "## %s\n\n", title)
+	if r.Description != "" {
+		fmt.Fprintf(&sb, "%s\n\n", r.Description)
+	}
+	counts := make(map[string]int)
+	for _, c := range r.Controls {
+		counts[c.Status]++
+	}
+	fmt.Fprintf(&sb, "%d of %d controls pass, %d fail", counts[report.ControlPass], len(r.Controls), counts[report.ControlFail])
+	if counts[report.ControlManual] > 0 {
+		fmt.Fprintf(&sb, " and %d need a manual check", counts[report.ControlManual])
+	}
+	sb.WriteString("\n\n| Control | Name | Severity | Status | Failing resources |\n|---|---|---|---|---|\n")
+
+	for _, status := range []string{report.ControlFail, report.ControlManual, report.ControlPass} {
+		for _, c := range r.Controls {
+			if c.Status != status {
+				continue
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", c.ID, escapeTableCell(c.Name), c.Severity, controlStatus(c.Status), controlResources(c, link))
+		}
+	}
+	return sb.String()
+}
+
+func controlStatus(status string) string {
+	switch status {
+	case report.ControlFail:
+		return ":x: fail"
+	case report.ControlPass:
+		return ":white_check_mark: pass"
+	}
+	return "manual"
+}
+
+func controlResources(c report.ComplianceControl, link func(f report.Finding) string) string {
+	if c.Status != report.ControlFail {
+		return ""
+	}
+	if len(c.Findings) == 0 {
+		return fmt.Sprintf("%d", c.Failures)
+	}
+	var resources []string
+	for i, f := range c.Findings {
+		if i == maxControlResources {
+			resources = append(resources, fmt.Sprintf("and %d more", len(c.Findings)-i))
+			break
+		}
+		name := f.Resource
+		if name == "" {
+			name = f.Target
+		}
+		resource := fmt.Sprintf("`%s`", escapeTableCell(name))
+		if url := link(f); url != "" {
+			resource = fmt.Sprintf("[%s](%s)", resource, url)
+		}
+		resources = append(resources, resource)
+	}
+	return strings.Join(resources, ", ")
+}
@@ -0,0 +1,64 @@
+package commenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// ExecFormatter delegates formatting to an external program, so custom formatters can be
+// shipped without building the commenter. The program is given a JSON request on stdin,
+// either {"Kind":"comment","Finding":{...}} or {"Kind":"summary","Findings":[...]},
+// and prints the markdown to stdout. A non-zero exit fails the comment.
+type ExecFormatter struct {
+	Command string
+	Args    []string
+}
+
+type execRequest struct {
+	Kind     string           `json:"Kind"`
+	Finding  *report.Finding  `json:"Finding,omitempty"`
+	Findings []report.Finding `json:"Findings,omitempty"`
+}
+
+// NewExecFormatter splits the command line on whitespace into the program and its arguments
+func NewExecFormatter(commandLine string) (*ExecFormatter, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no command given for the exec formatter")
+	}
+	return &ExecFormatter{Command: fields[0], Args: fields[1:]}, nil
+}
+
+func (e *ExecFormatter) Comment(f report.Finding) (string, error) {
+	comment, err := e.run(execRequest{Kind: "comment", Finding: &f})
+	return strings.TrimRight(comment, "\n"), err
+}
+
+func (e *ExecFormatter) Summary(findings []report.Finding) (string, error) {
+	return e.run(execRequest{Kind: "summary", Findings: findings})
+}
+
+func (e *ExecFormatter) run(request execRequest) (string, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(e.Command, e.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("formatter %s failed for the %s: %w (%s)", e.Command, request.Kind, err, msg)
+		}
+		return "", fmt.Errorf("formatter %s failed for the %s: %w", e.Command, request.Kind, err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,353 @@
+package commenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// Formatter renders the comment body of a finding and the summary of a report
+type Formatter interface {
+	Comment(f report.Finding) (string, error)
+	Summary(findings []report.Finding) (string, error)
+}
+
+// DefaultFormatter is used when no formatter is selected
+var DefaultFormatter Formatter = defaultFormatter{}
+
+// execFormatterPrefix selects an ExecFormatter by name, e.g. exec:./format-finding.sh
+const execFormatterPrefix = "exec:"
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{"default": DefaultFormatter}
+)
+
+// RegisterFormatter makes a formatter available by name to LookupFormatter,
+// replacing any formatter already registered under the name
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[name] = f
+}
+
+// LookupFormatter returns the formatter registered under the name. An empty name is the
+// default formatter, exec:<command> runs the command as an ExecFormatter and
+// template:<path> renders the template file with a TemplateFormatter.
+func LookupFormatter(name string) (Formatter, error) {
+	if name == "" {
+		return DefaultFormatter, nil
+	}
+	if command, ok := strings.CutPrefix(name, execFormatterPrefix); ok {
+		return NewExecFormatter(command)
+	}
+	if path, ok := strings.CutPrefix(name, templateFormatterPrefix); ok {
+		return NewTemplateFormatter(path)
+	}
+
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown formatter %q, expected one of %s, %s<command> or %s<path>", name, strings.Join(formatterNames(), ", "), execFormatterPrefix, templateFormatterPrefix)
+	}
+	return f, nil
+}
+
+func formatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type defaultFormatter struct{}
+
+func (defaultFormatter) Comment(f report.Finding) (string, error) {
+	return Message(f), nil
+}
+
+func (defaultFormatter) Summary(findings []report.Finding) (string, error) {
+	// the findings on generated files are left out altogether, not listed as suppressed
+	findings = sorted(report.Filter(findings, func(f report.Finding) bool { return f.Generated == "" }))
+	var vex, licenses []report.Finding
+	for _, f := range findings {
+		if f.VEX != nil {
+			vex = append(vex, f)
+		}
+		if f.License != "" {
+			licenses = append(licenses, f)
+		}
+	}
+	findings = report.Filter(findings, func(f report.Finding) bool { return !f.Suppressed })
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[strings.ToUpper(f.Severity)]++
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## trivy results\n\n")
+	if len(findings) == 0 {
+		sb.WriteString("No issues found.\n")
+		writeLicenses(&sb, licenses)
+		writeVEX(&sb, vex)
+		return sb.String(), nil
+	}
+
+	fmt.Fprintf(&sb, "trivy found %s\n\n", IssueCount(len(findings)))
+	sb.WriteString("| Severity | Count |\n|---|---|\n")
+	for i := len(report.Severities) - 1; i >= 0; i-- {
+		if counts[report.Severities[i]] > 0 {
+			fmt.Fprintf(&sb, "| %s | %d |\n", report.Severities[i], counts[report.Severities[i]])
+		}
+	}
+
+	if secrets := historySecrets(findings); secrets > 0 {
+		fmt.Fprintf(&sb, "\n> [!WARNING]\n> %d secrets were committed. Deleting them in a later commit leaves them in the git history, so rotate them, and rewrite the history with `git filter-repo` or BFG if it must not contain them.\n", secrets)
+	}
+
+	sb.WriteString("\n| File | Lines | Rule | Severity | Title |\n|---|---|---|---|---|\n")
+	for _, f := range findings {
+		lines := formatLines(f.StartLine, f.EndLine)
+		if f.Permalink != "" {
+			lines = fmt.Sprintf("[%s](%s)", lines, f.Permalink)
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s | `%s` | %s | %s |\n", f.Target, lines, f.ID, f.Severity, escapeTableCell(f.Title))
+	}
+	writeImages(&sb, findings)
+	writeLicenses(&sb, licenses)
+	writeVEX(&sb, vex)
+	return sb.String(), nil
+}
+
+// maxInstruction is the length an instruction is cut to in the layers table
+const maxInstruction = 100
+
+// writeImages breaks the vulnerabilities of each scanned image down by OS and language
+// packages and by the layer that installed them, as they have no lines to comment on
+func writeImages(sb *strings.Builder, findings []report.Finding) {
+	images := make(map[string][]report.Finding)
+	var names []string
+	for _, f := range findings {
+		if f.Image == "" || f.PkgName == "" {
+			continue
+		}
+		if _, ok := images[f.Image]; !ok {
+			names = append(names, f.Image)
+		}
+		images[f.Image] = append(images[f.Image], f)
+	}
+	sort.Strings(names)
+
+	header := func(first ...string) string {
+		columns := first
+		for i := len(report.Severities) - 1; i >= 0; i-- {
+			columns = append(columns, report.Severities[i])
+		}
+		return "| " + strings.Join(columns, " | ") + " |\n|" + strings.Repeat("---|", len(columns)) + "\n"
+	}
+	counts := func(findings []report.Finding) string {
+		bySeverity := make(map[string]int)
+		for _, f := range findings {
+			bySeverity[strings.ToUpper(f.Severity)]++
+		}
+		var cells []string
+		for i := len(report.Severities) - 1; i >= 0; i-- {
+			cells = append(cells, fmt.Sprintf("%d", bySeverity[report.Severities[i]]))
+		}
+		return strings.Join(cells, " | ")
+	}
+
+	for _, name := range names {
+		vulnerabilities := images[name]
+		fmt.Fprintf(sb, "\n### Image `%s`\n\n", name)
+		sb.WriteString(header("Packages"))
+		osPkgs := report.Filter(vulnerabilities, func(f report.Finding) bool { return f.Class == "os-pkgs" })
+		langPkgs := report.Filter(vulnerabilities, func(f report.Finding) bool { return f.Class != "os-pkgs" })
+		fmt.Fprintf(sb, "| OS packages | %s |\n| Language packages | %s |\n", counts(osPkgs), counts(langPkgs))
+
+		layers := make(map[report.ImageLayer][]report.Finding)
+		var order []report.ImageLayer
+		for _, f := range vulnerabilities {
+			layer := f.Layer
+			if _, ok := layers[layer]; !ok {
+				order = append(order, layer)
+			}
+			layers[layer] = append(layers[layer], f)
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			// the layers the image doesn't list last
+			if (order[i].Index == 0) != (order[j].Index == 0) {
+				return order[i].Index != 0
+			}
+			return order[i].Index < order[j].Index
+		})
+		sb.WriteString("\n" + header("Layer", "Instruction"))
+		for _, layer := range order {
+			id := fmt.Sprintf("%d", layer.Index)
+			if layer.Index == 0 {
+				id = shortDigest(layer.DiffID, layer.Digest)
+			}
+			instruction := "unknown"
+			if i := layer.Instruction(); i != "" {
+				instruction = "`" + escapeTableCell(truncateInstruction(i)) + "`"
+			}
+			fmt.Fprintf(sb, "| %s | %s | %s |\n", id, instruction, counts(layers[layer]))
+		}
+	}
+}
+
+func truncateInstruction(instruction string) string {
+	if len(instruction) <= maxInstruction {
+		return instruction
+	}
+	return strings.ToValidUTF8(instruction[:maxInstruction], "") + "…"
+}
+
+// shortDigest is the first 12 characters of the layer's digest, like docker shows them
+func shortDigest(digests ...string) string {
+	for _, d := range digests {
+		if _, hex, ok := strings.Cut(d, ":"); ok && len(hex) >= 12 {
+			return hex[:12]
+		}
+	}
+	return "-"
+}
+
+// writeLicenses lists the license of each package with the category of the license policy it
+// falls into, the allowed ones included
+func writeLicenses(sb *strings.Builder, findings []report.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+	sb.WriteString("\n### Licenses\n\n")
+	sb.WriteString("| Package | License | Policy | Severity |\n|---|---|---|---|\n")
+	for _, f := range findings {
+		category := f.LicenseCategory
+		if category == "" {
+			category = "not listed"
+		}
+		severity := f.Severity
+		if f.Suppressed {
+			severity = "-"
+		}
+		fmt.Fprintf(sb, "| `%s` | %s | %s | %s |\n", f.Resource, escapeTableCell(f.License), category, severity)
+	}
+}
+
+// writeVEX lists the vulnerabilities VEX statements suppressed or downgraded, with the reason
+func writeVEX(sb *strings.Builder, findings []report.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+	sb.WriteString("\n### VEX\n\n")
+	sb.WriteString("| Vulnerability | Package | Status | Action | Justification |\n|---|---|---|---|---|\n")
+	for _, f := range findings {
+		var action string
+		switch {
+		case f.Suppressed:
+			action = "suppressed"
+		case f.VEXSeverity != "":
+			action = fmt.Sprintf("downgraded from %s", f.VEXSeverity)
+		default:
+			action = fmt.Sprintf("kept at %s", f.Severity)
+		}
+		fmt.Fprintf(sb, "| `%s` | `%s` %s | %s | %s | %s |\n", f.ID, f.PkgName, f.InstalledVersion, f.VEX.Status, action, escapeTableCell(f.VEX.Reason()))
+	}
+}
+
+// maxDependencyChanges caps the rows of the dependency changes, a lockfile regenerated from
+// scratch would otherwise list every package
+const maxDependencyChanges = 100
+
+// DependencyChanges renders the dependencies added and removed by the PR with their worst
+// vulnerability, the vulnerable additions first, as a section appended to the summary. It is
+// empty when no dependency changed.
+func DependencyChanges(added, removed []report.Dependency) string {
+	if len(added) == 0 && len(removed) == 0 {
+		return ""
+	}
+	type change struct {
+		kind string
+		dep  report.Dependency
+	}
+	var changes []change
+	for _, d := range added {
+		changes = append(changes, change{"added", d})
+	}
+	for _, d := range removed {
+		changes = append(changes, change{"removed", d})
+	}
+	worst := func(d report.Dependency) int {
+		if v, ok := d.Worst(); ok {
+			return report.SeverityRank(v.Severity) + 1
+		}
+		return 0
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].kind != changes[j].kind {
+			return changes[i].kind == "added"
+		}
+		return worst(changes[i].dep) > worst(changes[j].dep)
+	})
+
+	var sb strings.Builder
+	sb.WriteString("\n### Dependency changes\n\n")
+	fmt.Fprintf(&sb, "%d dependencies added, %d removed\n\n", len(added), len(removed))
+	sb.WriteString("| Change | Dependency | Version | Worst vulnerability |\n|---|---|---|---|\n")
+	for i, c := range changes {
+		if i == maxDependencyChanges {
+			fmt.Fprintf(&sb, "\n_%d more changes are not shown._\n", len(changes)-i)
+			break
+		}
+		vulnerability := "none"
+		if v, ok := c.dep.Worst(); ok {
+			vulnerability = fmt.Sprintf("%s `%s`", v.Severity, v.ID)
+			if more := len(c.dep.Vulnerabilities) - 1; more > 0 {
+				vulnerability += fmt.Sprintf(" and %d more", more)
+			}
+		}
+		fmt.Fprintf(&sb, "| %s | `%s` | %s | %s |\n", c.kind, c.dep.Name, escapeTableCell(c.dep.Version), vulnerability)
+	}
+	return sb.String()
+}
+
+// historySecrets counts the secret findings flagged as needing the history rewritten
+func historySecrets(findings []report.Finding) int {
+	var count int
+	for _, f := range findings {
+		if f.SecretRemediation != nil && f.SecretRemediation.RewriteHistory {
+			count++
+		}
+	}
+	return count
+}
+
+func formatLines(startLine, endLine int) string {
+	switch {
+	case startLine < 1:
+		// a vulnerability of an image or a package the lockfile doesn't list
+		return "–"
+	case startLine >= endLine:
+		return fmt.Sprintf("%d", startLine)
+	}
+	return fmt.Sprintf("%d-%d", startLine, endLine)
+}
+
+// IssueCount is the number of issues with the noun agreeing, e.g. 1 issue or 3 issues
+func IssueCount(n int) string {
+	if n == 1 {
+		return "1 issue"
+	}
+	return fmt.Sprintf("%d issues", n)
+}
+
+func escapeTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,98 @@
+package commenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestFormatLines(t *testing.T) {
+	tests := []struct {
+		startLine, endLine int
+		want               string
+	}{
+		{startLine: 3, endLine: 3, want: "3"},
+		{startLine: 3, endLine: 7, want: "3-7"},
+		{startLine: 3, endLine: 0, want: "3"},
+		{startLine: 0, endLine: 0, want: "–"},
+	}
+	for _, tt := range tests {
+		if got := formatLines(tt.startLine, tt.endLine); got != tt.want {
+			t.Errorf("formatLines(%d, %d) = %q, want %q", tt.startLine, tt.endLine, got, tt.want)
+		}
+	}
+}
+
+func TestIssueCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0 issues", 1: "1 issue", 2: "2 issues"} {
+		if got := IssueCount(n); got != want {
+			t.Errorf("IssueCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	findings := []report.Finding{
+		{ID: "AVD-AWS-0086", Target: "main.tf", StartLine: 3, EndLine: 5, Severity: "HIGH", Title: "a | b"},
+		{ID: "CVE-2024-0001", Target: "alpine:3.18", Severity: "CRITICAL", PkgName: "openssl", Title: "openssl"},
+		{ID: "AVD-AWS-0087", Target: "main.tf", StartLine: 9, EndLine: 9, Severity: "LOW", Suppressed: true},
+		{ID: "AVD-AWS-0088", Target: "gen.tf", StartLine: 1, EndLine: 1, Severity: "LOW", Generated: "generated"},
+	}
+
+	summary, err := DefaultFormatter.Summary(findings)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+
+	for _, want := range []string{
+		"trivy found 2 issues",
+		"| CRITICAL | 1 |",
+		"| HIGH | 1 |",
+		"| `main.tf` | 3-5 | `AVD-AWS-0086` | HIGH | a \\| b |",
+		"| `alpine:3.18` | – | `CVE-2024-0001` | CRITICAL | openssl |",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("the summary lacks %q:\n%s", want, summary)
+		}
+	}
+	for _, unwanted := range []string{"AVD-AWS-0087", "AVD-AWS-0088"} {
+		if strings.Contains(summary, unwanted) {
+			t.Errorf("the summary lists %s, which is suppressed or generated:\n%s", unwanted, summary)
+		}
+	}
+	if strings.Index(summary, "CVE-2024-0001") > strings.Index(summary, "AVD-AWS-0086") {
+		t.Errorf("the summary doesn't list the most severe finding first:\n%s", summary)
+	}
+}
+
+func TestSummaryWithoutFindings(t *testing.T) {
+	summary, err := DefaultFormatter.Summary(nil)
+	if err != nil || !strings.Contains(summary, "No issues found.") {
+		t.Errorf("got the summary %q (%v), want no issues", summary, err)
+	}
+}
+
+func TestReviewBody(t *testing.T) {
+	comments := []Comment{
+		{Finding: report.Finding{ID: "A", Severity: "LOW", StartLine: 1, EndLine: 1, Title: "low", Permalink: "https://permalink/a"}, File: "main.tf", Body: "a"},
+		{Finding: report.Finding{ID: "B", Severity: "CRITICAL", StartLine: 2, EndLine: 4, Title: "critical"}, File: "main.tf", Body: "b"},
+	}
+	links := map[string]string{"b": "https://comment/b"}
+
+	body := ReviewBody(comments, func(c Comment) string { return links[c.Body] })
+
+	for _, want := range []string{
+		"trivy commented on 2 issues",
+		"**Jump to:** [CRITICAL (1)](#critical) · [LOW (1)](#low)",
+		"`B` in [`main.tf` lines 2-4](https://comment/b): critical",
+		"`A` in [`main.tf` line 1](https://permalink/a): low",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the review body lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "### CRITICAL") > strings.Index(body, "### LOW") {
+		t.Errorf("the review body doesn't list the most severe first:\n%s", body)
+	}
+}
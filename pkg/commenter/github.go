@@ -0,0 +1,29 @@
+package commenter
+
+import (
+	"fmt"
+	"net/url"
+
+	prcommenter "github.com/owenrumney/go-github-pr-commenter/commenter"
+)
+
+// NewGitHub creates a Provider commenting on a GitHub pull request. The apiURL selects a
+// GitHub Enterprise server, leave it empty for github.com.
+func NewGitHub(token, owner, repo string, prNo int, apiURL string) (Provider, error) {
+	var c *prcommenter.Commenter
+	var err error
+	if apiURL == "" || apiURL == "https://api.github.com" {
+		c, err = prcommenter.NewCommenter(token, owner, repo, prNo)
+	} else {
+		var u *url.URL
+		u, err = url.Parse(apiURL)
+		if err == nil {
+			enterpriseURL := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+			c, err = prcommenter.NewEnterpriseCommenter(token, enterpriseURL, enterpriseURL, owner, repo, prNo)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
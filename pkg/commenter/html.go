@@ -0,0 +1,151 @@
+package commenter
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// htmlReport is a standalone page, its styles and scripts inline so it opens from an artifact
+// without a server
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"rank":  report.SeverityRank,
+	"lines": formatLines,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+.chips { margin: 1em 0; }
+.chip { display: inline-block; border: 1px solid #d0d7de; border-radius: 2em; padding: .2em .8em; margin: .2em; cursor: pointer; user-select: none; }
+.chip.off { opacity: .4; text-decoration: line-through; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #d0d7de; padding: .4em .6em; text-align: left; vertical-align: top; }
+th { cursor: pointer; background: #f6f8fa; position: sticky; top: 0; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+.critical { color: #82071e; font-weight: bold; }
+.high { color: #cf222e; font-weight: bold; }
+.medium { color: #9a6700; }
+.low { color: #0969da; }
+pre { background: #f6f8fa; padding: .5em; overflow-x: auto; margin: .4em 0 0; }
+pre .cause { background: #ffebe9; display: inline-block; width: 100%; }
+details summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>{{ len .Findings }} findings</p>
+<div class="chips">
+{{- range .Severities }}
+<span class="chip {{ lower . }}" data-filter="severity" data-value="{{ . }}">{{ . }} ({{ index $.Counts . }})</span>
+{{- end }}
+{{- range .Types }}
+<span class="chip" data-filter="type" data-value="{{ . }}">{{ . }}</span>
+{{- end }}
+</div>
+<table>
+<thead><tr><th data-key="rank">Severity</th><th data-key="file">File</th><th data-key="line">Lines</th><th data-key="rule">Rule</th><th data-key="type">Type</th><th data-key="title">Title</th></tr></thead>
+<tbody>
+{{- range .Findings }}
+<tr data-severity="{{ upper .Severity }}" data-type="{{ .Type }}" data-rank="{{ rank .Severity }}" data-file="{{ .Target }}" data-line="{{ .StartLine }}" data-rule="{{ .ID }}" data-title="{{ .Title }}">
+<td class="{{ lower .Severity }}">{{ .Severity }}</td>
+<td>{{ if .Permalink }}<a href="{{ .Permalink }}">{{ .Target }}</a>{{ else }}{{ .Target }}{{ end }}</td>
+<td>{{ if gt .StartLine 0 }}{{ lines .StartLine .EndLine }}{{ end }}</td>
+<td>{{ if .PrimaryURL }}<a href="{{ .PrimaryURL }}">{{ .ID }}</a>{{ else }}{{ .ID }}{{ end }}</td>
+<td>{{ .Type }}</td>
+<td>
+{{- if or .Code .Description }}
+<details><summary>{{ .Title }}</summary>
+<p>{{ .Description }}</p>
+{{- if .PkgName }}<p>Affects <code>{{ .PkgName }}</code> version <code>{{ .InstalledVersion }}</code>{{ if .FixedVersion }}, fixed in <code>{{ .FixedVersion }}</code>{{ end }}</p>{{ end }}
+{{- if .Code }}
+<pre>{{ range .Code }}{{ if .IsCause }}<span class="cause">{{ end }}{{ printf "%4d" .Number }}  {{ .Content }}{{ if .IsCause }}</span>{{ end }}
+{{ end }}</pre>
+{{- end }}
+</details>
+{{- else }}{{ .Title }}{{ end }}
+</td>
+</tr>
+{{- end }}
+</tbody>
+</table>
+<script>
+(function () {
+  var rows = Array.prototype.slice.call(document.querySelectorAll("tbody tr"));
+  var hidden = { severity: {}, type: {} };
+  function filter() {
+    rows.forEach(function (row) {
+      row.style.display = hidden.severity[row.dataset.severity] || hidden.type[row.dataset.type] ? "none" : "";
+    });
+  }
+  document.querySelectorAll(".chip").forEach(function (chip) {
+    chip.addEventListener("click", function () {
+      var values = hidden[chip.dataset.filter];
+      values[chip.dataset.value] = !values[chip.dataset.value];
+      chip.classList.toggle("off", values[chip.dataset.value]);
+      filter();
+    });
+  });
+  document.querySelectorAll("th").forEach(function (th) {
+    th.addEventListener("click", function () {
+      var key = th.dataset.key, numeric = key === "rank" || key === "line";
+      var order = th.classList.contains("asc") ? -1 : 1;
+      document.querySelectorAll("th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+      th.classList.add(order === 1 ? "asc" : "desc");
+      rows.sort(function (a, b) {
+        var x = a.dataset[key], y = b.dataset[key];
+        return order * (numeric ? x - y : x.localeCompare(y));
+      });
+      var body = document.querySelector("tbody");
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
+
+// HTMLReport renders the findings as a standalone HTML page: a table, the most severe first and
+// sorted by clicking its headers, chips filtering it by severity and type, and each finding's code excerpt with the
+// cause lines highlighted. It gives reports too large to read as comments a richer view.
+func HTMLReport(title string, findings []report.Finding) (string, error) {
+	findings = sorted(findings)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return report.SeverityRank(findings[i].Severity) > report.SeverityRank(findings[j].Severity)
+	})
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	var types []string
+	for _, f := range findings {
+		counts[strings.ToUpper(f.Severity)]++
+		if !seen[f.Type] {
+			seen[f.Type] = true
+			types = append(types, f.Type)
+		}
+	}
+	sort.Strings(types)
+	var severities []string
+	for i := len(report.Severities) - 1; i >= 0; i-- {
+		if counts[report.Severities[i]] > 0 {
+			severities = append(severities, report.Severities[i])
+		}
+	}
+
+	var sb strings.Builder
+	err := htmlReport.Execute(&sb, struct {
+		Title      string
+		Findings   []report.Finding
+		Severities []string
+		Counts     map[string]int
+		Types      []string
+	}{title, findings, severities, counts, types})
+	return sb.String(), err
+}
@@ -0,0 +1,120 @@
+package commenter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// Fingerprint identifies a finding by its rule and location, and the package of a
+// vulnerability. Findings sharing a fingerprint are the same issue, however often the report
+// repeats it.
+func Fingerprint(f report.Finding) string {
+	return fmt.Sprintf("%s|%s|%d|%d|%s", f.Target, f.ID, f.StartLine, f.EndLine, f.PkgName)
+}
+
+// StableFingerprint identifies a finding across commits by its rule, its file and the content
+// of its lines rather than their numbers, which shift as the PR changes. Without a LineHash the
+// lines are all there is to go by.
+func StableFingerprint(f report.Finding) string {
+	lines := f.LineHash
+	if lines == "" {
+		lines = fmt.Sprintf("%d-%d", f.StartLine, f.EndLine)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s", f.ID, f.Target, lines, f.PkgName)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// fingerprintMarker ends every comment with the StableFingerprint of its finding, hidden when
+// the markdown is rendered, and the scope of the job that wrote it when it has one
+const fingerprintMarker = "\n\n<!-- trivy-fingerprint %s -->"
+
+var fingerprintPattern = regexp.MustCompile(`<!-- trivy-fingerprint ([0-9a-f]+)(?: scope=(\S+))? -->`)
+
+// fingerprintComment is the marker of the finding written by the scope
+func fingerprintComment(f report.Finding, scope string) string {
+	if scope == "" {
+		return fmt.Sprintf(fingerprintMarker, StableFingerprint(f))
+	}
+	return fmt.Sprintf(fingerprintMarker, StableFingerprint(f)+" scope="+url.PathEscape(scope))
+}
+
+// WrittenFingerprint is the StableFingerprint a comment was written with, empty for a comment
+// without one
+func WrittenFingerprint(body string) string {
+	if m := fingerprintPattern.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// WrittenScope is the Options.Scope a comment was written with, empty for a comment without
+// one or written before comments had scopes
+func WrittenScope(body string) string {
+	if m := fingerprintPattern.FindStringSubmatch(body); m != nil {
+		if scope, err := url.PathUnescape(m[2]); err == nil {
+			return scope
+		}
+	}
+	return ""
+}
+
+// CommentFingerprint identifies a comment by where it is written and what it says
+func CommentFingerprint(file, body string, startLine, endLine int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%s", file, startLine, endLine, body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Index is a set of fingerprints built once per run, so dedupe, update and resolve decisions
+// are a lookup rather than a scan of every earlier finding or comment. It is safe for
+// concurrent use.
+type Index struct {
+	mu      sync.Mutex
+	entries map[string]bool
+}
+
+// NewIndex creates an index holding the fingerprints
+func NewIndex(fingerprints ...string) *Index {
+	x := &Index{entries: make(map[string]bool, len(fingerprints))}
+	for _, fp := range fingerprints {
+		x.entries[fp] = true
+	}
+	return x
+}
+
+// Add records the fingerprint, reporting whether it wasn't in the index yet
+func (x *Index) Add(fp string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.entries[fp] {
+		return false
+	}
+	x.entries[fp] = true
+	return true
+}
+
+// Has reports whether the fingerprint is in the index
+func (x *Index) Has(fp string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.entries[fp]
+}
+
+// Remove drops the fingerprint from the index
+func (x *Index) Remove(fp string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.entries, fp)
+}
+
+// Len is the number of fingerprints in the index
+func (x *Index) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.entries)
+}
@@ -0,0 +1,81 @@
+package commenter
+
+import (
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestStableFingerprint(t *testing.T) {
+	f := report.Finding{ID: "AVD-AWS-0086", Target: "main.tf", StartLine: 3, EndLine: 5, LineHash: "abc"}
+	shifted := f
+	shifted.StartLine, shifted.EndLine = 13, 15
+
+	if StableFingerprint(f) != StableFingerprint(shifted) {
+		t.Error("the fingerprint changed with the lines of the same content")
+	}
+	if Fingerprint(f) == Fingerprint(shifted) {
+		t.Error("the fingerprint of the run didn't change with the lines")
+	}
+
+	tests := []struct {
+		name   string
+		change func(*report.Finding)
+	}{
+		{name: "rule", change: func(f *report.Finding) { f.ID = "AVD-AWS-0087" }},
+		{name: "file", change: func(f *report.Finding) { f.Target = "other.tf" }},
+		{name: "content", change: func(f *report.Finding) { f.LineHash = "def" }},
+		{name: "package", change: func(f *report.Finding) { f.PkgName = "openssl" }},
+		{name: "lines without content", change: func(f *report.Finding) { f.LineHash, f.StartLine = "", 4 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := f
+			tt.change(&other)
+			if StableFingerprint(f) == StableFingerprint(other) {
+				t.Errorf("the fingerprint didn't change with the %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestWrittenFingerprintAndScope(t *testing.T) {
+	f := report.Finding{ID: "AVD-AWS-0086", Target: "main.tf", StartLine: 3, EndLine: 5}
+	fp := StableFingerprint(f)
+	tests := []struct {
+		name      string
+		body      string
+		wantFP    string
+		wantScope string
+	}{
+		{name: "without a scope", body: "comment" + fingerprintComment(f, ""), wantFP: fp},
+		{name: "with a scope", body: "comment" + fingerprintComment(f, "CI/scan terraform"), wantFP: fp, wantScope: "CI/scan terraform"},
+		{name: "before the permalink", body: "comment" + fingerprintComment(f, "ci/scan") + "\n\n[permalink](https://github.com)", wantFP: fp, wantScope: "ci/scan"},
+		{name: "without a marker", body: "a comment of someone else"},
+		{name: "a malformed marker", body: "<!-- trivy-fingerprint XYZ -->"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WrittenFingerprint(tt.body); got != tt.wantFP {
+				t.Errorf("got the fingerprint %q, want %q", got, tt.wantFP)
+			}
+			if got := WrittenScope(tt.body); got != tt.wantScope {
+				t.Errorf("got the scope %q, want %q", got, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	x := NewIndex("a")
+	if !x.Has("a") || x.Add("a") {
+		t.Error("the index lacks the fingerprint it was created with")
+	}
+	if !x.Add("b") || !x.Has("b") || x.Len() != 2 {
+		t.Error("the index didn't add a new fingerprint")
+	}
+	x.Remove("a")
+	if x.Has("a") || x.Len() != 1 {
+		t.Error("the index still has a removed fingerprint")
+	}
+}
@@ -0,0 +1,23 @@
+package commenter
+
+import (
+	"os"
+	"regexp"
+)
+
+// envReference matches ${NAME} and ${NAME:-default}. The bare $NAME form is deliberately not
+// supported so that dollar signs in markdown and YAML are left alone.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ExpandEnv replaces environment variable references, unset variables expand to their default or
+// nothing. Templates and config files are expanded when they are loaded, so one can serve many
+// repos, e.g. with an org wide wiki URL.
+func ExpandEnv(s string) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		groups := envReference.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(groups[1]); ok && value != "" {
+			return value
+		}
+		return groups[2]
+	})
+}
@@ -0,0 +1,90 @@
+package commenter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// CacheKeyer is implemented by formatters whose comment only depends on part of a finding,
+// so the findings sharing that part share one rendering
+type CacheKeyer interface {
+	CacheKey(f report.Finding) string
+}
+
+// MemoFormatter caches the comments of the formatter it wraps. Findings with the same cache
+// key, e.g. the same rule on many resources, are rendered once, and the occurrences of each
+// distinct comment are counted.
+type MemoFormatter struct {
+	Formatter
+
+	mu     sync.Mutex
+	bodies map[string]string
+	counts map[string]int
+}
+
+// Memoize wraps the formatter with a cache, a MemoFormatter is returned as is
+func Memoize(f Formatter) *MemoFormatter {
+	if m, ok := f.(*MemoFormatter); ok {
+		return m
+	}
+	return &MemoFormatter{Formatter: f, bodies: make(map[string]string), counts: make(map[string]int)}
+}
+
+func (m *MemoFormatter) Comment(f report.Finding) (string, error) {
+	key := m.cacheKey(f)
+
+	m.mu.Lock()
+	body, ok := m.bodies[key]
+	if ok {
+		m.counts[body]++
+	}
+	m.mu.Unlock()
+	if ok {
+		return body, nil
+	}
+
+	body, err := m.Formatter.Comment(f)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bodies[key] = body
+	m.counts[body]++
+	return body, nil
+}
+
+// Occurrences counts how many findings rendered to each distinct comment
+func (m *MemoFormatter) Occurrences() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int, len(m.counts))
+	for body, count := range m.counts {
+		counts[body] = count
+	}
+	return counts
+}
+
+// cacheKey hashes the part of the finding the comment depends on, all of it unless the
+// formatter says otherwise
+func (m *MemoFormatter) cacheKey(f report.Finding) string {
+	var content []byte
+	if keyer, ok := m.Formatter.(CacheKeyer); ok {
+		content = []byte(keyer.CacheKey(f))
+	} else {
+		content, _ = json.Marshal(f)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// the default comment only shows the rule and package, not where it was found
+func (defaultFormatter) CacheKey(f report.Finding) string {
+	return strings.Join(append([]string{f.ID, f.Severity, f.Description, f.PkgName, f.InstalledVersion, f.FixedVersion, f.Suggestion, f.ValuesFile, strings.Join(f.ValuesKeys, ","), f.ModuleResource, f.ModuleLocation, fmt.Sprint(f.SecretRemediation), f.VEXSeverity, fmt.Sprint(f.VEX), f.LicenseCategory}, f.References...), "\x00")
+}
@@ -0,0 +1,51 @@
+package commenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// OwnerSections renders a section of the summary for each owner, listing only the findings
+// they own so each team of a PR touching many areas gets a view of its own. The findings
+// keyed by an empty owner are listed last, as unowned.
+func OwnerSections(owned map[string][]report.Finding) string {
+	owners := make([]string, 0, len(owned))
+	for owner := range owned {
+		if owner != "" {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return strings.ToLower(owners[i]) < strings.ToLower(owners[j]) })
+	if len(owned[""]) > 0 {
+		owners = append(owners, "")
+	}
+	if len(owners) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n## Findings by owner\n")
+	for _, owner := range owners {
+		findings := sorted(owned[owner])
+		sort.SliceStable(findings, func(i, j int) bool {
+			return report.SeverityRank(findings[i].Severity) > report.SeverityRank(findings[j].Severity)
+		})
+		title := owner
+		if owner == "" {
+			title = "Unowned"
+		}
+		fmt.Fprintf(&sb, "\n### %s\n\n%s\n\n", title, IssueCount(len(findings)))
+		sb.WriteString("| File | Lines | Rule | Severity | Title |\n|---|---|---|---|---|\n")
+		for _, f := range findings {
+			lines := formatLines(f.StartLine, f.EndLine)
+			if f.Permalink != "" {
+				lines = fmt.Sprintf("[%s](%s)", lines, f.Permalink)
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s | `%s` | %s | %s |\n", f.Target, lines, f.ID, f.Severity, escapeTableCell(f.Title))
+		}
+	}
+	return sb.String()
+}
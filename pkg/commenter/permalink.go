@@ -0,0 +1,14 @@
+package commenter
+
+import "regexp"
+
+// permalinkLine ends a comment on a file with the link to its lines at the commit scanned
+const permalinkLine = "\n\n[Permalink](%s) to the lines at the commit scanned"
+
+var permalinkPattern = regexp.MustCompile(`\n\n\[Permalink\]\([^)]*\) to the lines at the commit scanned`)
+
+// StripPermalink removes the permalink from a comment. It differs for every commit, the
+// comments of two runs are the same comment when they only differ in it.
+func StripPermalink(body string) string {
+	return permalinkPattern.ReplaceAllString(body, "")
+}
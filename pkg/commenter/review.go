@@ -0,0 +1,88 @@
+package commenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// ReviewBody renders the body of a review batching the comments: the findings grouped by
+// severity, the most severe first, so reviewers triage the CRITICALs before scrolling through
+// the files. A line at the top jumps to each severity, and each finding links to wherever
+// link points for its comment, e.g. the inline comment of the review, or to its permalink when
+// link returns nothing.
+func ReviewBody(comments []Comment, link func(c Comment) string) string {
+	bySeverity := make(map[string][]Comment)
+	for _, c := range comments {
+		severity := strings.ToUpper(c.Finding.Severity)
+		bySeverity[severity] = append(bySeverity[severity], c)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## trivy review\n\n")
+	if len(comments) == 0 {
+		sb.WriteString("No issues found.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "trivy commented on %s\n\n", IssueCount(len(comments)))
+	var jumps []string
+	for _, severity := range reviewSeverities(bySeverity) {
+		jumps = append(jumps, fmt.Sprintf("[%s (%d)](#%s)", severity, len(bySeverity[severity]), strings.ToLower(severity)))
+	}
+	fmt.Fprintf(&sb, "**Jump to:** %s\n", strings.Join(jumps, " · "))
+
+	for _, severity := range reviewSeverities(bySeverity) {
+		fmt.Fprintf(&sb, "\n### %s\n\n", severity)
+		for _, c := range bySeverity[severity] {
+			fmt.Fprintf(&sb, "- %s\n", reviewFinding(c, link(c)))
+		}
+	}
+	return sb.String()
+}
+
+// reviewSeverities are the severities with comments, the most severe first and any severity
+// trivy doesn't rank last
+func reviewSeverities(bySeverity map[string][]Comment) []string {
+	var severities []string
+	for i := len(report.Severities) - 1; i >= 0; i-- {
+		if len(bySeverity[report.Severities[i]]) > 0 {
+			severities = append(severities, report.Severities[i])
+		}
+	}
+	var unranked []string
+	for severity := range bySeverity {
+		if report.SeverityRank(severity) == 0 && !containsFold(severities, severity) {
+			unranked = append(unranked, severity)
+		}
+	}
+	sort.Strings(unranked)
+	return append(severities, unranked...)
+}
+
+func reviewFinding(c Comment, url string) string {
+	f := c.Finding
+	if url == "" {
+		url = f.Permalink
+	}
+	location := fmt.Sprintf("`%s`", c.File)
+	switch {
+	case f.StartLine > 0 && f.EndLine > f.StartLine:
+		location = fmt.Sprintf("`%s` lines %d-%d", c.File, f.StartLine, f.EndLine)
+	case f.StartLine > 0:
+		location = fmt.Sprintf("`%s` line %d", c.File, f.StartLine)
+	}
+	if url != "" {
+		location = fmt.Sprintf("[%s](%s)", location, url)
+	}
+	text := f.Title
+	if text == "" {
+		text = f.Message
+	}
+	line := fmt.Sprintf("`%s` in %s: %s", f.ID, location, text)
+	if len(c.Related) > 0 {
+		line += fmt.Sprintf(" (and %d more findings)", len(c.Related))
+	}
+	return line
+}
@@ -0,0 +1,61 @@
+package commenter
+
+import (
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// Route sends the findings it matches to reviewers, e.g. the S3 findings to the storage team.
+// Every field left empty matches any finding.
+type Route struct {
+	// Severity is the lowest severity matched
+	Severity string
+	// Provider and Service are those of a misconfiguration, e.g. aws and s3, matched case
+	// insensitively
+	Provider string
+	Service  string
+	// Path is a prefix of the repository path of the finding, e.g. infra/storage/
+	Path string
+	// Reviewers are users as @login and teams as @org/team
+	Reviewers []string
+}
+
+// Matches reports whether the route covers the finding at the repository path
+func (r Route) Matches(f report.Finding, path string) bool {
+	if r.Severity != "" && report.SeverityRank(f.Severity) < report.SeverityRank(r.Severity) {
+		return false
+	}
+	if r.Provider != "" && !strings.EqualFold(r.Provider, f.Provider) {
+		return false
+	}
+	if r.Service != "" && !strings.EqualFold(r.Service, f.Service) {
+		return false
+	}
+	return r.Path == "" || strings.HasPrefix(strings.TrimPrefix(path, "./"), strings.TrimPrefix(r.Path, "./"))
+}
+
+// Reviewers returns the reviewers of every route matching the finding, each once
+func Reviewers(routes []Route, f report.Finding, path string) []string {
+	var reviewers []string
+	for _, r := range routes {
+		if !r.Matches(f, path) {
+			continue
+		}
+		for _, reviewer := range r.Reviewers {
+			if !containsFold(reviewers, reviewer) {
+				reviewers = append(reviewers, reviewer)
+			}
+		}
+	}
+	return reviewers
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package commenter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// templateFormatterPrefix selects a TemplateFormatter by name, e.g. template:.github/comment.tmpl
+const templateFormatterPrefix = "template:"
+
+// summaryTemplate is the name of the optional template rendering the summary
+const summaryTemplate = "summary"
+
+// TemplateFormatter renders comments with a text/template executed on the report.Finding.
+// When the file also defines a template named "summary" it renders the summary from the
+// slice of findings, otherwise the DefaultFormatter summary is used.
+type TemplateFormatter struct {
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"lines": formatLines,
+	"urls":  formatUrls,
+	// code renders the finding's lines as a fenced block with the cause marked, e.g. {{ code . }}
+	"code": func(f report.Finding) string { return strings.TrimLeft(codeSnippet(f), "\n") },
+	// truncate shortens text to the given number of characters, e.g. {{ .Description | truncate 200 }}
+	"truncate": func(max int, s string) string { return TruncateText(s, max) },
+}
+
+// NewTemplateFormatter parses the template file
+func NewTemplateFormatter(path string) (*TemplateFormatter, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(filepath.Base(path), string(text))
+}
+
+// ParseTemplate parses the template text, after expanding the ${NAME} references, see ExpandEnv
+func ParseTemplate(name, text string) (*TemplateFormatter, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(ExpandEnv(text))
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFormatter{tmpl: tmpl}, nil
+}
+
+func (t *TemplateFormatter) Comment(f report.Finding) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, f); err != nil {
+		return "", fmt.Errorf("template %s failed for %s: %w", t.tmpl.Name(), f.ID, err)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func (t *TemplateFormatter) Summary(findings []report.Finding) (string, error) {
+	if t.tmpl.Lookup(summaryTemplate) == nil {
+		return DefaultFormatter.Summary(findings)
+	}
+	var sb strings.Builder
+	if err := t.tmpl.ExecuteTemplate(&sb, summaryTemplate, findings); err != nil {
+		return "", fmt.Errorf("template %s failed for the summary: %w", t.tmpl.Name(), err)
+	}
+	return sb.String(), nil
+}
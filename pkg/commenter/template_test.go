@@ -0,0 +1,84 @@
+package commenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+func TestTemplateComment(t *testing.T) {
+	f := report.Finding{
+		ID: "AVD-AWS-0086", Severity: "HIGH", Title: "S3 access block", Target: "main.tf",
+		StartLine: 3, EndLine: 5, Description: strings.Repeat("x", 50), References: []string{"https://a", "https://b"},
+	}
+	tests := []struct {
+		name string
+		text string
+		env  map[string]string
+		want string
+	}{
+		{name: "fields", text: "{{ .Severity }} {{ .ID }} in {{ .Target }}", want: "HIGH AVD-AWS-0086 in main.tf"},
+		{name: "upper and lower", text: "{{ lower .Severity }} {{ upper .Title }}", want: "high S3 ACCESS BLOCK"},
+		{name: "lines", text: "{{ lines .StartLine .EndLine }}", want: "3-5"},
+		{name: "urls", text: "{{ urls .References }}", want: "[here](https://a) and [here](https://b)"},
+		{name: "join", text: `{{ join .References ", " }}`, want: "https://a, https://b"},
+		{name: "truncate", text: "{{ .Description | truncate 10 }}", want: TruncateText(strings.Repeat("x", 50), 10)},
+		{name: "trailing newlines", text: "{{ .ID }}\n\n", want: "AVD-AWS-0086"},
+		{name: "environment", text: "See ${WIKI_URL}/{{ .ID }}", env: map[string]string{"WIKI_URL": "https://wiki"}, want: "See https://wiki/AVD-AWS-0086"},
+		{name: "environment default", text: "See ${TEMPLATE_TEST_UNSET:-https://default}", want: "See https://default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			tmpl, err := ParseTemplate("comment", tt.text)
+			if err != nil {
+				t.Fatalf("ParseTemplate: %v", err)
+			}
+			got, err := tmpl.Comment(f)
+			if err != nil {
+				t.Fatalf("Comment: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := ParseTemplate("comment", "{{ .ID "); err == nil {
+		t.Error("parsed an unterminated action")
+	}
+	tmpl, err := ParseTemplate("comment", "{{ .NoSuchField }}")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	if _, err := tmpl.Comment(report.Finding{ID: "X"}); err == nil || !strings.Contains(err.Error(), "X") {
+		t.Errorf("got %v for an unknown field, want an error naming the finding", err)
+	}
+}
+
+func TestTemplateSummary(t *testing.T) {
+	findings := []report.Finding{{ID: "A", Severity: "HIGH"}, {ID: "B", Severity: "LOW"}}
+
+	own, err := ParseTemplate("comment", `{{ .ID }}{{ define "summary" }}{{ len . }} findings{{ end }}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	if got, err := own.Summary(findings); err != nil || got != "2 findings" {
+		t.Errorf("got the summary %q (%v), want the template's", got, err)
+	}
+
+	fallback, err := ParseTemplate("comment", "{{ .ID }}")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	got, err := fallback.Summary(findings)
+	want, _ := DefaultFormatter.Summary(findings)
+	if err != nil || got != want {
+		t.Errorf("got the summary %q (%v), want the default one", got, err)
+	}
+}
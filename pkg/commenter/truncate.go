@@ -0,0 +1,109 @@
+package commenter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxCommentLength is the longest comment body GitHub accepts
+const MaxCommentLength = 65536
+
+// TruncatedMarker ends a comment cut down to MaxCommentLength
+const TruncatedMarker = "\n\n_Truncated, see the report for the full details._"
+
+// Truncate shortens markdown to at most max bytes, the marker included. The cut never splits a
+// multi-byte rune, prefers a line break, and closes a fenced code block it falls inside, so the
+// rest of the comment still renders.
+func Truncate(s string, max int, marker string) string {
+	if len(s) <= max {
+		return s
+	}
+	budget := max - len(marker)
+	if budget <= 0 {
+		return cutRunes(marker, max)
+	}
+
+	for reserve := 0; ; {
+		cut := cutAtLine(cutRunes(s, budget-reserve))
+		fence := openFence(cut)
+		if fence == "" {
+			return cut + marker
+		}
+		closed := strings.TrimRight(cut, "\n") + "\n" + fence
+		if len(closed) <= budget {
+			return closed + marker
+		}
+		// make room for closing the fence and cut again
+		reserve += len(closed) - budget
+	}
+}
+
+// TruncateText shortens plain text such as a description to at most max runes, ending it
+// with an ellipsis
+func TruncateText(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	if max <= 1 {
+		return "…"
+	}
+	runes := []rune(s)
+	return strings.TrimRight(string(runes[:max-1]), " ") + "…"
+}
+
+// cutRunes keeps at most n bytes without splitting a rune
+func cutRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// cutAtLine drops a partial last line when that keeps most of the text
+func cutAtLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i > len(s)/2 {
+		return s[:i+1]
+	}
+	return s
+}
+
+// openFence returns the fence of a code block left open at the end of the markdown
+func openFence(s string) string {
+	var open string
+	for _, line := range strings.Split(s, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 {
+			continue
+		}
+		fence := fenceOf(trimmed)
+		switch {
+		case fence == "":
+		case open == "":
+			open = fence
+		case fence[0] == open[0] && len(fence) >= len(open) && strings.TrimSpace(trimmed[len(fence):]) == "":
+			open = ""
+		}
+	}
+	return open
+}
+
+// fenceOf returns the run of three or more backticks or tildes the line starts with
+func fenceOf(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
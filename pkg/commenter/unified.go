@@ -0,0 +1,134 @@
+package commenter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+)
+
+// The sections of a unified comment, in the order they are listed
+var findingKinds = []string{"Misconfigurations", "Secrets", "Vulnerabilities", "Licenses"}
+
+// findingKind is the section of a unified comment the finding is listed in
+func findingKind(f report.Finding) string {
+	switch {
+	case f.Type == "secret":
+		return "Secrets"
+	case f.Type == "license":
+		return "Licenses"
+	case f.PkgName != "":
+		return "Vulnerabilities"
+	}
+	return "Misconfigurations"
+}
+
+// mostSevere is the finding a unified comment is written on, the first of the most severe
+func mostSevere(group []report.Finding) report.Finding {
+	worst := group[0]
+	for _, f := range group[1:] {
+		if report.SeverityRank(f.Severity) > report.SeverityRank(worst.Severity) {
+			worst = f
+		}
+	}
+	return worst
+}
+
+// related are the findings of the group at the minimum severity other than the one commented on
+func related(group []report.Finding, commented report.Finding, minSeverity string) []report.Finding {
+	var rest []report.Finding
+	for _, f := range group {
+		if Fingerprint(f) != Fingerprint(commented) && report.SeverityRank(f.Severity) >= report.SeverityRank(minSeverity) {
+			rest = append(rest, f)
+		}
+	}
+	return rest
+}
+
+// coLocated are the findings of the group at the minimum severity on lines overlapping the
+// commented finding's, which a comment on it lists rather than stacking comments on the lines
+func coLocated(group []report.Finding, commented report.Finding, minSeverity string) []report.Finding {
+	if commented.StartLine <= 0 {
+		return nil
+	}
+	var rest []report.Finding
+	for _, f := range related(group, commented, minSeverity) {
+		if f.StartLine > 0 && f.StartLine <= lastLine(commented) && commented.StartLine <= lastLine(f) {
+			rest = append(rest, f)
+		}
+	}
+	return rest
+}
+
+func lastLine(f report.Finding) int {
+	if f.EndLine < f.StartLine {
+		return f.StartLine
+	}
+	return f.EndLine
+}
+
+// commentOn is the finding of the group a comment is written on and the other findings it
+// covers: the most severe of the file and the rest of it for a unified comment, and otherwise
+// the most severe of the findings on the lines of the first one and the rest of those. False
+// when no finding is at the minimum severity.
+func commentOn(opts Options, group []report.Finding) (report.Finding, []report.Finding, bool) {
+	first, ok := firstAtSeverity(group, opts.MinSeverity)
+	if !ok {
+		return report.Finding{}, nil, false
+	}
+	if opts.Unified {
+		commented := mostSevere(group)
+		return commented, related(group, commented, opts.MinSeverity), true
+	}
+	cluster := append([]report.Finding{first}, coLocated(group, first, opts.MinSeverity)...)
+	commented := mostSevere(cluster)
+	return commented, related(cluster, commented, opts.MinSeverity), true
+}
+
+// relatedFindings lists the other findings a comment covers, those of the file for a unified
+// comment or on the same lines otherwise, a line each in the section of their kind
+func relatedFindings(related []report.Finding, unified bool) string {
+	if len(related) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	if unified {
+		sb.WriteString("\n\n#### Also in this file\n")
+	} else {
+		sb.WriteString("\n\n#### Also on these lines\n")
+	}
+	for _, kind := range findingKinds {
+		var lines []string
+		for _, f := range related {
+			if findingKind(f) == kind {
+				lines = append(lines, relatedFinding(f))
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&sb, "\n**%s**\n%s\n", kind, strings.Join(lines, "\n"))
+		}
+	}
+	return sb.String()
+}
+
+func relatedFinding(f report.Finding) string {
+	id := fmt.Sprintf("`%s`", f.ID)
+	if f.PrimaryURL != "" {
+		id = fmt.Sprintf("[%s](%s)", id, f.PrimaryURL)
+	}
+	var location string
+	switch {
+	case f.StartLine > 0 && f.EndLine > f.StartLine:
+		location = fmt.Sprintf(" on lines %d-%d", f.StartLine, f.EndLine)
+	case f.StartLine > 0:
+		location = fmt.Sprintf(" on line %d", f.StartLine)
+	}
+	if location != "" && f.Permalink != "" {
+		location = fmt.Sprintf(" [%s](%s)", strings.TrimPrefix(location, " "), f.Permalink)
+	}
+	text := f.Message
+	if text == "" {
+		text = f.Title
+	}
+	return fmt.Sprintf("- **%s** %s%s: %s", f.Severity, id, location, text)
+}
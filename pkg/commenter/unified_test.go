@@ -0,0 +1,69 @@
+package commenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/report"
+	"github.com/XiaxueTech/trivy-terraform-pr-commenter/pkg/testutil"
+)
+
+func TestCommentOn(t *testing.T) {
+	low := misconfiguration("LOW-1", "main.tf", 1, 4, "LOW")
+	critical := misconfiguration("CRITICAL-1", "main.tf", 3, 3, "CRITICAL")
+	medium := misconfiguration("MEDIUM-1", "main.tf", 4, 6, "MEDIUM")
+	high := misconfiguration("HIGH-1", "main.tf", 10, 12, "HIGH")
+	group := []report.Finding{low, critical, medium, high}
+
+	tests := []struct {
+		name        string
+		opts        Options
+		wantOn      string
+		wantRelated []string
+	}{
+		{name: "co-located", wantOn: "CRITICAL-1", wantRelated: []string{"LOW-1", "MEDIUM-1"}},
+		{name: "unified", opts: Options{Unified: true}, wantOn: "CRITICAL-1", wantRelated: []string{"LOW-1", "MEDIUM-1", "HIGH-1"}},
+		{name: "above the first", opts: Options{MinSeverity: "HIGH"}, wantOn: "CRITICAL-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			on, related, ok := commentOn(tt.opts, group)
+			if !ok || on.ID != tt.wantOn {
+				t.Fatalf("commented on %s (%t), want %s", on.ID, ok, tt.wantOn)
+			}
+			var ids []string
+			for _, f := range related {
+				ids = append(ids, f.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantRelated, ",") {
+				t.Errorf("got the related findings %v, want %v", ids, tt.wantRelated)
+			}
+		})
+	}
+
+	if _, _, ok := commentOn(Options{MinSeverity: "CRITICAL"}, []report.Finding{low, medium}); ok {
+		t.Error("commented on a group below the minimum severity")
+	}
+}
+
+func TestPostAnchorsAClusterOnItsMostSevereFinding(t *testing.T) {
+	gh, p := newFakeProvider(t, testutil.AddedFile("main.tf", 20))
+	findings := []report.Finding{
+		misconfiguration("LOW-1", "main.tf", 1, 4, "LOW"),
+		misconfiguration("CRITICAL-1", "main.tf", 3, 3, "CRITICAL"),
+	}
+
+	outcome := Post(p, findings, Options{})
+
+	comments := gh.Comments()
+	if outcome.Posted != 1 || len(comments) != 1 {
+		t.Fatalf("posted %d comments, want 1", len(comments))
+	}
+	c := comments[0]
+	if c.GetLine() != 3 || !strings.Contains(c.GetBody(), "rule `CRITICAL-1`") {
+		t.Errorf("commented on line %d, want the critical finding's line 3:\n%s", c.GetLine(), c.GetBody())
+	}
+	if !strings.Contains(c.GetBody(), "#### Also on these lines") || !strings.Contains(c.GetBody(), "**LOW** `LOW-1` on lines 1-4: LOW-1 message") {
+		t.Errorf("the comment doesn't list the co-located finding:\n%s", c.GetBody())
+	}
+}
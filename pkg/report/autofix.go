@@ -0,0 +1,48 @@
+package report
+
+import (
+	"sort"
+	"strings"
+)
+
+// ApplySuggestions rewrites the lines of the file's findings with their suggestions, for a fix
+// commit covering every suggestion at once. A finding without a suggestion, or whose lines are
+// past the end of the file or overlap those of a finding already applied, is left out. The
+// findings applied are returned with the fixed content.
+func ApplySuggestions(content []byte, findings []Finding) ([]byte, []Finding) {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	candidates := Filter(findings, func(f Finding) bool {
+		return f.Suggestion != "" && f.StartLine >= 1 && f.EndLine >= f.StartLine && f.EndLine <= len(lines)
+	})
+	SortFindings(candidates)
+
+	var applied []Finding
+	end := 0
+	for _, f := range candidates {
+		if f.StartLine <= end {
+			continue
+		}
+		applied = append(applied, f)
+		end = f.EndLine
+	}
+	// from the bottom up, so the lines of the findings above don't move
+	sort.SliceStable(applied, func(i, j int) bool { return applied[i].StartLine > applied[j].StartLine })
+	for _, f := range applied {
+		newline := "\n"
+		if last := lines[f.EndLine-1]; !strings.HasSuffix(last, "\n") {
+			newline = ""
+		} else if strings.HasSuffix(last, "\r\n") {
+			newline = "\r\n"
+		}
+		replacement := strings.SplitAfter(strings.TrimSuffix(f.Suggestion, "\n")+newline, "\n")
+		if replacement[len(replacement)-1] == "" {
+			replacement = replacement[:len(replacement)-1]
+		}
+		lines = append(lines[:f.StartLine-1], append(replacement, lines[f.EndLine:]...)...)
+	}
+	SortFindings(applied)
+	return []byte(strings.Join(lines, "")), applied
+}
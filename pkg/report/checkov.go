@@ -0,0 +1,122 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// checkovReport is the report of one framework in checkov -o json, written as an array of
+// them when several frameworks found something
+type checkovReport struct {
+	CheckType string `json:"check_type"`
+	Results   struct {
+		FailedChecks []checkovCheck `json:"failed_checks"`
+	} `json:"results"`
+}
+
+type checkovCheck struct {
+	CheckID       string   `json:"check_id"`
+	CheckName     string   `json:"check_name"`
+	FilePath      string   `json:"file_path"`
+	RepoFilePath  string   `json:"repo_file_path"`
+	FileLineRange []int    `json:"file_line_range"`
+	Resource      string   `json:"resource"`
+	Severity      *string  `json:"severity"`
+	Guideline     string   `json:"guideline"`
+	Description   string   `json:"description"`
+	Details       []string `json:"details"`
+}
+
+// isCheckov reports whether the top level fields of a report are those of a checkov report
+func isCheckov(fields map[string]json.RawMessage) bool {
+	_, checkType := fields["check_type"]
+	_, results := fields["results"]
+	return checkType && results
+}
+
+// parseCheckov maps the failed checks of a checkov -o json report, a single framework's or
+// the array of several, onto the misconfigurations of a Trivy report, one result per file.
+// The file_line_range of a check are the lines of its resource. Checkov only rates severities
+// with a platform API key, a check without one is UNKNOWN.
+func parseCheckov(data []byte) ([]Result, error) {
+	var reports []checkovReport
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &reports); err != nil {
+			return nil, err
+		}
+	} else {
+		var report checkovReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		reports = []checkovReport{report}
+	}
+
+	byTarget := make(map[string]*Result)
+	for _, report := range reports {
+		for _, check := range report.Results.FailedChecks {
+			path := check.RepoFilePath
+			if path == "" {
+				path = check.FilePath
+			}
+			target := strings.TrimPrefix(path, "/")
+			r, ok := byTarget[target+"\x00"+report.CheckType]
+			if !ok {
+				r = &Result{Target: target, Class: "config", Type: report.CheckType}
+				byTarget[target+"\x00"+report.CheckType] = r
+			}
+			r.Misconfigurations = append(r.Misconfigurations, checkovMisconfiguration(report.CheckType, check))
+		}
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Target != results[j].Target {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].Type < results[j].Type
+	})
+	return results, nil
+}
+
+func checkovMisconfiguration(checkType string, check checkovCheck) Misconfiguration {
+	severity := "UNKNOWN"
+	if check.Severity != nil {
+		if parsed, err := ParseSeverity(*check.Severity); err == nil {
+			severity = parsed
+		}
+	}
+	var startLine, endLine int
+	if len(check.FileLineRange) == 2 {
+		startLine, endLine = check.FileLineRange[0], check.FileLineRange[1]
+	}
+	description := check.Description
+	if description == "" {
+		description = strings.Join(check.Details, "\n")
+	}
+	if description == "" {
+		description = check.CheckName
+	}
+	var references []string
+	if check.Guideline != "" {
+		references = []string{check.Guideline}
+	}
+	return Misconfiguration{
+		Type:          checkType,
+		ID:            check.CheckID,
+		AVDID:         check.CheckID,
+		Title:         check.CheckName,
+		Description:   description,
+		Message:       check.CheckName,
+		Severity:      severity,
+		PrimaryURL:    check.Guideline,
+		References:    references,
+		Status:        "FAIL",
+		CauseMetadata: CauseMetadata{Resource: check.Resource, StartLine: startLine, EndLine: endLine},
+	}
+}
@@ -0,0 +1,163 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// The roles of cluster components, the workloads of a cluster aren't components
+const (
+	RoleControlPlane = "control plane"
+	RoleNode         = "node"
+)
+
+// controlPlanePods are the kube-system pods of the control plane and node agents, for the
+// clusters whose components trivy reports as their pods rather than as a KBOM
+var controlPlanePods = map[string]string{
+	"kube-apiserver": RoleControlPlane, "kube-controller-manager": RoleControlPlane, "kube-scheduler": RoleControlPlane,
+	"etcd": RoleControlPlane, "cloud-controller-manager": RoleControlPlane, "coredns": RoleControlPlane,
+	"kube-proxy": RoleNode, "aws-node": RoleNode, "calico-node": RoleNode, "cilium": RoleNode,
+}
+
+// ClusterReport is the output of trivy k8s, the components of its KBOM (the control plane and
+// node components of the cluster) with their vulnerabilities. Such findings have no lines in the
+// repo, they are summarised rather than commented on.
+type ClusterReport struct {
+	Name string
+	// Version is the Kubernetes version of the API server, empty when the report doesn't have it
+	Version    string
+	Components []ClusterComponent
+	// Workloads counts the other resources with vulnerabilities, which aren't summarised
+	Workloads int
+}
+
+// ClusterComponent is a control plane or node component of a cluster
+type ClusterComponent struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Role      string
+	Version   string
+	// UpgradeTo is the lowest version fixing every fixable vulnerability of the component,
+	// empty when none is fixable
+	UpgradeTo string
+	// Findings are the vulnerabilities, the most severe first
+	Findings []Finding
+}
+
+// Vulnerable returns the components with vulnerabilities
+func (r *ClusterReport) Vulnerable() []ClusterComponent {
+	var vulnerable []ClusterComponent
+	for _, c := range r.Components {
+		if len(c.Findings) > 0 {
+			vulnerable = append(vulnerable, c)
+		}
+	}
+	return vulnerable
+}
+
+type clusterResource struct {
+	Namespace string   `json:"Namespace"`
+	Kind      string   `json:"Kind"`
+	Name      string   `json:"Name"`
+	Results   []Result `json:"Results"`
+}
+
+type clusterDocument struct {
+	ClusterName string            `json:"ClusterName"`
+	Resources   []clusterResource `json:"Resources"`
+	// Vulnerabilities lists the resources of trivy releases before 0.38
+	Vulnerabilities []clusterResource `json:"Vulnerabilities"`
+}
+
+// ParseClusterReport reads the JSON output of trivy k8s, e.g. trivy k8s --format json
+// --scanners vuln cluster, with the KBOM's ControlPlaneComponents and NodeComponents or, for
+// older releases and managed clusters, the kube-system pods of the components
+func ParseClusterReport(data []byte) (*ClusterReport, error) {
+	var doc clusterDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.ClusterName == "" {
+		return nil, errors.New("not a trivy k8s report")
+	}
+	r := &ClusterReport{Name: doc.ClusterName}
+	for _, resource := range append(doc.Resources, doc.Vulnerabilities...) {
+		findings := Filter(Findings(resource.Results), func(f Finding) bool { return f.PkgName != "" })
+		role := componentRole(resource)
+		if role == "" {
+			if len(findings) > 0 {
+				r.Workloads++
+			}
+			continue
+		}
+		sort.SliceStable(findings, func(i, j int) bool {
+			return SeverityRank(findings[i].Severity) > SeverityRank(findings[j].Severity)
+		})
+		component := ClusterComponent{
+			Kind: resource.Kind, Namespace: resource.Namespace, Name: resource.Name, Role: role,
+			Version: componentVersion(resource), Findings: findings,
+		}
+		for _, f := range findings {
+			if fixed := FixedVersion(f.InstalledVersion, f.FixedVersion); fixed != "" && compareVersions(fixed, component.UpgradeTo) > 0 {
+				component.UpgradeTo = fixed
+			}
+		}
+		if component.Name == "k8s.io/apiserver" || strings.HasPrefix(component.Name, "kube-apiserver") {
+			r.Version = component.Version
+		}
+		r.Components = append(r.Components, component)
+	}
+	sort.SliceStable(r.Components, func(i, j int) bool {
+		if r.Components[i].Role != r.Components[j].Role {
+			return r.Components[i].Role == RoleControlPlane
+		}
+		return r.Components[i].Name < r.Components[j].Name
+	})
+	return r, nil
+}
+
+func componentRole(resource clusterResource) string {
+	switch resource.Kind {
+	case "ControlPlaneComponents", "Cluster":
+		return RoleControlPlane
+	case "NodeComponents", "NodeInfo":
+		return RoleNode
+	}
+	if resource.Namespace != "kube-system" {
+		return ""
+	}
+	for prefix, role := range controlPlanePods {
+		if resource.Name == prefix || strings.HasPrefix(resource.Name, prefix+"-") {
+			return role
+		}
+	}
+	return ""
+}
+
+// componentVersion is the version of the component's own package, e.g. k8s.io/apiserver, or of
+// the kubelet of a node, and the version of the first package otherwise
+func componentVersion(resource clusterResource) string {
+	var first string
+	for _, result := range resource.Results {
+		for _, p := range result.Packages {
+			if p.Name == resource.Name || p.Name == "k8s.io/kubelet" {
+				return p.Version
+			}
+			if first == "" {
+				first = p.Version
+			}
+		}
+		for _, v := range result.Vulnerabilities {
+			if v.PkgName == resource.Name || v.PkgName == "k8s.io/kubelet" {
+				return v.InstalledVersion
+			}
+			if first == "" {
+				first = v.InstalledVersion
+			}
+		}
+	}
+	return first
+}
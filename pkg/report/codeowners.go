@@ -0,0 +1,62 @@
+package report
+
+import "strings"
+
+// Codeowners are the rules of a CODEOWNERS file, in the order of the file
+type Codeowners []codeownersRule
+
+type codeownersRule struct {
+	pattern []string
+	// dir is set for a pattern ending in a slash, which only matches directories
+	dir    bool
+	owners []string
+}
+
+// ParseCodeowners reads a CODEOWNERS file. A rule without owners is kept, a path it matches
+// last has no owner.
+func ParseCodeowners(content []byte) Codeowners {
+	var rules Codeowners
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern := fields[0]
+		rule := codeownersRule{dir: strings.HasSuffix(pattern, "/"), owners: fields[1:]}
+		pattern = strings.TrimSuffix(pattern, "/")
+		// like .gitignore, a pattern without a slash but at its end matches at any depth
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		rule.pattern = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Owners returns the owners of a path of the repo, those of the last rule matching it or a
+// directory it is in
+func (c Codeowners) Owners(name string) []string {
+	segments := strings.Split(cleanPath(name), "/")
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].matches(segments) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+func (r codeownersRule) matches(segments []string) bool {
+	for end := len(segments); end > 0; end-- {
+		if end == len(segments) && r.dir {
+			continue
+		}
+		if matchSegments(r.pattern, segments[:end]) {
+			return true
+		}
+	}
+	return false
+}
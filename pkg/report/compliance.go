@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// The statuses of a compliance control
+const (
+	ControlPass   = "PASS"
+	ControlFail   = "FAIL"
+	ControlManual = "MANUAL"
+)
+
+// ComplianceReport is the output of trivy's --compliance flag, e.g. for aws-cis-1.4 or
+// k8s-nsa, with the results of each control of the framework
+type ComplianceReport struct {
+	ID          string
+	Title       string
+	Description string
+	Version     string
+	Controls    []ComplianceControl
+}
+
+// ComplianceControl is a control of a compliance framework and how the scan fared against it
+type ComplianceControl struct {
+	ID          string
+	Name        string
+	Description string
+	Severity    string
+	Status      string
+	// Failures counts the failing resources, Findings are them when the report lists them
+	Failures int
+	Findings []Finding
+}
+
+// Failing counts the controls that failed
+func (r *ComplianceReport) Failing() int {
+	var failing int
+	for _, c := range r.Controls {
+		if c.Status == ControlFail {
+			failing++
+		}
+	}
+	return failing
+}
+
+type complianceDocument struct {
+	ID          string `json:"ID"`
+	Title       string `json:"Title"`
+	Description string `json:"Description"`
+	Version     string `json:"Version"`
+	// Results are the controls of a --report all
+	Results []struct {
+		ID            string   `json:"ID"`
+		Name          string   `json:"Name"`
+		Description   string   `json:"Description"`
+		DefaultStatus string   `json:"DefaultStatus"`
+		Severity      string   `json:"Severity"`
+		Results       []Result `json:"Results"`
+	} `json:"Results"`
+	// SummaryControls are the controls of a --report summary, without the results
+	SummaryControls []struct {
+		ID       string `json:"ID"`
+		Name     string `json:"Name"`
+		Severity string `json:"Severity"`
+		// TotalFail is missing for a control that can only be checked by hand
+		TotalFail *int `json:"TotalFail"`
+	} `json:"SummaryControls"`
+}
+
+// ParseCompliance reads a compliance report of trivy's all or summary format
+func ParseCompliance(data []byte) (*ComplianceReport, error) {
+	var doc complianceDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.ID == "" || doc.Results == nil && doc.SummaryControls == nil {
+		return nil, errors.New("not a trivy compliance report")
+	}
+	r := &ComplianceReport{ID: doc.ID, Title: doc.Title, Description: doc.Description, Version: doc.Version}
+	for _, c := range doc.Results {
+		control := ComplianceControl{ID: c.ID, Name: c.Name, Description: c.Description, Severity: c.Severity, Status: ControlPass}
+		// the report keeps the passing checks when scanned with --include-non-failures
+		for i := range c.Results {
+			c.Results[i].Misconfigurations = failedMisconfigurations(c.Results[i].Misconfigurations)
+		}
+		control.Findings = Findings(c.Results)
+		control.Failures = len(control.Findings)
+		switch {
+		case control.Failures > 0:
+			control.Status = ControlFail
+		case len(c.Results) == 0 && c.DefaultStatus != "":
+			control.Status = ControlManual
+		}
+		r.Controls = append(r.Controls, control)
+	}
+	for _, c := range doc.SummaryControls {
+		control := ComplianceControl{ID: c.ID, Name: c.Name, Severity: c.Severity, Status: ControlManual}
+		if c.TotalFail != nil {
+			control.Failures = *c.TotalFail
+			control.Status = ControlPass
+			if control.Failures > 0 {
+				control.Status = ControlFail
+			}
+		}
+		r.Controls = append(r.Controls, control)
+	}
+	return r, nil
+}
+
+func failedMisconfigurations(misconfs []Misconfiguration) []Misconfiguration {
+	var failed []Misconfiguration
+	for _, m := range misconfs {
+		if m.Status != "PASS" {
+			failed = append(failed, m)
+		}
+	}
+	return failed
+}
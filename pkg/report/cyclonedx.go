@@ -0,0 +1,162 @@
+package report
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cycloneDXFixed reads the fixed version from the recommendation trivy writes for a
+// vulnerability, e.g. Upgrade lodash to version 4.17.21
+var cycloneDXFixed = regexp.MustCompile(`to version (\S+?)\.?$`)
+
+// isCycloneDX reports whether the top level fields of a report are those of a CycloneDX BOM
+func isCycloneDX(fields map[string]json.RawMessage) bool {
+	var format string
+	if raw, ok := fields["bomFormat"]; ok && json.Unmarshal(raw, &format) == nil {
+		return format == "CycloneDX"
+	}
+	return false
+}
+
+// parseCycloneDXReport maps a CycloneDX JSON SBOM with embedded vulnerabilities, e.g. from
+// trivy fs --format cyclonedx --scanners vuln, onto the results of a Trivy report. Each
+// application component, a lockfile or manifest for trivy, and each operating system is a
+// result with the packages it depends on, nested or in the dependency graph. Packages outside
+// of any are the artifact's. Their vulnerabilities get lines from LocatePackages like those of a
+// JSON report.
+func parseCycloneDXReport(data []byte) ([]Result, error) {
+	var doc cycloneDXDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	artifact := doc.Metadata.Component.Name
+	if artifact == "" {
+		artifact = "sbom"
+	}
+
+	components := make(map[string]cycloneDXComponent)
+	owners := make(map[string]string)
+	var walk func(components []cycloneDXComponent, owner string)
+	walk = func(list []cycloneDXComponent, owner string) {
+		for _, c := range list {
+			if c.BOMRef != "" {
+				components[c.BOMRef] = c
+				if owner != "" && !isCycloneDXTarget(c) {
+					owners[c.BOMRef] = owner
+				}
+			}
+			child := owner
+			if isCycloneDXTarget(c) {
+				child = c.BOMRef
+			}
+			walk(c.Components, child)
+		}
+	}
+	walk(doc.Components, "")
+	for _, d := range doc.Dependencies {
+		if !isCycloneDXTarget(components[d.Ref]) {
+			continue
+		}
+		for _, ref := range d.DependsOn {
+			if _, ok := owners[ref]; !ok && !isCycloneDXTarget(components[ref]) {
+				owners[ref] = d.Ref
+			}
+		}
+	}
+
+	byTarget := make(map[string]*Result)
+	result := func(pkg cycloneDXComponent) *Result {
+		target := components[owners[pkg.BOMRef]]
+		name := cycloneDXTargetName(target, artifact)
+		r, ok := byTarget[name]
+		if !ok {
+			r = &Result{Target: name, Class: target.property("aquasecurity:trivy:Class"), Type: target.property("aquasecurity:trivy:Type")}
+			if r.Class == "" {
+				r.Class = "lang-pkgs"
+				if target.Type == "operating-system" {
+					r.Class = "os-pkgs"
+				}
+			}
+			if r.Type == "" {
+				r.Type = pkg.property("aquasecurity:trivy:PkgType")
+			}
+			byTarget[name] = r
+		}
+		return r
+	}
+	for ref, c := range components {
+		if !isCycloneDXTarget(c) && ref != doc.Metadata.Component.BOMRef {
+			r := result(c)
+			r.Packages = append(r.Packages, Package{
+				ID: ref, Name: dependencyName(c.PURL, c.Group, c.Name), Version: c.Version,
+				Identifier: PkgIdentifier{PURL: c.PURL, UID: ref},
+			})
+		}
+	}
+	for _, v := range doc.Vulnerabilities {
+		for _, affected := range v.Affects {
+			c, ok := components[affected.Ref]
+			if !ok {
+				continue
+			}
+			r := result(c)
+			r.Vulnerabilities = append(r.Vulnerabilities, cycloneDXFinding(v, c))
+		}
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		sort.Slice(r.Packages, func(i, j int) bool { return r.Packages[i].ID < r.Packages[j].ID })
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+func cycloneDXFinding(v cycloneDXVulnerability, c cycloneDXComponent) Vulnerability {
+	var references []string
+	for _, advisory := range v.Advisories {
+		references = append(references, advisory.URL)
+	}
+	primary := v.Source.URL
+	if len(references) > 0 {
+		primary = references[0]
+	} else if primary != "" {
+		references = []string{primary}
+	}
+	var fixed string
+	if m := cycloneDXFixed.FindStringSubmatch(strings.TrimSpace(v.Recommendation)); m != nil {
+		fixed = m[1]
+	}
+	return Vulnerability{
+		VulnerabilityID:  v.ID,
+		PkgID:            c.BOMRef,
+		PkgName:          dependencyName(c.PURL, c.Group, c.Name),
+		InstalledVersion: c.Version,
+		FixedVersion:     fixed,
+		Description:      v.Description,
+		Severity:         v.severity(),
+		PrimaryURL:       primary,
+		References:       references,
+	}
+}
+
+// isCycloneDXTarget reports whether the component is what trivy scans packages in rather than a
+// package: a lockfile or manifest, or an operating system
+func isCycloneDXTarget(c cycloneDXComponent) bool {
+	return c.Type == "application" || c.Type == "operating-system"
+}
+
+// cycloneDXTargetName is the target of the result, the path of a lockfile or the name and
+// version of an operating system as trivy reports them
+func cycloneDXTargetName(c cycloneDXComponent, artifact string) string {
+	switch {
+	case c.Name == "":
+		return artifact
+	case c.Type == "operating-system" && c.Version != "":
+		return c.Name + " " + c.Version
+	}
+	return c.Name
+}
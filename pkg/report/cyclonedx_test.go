@@ -0,0 +1,99 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+const cycloneDXReport = `{
+  "bomFormat": "CycloneDX",
+  "metadata": {"component": {"bom-ref": "root", "type": "application", "name": "github.com/org/app"}},
+  "components": [
+    {"bom-ref": "lock", "type": "application", "name": "web/package-lock.json",
+     "properties": [{"name": "aquasecurity:trivy:Class", "value": "lang-pkgs"}, {"name": "aquasecurity:trivy:Type", "value": "npm"}],
+     "components": [{"bom-ref": "lodash", "type": "library", "name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20"}]},
+    {"bom-ref": "minimist", "type": "library", "name": "minimist", "version": "1.2.5", "purl": "pkg:npm/minimist@1.2.5"},
+    {"bom-ref": "os", "type": "operating-system", "name": "alpine", "version": "3.18.4"},
+    {"bom-ref": "openssl", "type": "library", "name": "openssl", "version": "3.1.3-r0", "purl": "pkg:apk/alpine/openssl@3.1.3-r0",
+     "properties": [{"name": "aquasecurity:trivy:PkgType", "value": "alpine"}]},
+    {"bom-ref": "stray", "type": "library", "name": "left-pad", "version": "1.3.0"}
+  ],
+  "dependencies": [
+    {"ref": "lock", "dependsOn": ["lodash", "minimist"]},
+    {"ref": "os", "dependsOn": ["openssl"]}
+  ],
+  "vulnerabilities": [
+    {"id": "CVE-2021-23337", "ratings": [{"severity": "medium"}, {"severity": "high"}], "description": "command injection",
+     "recommendation": "Upgrade lodash to version 4.17.21.", "advisories": [{"url": "https://github.com/advisories/GHSA-35jh-r3h4-6jhm"}],
+     "affects": [{"ref": "lodash"}]},
+    {"id": "CVE-2021-44906", "source": {"url": "https://nvd.nist.gov/vuln/detail/CVE-2021-44906"}, "ratings": [{"severity": "critical"}],
+     "affects": [{"ref": "minimist"}]},
+    {"id": "CVE-2023-5363", "ratings": [{"severity": "high"}], "affects": [{"ref": "openssl"}, {"ref": "unknown"}]},
+    {"id": "CVE-2020-0001", "affects": [{"ref": "stray"}]}
+  ]
+}`
+
+func TestParseCycloneDXReport(t *testing.T) {
+	results, err := parseCycloneDXReport([]byte(cycloneDXReport))
+	if err != nil {
+		t.Fatalf("parseCycloneDXReport: %v", err)
+	}
+
+	byTarget := make(map[string]Result)
+	var targets []string
+	for _, r := range results {
+		byTarget[r.Target] = r
+		targets = append(targets, r.Target)
+	}
+	// the packages outside of a lockfile or system are the artifact's
+	if got := strings.Join(targets, ", "); got != "alpine 3.18.4, github.com/org/app, web/package-lock.json" {
+		t.Fatalf("got the targets %s", got)
+	}
+
+	lock := byTarget["web/package-lock.json"]
+	if lock.Class != "lang-pkgs" || lock.Type != "npm" || len(lock.Packages) != 2 || len(lock.Vulnerabilities) != 2 {
+		t.Errorf("got the lockfile's result %+v, want lodash and minimist, nested and from the dependency graph", lock)
+	}
+	for _, v := range lock.Vulnerabilities {
+		switch v.VulnerabilityID {
+		case "CVE-2021-23337":
+			if v.PkgName != "lodash" || v.InstalledVersion != "4.17.20" || v.FixedVersion != "4.17.21" || v.Severity != "HIGH" ||
+				v.PrimaryURL != "https://github.com/advisories/GHSA-35jh-r3h4-6jhm" {
+				t.Errorf("got the lodash vulnerability %+v", v)
+			}
+		case "CVE-2021-44906":
+			if v.PkgName != "minimist" || v.Severity != "CRITICAL" || v.PrimaryURL != "https://nvd.nist.gov/vuln/detail/CVE-2021-44906" ||
+				len(v.References) != 1 {
+				t.Errorf("got the minimist vulnerability %+v", v)
+			}
+		default:
+			t.Errorf("got the vulnerability %s in the lockfile", v.VulnerabilityID)
+		}
+	}
+
+	os := byTarget["alpine 3.18.4"]
+	if os.Class != "os-pkgs" || os.Type != "alpine" || len(os.Vulnerabilities) != 1 || os.Vulnerabilities[0].PkgName != "openssl" {
+		t.Errorf("got the system's result %+v", os)
+	}
+	stray := byTarget["github.com/org/app"]
+	if len(stray.Vulnerabilities) != 1 || stray.Vulnerabilities[0].Severity != "UNKNOWN" || stray.Class != "lang-pkgs" {
+		t.Errorf("got the artifact's result %+v, want the unrated left-pad vulnerability", stray)
+	}
+}
+
+func TestCycloneDXTargetName(t *testing.T) {
+	tests := []struct {
+		component cycloneDXComponent
+		want      string
+	}{
+		{component: cycloneDXComponent{Type: "application", Name: "go.mod"}, want: "go.mod"},
+		{component: cycloneDXComponent{Type: "operating-system", Name: "debian", Version: "12.2"}, want: "debian 12.2"},
+		{component: cycloneDXComponent{Type: "operating-system", Name: "debian"}, want: "debian"},
+		{component: cycloneDXComponent{}, want: "sbom"},
+	}
+	for _, tt := range tests {
+		if got := cycloneDXTargetName(tt.component, "sbom"); got != tt.want {
+			t.Errorf("cycloneDXTargetName(%+v) = %q, want %q", tt.component, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SupportedSchemaVersion is the Trivy report schema version the types are written against,
+// reports of LegacySchemaVersion are decoded as well
+const SupportedSchemaVersion = 2
+
+// DriftKind classifies how a report differs from the schema the types know
+type DriftKind string
+
+const (
+	// DriftUnknown is a field the schema doesn't have, kept in the Extra of its parent
+	DriftUnknown DriftKind = "unknown"
+	// DriftInvalid is a field of an unexpected type, left at its zero value
+	DriftInvalid DriftKind = "invalid"
+	// DriftMissing is a field a finding can't do without
+	DriftMissing DriftKind = "missing"
+	// DriftVersion is a report of another schema version
+	DriftVersion DriftKind = "version"
+)
+
+// Drift is a difference between a report and the schema the types know
+type Drift struct {
+	// Path locates the field, e.g. Results[2].Misconfigurations[0].Severity
+	Path   string
+	Kind   DriftKind
+	Detail string
+}
+
+func (d Drift) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("%s field %s", d.Kind, d.Path)
+	}
+	return fmt.Sprintf("%s field %s: %s", d.Kind, d.Path, d.Detail)
+}
+
+// Report is a decoded Trivy report along with every difference from the known schema found
+// while decoding it
+type Report struct {
+	SchemaVersion int
+	Results       []Result
+	// Extra holds the top level fields the types don't model, such as ArtifactName
+	Extra map[string]json.RawMessage
+	Drift []Drift
+}
+
+// schemaFields are the fields of the supported schema that the types recognise but don't
+// model, they are kept in Extra but aren't drift
+var schemaFields = map[string][]string{
+	"Report":           {"CreatedAt", "ArtifactName", "ArtifactType", "Metadata", "ReportID"},
+	"Result":           {"CustomResources"},
+	"Misconfiguration": {"Namespace", "Traces"},
+	"Vulnerability": {"SeveritySource", "DataSource", "CweIDs", "VendorSeverity", "CVSS", "PublishedDate",
+		"LastModifiedDate", "PkgIdentifier"},
+	"CauseMetadata": {"RenderedCause"},
+	"Package": {"UID", "Arch", "SrcName", "SrcVersion", "SrcRelease", "SrcEpoch", "Release", "Epoch", "Licenses",
+		"Layer", "Digest", "DependsOn", "Indirect", "Relationship", "Locations", "FilePath", "InstalledFiles", "Modularitylabel"},
+	"PkgIdentifier": {"BOMRef"},
+	"License":       {"Text"},
+}
+
+// requiredFields are needed for a useful finding, a report without them has drifted
+var requiredFields = map[string][]string{
+	"Result":           {"Target"},
+	"Misconfiguration": {"ID", "Severity"},
+	"Vulnerability":    {"VulnerabilityID", "PkgName", "Severity"},
+	"Secret":           {"RuleID", "Severity"},
+	"Package":          {"Name"},
+	"License":          {"Name", "Severity"},
+}
+
+// LoadReport reads and tolerantly decodes the report at path, a Trivy JSON report or one in
+// another of the Formats, streaming its results with DecodeReport
+func LoadReport(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeReport(f)
+}
+
+// ParseReport decodes a Trivy JSON report field by field. A field of an unexpected type is
+// recorded as drift and left empty rather than failing the whole report, so a new Trivy
+// release degrades the comments instead of breaking them. Only input that isn't a JSON
+// object is an error. A SARIF log, e.g. from trivy --format sarif, a CycloneDX or SPDX SBOM or
+// the report of another scanner of the Formats is read as the report its results map onto.
+func ParseReport(data []byte) (*Report, error) {
+	return DecodeReport(bytes.NewReader(data))
+}
+
+// DecodeReport is ParseReport reading from r. The entries of Results are decoded one at a
+// time as they are read, so an image scan of hundreds of megabytes isn't held in memory as a
+// whole next to its decoded results. SARIF logs, SBOMs and the reports of other scanners have
+// no Results and are read whole. The schema version is detected from the report: a bare array
+// of results is the legacy schema of trivy releases before 0.20, unless its first entry is
+// checkov's, hadolint's or kube-bench's, anything else the object of SchemaVersion 2. A gzip
+// compressed report is decompressed as it's read.
+func DecodeReport(r io.Reader) (*Report, error) {
+	r, err := Uncompressed(r)
+	if err != nil {
+		return nil, &DecodeError{Err: err}
+	}
+	dec := json.NewDecoder(r)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, &DecodeError{Err: err}
+	}
+	d := &decoder{}
+	if token == json.Delim('[') {
+		var first json.RawMessage
+		if dec.More() {
+			if err := dec.Decode(&first); err != nil {
+				return nil, &DecodeError{SchemaVersion: LegacySchemaVersion, Err: err}
+			}
+		}
+		if results, ok, err := parseOtherArray(dec, first); ok {
+			if err != nil {
+				return nil, err
+			}
+			return &Report{SchemaVersion: SupportedSchemaVersion, Results: results, Extra: make(map[string]json.RawMessage)}, nil
+		}
+		results, err := d.streamEntries(dec, first)
+		if err != nil {
+			return nil, &DecodeError{SchemaVersion: LegacySchemaVersion, Err: err}
+		}
+		for i := range results {
+			if results[i].Class == "" {
+				results[i].Class = legacyClass(results[i])
+			}
+		}
+		return &Report{SchemaVersion: LegacySchemaVersion, Results: results, Extra: make(map[string]json.RawMessage), Drift: d.sorted()}, nil
+	}
+	if token != json.Delim('{') {
+		return nil, errors.New("the report isn't a JSON object or, for trivy releases before 0.20, array")
+	}
+
+	rep := &Report{Extra: make(map[string]json.RawMessage)}
+	fields := make(map[string]json.RawMessage)
+	var streamed bool
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, &DecodeError{SchemaVersion: rep.SchemaVersion, Err: err}
+		}
+		name, _ := token.(string)
+		if name == "Results" {
+			if rep.Results, err = d.streamResults(dec); err != nil {
+				return nil, &DecodeError{SchemaVersion: rep.SchemaVersion, Err: err}
+			}
+			streamed = true
+			continue
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, &DecodeError{SchemaVersion: rep.SchemaVersion, Err: err}
+		}
+		if name == "SchemaVersion" {
+			// trivy writes it first, so it names the schema of errors further on
+			if err := json.Unmarshal(raw, &rep.SchemaVersion); err != nil {
+				d.drift("SchemaVersion", DriftInvalid, err.Error())
+			}
+			continue
+		}
+		fields[name] = raw
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, &DecodeError{SchemaVersion: rep.SchemaVersion, Err: err}
+	}
+	if !streamed {
+		if results, ok, err := parseOtherFormat(fields); ok {
+			if err != nil {
+				return nil, err
+			}
+			return &Report{SchemaVersion: SupportedSchemaVersion, Results: results, Extra: make(map[string]json.RawMessage)}, nil
+		}
+	}
+
+	if rep.SchemaVersion != 0 && !supportedSchema(rep.SchemaVersion) {
+		d.drift("SchemaVersion", DriftVersion, fmt.Sprintf("version %d, this release reads %s", rep.SchemaVersion, supportedSchemas()))
+	}
+	d.extra("", "Report", fields, rep.Extra)
+	if image := reportImage(rep.Extra); image != nil {
+		for i := range rep.Results {
+			rep.Results[i].Image = image
+		}
+	}
+	rep.Drift = d.sorted()
+	return rep, nil
+}
+
+// LegacySchemaVersion is the schema of trivy releases before 0.20, which wrote the results as a
+// bare array before SchemaVersion existed
+const LegacySchemaVersion = 1
+
+func supportedSchema(version int) bool {
+	return version == LegacySchemaVersion || version == SupportedSchemaVersion
+}
+
+func supportedSchemas() string {
+	return fmt.Sprintf("%d and %d", LegacySchemaVersion, SupportedSchemaVersion)
+}
+
+// legacyClass is the Class trivy gives results since 0.20, for the results of legacy reports
+// that have none
+func legacyClass(r Result) string {
+	switch {
+	case len(r.Misconfigurations) > 0:
+		return "config"
+	case len(r.Secrets) > 0:
+		return "secret"
+	case osFamilies[strings.ToLower(r.Type)]:
+		return "os-pkgs"
+	}
+	return "lang-pkgs"
+}
+
+// osFamilies are the result types of OS package scans
+var osFamilies = map[string]bool{
+	"alpine": true, "amazon": true, "cbl-mariner": true, "centos": true, "debian": true, "oracle": true,
+	"photon": true, "redhat": true, "rocky": true, "alma": true, "suse": true, "opensuse.leap": true, "ubuntu": true,
+	"wolfi": true, "chainguard": true,
+}
+
+// DecodeError is a report that isn't valid JSON, naming the schema version detected before the
+// error so a truncated or mangled report is told apart from a schema this release doesn't know
+type DecodeError struct {
+	// SchemaVersion is 0 when the error came before the report named its version
+	SchemaVersion int
+	Err           error
+}
+
+func (e *DecodeError) Error() string {
+	if e.SchemaVersion == 0 {
+		return fmt.Sprintf("the report can't be decoded, the error comes before its schema version (this release reads %s): %v", supportedSchemas(), e.Err)
+	}
+	return fmt.Sprintf("the report can't be decoded as schema version %d (this release reads %s): %v", e.SchemaVersion, supportedSchemas(), e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// parseOtherFormat reads the reports in another format than trivy's JSON, a SARIF log, a
+// CycloneDX or SPDX SBOM or the report of another scanner, returning false for a trivy report
+func parseOtherFormat(fields map[string]json.RawMessage) ([]Result, bool, error) {
+	var format string
+	var parse func(data []byte) ([]Result, error)
+	switch {
+	case isSARIF(fields):
+		format, parse = "SARIF", parseSARIF
+	case isCycloneDX(fields):
+		format, parse = "CycloneDX", parseCycloneDXReport
+	case isSPDX(fields):
+		format, parse = "SPDX", parseSPDXReport
+	case isGrype(fields):
+		format, parse = "grype", parseGrype
+	case isCheckov(fields):
+		format, parse = "checkov", parseCheckov
+	case isKubescape(fields):
+		format, parse = "kubescape", parseKubescape
+	case isKubeBench(fields):
+		format, parse = "kube-bench", parseKubeBench
+	case isSemgrep(fields):
+		format, parse = "semgrep", parseSemgrep
+	case isTfsec(fields):
+		format, parse = "tfsec", parseTfsec
+	default:
+		return nil, false, nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", format, err)
+	}
+	results, err := parse(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", format, err)
+	}
+	return results, true, nil
+}
+
+// parseOtherArray reads the reports in another format that are an array like those of the
+// legacy schema, checkov's of several frameworks, hadolint's or kube-bench's, told apart by
+// their first entry, returning false for a legacy trivy report
+func parseOtherArray(dec *json.Decoder, first json.RawMessage) ([]Result, bool, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(first, &fields) != nil {
+		return nil, false, nil
+	}
+	var format string
+	var parse func(data []byte) ([]Result, error)
+	switch {
+	case isCheckov(fields):
+		format, parse = "checkov", parseCheckov
+	case isHadolint(fields):
+		format, parse = "hadolint", parseHadolint
+	case isKubeBench(fields):
+		format, parse = "kube-bench", parseKubeBench
+	default:
+		return nil, false, nil
+	}
+	entries := []json.RawMessage{first}
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, true, fmt.Errorf("%s: %w", format, err)
+		}
+		entries = append(entries, raw)
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, true, fmt.Errorf("%s: %w", format, err)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", format, err)
+	}
+	results, err := parse(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", format, err)
+	}
+	return results, true, nil
+}
+
+// Formats are the report formats DecodeFormat reads, by the name a format is selected with.
+// DecodeReport tells them apart by their fields.
+var Formats = []string{"trivy", "sarif", "cyclonedx", "spdx", "grype", "checkov", "tfsec", "semgrep", "hadolint", "kubescape", "kube-bench"}
+
+var formatParsers = map[string]func(data []byte) ([]Result, error){
+	"sarif":      parseSARIF,
+	"cyclonedx":  parseCycloneDXReport,
+	"spdx":       parseSPDXReport,
+	"grype":      parseGrype,
+	"checkov":    parseCheckov,
+	"tfsec":      parseTfsec,
+	"semgrep":    parseSemgrep,
+	"hadolint":   parseHadolint,
+	"kubescape":  parseKubescape,
+	"kube-bench": parseKubeBench,
+}
+
+// LoadReportFormat is LoadReport reading the report at path as the named format
+func LoadReportFormat(path, format string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeFormat(f, format)
+}
+
+// DecodeFormat is DecodeReport reading r as the named format of Formats rather than telling it
+// from its fields, an empty format or trivy is DecodeReport. Other formats are read whole.
+func DecodeFormat(r io.Reader, format string) (*Report, error) {
+	format = strings.ToLower(format)
+	if format == "" || format == "trivy" {
+		return DecodeReport(r)
+	}
+	parse, ok := formatParsers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown report format %s, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	r, err := Uncompressed(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	results, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+	return &Report{SchemaVersion: SupportedSchemaVersion, Results: results, Extra: make(map[string]json.RawMessage)}, nil
+}
+
+// streamResults decodes the Results array an entry at a time, a value that isn't an array is
+// drift like any other field of an unexpected type
+func (d *decoder) streamResults(dec *json.Decoder) ([]Result, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		d.drift("Results", DriftInvalid, fmt.Sprintf("expected an array, found %v", token))
+		return nil, skipValue(dec, token)
+	}
+	return d.streamEntries(dec, nil)
+}
+
+// streamEntries decodes the entries of an array of results whose opening bracket was read,
+// after the first entry when it was read already
+func (d *decoder) streamEntries(dec *json.Decoder, first json.RawMessage) ([]Result, error) {
+	var results []Result
+	for i := 0; first != nil || dec.More(); i++ {
+		raw := first
+		first = nil
+		if raw == nil {
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+		}
+		var result Result
+		d.decode(raw, fmt.Sprintf("Results[%d]", i), reflect.ValueOf(&result).Elem())
+		results = append(results, result)
+	}
+	return results, expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token, failing unless it is the delimiter
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %v, found %v", want, token)
+	}
+	return nil
+}
+
+// skipValue reads the rest of the value the token opens
+func skipValue(dec *json.Decoder, token json.Token) error {
+	delim, ok := token.(json.Delim)
+	if !ok || delim == '}' || delim == ']' {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// SchemaError lists every way a report differs from the supported schema
+type SchemaError struct {
+	Drift []Drift
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, 0, len(e.Drift))
+	for _, d := range e.Drift {
+		lines = append(lines, "  - "+d.String())
+	}
+	return fmt.Sprintf("the report doesn't match schema version %d, %d differences:\n%s", SupportedSchemaVersion, len(e.Drift), strings.Join(lines, "\n"))
+}
+
+// CheckSchema returns a *SchemaError when the report drifted from the supported schema in any
+// way, unknown fields and a missing schema version included, for callers that would rather
+// stop than comment on a partial reading of the report
+func (r *Report) CheckSchema() error {
+	drift := r.Drift
+	if r.SchemaVersion == 0 {
+		drift = append([]Drift{{Path: "SchemaVersion", Kind: DriftMissing}}, drift...)
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	return &SchemaError{Drift: drift}
+}
+
+type decoder struct {
+	drifts []Drift
+}
+
+func (d *decoder) drift(path string, kind DriftKind, detail string) {
+	d.drifts = append(d.drifts, Drift{Path: path, Kind: kind, Detail: detail})
+}
+
+// sorted returns the drift ordered by path
+func (d *decoder) sorted() []Drift {
+	sort.SliceStable(d.drifts, func(i, j int) bool { return d.drifts[i].Path < d.drifts[j].Path })
+	return d.drifts
+}
+
+var rawMessageMap = reflect.TypeOf(map[string]json.RawMessage(nil))
+
+// decode fills v from raw, descending into structs and slices of structs so a bad field only
+// loses itself
+func (d *decoder) decode(raw json.RawMessage, path string, v reflect.Value) {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return
+	}
+	switch {
+	case v.Kind() == reflect.Struct:
+		d.decodeStruct(raw, path, v)
+	case v.Kind() == reflect.Pointer && v.Type().Elem().Kind() == reflect.Struct:
+		elem := reflect.New(v.Type().Elem())
+		d.decodeStruct(raw, path, elem.Elem())
+		v.Set(elem)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			d.drift(path, DriftInvalid, err.Error())
+			return
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			d.decode(item, fmt.Sprintf("%s[%d]", path, i), slice.Index(i))
+		}
+		v.Set(slice)
+	default:
+		if err := json.Unmarshal(raw, v.Addr().Interface()); err != nil {
+			d.drift(path, DriftInvalid, err.Error())
+		}
+	}
+}
+
+func (d *decoder) decodeStruct(raw json.RawMessage, path string, v reflect.Value) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		d.drift(path, DriftInvalid, err.Error())
+		return
+	}
+
+	t := v.Type()
+	var extra reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			if field.Name == "Extra" && field.Type == rawMessageMap {
+				extra = v.Field(i)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if value, ok := fields[name]; ok {
+			d.decode(value, join(path, name), v.Field(i))
+			delete(fields, name)
+		}
+	}
+	for _, name := range requiredFields[t.Name()] {
+		if v.FieldByName(name).IsZero() {
+			d.drift(join(path, name), DriftMissing, "")
+		}
+	}
+
+	kept := make(map[string]json.RawMessage)
+	d.extra(path, t.Name(), fields, kept)
+	if extra.IsValid() && len(kept) > 0 {
+		extra.Set(reflect.ValueOf(kept))
+	}
+}
+
+// extra keeps the fields the type doesn't model, reporting those of no known schema
+func (d *decoder) extra(path, typeName string, fields, kept map[string]json.RawMessage) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kept[name] = fields[name]
+		if !contains(schemaFields[typeName], name) {
+			d.drift(join(path, name), DriftUnknown, "")
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
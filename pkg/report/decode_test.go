@@ -0,0 +1,158 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+// formatReports are a report of each format with its single finding
+var formatReports = []struct {
+	format string
+	data   string
+	want   Finding
+}{
+	{
+		format: "trivy",
+		data: `{"SchemaVersion": 2, "Results": [{"Target": "main.tf", "Class": "config", "Type": "terraform",
+				"Misconfigurations": [{"ID": "AVD-AWS-0086", "Title": "block public acls", "Severity": "HIGH",
+				"CauseMetadata": {"StartLine": 3, "EndLine": 5}}]}]}`,
+		want: Finding{Target: "main.tf", ID: "AVD-AWS-0086", Severity: "HIGH", StartLine: 3, EndLine: 5},
+	},
+	{
+		format: "tfsec",
+		data: `{"results": [{"rule_id": "AVD-AWS-0086", "long_id": "aws-s3-block-public-acls", "severity": "HIGH",
+				"location": {"filename": "main.tf", "start_line": 3, "end_line": 5}}]}`,
+		want: Finding{Target: "main.tf", Severity: "HIGH", StartLine: 3, EndLine: 5},
+	},
+	{
+		format: "checkov",
+		data: `{"check_type": "terraform", "results": {"failed_checks": [{"check_id": "CKV_AWS_20",
+				"file_path": "/main.tf", "file_line_range": [3, 5], "severity": "HIGH"}]}}`,
+		want: Finding{ID: "CKV_AWS_20", Severity: "HIGH", StartLine: 3, EndLine: 5},
+	},
+	{
+		format: "semgrep",
+		data: `{"results": [{"check_id": "go.lang.security.audit", "path": "main.go",
+				"start": {"line": 3}, "end": {"line": 5}, "extra": {"message": "audit", "severity": "ERROR"}}], "errors": []}`,
+		want: Finding{Target: "main.go", ID: "go.lang.security.audit", Severity: "HIGH", StartLine: 3, EndLine: 5},
+	},
+	{
+		format: "hadolint",
+		data:   `[{"code": "DL3007", "file": "Dockerfile", "level": "warning", "line": 1, "message": "latest"}]`,
+		want:   Finding{Target: "Dockerfile", ID: "DL3007", Severity: "MEDIUM", StartLine: 1, EndLine: 1},
+	},
+	{
+		format: "sarif",
+		data: `{"runs": [{"tool": {"driver": {"rules": [{"id": "AVD-AWS-0086"}]}}, "results": [{"ruleId": "AVD-AWS-0086",
+				"level": "error", "message": {"text": "public acls"}, "locations": [{"physicalLocation":
+				{"artifactLocation": {"uri": "main.tf"}, "region": {"startLine": 3, "endLine": 5}}}]}]}]}`,
+		want: Finding{Target: "main.tf", ID: "AVD-AWS-0086", StartLine: 3, EndLine: 5},
+	},
+	{
+		format: "grype",
+		data: `{"matches": [{"vulnerability": {"id": "CVE-2024-0001", "severity": "Critical"},
+				"artifact": {"name": "openssl", "version": "3.0.0", "type": "apk", "locations": [{"path": "/lib/apk/db/installed"}]}}],
+				"source": {"type": "image", "target": {"userInput": "alpine:3.18"}}, "descriptor": {"name": "grype"}}`,
+		want: Finding{ID: "CVE-2024-0001", Severity: "CRITICAL", PkgName: "openssl", InstalledVersion: "3.0.0"},
+	},
+	{
+		format: "kubescape",
+		data: `{"summaryDetails": {"controls": {"C-0057": {"name": "Privileged container", "severity": "High"}}},
+				"resources": [{"resourceID": "web", "object": {"kind": "Deployment", "metadata": {"name": "web"}}, "source": {"relativePath": "web.yaml"}}],
+				"results": [{"resourceID": "web", "controls": [{"controlID": "C-0057", "name": "Privileged container", "status": {"status": "failed"},
+				"rules": [{"status": "failed", "paths": [{"failedPath": "spec.containers[0].securityContext.privileged"}]}]}]}]}`,
+		want: Finding{Target: "web.yaml", ID: "C-0057", Severity: "HIGH"},
+	},
+	{
+		format: "kube-bench",
+		data: `{"Controls": [{"id": "1", "version": "cis-1.8", "node_type": "master", "tests": [{"section": "1.2", "desc": "API Server",
+				"results": [{"test_number": "1.2.1", "test_desc": "anonymous-auth is false", "status": "FAIL", "scored": true},
+				{"test_number": "1.2.2", "status": "PASS", "scored": true}]}]}], "Totals": {"total_fail": 1}}`,
+		want: Finding{Target: "kube-bench master (cis-1.8)", ID: "1.2.1", Severity: "HIGH"},
+	},
+	{
+		format: "cyclonedx",
+		data: `{"bomFormat": "CycloneDX", "components": [{"bom-ref": "lock", "type": "application", "name": "package-lock.json",
+				"components": [{"bom-ref": "lodash", "type": "library", "name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20"}]}],
+				"vulnerabilities": [{"id": "CVE-2021-23337", "ratings": [{"severity": "high"}], "recommendation": "Upgrade lodash to version 4.17.21",
+				"affects": [{"ref": "lodash"}]}]}`,
+		want: Finding{Target: "package-lock.json", ID: "CVE-2021-23337", Severity: "HIGH", PkgName: "lodash", InstalledVersion: "4.17.20"},
+	},
+	{
+		format: "spdx",
+		data: `{"spdxVersion": "SPDX-2.3", "packages": [{"SPDXID": "SPDXRef-lodash", "name": "lodash", "versionInfo": "4.17.20",
+				"sourceInfo": "package found in: package-lock.json", "externalRefs": [
+				{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:npm/lodash@4.17.20"},
+				{"referenceCategory": "SECURITY", "referenceType": "advisory", "referenceLocator": "https://nvd.nist.gov/vuln/detail/CVE-2021-23337"}]}]}`,
+		want: Finding{Target: "package-lock.json", ID: "CVE-2021-23337", Severity: "UNKNOWN", PkgName: "lodash", InstalledVersion: "4.17.20"},
+	},
+}
+
+func TestDecodeFormat(t *testing.T) {
+	for _, tt := range formatReports {
+		t.Run(tt.format, func(t *testing.T) {
+			r, err := DecodeFormat(strings.NewReader(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("DecodeFormat: %v", err)
+			}
+			findings := Findings(r.Results)
+			if len(findings) != 1 {
+				t.Fatalf("got %d findings, want 1", len(findings))
+			}
+			assertFinding(t, findings[0], tt.want)
+		})
+	}
+}
+
+// assertFinding compares the fields set on want
+func assertFinding(t *testing.T, got, want Finding) {
+	t.Helper()
+	check := func(field, got, want string) {
+		if want != "" && got != want {
+			t.Errorf("got the %s %q, want %q", field, got, want)
+		}
+	}
+	check("target", got.Target, want.Target)
+	check("ID", got.ID, want.ID)
+	check("severity", got.Severity, want.Severity)
+	check("package", got.PkgName, want.PkgName)
+	check("installed version", got.InstalledVersion, want.InstalledVersion)
+	if want.StartLine != 0 && (got.StartLine != want.StartLine || got.EndLine != want.EndLine) {
+		t.Errorf("got the lines %d-%d, want %d-%d", got.StartLine, got.EndLine, want.StartLine, want.EndLine)
+	}
+}
+
+func TestDecodeFormatErrors(t *testing.T) {
+	if _, err := DecodeFormat(strings.NewReader("{}"), "snyk"); err == nil || !strings.Contains(err.Error(), "unknown report format") {
+		t.Errorf("got %v for an unknown format, want it named", err)
+	}
+	if _, err := DecodeFormat(strings.NewReader("not json"), "tfsec"); err == nil || !strings.HasPrefix(err.Error(), "tfsec: ") {
+		t.Errorf("got %v for an invalid report, want the format named", err)
+	}
+}
+
+func TestDecodeReportTellsTheFormat(t *testing.T) {
+	for _, tt := range formatReports {
+		t.Run(tt.format, func(t *testing.T) {
+			r, err := DecodeReport(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("DecodeReport: %v", err)
+			}
+			findings := Findings(r.Results)
+			if len(findings) != 1 {
+				t.Fatalf("got %d findings, want 1", len(findings))
+			}
+			assertFinding(t, findings[0], tt.want)
+		})
+	}
+
+	// the bare array of controls older kube-bench releases write
+	r, err := DecodeReport(strings.NewReader(`[{"id": "4", "version": "cis-1.8", "node_type": "node", "tests": [{"section": "4.2",
+		"results": [{"test_number": "4.2.1", "test_desc": "anonymous-auth is false", "status": "WARN"}]}]}]`))
+	if err != nil {
+		t.Fatalf("DecodeReport: %v", err)
+	}
+	if findings := Findings(r.Results); len(findings) != 1 || findings[0].ID != "4.2.1" || findings[0].Severity != "LOW" {
+		t.Errorf("got %v, want the kube-bench warning", findings)
+	}
+}
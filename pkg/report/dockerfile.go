@@ -0,0 +1,199 @@
+package report
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// BaseImage is the image a FROM instruction of a Dockerfile builds on
+type BaseImage struct {
+	// Line is the 1-based line of the FROM instruction
+	Line int
+	// Repository is the image without its tag or digest, e.g. alpine or ghcr.io/org/app
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Reference is the image as written, e.g. alpine:3.18
+func (b BaseImage) Reference() string {
+	ref := b.Repository
+	if b.Tag != "" {
+		ref += ":" + b.Tag
+	}
+	if b.Digest != "" {
+		ref += "@" + b.Digest
+	}
+	return ref
+}
+
+// IsDockerfile reports whether the target is a Dockerfile by its name
+func IsDockerfile(target string) bool {
+	base := path.Base(target)
+	return base == "Dockerfile" || base == "Containerfile" ||
+		strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".Dockerfile")
+}
+
+// BaseImages returns the images the stages of the Dockerfile build on in order, leaving out
+// stages built on earlier stages and scratch
+func BaseImages(content []byte) []BaseImage {
+	var images []BaseImage
+	stages := make(map[string]bool)
+	for i, line := range strings.Split(string(content), "\n") {
+		ref, stage, ok := parseFrom(line)
+		if !ok {
+			continue
+		}
+		// a stage is only known to the stages after it
+		earlier := stages[strings.ToLower(ref)] && !strings.ContainsAny(ref, ":/@")
+		if stage != "" {
+			stages[strings.ToLower(stage)] = true
+		}
+		if earlier || !resolvable(ref) {
+			continue
+		}
+		image := parseImage(ref)
+		image.Line = i + 1
+		images = append(images, image)
+	}
+	return images
+}
+
+// LocateBaseImages anchors the vulnerabilities of an image scan onto the FROM instruction of
+// the Dockerfile its packages come from: the stage building on the scanned image, or the final
+// stage when the scanned image is the one the Dockerfile builds.
+func LocateBaseImages(findings []Finding, dockerfile string, content []byte) []Finding {
+	images := BaseImages(content)
+	if len(images) == 0 {
+		return findings
+	}
+	located := make([]Finding, len(findings))
+	for i, f := range findings {
+		located[i] = f
+		if f.Class != "os-pkgs" || f.StartLine > 0 {
+			continue
+		}
+		scanned := ImageName(f.Target)
+		base := images[len(images)-1]
+		for _, image := range images {
+			if image.Reference() == scanned || image.Repository == parseImage(scanned).Repository {
+				base = image
+				break
+			}
+		}
+		located[i].Target = dockerfile
+		located[i].StartLine, located[i].EndLine = base.Line, base.Line
+		if f.FixedVersion != "" {
+			located[i].Resolution = fmt.Sprintf("Upgrade %s to %s, or build on a newer %s", f.PkgName, f.FixedVersion, base.Reference())
+		}
+	}
+	SortFindings(located)
+	return located
+}
+
+// ImageName is the image of an image scan target, e.g. alpine:3.14 for
+// "alpine:3.14 (alpine 3.14.2)"
+func ImageName(target string) string {
+	name, _, _ := strings.Cut(target, " (")
+	return name
+}
+
+// SuggestBaseImages sets the suggestion of the findings on a FROM line of a Dockerfile, the
+// misconfigurations of the instruction and the vulnerabilities of its image, to the same
+// instruction building on the image the resolve function returns. The function is given the
+// base image and returns its replacement, false when it has none.
+func SuggestBaseImages(findings []Finding, read func(target string) ([]byte, error), resolve func(BaseImage) (BaseImage, bool)) []Finding {
+	contents := make(map[string][]string)
+	suggested := make([]Finding, len(findings))
+	for i, f := range findings {
+		suggested[i] = f
+		if f.Suggestion != "" || !IsDockerfile(f.Target) || f.StartLine < 1 || f.StartLine != f.EndLine {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		if f.StartLine > len(lines) {
+			continue
+		}
+		line := lines[f.StartLine-1]
+		ref, _, ok := parseFrom(line)
+		if !ok || !resolvable(ref) {
+			continue
+		}
+		replacement, ok := resolve(parseImage(ref))
+		if !ok || replacement.Reference() == ref {
+			continue
+		}
+		suggested[i].Suggestion = strings.Replace(line, ref, replacement.Reference(), 1)
+	}
+	return suggested
+}
+
+var fromInstruction = regexp.MustCompile(`(?i)^\s*FROM\s+((?:--\S+\s+)*)(\S+)(?:\s+AS\s+(\S+))?\s*$`)
+
+// parseFrom returns the image reference and stage name of a FROM instruction
+func parseFrom(line string) (string, string, bool) {
+	m := fromInstruction.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	return m[2], m[3], true
+}
+
+// resolvable reports whether the reference names an image, rather than scratch or an image
+// chosen by a build argument
+func resolvable(ref string) bool {
+	return ref != "scratch" && !strings.Contains(ref, "$")
+}
+
+func parseImage(ref string) BaseImage {
+	var image BaseImage
+	ref, image.Digest, _ = strings.Cut(ref, "@")
+	// a colon before the last slash is the port of the registry, not a tag
+	if i := strings.LastIndexByte(ref, ':'); i > strings.LastIndexByte(ref, '/') {
+		ref, image.Tag = ref[:i], ref[i+1:]
+	}
+	image.Repository = ref
+	return image
+}
+
+var tagVersion = regexp.MustCompile(`^(v?)(\d+(?:\.\d+)*)(.*)$`)
+
+// NewerTag picks the newest of the tags shaped like the current one, the same number of
+// version components and the same variant suffix, e.g. 3.19 for 3.14 or 20-slim for
+// 18-slim. A latest or missing tag is replaced by the newest plain version. Empty is returned
+// when no tag is newer than the current one.
+func NewerTag(current string, tags []string) string {
+	var prefix, suffix string
+	components := -1
+	if m := tagVersion.FindStringSubmatch(current); m != nil {
+		prefix, suffix, components = m[1], m[3], strings.Count(m[2], ".")+1
+	} else {
+		current = ""
+	}
+	var newest string
+	for _, tag := range tags {
+		m := tagVersion.FindStringSubmatch(tag)
+		if m == nil || m[1] != prefix || m[3] != suffix {
+			continue
+		}
+		if components > 0 && strings.Count(m[2], ".")+1 != components {
+			continue
+		}
+		if current != "" && compareVersions(tag, current) <= 0 {
+			continue
+		}
+		if newest == "" || compareVersions(tag, newest) > 0 ||
+			compareVersions(tag, newest) == 0 && len(tag) > len(newest) {
+			newest = tag
+		}
+	}
+	return newest
+}
@@ -0,0 +1,228 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Finding is the stable, flattened view of a single issue in a report,
+// independent of how the report nests it
+type Finding struct {
+	Target      string
+	Class       string
+	Type        string
+	ID          string
+	AVDID       string
+	Title       string
+	Description string
+	Message     string
+	Resolution  string
+	Severity    string
+	PrimaryURL  string
+	References  []string
+	Resource    string
+	Provider    string
+	Service     string
+	StartLine   int
+	EndLine     int
+	Code        []Line
+	Occurrences []Occurrence
+
+	// the vulnerable package of a vulnerability, empty for a misconfiguration
+	PkgName          string
+	InstalledVersion string
+	FixedVersion     string
+	// Suggestion replaces the lines of the finding to upgrade the package, set by
+	// LocatePackages when the manifest line can be rewritten
+	Suggestion string
+
+	// the Helm values a finding on a chart template is set from, see LocateHelmTemplates
+	ValuesFile string
+	ValuesKeys []string
+
+	// the field of a Kubernetes manifest the finding points at, see LocateManifestPaths
+	ManifestPath string
+
+	// the resource and location in a module a finding on its module call was raised on, see
+	// LocateModuleCalls
+	ModuleResource string
+	ModuleLocation string
+
+	// the category of a secret, e.g. AWS, and the remediation RemediateSecrets adds to it
+	SecretCategory    string
+	SecretRemediation *SecretRemediation
+
+	// the VEX statement covering a vulnerability, see ApplyVEX. A suppressed finding is only
+	// listed in the summary, a downgraded one keeps its original severity in VEXSeverity.
+	VEX         *VEXStatement
+	VEXSeverity string
+	Suppressed  bool
+
+	// the license of a license finding, the package it is on being the Resource, and the
+	// category of the license policy it falls into, see ApplyLicensePolicy. An allowed license
+	// is suppressed.
+	License         string
+	LicenseCategory string
+
+	// the image and layer a vulnerability of a container image scan is in
+	Image string
+	Layer ImageLayer
+
+	// why the file of the finding is taken as generated or vendored, see SkipGenerated. Such
+	// a finding is suppressed.
+	Generated string
+
+	// Permalink links the lines of the finding at the commit scanned, see Permalinks
+	Permalink string
+	// LineHash is the hash of the content of the lines of the finding, see LineHashes
+	LineHash string
+}
+
+// Findings flattens the results into one finding per misconfiguration, vulnerability, secret and license,
+// sorted with SortFindings. Vulnerabilities have no lines until LocatePackages finds them.
+func Findings(results []Result) []Finding {
+	var findings []Finding
+	for _, result := range results {
+		for _, misconf := range result.Misconfigurations {
+			findings = append(findings, Finding{
+				Target:       result.Target,
+				Class:        result.Class,
+				Type:         result.Type,
+				ID:           misconf.ID,
+				AVDID:        misconf.AVDID,
+				Title:        misconf.Title,
+				Description:  misconf.Description,
+				Message:      misconf.Message,
+				Resolution:   misconf.Resolution,
+				Severity:     misconf.Severity,
+				PrimaryURL:   misconf.PrimaryURL,
+				References:   misconf.References,
+				Resource:     misconf.CauseMetadata.Resource,
+				Provider:     misconf.CauseMetadata.Provider,
+				Service:      misconf.CauseMetadata.Service,
+				StartLine:    misconf.CauseMetadata.StartLine,
+				EndLine:      misconf.CauseMetadata.EndLine,
+				Code:         misconf.CauseMetadata.Code.Lines,
+				Occurrences:  misconf.CauseMetadata.Occurrences,
+				ManifestPath: misconf.CauseMetadata.ManifestPath,
+			})
+		}
+		for _, vuln := range result.Vulnerabilities {
+			f := Finding{
+				Target:           result.Target,
+				Class:            result.Class,
+				Type:             result.Type,
+				ID:               vuln.VulnerabilityID,
+				Title:            vuln.Title,
+				Description:      vuln.Description,
+				Message:          fmt.Sprintf("%s %s is vulnerable", vuln.PkgName, vuln.InstalledVersion),
+				Severity:         vuln.Severity,
+				PrimaryURL:       vuln.PrimaryURL,
+				References:       vuln.References,
+				Resource:         vuln.PkgName,
+				PkgName:          vuln.PkgName,
+				InstalledVersion: vuln.InstalledVersion,
+				FixedVersion:     vuln.FixedVersion,
+			}
+			if len(vuln.Layer) > 0 {
+				f.Layer = result.Image.layer(vuln.Layer)
+			}
+			if result.Image != nil {
+				f.Image = result.Image.Name
+			}
+			if f.Title == "" {
+				f.Title = f.ID
+			}
+			if vuln.FixedVersion != "" {
+				f.Resolution = fmt.Sprintf("Upgrade %s to %s", vuln.PkgName, vuln.FixedVersion)
+			}
+			findings = append(findings, f)
+		}
+		for _, secret := range result.Secrets {
+			findings = append(findings, Finding{
+				Target:         result.Target,
+				Class:          result.Class,
+				Type:           "secret",
+				ID:             secret.RuleID,
+				Title:          secret.Title,
+				Description:    fmt.Sprintf("%s committed to the repository", secret.Title),
+				Message:        fmt.Sprintf("%s secret found", secret.Category),
+				Resolution:     "Remove the secret from the file and rotate it",
+				Severity:       secret.Severity,
+				StartLine:      secret.StartLine,
+				EndLine:        secret.EndLine,
+				Code:           secret.Code.Lines,
+				SecretCategory: secret.Category,
+			})
+		}
+		for _, license := range result.Licenses {
+			f := Finding{
+				Target:     result.Target,
+				Class:      result.Class,
+				Type:       "license",
+				ID:         license.Name,
+				Title:      fmt.Sprintf("%s license", license.Name),
+				Message:    fmt.Sprintf("%s is licensed under %s", license.PkgName, license.Name),
+				Severity:   license.Severity,
+				PrimaryURL: license.Link,
+				Resource:   license.PkgName,
+				License:    license.Name,
+			}
+			if license.Link != "" {
+				f.References = []string{license.Link}
+			}
+			if license.FilePath != "" {
+				// a license file rather than a package
+				f.Target, f.Resource = license.FilePath, license.FilePath
+				f.Message = fmt.Sprintf("%s is licensed under %s", license.FilePath, license.Name)
+			}
+			f.Description = fmt.Sprintf("%s, which trivy classifies as %s", f.Message, license.Category)
+			findings = append(findings, f)
+		}
+	}
+	SortFindings(findings)
+	return findings
+}
+
+// SortFindings orders the findings by file, then line, then the most severe first, so the
+// same report always produces the same output whatever order trivy listed it in
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		if a.EndLine != b.EndLine {
+			return a.EndLine < b.EndLine
+		}
+		if ra, rb := SeverityRank(a.Severity), SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		return a.ID < b.ID
+	})
+}
+
+// FilterBySeverity keeps the findings at or above the minimum severity
+func FilterBySeverity(findings []Finding, minSeverity string) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if SeverityRank(f.Severity) >= SeverityRank(minSeverity) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// Filter keeps the findings matching the predicate
+func Filter(findings []Finding, keep func(Finding) bool) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if keep(f) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// LineHashes hashes the content of the lines of each finding on a file of the repo, with the
+// whitespace of each line collapsed and blank lines left out. The hash stays the same when
+// lines are added above the finding or reindented, so it identifies the finding across commits
+// where its line numbers don't. Findings without lines, or on a file that can't be read, are
+// left without one.
+func LineHashes(findings []Finding, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	hashed := append([]Finding(nil), findings...)
+	for i, f := range hashed {
+		if f.StartLine <= 0 {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		end := f.EndLine
+		if end < f.StartLine {
+			end = f.StartLine
+		}
+		if f.StartLine > len(lines) {
+			continue
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		var normalised []string
+		for _, line := range lines[f.StartLine-1 : end] {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				normalised = append(normalised, strings.Join(fields, " "))
+			}
+		}
+		sum := sha256.Sum256([]byte(strings.Join(normalised, "\n")))
+		hashed[i].LineHash = hex.EncodeToString(sum[:])
+	}
+	return hashed
+}
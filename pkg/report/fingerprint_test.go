@@ -0,0 +1,46 @@
+package report
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLineHashes(t *testing.T) {
+	files := map[string]string{
+		"before.tf": "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"public-read\"\n}\n",
+		"after.tf":  "# a bucket\n\nresource \"aws_s3_bucket\" \"b\" {\n\n    acl   =   \"public-read\"\n}\n",
+		"other.tf":  "resource \"aws_s3_bucket\" \"b\" {\n  acl = \"private\"\n}\n",
+	}
+	read := func(target string) ([]byte, error) {
+		if content, ok := files[target]; ok {
+			return []byte(content), nil
+		}
+		return nil, errors.New("not found")
+	}
+	findings := []Finding{
+		{Target: "before.tf", StartLine: 1, EndLine: 3},
+		// added lines above and reindented
+		{Target: "after.tf", StartLine: 3, EndLine: 6},
+		{Target: "other.tf", StartLine: 1, EndLine: 3},
+		{Target: "missing.tf", StartLine: 1, EndLine: 3},
+		{Target: "before.tf", StartLine: 9, EndLine: 9},
+		{Target: "alpine:3.18", PkgName: "openssl"},
+	}
+
+	hashed := LineHashes(findings, read)
+
+	if hashed[0].LineHash == "" || hashed[0].LineHash != hashed[1].LineHash {
+		t.Errorf("got the hashes %q and %q for the same lines moved", hashed[0].LineHash, hashed[1].LineHash)
+	}
+	if hashed[0].LineHash == hashed[2].LineHash {
+		t.Error("got the same hash for different lines")
+	}
+	for _, f := range hashed[3:] {
+		if f.LineHash != "" {
+			t.Errorf("hashed %s line %d, which can't be read", f.Target, f.StartLine)
+		}
+	}
+	if findings[0].LineHash != "" {
+		t.Error("modified the findings passed in")
+	}
+}
@@ -0,0 +1,198 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The reasons a file is skipped as generated or vendored
+const (
+	GeneratedVendored   = "vendored"
+	GeneratedAttributes = "gitattributes"
+	GeneratedHeader     = "generated header"
+)
+
+// vendoredDirs hold code checked in from elsewhere, fixed upstream rather than in the PR
+var vendoredDirs = []string{"vendor", "node_modules"}
+
+// generatedMarker is a comment at the top of a file saying a tool wrote it, e.g. Go's
+// "// Code generated by protoc-gen-go. DO NOT EDIT." or "# @generated by pdm"
+var generatedMarker = regexp.MustCompile(`(?i)\bdo not edit\b|@generated\b|\bauto-?generated\b`)
+
+// headerLines is how far into a file the generated marker is looked for
+const headerLines = 10
+
+// SkipGenerated suppresses the findings on generated and vendored files, which a PR can't
+// fix: files in a vendor/ or node_modules/ directory, those .gitattributes marks as
+// linguist-generated or linguist-vendored, and those whose header says they are generated.
+// A .gitattributes setting the attributes to false, e.g. vendor/** -linguist-vendored, keeps
+// the findings. Generated is set to the reason. anchor maps a target onto its path in the repo
+// and read reads a file of the repo.
+func SkipGenerated(findings []Finding, anchor func(target string) string, read func(name string) ([]byte, error)) []Finding {
+	attributes := gitAttributes{read: read, files: make(map[string][]gitAttribute)}
+	reasons := make(map[string]string)
+	skipped := make([]Finding, len(findings))
+	copy(skipped, findings)
+	for i, f := range skipped {
+		name := cleanPath(anchor(f.Target))
+		reason, ok := reasons[name]
+		if !ok {
+			reason = generatedReason(name, attributes, read)
+			reasons[name] = reason
+		}
+		if reason != "" {
+			skipped[i].Generated = reason
+			skipped[i].Suppressed = true
+		}
+	}
+	SortFindings(skipped)
+	return skipped
+}
+
+func generatedReason(name string, attributes gitAttributes, read func(name string) ([]byte, error)) string {
+	generated, set := attributes.generated(name)
+	if set {
+		if generated {
+			return GeneratedAttributes
+		}
+		return ""
+	}
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		for _, vendored := range vendoredDirs {
+			if dir == vendored {
+				return GeneratedVendored
+			}
+		}
+	}
+	if content, err := read(name); err == nil && hasGeneratedHeader(content) {
+		return GeneratedHeader
+	}
+	return ""
+}
+
+// hasGeneratedHeader reports whether a comment among the first lines of the file marks it as generated
+func hasGeneratedHeader(content []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; i < headerLines && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		for _, comment := range []string{"//", "#", "/*", "*", "<!--", "--", ";"} {
+			if strings.HasPrefix(line, comment) && generatedMarker.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean(strings.TrimPrefix(name, "./")), "/")
+}
+
+type gitAttribute struct {
+	pattern string
+	value   bool
+}
+
+// gitAttributes reads the linguist-generated and linguist-vendored settings of the
+// .gitattributes files of the repo, each cached after its first read
+type gitAttributes struct {
+	read  func(name string) ([]byte, error)
+	files map[string][]gitAttribute
+}
+
+// generated reports whether the .gitattributes files mark the file as generated or vendored,
+// and whether they set the attributes at all. The deepest file and its last matching line win.
+func (a gitAttributes) generated(name string) (bool, bool) {
+	var dirs []string
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, ".")
+	for _, dir := range dirs {
+		rel := name
+		if dir != "." {
+			rel = strings.TrimPrefix(name, dir+"/")
+		}
+		attrs := a.load(dir)
+		for i := len(attrs) - 1; i >= 0; i-- {
+			if matchAttributePattern(attrs[i].pattern, rel) {
+				return attrs[i].value, true
+			}
+		}
+	}
+	return false, false
+}
+
+func (a gitAttributes) load(dir string) []gitAttribute {
+	if attrs, ok := a.files[dir]; ok {
+		return attrs
+	}
+	var attrs []gitAttribute
+	if content, err := a.read(path.Join(dir, ".gitattributes")); err == nil {
+		attrs = parseGitAttributes(content)
+	}
+	a.files[dir] = attrs
+	return attrs
+}
+
+func parseGitAttributes(content []byte) []gitAttribute {
+	var attrs []gitAttribute
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			value := true
+			switch {
+			case strings.HasPrefix(field, "-"), strings.HasPrefix(field, "!"):
+				field, value = field[1:], false
+			case strings.HasSuffix(field, "=false"):
+				field, value = strings.TrimSuffix(field, "=false"), false
+			case strings.HasSuffix(field, "=true"):
+				field = strings.TrimSuffix(field, "=true")
+			}
+			if field == "linguist-generated" || field == "linguist-vendored" {
+				attrs = append(attrs, gitAttribute{pattern: fields[0], value: value})
+			}
+		}
+	}
+	return attrs
+}
+
+// matchAttributePattern matches a path relative to the .gitattributes file against one of its
+// patterns: without a slash the pattern matches the file name at any depth, with one it is
+// relative to the file, and ** matches any number of directories. Unlike .gitignore, a pattern
+// matching a directory doesn't cover the files in it.
+func matchAttributePattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
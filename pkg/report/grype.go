@@ -0,0 +1,145 @@
+package report
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type grypeDocument struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string   `json:"id"`
+			DataSource  string   `json:"dataSource"`
+			Severity    string   `json:"severity"`
+			URLs        []string `json:"urls"`
+			Description string   `json:"description"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+				State    string   `json:"state"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Type      string `json:"type"`
+			PURL      string `json:"purl"`
+			Locations []struct {
+				Path    string `json:"path"`
+				LayerID string `json:"layerID"`
+			} `json:"locations"`
+		} `json:"artifact"`
+	} `json:"matches"`
+	Source struct {
+		Type   string          `json:"type"`
+		Target json.RawMessage `json:"target"`
+	} `json:"source"`
+	Distro struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"distro"`
+}
+
+// grypeOSPackages are the artifact types of OS packages
+var grypeOSPackages = map[string]bool{"apk": true, "deb": true, "rpm": true, "alpm": true, "portage": true}
+
+// grypeSeverities map grype's severities onto trivy's
+var grypeSeverities = map[string]string{"negligible": "LOW"}
+
+// isGrype reports whether the top level fields of a report are those of grype's JSON output
+func isGrype(fields map[string]json.RawMessage) bool {
+	var descriptor struct {
+		Name string `json:"name"`
+	}
+	_, matches := fields["matches"]
+	return matches && json.Unmarshal(fields["descriptor"], &descriptor) == nil && descriptor.Name == "grype"
+}
+
+// parseGrype maps the matches of a grype -o json report onto the results of a Trivy report. A
+// package found in a file of the scanned directory, e.g. a lockfile, is a result of that file
+// so its vulnerabilities are commented on its entry like trivy's. The OS packages of an image
+// are a result of the image and its distro, and have no lines.
+func parseGrype(data []byte) ([]Result, error) {
+	var doc grypeDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	byTarget := make(map[string]*Result)
+	for _, m := range doc.Matches {
+		a, v := m.Artifact, m.Vulnerability
+		class, target := "lang-pkgs", ""
+		if len(a.Locations) > 0 {
+			target = a.Locations[0].Path
+		}
+		if doc.Source.Type == "directory" || doc.Source.Type == "file" {
+			target = strings.TrimPrefix(target, "/")
+		}
+		if grypeOSPackages[a.Type] {
+			class, target = "os-pkgs", grypeSourceTarget(doc)
+		}
+		if target == "" {
+			target = grypeSourceTarget(doc)
+		}
+		r, ok := byTarget[target]
+		if !ok {
+			r = &Result{Target: target, Class: class, Type: a.Type}
+			if class == "os-pkgs" && doc.Distro.Name != "" {
+				r.Type = doc.Distro.Name
+			}
+			byTarget[target] = r
+		}
+		severity, err := ParseSeverity(v.Severity)
+		if err != nil {
+			if severity = grypeSeverities[strings.ToLower(v.Severity)]; severity == "" {
+				severity = "UNKNOWN"
+			}
+		}
+		var fixed string
+		if v.Fix.State == "fixed" {
+			fixed = strings.Join(v.Fix.Versions, ", ")
+		}
+		primary := v.DataSource
+		if primary == "" && len(v.URLs) > 0 {
+			primary = v.URLs[0]
+		}
+		r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+			VulnerabilityID:  v.ID,
+			PkgID:            a.ID,
+			PkgName:          a.Name,
+			InstalledVersion: a.Version,
+			FixedVersion:     fixed,
+			Status:           v.Fix.State,
+			Description:      v.Description,
+			Severity:         severity,
+			PrimaryURL:       primary,
+			References:       v.URLs,
+		})
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+// grypeSourceTarget names the OS packages of an image the way trivy does, e.g. alpine:3.18
+// (alpine 3.18.4), and the packages grype found nowhere in particular
+func grypeSourceTarget(doc grypeDocument) string {
+	var target struct {
+		UserInput string `json:"userInput"`
+	}
+	_ = json.Unmarshal(doc.Source.Target, &target)
+	distro := strings.TrimSpace(doc.Distro.Name + " " + doc.Distro.Version)
+	switch {
+	case target.UserInput != "" && distro != "":
+		return target.UserInput + " (" + distro + ")"
+	case distro != "":
+		return distro
+	case target.UserInput != "":
+		return target.UserInput
+	}
+	return "grype"
+}
@@ -0,0 +1,35 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Uncompressed returns a reader of the content of r, decompressing it when it is gzip
+// compressed, e.g. a .json.gz report handed between jobs, whatever the file is named
+func Uncompressed(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		// too short to be gzip, the decoder reports what it is
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// uncompressedBytes is Uncompressed for a report read whole
+func uncompressedBytes(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
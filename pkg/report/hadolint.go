@@ -0,0 +1,77 @@
+package report
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type hadolintResult struct {
+	Code    string `json:"code"`
+	File    string `json:"file"`
+	Level   string `json:"level"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// isHadolint reports whether the fields of an entry of a report are those of a result of
+// hadolint -f json, which writes a bare array of them
+func isHadolint(fields map[string]json.RawMessage) bool {
+	_, code := fields["code"]
+	_, level := fields["level"]
+	_, line := fields["line"]
+	return code && level && line
+}
+
+// parseHadolint maps the results of a hadolint -f json report onto the misconfigurations of a
+// Trivy report, one result per Dockerfile, commented on the line of the instruction. The rules
+// link to the hadolint wiki, or ShellCheck's for the SC codes of RUN instructions.
+func parseHadolint(data []byte) ([]Result, error) {
+	var report []hadolintResult
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	byTarget := make(map[string]*Result)
+	for _, result := range report {
+		r, ok := byTarget[result.File]
+		if !ok {
+			r = &Result{Target: result.File, Class: "config", Type: "dockerfile"}
+			byTarget[result.File] = r
+		}
+		var references []string
+		link := hadolintLink(result.Code)
+		if link != "" {
+			references = []string{link}
+		}
+		r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+			Type:          "dockerfile",
+			ID:            result.Code,
+			AVDID:         result.Code,
+			Title:         result.Message,
+			Description:   result.Message,
+			Message:       result.Message,
+			Severity:      scannerSeverity(result.Level),
+			PrimaryURL:    link,
+			References:    references,
+			Status:        "FAIL",
+			CauseMetadata: CauseMetadata{StartLine: result.Line, EndLine: result.Line},
+		})
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+func hadolintLink(code string) string {
+	switch {
+	case strings.HasPrefix(code, "DL"):
+		return "https://github.com/hadolint/hadolint/wiki/" + code
+	case strings.HasPrefix(code, "SC"):
+		return "https://www.shellcheck.net/wiki/" + code
+	}
+	return ""
+}
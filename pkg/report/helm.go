@@ -0,0 +1,210 @@
+package report
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// HelmSource is the part of rendered Helm output produced by one template, as marked by the
+// "# Source:" comment helm template writes above it
+type HelmSource struct {
+	// Template is the path helm gives the template, starting with the chart name, e.g.
+	// app/templates/deployment.yaml
+	Template  string
+	StartLine int
+	EndLine   int
+}
+
+// HelmSources splits rendered Helm output into the parts of its templates
+func HelmSources(rendered []string) []HelmSource {
+	var sources []HelmSource
+	for i, line := range rendered {
+		template, ok := strings.CutPrefix(strings.TrimSpace(line), "# Source: ")
+		if !ok {
+			continue
+		}
+		if n := len(sources); n > 0 {
+			sources[n-1].EndLine = i
+		}
+		sources = append(sources, HelmSource{Template: strings.TrimSpace(template), StartLine: i + 1})
+	}
+	if n := len(sources); n > 0 {
+		sources[n-1].EndLine = len(rendered)
+	}
+	return sources
+}
+
+// LocateHelmTemplates moves the findings on rendered Helm output onto the chart template the
+// output came from, so they are commented on a file of the PR. Two kinds of target are mapped:
+//   - a file of helm template output, keyed in charts by its path with the directory of the
+//     chart it was rendered from as the value
+//   - a template Trivy rendered itself when scanning a chart, whose lines are those of the
+//     rendering rather than the template
+//
+// The line is found by matching the rendered cause, or the mapping it is nested in, to a
+// template line. The values the line is set from become the ValuesKeys of the finding.
+func LocateHelmTemplates(findings []Finding, charts map[string]string, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	readLines := func(target string) []string {
+		lines, ok := contents[target]
+		if !ok {
+			if data, err := read(target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[target] = lines
+		}
+		return lines
+	}
+
+	located := make([]Finding, len(findings))
+	for i, f := range findings {
+		located[i] = f
+		if f.StartLine < 1 {
+			continue
+		}
+		var template string
+		var cause []Line
+		if chart, ok := charts[f.Target]; ok {
+			rendered := readLines(f.Target)
+			for _, source := range HelmSources(rendered) {
+				if f.StartLine >= source.StartLine && f.StartLine <= source.EndLine {
+					// the chart name helm puts first is the chart directory
+					_, rest, _ := strings.Cut(source.Template, "/")
+					template = path.Join(chart, rest)
+					cause = renderedCause(rendered, source.StartLine, f.StartLine, f.EndLine)
+					break
+				}
+			}
+		} else if isHelmTemplate(f.Target, readLines) {
+			template = f.Target
+			cause = codeCause(f.Code)
+		}
+		if template == "" || len(cause) == 0 {
+			continue
+		}
+		lines := readLines(template)
+		if len(lines) == 0 {
+			continue
+		}
+		line, keys := matchTemplateLine(lines, cause)
+		located[i].Target = template
+		located[i].StartLine, located[i].EndLine = line, line
+		located[i].Code = nil
+		if len(keys) > 0 {
+			located[i].ValuesFile = path.Join(path.Dir(path.Dir(template)), "values.yaml")
+			located[i].ValuesKeys = keys
+		}
+	}
+	SortFindings(located)
+	return located
+}
+
+// isHelmTemplate reports whether the target is in the templates directory of a chart
+func isHelmTemplate(target string, readLines func(string) []string) bool {
+	dir := path.Dir(target)
+	for dir != "." && dir != "/" && path.Base(dir) != "templates" {
+		dir = path.Dir(dir)
+	}
+	if path.Base(dir) != "templates" {
+		return false
+	}
+	return len(readLines(path.Join(path.Dir(dir), "Chart.yaml"))) > 0
+}
+
+// renderedCause returns the cause lines followed by the mappings they are nested in, nearest
+// first, within the part of the output starting at from
+func renderedCause(rendered []string, from, start, end int) []Line {
+	var cause []Line
+	for n := start; n <= end && n <= len(rendered); n++ {
+		cause = append(cause, Line{Number: n, Content: rendered[n-1], IsCause: true})
+	}
+	if len(cause) == 0 {
+		return nil
+	}
+	indent, _ := yamlIndent(rendered[start-1])
+	for n := start - 1; n >= from && indent > 0; n-- {
+		line := rendered[n-1]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if i, _ := yamlIndent(line); i < indent {
+			cause = append(cause, Line{Number: n, Content: line})
+			indent = i
+		}
+	}
+	return cause
+}
+
+// codeCause orders the code of a finding like renderedCause, the cause lines followed by the
+// lines before them nearest first
+func codeCause(code []Line) []Line {
+	var cause, before []Line
+	for _, line := range code {
+		switch {
+		case line.IsCause:
+			cause = append(cause, line)
+		case len(cause) == 0:
+			before = append([]Line{line}, before...)
+		}
+	}
+	return append(cause, before...)
+}
+
+var valuesReference = regexp.MustCompile(`\.Values\.([A-Za-z0-9_.]+)`)
+
+// matchTemplateLine finds the template line the first rendered line that can be matched came
+// from, an identical line first and a line with the same key second, along with the values
+// set on it or its nested lines. The first line is returned when nothing matches.
+func matchTemplateLine(template []string, rendered []Line) (int, []string) {
+	for _, r := range rendered {
+		content := strings.TrimSpace(yamlContent(r.Content))
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		key, _, hasKey := strings.Cut(content, ":")
+		match := -1
+		for i, line := range template {
+			t := strings.TrimSpace(yamlContent(line))
+			if t == content {
+				match = i
+				break
+			}
+			if match < 0 && hasKey {
+				if k, _, ok := strings.Cut(t, ":"); ok && k == key && !strings.Contains(k, "{{") {
+					match = i
+				}
+			}
+		}
+		if match >= 0 {
+			return match + 1, valuesKeys(template, match)
+		}
+	}
+	return 1, nil
+}
+
+// valuesKeys returns the values referenced on the line or in the lines nested in it
+func valuesKeys(template []string, at int) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(line string) {
+		for _, m := range valuesReference.FindAllStringSubmatch(line, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				keys = append(keys, m[1])
+			}
+		}
+	}
+	add(template[at])
+	indent, _ := yamlIndent(template[at])
+	for _, line := range template[at+1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if i, _ := yamlIndent(line); i <= indent {
+			break
+		}
+		add(line)
+	}
+	return keys
+}
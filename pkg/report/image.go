@@ -0,0 +1,109 @@
+package report
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Image is the container image a report was scanned from, as described by its metadata
+type Image struct {
+	// Name is the image as given to trivy, e.g. alpine:3.19
+	Name string
+	ID   string
+	// Layers are the layers of the image in build order
+	Layers []ImageLayer
+}
+
+// ImageLayer is a layer of an image and the Dockerfile instruction that created it
+type ImageLayer struct {
+	// Index is the position of the layer in the image from 1, 0 when the image's layers are
+	// unknown
+	Index     int
+	DiffID    string
+	Digest    string
+	CreatedBy string
+}
+
+// Instruction is the instruction that created the layer without the shell docker wraps it in,
+// e.g. RUN apk add curl
+func (l ImageLayer) Instruction() string {
+	instruction := strings.TrimSpace(l.CreatedBy)
+	if rest, ok := strings.CutPrefix(instruction, "/bin/sh -c #(nop) "); ok {
+		return strings.TrimSpace(rest)
+	}
+	if rest, ok := strings.CutPrefix(instruction, "/bin/sh -c "); ok {
+		return "RUN " + strings.TrimSpace(rest)
+	}
+	// buildkit records the instruction itself, with the shell of a RUN
+	instruction = strings.TrimSuffix(instruction, " # buildkit")
+	if rest, ok := strings.CutPrefix(instruction, "RUN /bin/sh -c "); ok {
+		return "RUN " + strings.TrimSpace(rest)
+	}
+	return instruction
+}
+
+type imageMetadata struct {
+	ImageID     string `json:"ImageID"`
+	DiffIDs     []string
+	ImageConfig struct {
+		History []struct {
+			CreatedBy  string `json:"created_by"`
+			EmptyLayer bool   `json:"empty_layer"`
+		} `json:"history"`
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	} `json:"ImageConfig"`
+}
+
+// reportImage reads the image of a container image scan from the report's metadata, nil for
+// other scans
+func reportImage(extra map[string]json.RawMessage) *Image {
+	var artifactType string
+	if err := json.Unmarshal(extra["ArtifactType"], &artifactType); err != nil || artifactType != "container_image" {
+		return nil
+	}
+	image := &Image{}
+	_ = json.Unmarshal(extra["ArtifactName"], &image.Name)
+	var metadata imageMetadata
+	if err := json.Unmarshal(extra["Metadata"], &metadata); err != nil {
+		return image
+	}
+	image.ID = metadata.ImageID
+	diffIDs := metadata.ImageConfig.RootFS.DiffIDs
+	if len(diffIDs) == 0 {
+		diffIDs = metadata.DiffIDs
+	}
+	// the history has an entry per instruction, only those that aren't empty made a layer
+	var createdBy []string
+	for _, h := range metadata.ImageConfig.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+	}
+	for i, diffID := range diffIDs {
+		layer := ImageLayer{Index: i + 1, DiffID: diffID}
+		if len(createdBy) == len(diffIDs) {
+			layer.CreatedBy = createdBy[i]
+		}
+		image.Layers = append(image.Layers, layer)
+	}
+	return image
+}
+
+// layer returns the layer of the image that trivy's layer of a package or secret refers to
+func (i *Image) layer(refs map[string]string) ImageLayer {
+	found := ImageLayer{DiffID: refs["DiffID"], Digest: refs["Digest"], CreatedBy: refs["CreatedBy"]}
+	if i == nil {
+		return found
+	}
+	for _, l := range i.Layers {
+		if l.DiffID != "" && l.DiffID == found.DiffID {
+			found.Index = l.Index
+			if found.CreatedBy == "" {
+				found.CreatedBy = l.CreatedBy
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+type kubeBenchControls struct {
+	ID       string `json:"id"`
+	Version  string `json:"version"`
+	Text     string `json:"text"`
+	NodeType string `json:"node_type"`
+	Tests    []struct {
+		Section string `json:"section"`
+		Desc    string `json:"desc"`
+		Results []struct {
+			TestNumber     string `json:"test_number"`
+			TestDesc       string `json:"test_desc"`
+			Remediation    string `json:"remediation"`
+			Status         string `json:"status"`
+			Scored         bool   `json:"scored"`
+			ExpectedResult string `json:"expected_result"`
+			ActualValue    string `json:"actual_value"`
+		} `json:"results"`
+	} `json:"tests"`
+}
+
+// isKubeBench reports whether the top level fields of a report are those of kube-bench --json,
+// or those of an entry of the bare array of controls older releases write
+func isKubeBench(fields map[string]json.RawMessage) bool {
+	_, controls := fields["Controls"]
+	_, totals := fields["Totals"]
+	_, nodeType := fields["node_type"]
+	_, tests := fields["tests"]
+	return controls && totals || nodeType && tests
+}
+
+// parseKubeBench maps the failed and warning checks of a kube-bench --json report onto the
+// misconfigurations of a Trivy report, one result per node type and benchmark. The checks are
+// of a node's configuration rather than a file, so they have no lines and are listed in the
+// summary. kube-bench doesn't rate checks: a failed scored check is HIGH, a failed unscored
+// one MEDIUM and a check to be made manually, WARN, LOW.
+func parseKubeBench(data []byte) ([]Result, error) {
+	var controls []kubeBenchControls
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &controls); err != nil {
+			return nil, err
+		}
+	} else {
+		var report struct {
+			Controls []kubeBenchControls `json:"Controls"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		controls = report.Controls
+	}
+
+	byTarget := make(map[string]*Result)
+	for _, c := range controls {
+		target := fmt.Sprintf("kube-bench %s (%s)", c.NodeType, c.Version)
+		for _, test := range c.Tests {
+			for _, result := range test.Results {
+				var severity string
+				switch {
+				case result.Status == "FAIL" && result.Scored:
+					severity = "HIGH"
+				case result.Status == "FAIL":
+					severity = "MEDIUM"
+				case result.Status == "WARN":
+					severity = "LOW"
+				default:
+					continue
+				}
+				r, ok := byTarget[target]
+				if !ok {
+					r = &Result{Target: target, Class: "config", Type: "kubernetes"}
+					byTarget[target] = r
+				}
+				message := result.TestDesc
+				if result.ActualValue != "" && result.ExpectedResult != "" {
+					message = fmt.Sprintf("%s: expected %s, found %s", result.TestDesc, result.ExpectedResult, result.ActualValue)
+				}
+				r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+					Type:          "kubernetes",
+					ID:            result.TestNumber,
+					AVDID:         result.TestNumber,
+					Title:         result.TestDesc,
+					Description:   message,
+					Message:       message,
+					Resolution:    result.Remediation,
+					Severity:      severity,
+					Status:        "FAIL",
+					CauseMetadata: CauseMetadata{Resource: fmt.Sprintf("%s %s", test.Section, test.Desc)},
+				})
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
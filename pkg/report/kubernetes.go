@@ -0,0 +1,180 @@
+package report
+
+import (
+	"strings"
+)
+
+// kubernetesFix sets a field of the container or pod spec a check points at
+type kubernetesFix struct {
+	path  []string
+	value string
+}
+
+// kubernetesFixes are the fixes of the common Kubernetes checks, keyed by their ID. The
+// resource values are a starting point for the author to adjust.
+var kubernetesFixes = map[string]kubernetesFix{
+	"KSV001": {path: []string{"securityContext", "allowPrivilegeEscalation"}, value: "false"},
+	"KSV011": {path: []string{"resources", "limits", "cpu"}, value: "500m"},
+	"KSV012": {path: []string{"securityContext", "runAsNonRoot"}, value: "true"},
+	"KSV014": {path: []string{"securityContext", "readOnlyRootFilesystem"}, value: "true"},
+	"KSV015": {path: []string{"resources", "requests", "cpu"}, value: "100m"},
+	"KSV016": {path: []string{"resources", "requests", "memory"}, value: "128Mi"},
+	"KSV017": {path: []string{"securityContext", "privileged"}, value: "false"},
+	"KSV018": {path: []string{"resources", "limits", "memory"}, value: "512Mi"},
+}
+
+// SuggestKubernetesFixes sets the suggestion of the findings of the common Kubernetes checks
+// to their lines with the fix applied. The cause lines of a finding are the container or spec
+// it points at, the fix is put into that block at the indentation of its fields.
+func SuggestKubernetesFixes(findings []Finding, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	suggested := make([]Finding, len(findings))
+	for i, f := range findings {
+		suggested[i] = f
+		fix, ok := kubernetesFixes[f.ID]
+		if !ok || f.Suggestion != "" || f.StartLine < 1 || f.EndLine < f.StartLine {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		if f.EndLine > len(lines) || strings.Contains(strings.Join(lines[f.StartLine-1:f.EndLine], "\n"), "{{") {
+			// a Helm template is fixed in its values rather than its lines
+			continue
+		}
+		if fixed, ok := fixKubernetesBlock(lines[f.StartLine-1:f.EndLine], fix); ok {
+			suggested[i].Suggestion = strings.Join(fixed, "\n")
+		}
+	}
+	return suggested
+}
+
+// fixKubernetesBlock applies the fix to the mapping of the block, false when the block isn't a
+// single nested mapping such as one container
+func fixKubernetesBlock(block []string, fix kubernetesFix) ([]string, bool) {
+	first := -1
+	for i, line := range block {
+		if strings.TrimSpace(line) != "" {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil, false
+	}
+	indent, _ := yamlIndent(block[first])
+	if indent == 0 {
+		// a whole document rather than the container the check points at
+		return nil, false
+	}
+	for _, line := range block[first+1:] {
+		if i, item := yamlIndent(line); item && i == indent {
+			// several containers, there's no telling which one is meant
+			return nil, false
+		}
+	}
+	return setYAMLKey(append([]string(nil), block...), first, len(block), indent, fix.path, fix.value)
+}
+
+// setYAMLKey sets the key path to the value in the mapping of lines[from:to] whose keys are at
+// the indentation, adding the keys that are missing at the end of the mapping
+func setYAMLKey(lines []string, from, to, indent int, path []string, value string) ([]string, bool) {
+	for i := from; i < to; i++ {
+		lineIndent, _ := yamlIndent(lines[i])
+		if strings.TrimSpace(lines[i]) == "" || lineIndent != indent {
+			continue
+		}
+		key, rest, ok := strings.Cut(yamlContent(lines[i]), ":")
+		if !ok || strings.TrimSpace(key) != path[0] {
+			continue
+		}
+		rest = strings.TrimSpace(rest)
+		if len(path) == 1 {
+			prefix := lines[i][:len(lines[i])-len(yamlContent(lines[i]))]
+			lines[i] = prefix + path[0] + ": " + value
+			return lines, true
+		}
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			// an inline mapping such as {}, not rewritten line by line
+			return nil, false
+		}
+		end := i + 1
+		childIndent := -1
+		for end < to {
+			if strings.TrimSpace(lines[end]) != "" {
+				j, _ := yamlIndent(lines[end])
+				if j <= indent {
+					break
+				}
+				if childIndent < 0 {
+					childIndent = j
+				}
+			}
+			end++
+		}
+		if childIndent < 0 {
+			childIndent = indent + yamlIndentUnit(lines)
+		}
+		return setYAMLKey(lines, i+1, end, childIndent, path[1:], value)
+	}
+
+	// insert before the blank lines ending the mapping
+	at := to
+	for at > from && strings.TrimSpace(lines[at-1]) == "" {
+		at--
+	}
+	unit := yamlIndentUnit(lines)
+	added := make([]string, 0, len(path))
+	for depth, key := range path {
+		line := strings.Repeat(" ", indent+depth*unit) + key + ":"
+		if depth == len(path)-1 {
+			line += " " + value
+		}
+		added = append(added, line)
+	}
+	return append(lines[:at], append(added, lines[at:]...)...), true
+}
+
+// yamlIndent returns the indentation of the keys of the line, counting the dash of a list item
+// as indentation, and whether the line starts a list item
+func yamlIndent(line string) (int, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if strings.HasPrefix(trimmed, "- ") {
+		return indent + 2 + len(trimmed[2:]) - len(strings.TrimLeft(trimmed[2:], " ")), true
+	}
+	return indent, false
+}
+
+// yamlContent is the line without its indentation and list item dash
+func yamlContent(line string) string {
+	content := strings.TrimLeft(line, " ")
+	if strings.HasPrefix(content, "- ") {
+		content = strings.TrimLeft(content[2:], " ")
+	}
+	return content
+}
+
+// yamlIndentUnit is the indentation step of the lines, 2 when they don't nest
+func yamlIndentUnit(lines []string) int {
+	unit := 0
+	previous := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent, _ := yamlIndent(line)
+		if previous >= 0 && indent > previous && (unit == 0 || indent-previous < unit) {
+			unit = indent - previous
+		}
+		previous = indent
+	}
+	if unit == 0 {
+		return 2
+	}
+	return unit
+}
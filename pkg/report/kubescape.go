@@ -0,0 +1,382 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type kubescapeReport struct {
+	SummaryDetails struct {
+		Controls map[string]struct {
+			Name        string  `json:"name"`
+			Severity    string  `json:"severity"`
+			ScoreFactor float64 `json:"scoreFactor"`
+		} `json:"controls"`
+	} `json:"summaryDetails"`
+	Resources []struct {
+		ResourceID string `json:"resourceID"`
+		Object     struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"object"`
+		Source struct {
+			RelativePath string `json:"relativePath"`
+			Path         string `json:"path"`
+		} `json:"source"`
+	} `json:"resources"`
+	Results []struct {
+		ResourceID string `json:"resourceID"`
+		Controls   []struct {
+			ControlID string `json:"controlID"`
+			Name      string `json:"name"`
+			Status    struct {
+				Status string `json:"status"`
+			} `json:"status"`
+			Rules []kubescapeRule `json:"rules"`
+		} `json:"controls"`
+	} `json:"results"`
+}
+
+type kubescapeRule struct {
+	Status string `json:"status"`
+	Paths  []struct {
+		FailedPath string `json:"failedPath"`
+		DeletePath string `json:"deletePath"`
+		ReviewPath string `json:"reviewPath"`
+		FixPath    struct {
+			Path string `json:"path"`
+		} `json:"fixPath"`
+	} `json:"paths"`
+}
+
+// isKubescape reports whether the top level fields of a report are those of kubescape's JSON
+// output
+func isKubescape(fields map[string]json.RawMessage) bool {
+	_, summary := fields["summaryDetails"]
+	_, results := fields["results"]
+	return summary && results
+}
+
+// parseKubescape maps the failed controls of a kubescape scan --format json report onto the
+// misconfigurations of a Trivy report, one result per manifest. Each path a control failed on
+// is a finding of its own, with the path as its ManifestPath for LocateManifestPaths to find
+// the lines of. The severity is the control's, or else rated from its score factor the way
+// kubescape does.
+func parseKubescape(data []byte) ([]Result, error) {
+	var report kubescapeReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	type resource struct{ file, name string }
+	resources := make(map[string]resource, len(report.Resources))
+	for _, r := range report.Resources {
+		file := r.Source.RelativePath
+		if file == "" {
+			file = r.Source.Path
+		}
+		name := r.Object.Metadata.Name
+		if r.Object.Kind != "" {
+			name = r.Object.Kind + "/" + name
+		}
+		resources[r.ResourceID] = resource{file: file, name: name}
+	}
+
+	byTarget := make(map[string]*Result)
+	for _, result := range report.Results {
+		res, ok := resources[result.ResourceID]
+		if !ok || res.file == "" {
+			// a resource of a cluster rather than a file, e.g. from kubescape scan without a path
+			res.file = "kubescape"
+		}
+		if res.name == "" {
+			res.name = result.ResourceID
+		}
+		for _, control := range result.Controls {
+			if control.Status.Status != "failed" {
+				continue
+			}
+			r, ok := byTarget[res.file]
+			if !ok {
+				r = &Result{Target: res.file, Class: "config", Type: "kubernetes"}
+				byTarget[res.file] = r
+			}
+			summary := report.SummaryDetails.Controls[control.ControlID]
+			severity, err := ParseSeverity(summary.Severity)
+			if err != nil {
+				severity = kubescapeSeverity(summary.ScoreFactor)
+			}
+			link := "https://hub.armosec.io/docs/" + strings.ToLower(control.ControlID)
+			for _, path := range kubescapePaths(control.Rules) {
+				message := fmt.Sprintf("%s fails %s", res.name, control.Name)
+				if path != "" {
+					message += fmt.Sprintf(" at %s", path)
+				} else {
+					// a control failing the resource as a whole is commented on its kind
+					path = "kind"
+				}
+				r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+					Type:          "kubernetes",
+					ID:            control.ControlID,
+					AVDID:         control.ControlID,
+					Title:         control.Name,
+					Description:   message,
+					Message:       message,
+					Severity:      severity,
+					PrimaryURL:    link,
+					References:    []string{link},
+					Status:        "FAIL",
+					CauseMetadata: CauseMetadata{Resource: res.name, ManifestPath: path},
+				})
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+// kubescapePaths are the distinct paths the failed rules of a control point at, or a single
+// empty path for a control failing the resource as a whole
+func kubescapePaths(rules []kubescapeRule) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Status != "" && rule.Status != "failed" {
+			continue
+		}
+		for _, p := range rule.Paths {
+			path := p.FailedPath
+			for _, other := range []string{p.FixPath.Path, p.DeletePath, p.ReviewPath} {
+				if path == "" {
+					path = other
+				}
+			}
+			if path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return []string{""}
+	}
+	return paths
+}
+
+// kubescapeSeverity rates a control's score factor as kubescape does
+func kubescapeSeverity(score float64) string {
+	switch {
+	case score >= 9:
+		return "CRITICAL"
+	case score >= 7:
+		return "HIGH"
+	case score >= 4:
+		return "MEDIUM"
+	case score >= 1:
+		return "LOW"
+	}
+	return "UNKNOWN"
+}
+
+// manifestPathSegment is a key of a manifest path with the index of a list item, e.g.
+// containers[0]
+var manifestPathSegment = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// LocateManifestPaths finds the lines of the findings that point at a field of a Kubernetes
+// manifest rather than lines, as kubescape's do. The document of the finding's resource is
+// walked along the path, and the finding gets the lines of the deepest field of the path the
+// manifest has: a missing field, such as a securityContext that isn't set, is commented on the
+// container or spec it would be set in.
+func LocateManifestPaths(findings []Finding, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	located := make([]Finding, len(findings))
+	for i, f := range findings {
+		located[i] = f
+		if f.StartLine > 0 || f.ManifestPath == "" {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		from, to, ok := manifestDocument(lines, f.Resource)
+		if !ok {
+			continue
+		}
+		start, end := manifestPathLines(lines, from, to, f.ManifestPath)
+		located[i].StartLine, located[i].EndLine = start+1, end
+	}
+	return located
+}
+
+// manifestDocument returns the lines of the document of a manifest whose kind and name are
+// those of the resource, Kind/name, or the only document when the file has one
+func manifestDocument(lines []string, resource string) (int, int, bool) {
+	kind, name, _ := strings.Cut(resource, "/")
+	var documents [][2]int
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i == len(lines) || strings.HasPrefix(lines[i], "---") {
+			if strings.TrimSpace(strings.Join(lines[start:i], "")) != "" {
+				documents = append(documents, [2]int{start, i})
+			}
+			start = i + 1
+		}
+	}
+	for _, document := range documents {
+		var docKind, docName string
+		inMetadata := false
+		for _, line := range lines[document[0]:document[1]] {
+			indent, _ := yamlIndent(line)
+			key, value, _ := strings.Cut(yamlContent(line), ":")
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			switch {
+			case indent == 0 && key == "kind":
+				docKind = value
+			case indent == 0:
+				inMetadata = key == "metadata"
+			case inMetadata && key == "name" && docName == "":
+				docName = value
+			}
+		}
+		if docKind == kind && docName == name {
+			return document[0], document[1], true
+		}
+	}
+	if len(documents) == 1 {
+		return documents[0][0], documents[0][1], true
+	}
+	return 0, 0, false
+}
+
+// manifestPathLines walks the document in lines[from:to] along the path, returning the lines
+// of the deepest field found, the whole document when not even its first key is
+func manifestPathLines(lines []string, from, to int, path string) (int, int) {
+	start, end, indent := from, to, 0
+	for _, segment := range strings.Split(path, ".") {
+		match := manifestPathSegment.FindStringSubmatch(segment)
+		if match == nil {
+			break
+		}
+		i, ok := manifestKey(lines, start, end, indent, match[1])
+		if !ok {
+			break
+		}
+		keyEnd := yamlBlockEnd(lines, i, end)
+		childStart, childEnd := i, keyEnd
+		found := true
+		for _, index := range strings.Split(strings.Trim(match[2], "[]"), "][") {
+			if index == "" {
+				continue
+			}
+			n, _ := strconv.Atoi(index)
+			item, ok := manifestItem(lines, childStart+1, childEnd, n)
+			if !ok {
+				found = false
+				break
+			}
+			childStart, childEnd = item, yamlBlockEnd(lines, item, childEnd)
+		}
+		start, end = childStart, childEnd
+		if !found {
+			break
+		}
+		// the keys nested in the field, or in the list item, are indented further
+		indent = -1
+		if first := manifestFirstKey(lines, start, end); first >= 0 {
+			indent, _ = yamlIndent(lines[first])
+		}
+		if indent < 0 {
+			break
+		}
+	}
+	for end > start+1 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return start, end
+}
+
+// manifestKey finds the line of the key at the indentation within lines[from:to]
+func manifestKey(lines []string, from, to, indent int, key string) (int, bool) {
+	for i := from; i < to; i++ {
+		lineIndent, _ := yamlIndent(lines[i])
+		if strings.TrimSpace(lines[i]) == "" || lineIndent != indent {
+			continue
+		}
+		if k, _, ok := strings.Cut(yamlContent(lines[i]), ":"); ok && strings.TrimSpace(k) == key {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// manifestItem finds the line of the nth list item within lines[from:to]
+func manifestItem(lines []string, from, to, n int) (int, bool) {
+	itemIndent := -1
+	for i := from; i < to; i++ {
+		indent, item := yamlIndent(lines[i])
+		if !item || itemIndent >= 0 && indent != itemIndent {
+			continue
+		}
+		itemIndent = indent
+		if n == 0 {
+			return i, true
+		}
+		n--
+	}
+	return 0, false
+}
+
+// manifestFirstKey is the first line of a key nested in the field at lines[start], or a list
+// item's own first key on the line of its dash
+func manifestFirstKey(lines []string, start, end int) int {
+	if _, item := yamlIndent(lines[start]); item {
+		return start
+	}
+	for i := start + 1; i < end; i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlBlockEnd is the end of the field or list item at lines[at], the first line after it that
+// isn't nested in it
+func yamlBlockEnd(lines []string, at, to int) int {
+	indent, item := yamlIndent(lines[at])
+	if item {
+		// the keys of an item are at the indentation past its dash, the item ends at its dash's
+		indent -= 2
+	}
+	for i := at + 1; i < to; i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		lineIndent, lineItem := yamlIndent(lines[i])
+		if lineItem {
+			lineIndent -= 2
+		}
+		if lineIndent <= indent {
+			if lineItem && !item && lineIndent == indent {
+				// a list nested at the key's own indentation, as in containers:\n- name: app
+				continue
+			}
+			return i
+		}
+	}
+	return to
+}
@@ -0,0 +1,137 @@
+package report
+
+import (
+	"errors"
+	"testing"
+)
+
+const kubescapeReportJSON = `{
+  "summaryDetails": {"controls": {
+    "C-0057": {"name": "Privileged container", "severity": "High"},
+    "C-0017": {"name": "Immutable container filesystem", "scoreFactor": 5},
+    "C-0035": {"name": "Administrative Roles", "scoreFactor": 9}
+  }},
+  "resources": [
+    {"resourceID": "apps/v1/default/Deployment/web", "object": {"kind": "Deployment", "metadata": {"name": "web"}},
+     "source": {"relativePath": "deploy/web.yaml"}},
+    {"resourceID": "rbac/v1//ClusterRole/admin", "object": {"kind": "ClusterRole", "metadata": {"name": "admin"}}}
+  ],
+  "results": [
+    {"resourceID": "apps/v1/default/Deployment/web", "controls": [
+      {"controlID": "C-0057", "name": "Privileged container", "status": {"status": "failed"}, "rules": [
+        {"status": "failed", "paths": [
+          {"failedPath": "spec.template.spec.containers[0].securityContext.privileged"},
+          {"failedPath": "spec.template.spec.containers[0].securityContext.privileged"}
+        ]}
+      ]},
+      {"controlID": "C-0017", "name": "Immutable container filesystem", "status": {"status": "failed"}, "rules": [
+        {"status": "failed", "paths": [{"fixPath": {"path": "spec.template.spec.containers[1].securityContext.readOnlyRootFilesystem"}}]}
+      ]},
+      {"controlID": "C-0016", "name": "Allow privilege escalation", "status": {"status": "passed"}}
+    ]},
+    {"resourceID": "rbac/v1//ClusterRole/admin", "controls": [
+      {"controlID": "C-0035", "name": "Administrative Roles", "status": {"status": "failed"}, "rules": [{"status": "failed"}]}
+    ]}
+  ]
+}`
+
+func TestParseKubescape(t *testing.T) {
+	results, err := parseKubescape([]byte(kubescapeReportJSON))
+	if err != nil {
+		t.Fatalf("parseKubescape: %v", err)
+	}
+	if len(results) != 2 || results[0].Target != "deploy/web.yaml" || results[1].Target != "kubescape" {
+		t.Fatalf("got the results %+v, want one of the manifest and one of the cluster", results)
+	}
+
+	tests := []struct {
+		id, severity, resource, path string
+	}{
+		{id: "C-0057", severity: "HIGH", resource: "Deployment/web", path: "spec.template.spec.containers[0].securityContext.privileged"},
+		// rated from the score factor
+		{id: "C-0017", severity: "MEDIUM", resource: "Deployment/web", path: "spec.template.spec.containers[1].securityContext.readOnlyRootFilesystem"},
+	}
+	misconfigurations := results[0].Misconfigurations
+	if len(misconfigurations) != len(tests) {
+		t.Fatalf("got %d misconfigurations of the manifest, want %d", len(misconfigurations), len(tests))
+	}
+	for i, tt := range tests {
+		m := misconfigurations[i]
+		if m.ID != tt.id || m.Severity != tt.severity || m.CauseMetadata.Resource != tt.resource || m.CauseMetadata.ManifestPath != tt.path {
+			t.Errorf("got %s %s on %s at %s, want %s %s on %s at %s", m.ID, m.Severity, m.CauseMetadata.Resource, m.CauseMetadata.ManifestPath,
+				tt.id, tt.severity, tt.resource, tt.path)
+		}
+	}
+	if m := misconfigurations[0]; m.PrimaryURL != "https://hub.armosec.io/docs/c-0057" || m.Message != "Deployment/web fails Privileged container at "+tests[0].path {
+		t.Errorf("got the link %s and message %q", m.PrimaryURL, m.Message)
+	}
+
+	cluster := results[1].Misconfigurations
+	if len(cluster) != 1 || cluster[0].Severity != "CRITICAL" || cluster[0].CauseMetadata.ManifestPath != "kind" {
+		t.Errorf("got %+v for the cluster role, want a CRITICAL finding on its kind", cluster)
+	}
+}
+
+func TestKubescapeSeverity(t *testing.T) {
+	for score, want := range map[float64]string{9: "CRITICAL", 7.5: "HIGH", 4: "MEDIUM", 1: "LOW", 0: "UNKNOWN"} {
+		if got := kubescapeSeverity(score); got != want {
+			t.Errorf("kubescapeSeverity(%v) = %s, want %s", score, got, want)
+		}
+	}
+}
+
+const kubernetesManifest = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx
+          securityContext:
+            privileged: true
+        - name: sidecar
+          image: envoy
+`
+
+func TestLocateManifestPaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		resource   string
+		path       string
+		start, end int
+	}{
+		{name: "a field", resource: "Deployment/web", path: "spec.template.spec.containers[0].securityContext.privileged", start: 17, end: 17},
+		{name: "a missing field", resource: "Deployment/web", path: "spec.template.spec.containers[1].securityContext.readOnlyRootFilesystem", start: 18, end: 19},
+		{name: "the kind", resource: "Deployment/web", path: "kind", start: 7, end: 7},
+		{name: "another document", resource: "Service/web", path: "metadata.name", start: 4, end: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := []Finding{{Target: "deploy/web.yaml", Resource: tt.resource, ManifestPath: tt.path}}
+			read := func(target string) ([]byte, error) {
+				if target != "deploy/web.yaml" {
+					return nil, errors.New("not found")
+				}
+				return []byte(kubernetesManifest), nil
+			}
+			got := LocateManifestPaths(findings, read)[0]
+			if got.StartLine != tt.start || got.EndLine != tt.end {
+				t.Errorf("got the lines %d-%d, want %d-%d", got.StartLine, got.EndLine, tt.start, tt.end)
+			}
+		})
+	}
+
+	unread := LocateManifestPaths([]Finding{{Target: "missing.yaml", Resource: "Deployment/web", ManifestPath: "kind"}},
+		func(string) ([]byte, error) { return nil, errors.New("not found") })
+	if unread[0].StartLine != 0 {
+		t.Errorf("located a finding of a file that can't be read on line %d", unread[0].StartLine)
+	}
+}
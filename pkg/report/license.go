@@ -0,0 +1,82 @@
+package report
+
+import (
+	"path"
+	"strings"
+)
+
+// The categories of a LicensePolicy, from the most permissive
+const (
+	LicenseAllowed    = "allowed"
+	LicenseNotice     = "notice"
+	LicenseRestricted = "restricted"
+	LicenseForbidden  = "forbidden"
+)
+
+// licenseSeverities are the severities a license finding gets in each category, an allowed
+// license is suppressed instead
+var licenseSeverities = map[string]string{
+	LicenseNotice:     "LOW",
+	LicenseRestricted: "HIGH",
+	LicenseForbidden:  "CRITICAL",
+}
+
+// LicensePolicy sorts licenses into categories by their SPDX ID, matched case insensitively
+// with * as a wildcard, e.g. GPL-*
+type LicensePolicy struct {
+	Allowed    []string
+	Notice     []string
+	Restricted []string
+	Forbidden  []string
+}
+
+// Category returns the category the license falls into, the strictest one listing it, empty
+// when the policy doesn't list it
+func (p LicensePolicy) Category(license string) string {
+	for _, category := range []struct {
+		name     string
+		patterns []string
+	}{{LicenseForbidden, p.Forbidden}, {LicenseRestricted, p.Restricted}, {LicenseNotice, p.Notice}, {LicenseAllowed, p.Allowed}} {
+		for _, pattern := range category.patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(license)); ok {
+				return category.name
+			}
+		}
+	}
+	return ""
+}
+
+// ApplyLicensePolicy sets the category of the license findings and the severity that comes
+// with it: an allowed license is suppressed, and one the policy doesn't list keeps trivy's
+// severity
+func ApplyLicensePolicy(findings []Finding, policy LicensePolicy) []Finding {
+	applied := make([]Finding, len(findings))
+	for i, f := range findings {
+		applied[i] = f
+		if f.License == "" {
+			continue
+		}
+		category := policy.Category(f.License)
+		applied[i].LicenseCategory = category
+		switch category {
+		case "":
+		case LicenseAllowed:
+			applied[i].Suppressed = true
+		default:
+			applied[i].Severity = licenseSeverities[category]
+		}
+	}
+	return applied
+}
+
+// IntroducedLicenses leaves out the license findings on packages the base dependencies
+// already have, so only the licenses a PR brings in are reported
+func IntroducedLicenses(findings []Finding, base []Dependency) []Finding {
+	names := make(map[string]bool, len(base))
+	for _, d := range base {
+		names[d.Name] = true
+	}
+	return Filter(findings, func(f Finding) bool {
+		return f.License == "" || !names[f.Resource]
+	})
+}
@@ -0,0 +1,78 @@
+package report
+
+import "testing"
+
+func TestLicensePolicyCategory(t *testing.T) {
+	policy := LicensePolicy{
+		Allowed:    []string{"MIT", "Apache-2.0", "GPL-2.0-with-classpath-exception"},
+		Notice:     []string{"BSD-*"},
+		Restricted: []string{"LGPL-*", "MPL-2.0"},
+		Forbidden:  []string{"GPL-*", "AGPL-*"},
+	}
+	tests := []struct {
+		license string
+		want    string
+	}{
+		{license: "MIT", want: LicenseAllowed},
+		{license: "apache-2.0", want: LicenseAllowed},
+		{license: "BSD-3-Clause", want: LicenseNotice},
+		{license: "LGPL-2.1-only", want: LicenseRestricted},
+		{license: "GPL-3.0-only", want: LicenseForbidden},
+		// listed as allowed, but the strictest category listing it wins
+		{license: "GPL-2.0-with-classpath-exception", want: LicenseForbidden},
+		{license: "WTFPL"},
+	}
+	for _, tt := range tests {
+		if got := policy.Category(tt.license); got != tt.want {
+			t.Errorf("Category(%q) = %q, want %q", tt.license, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLicensePolicy(t *testing.T) {
+	results := []Result{{
+		Target: "package-lock.json", Class: "license",
+		Licenses: []License{
+			{PkgName: "left-pad", Name: "MIT", Severity: "LOW", Category: "notice"},
+			{PkgName: "readline", Name: "GPL-3.0", Severity: "HIGH", Category: "restricted"},
+			{PkgName: "odd", Name: "WTFPL", Severity: "MEDIUM", Category: "unknown"},
+		},
+	}, {
+		Target: "main.tf", Class: "config", Type: "terraform",
+		Misconfigurations: []Misconfiguration{{ID: "AVD-AWS-0086", Severity: "HIGH"}},
+	}}
+	policy := LicensePolicy{Allowed: []string{"MIT"}, Forbidden: []string{"GPL-*"}}
+
+	applied := ApplyLicensePolicy(Findings(results), policy)
+
+	byID := make(map[string]Finding)
+	for _, f := range applied {
+		byID[f.ID] = f
+	}
+	if f := byID["MIT"]; !f.Suppressed || f.LicenseCategory != LicenseAllowed || f.Resource != "left-pad" {
+		t.Errorf("got %+v for an allowed license, want it suppressed", f)
+	}
+	if f := byID["GPL-3.0"]; f.Suppressed || f.Severity != "CRITICAL" || f.LicenseCategory != LicenseForbidden {
+		t.Errorf("got %s %s for a forbidden license, want CRITICAL", f.LicenseCategory, f.Severity)
+	}
+	if f := byID["WTFPL"]; f.Severity != "MEDIUM" || f.LicenseCategory != "" {
+		t.Errorf("got %s %s for an unlisted license, want trivy's severity", f.LicenseCategory, f.Severity)
+	}
+	if f := byID["AVD-AWS-0086"]; f.Suppressed || f.Severity != "HIGH" {
+		t.Errorf("the policy changed the misconfiguration to %s", f.Severity)
+	}
+}
+
+func TestIntroducedLicenses(t *testing.T) {
+	findings := []Finding{
+		{ID: "MIT", License: "MIT", Resource: "left-pad"},
+		{ID: "GPL-3.0", License: "GPL-3.0", Resource: "readline"},
+		{ID: "AVD-AWS-0086", Resource: "left-pad"},
+	}
+
+	introduced := IntroducedLicenses(findings, []Dependency{{Name: "left-pad"}})
+
+	if len(introduced) != 2 || introduced[0].ID != "GPL-3.0" || introduced[1].ID != "AVD-AWS-0086" {
+		t.Errorf("got %v, want the new package's license and the other finding", introduced)
+	}
+}
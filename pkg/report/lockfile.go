@@ -0,0 +1,197 @@
+package report
+
+import (
+	"path"
+	"strings"
+)
+
+// LocatePackages anchors the vulnerabilities without lines onto the entry of their package in
+// the lockfile or manifest they were found in, so they can be commented on inline. The read
+// function returns the content of a target, findings whose target can't be read or whose
+// package isn't found keep no lines. A manifest line that UpgradeLine can rewrite to the fixed
+// version becomes the Suggestion of the finding. The license of a package is anchored the same
+// way, on the first entry of the package as the report has no version for it.
+func LocatePackages(findings []Finding, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	located := make([]Finding, len(findings))
+	for i, f := range findings {
+		located[i] = f
+		name := f.PkgName
+		if name == "" && f.License != "" && f.Resource != f.Target {
+			name = f.Resource
+		}
+		if name == "" || f.StartLine > 0 {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		if start, end, ok := locatePackage(path.Base(f.Target), lines, name, f.InstalledVersion); ok {
+			located[i].StartLine, located[i].EndLine = start, end
+			if start == end {
+				located[i].Suggestion, _ = UpgradeLine(f.Target, lines[start-1], f)
+			}
+		}
+	}
+	SortFindings(located)
+	return located
+}
+
+// LocatePackage finds the lines of the package's entry in the content of a lockfile or
+// manifest, returning 1-based line numbers. An empty version matches any version.
+func LocatePackage(filename string, content []byte, name, version string) (int, int, bool) {
+	return locatePackage(path.Base(filename), strings.Split(string(content), "\n"), name, version)
+}
+
+func locatePackage(base string, lines []string, name, version string) (int, int, bool) {
+	var start, end int
+	switch {
+	case base == "package-lock.json" || base == "npm-shrinkwrap.json":
+		// lockfile v2 and v3 key packages by path, v1 nests them by name
+		start, end = jsonBlock(lines, func(line string) bool {
+			return strings.HasSuffix(strings.TrimSpace(line), `node_modules/`+name+`": {`)
+		}, `"version": "`+version+`"`)
+		if start == 0 {
+			start, end = jsonBlock(lines, func(line string) bool {
+				return strings.TrimSpace(line) == `"`+name+`": {`
+			}, `"version": "`+version+`"`)
+		}
+	case base == "package.json":
+		start = firstLine(lines, func(line string) bool {
+			return strings.HasPrefix(strings.TrimSpace(line), `"`+name+`": "`)
+		})
+		end = start
+	case base == "Pipfile.lock" || base == "composer.lock":
+		start, end = jsonBlock(lines, func(line string) bool {
+			trimmed := strings.TrimSpace(line)
+			return trimmed == `"`+name+`": {` || strings.HasPrefix(trimmed, `"name": "`+name+`"`)
+		}, version)
+	case base == "yarn.lock":
+		start, end = blankLineBlock(lines, func(line string) bool {
+			entry := strings.TrimLeft(line, `"`)
+			return !strings.HasPrefix(line, " ") && strings.HasPrefix(entry, name+"@")
+		}, version)
+	case base == "pnpm-lock.yaml":
+		start = firstLine(lines, func(line string) bool {
+			entry := strings.Trim(strings.TrimSpace(line), `'"/`)
+			return strings.HasPrefix(entry, name+"@"+version) || strings.HasPrefix(entry, name+"/"+version)
+		})
+		end = start
+	case base == "go.mod":
+		start = firstLine(lines, func(line string) bool {
+			fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "require "))
+			return len(fields) >= 2 && fields[0] == name && (version == "" || fields[1] == version)
+		})
+		end = start
+	case base == "go.sum":
+		// the module and its go.mod each have a line
+		for i, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == name && (version == "" || strings.TrimSuffix(fields[1], "/go.mod") == version) {
+				if start == 0 {
+					start = i + 1
+				}
+				end = i + 1
+			}
+		}
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		start = firstLine(lines, func(line string) bool {
+			requirement := strings.TrimSpace(line)
+			if i := strings.IndexAny(requirement, "=<>!~;[ @"); i >= 0 {
+				requirement = requirement[:i]
+			}
+			return requirement != "" && normalizePythonName(requirement) == normalizePythonName(name)
+		})
+		end = start
+	case base == "poetry.lock" || base == "Cargo.lock" || base == "uv.lock":
+		start, end = blankLineBlock(lines, func(line string) bool {
+			return strings.TrimSpace(line) == `name = "`+name+`"`
+		}, `version = "`+version+`"`)
+	case base == "Gemfile.lock":
+		start = firstLine(lines, func(line string) bool {
+			return strings.TrimSpace(line) == name+" ("+version+")" || version == "" && strings.HasPrefix(strings.TrimSpace(line), name+" (")
+		})
+		end = start
+	default:
+		start = firstLine(lines, func(line string) bool {
+			return strings.Contains(line, name) && strings.Contains(line, version)
+		})
+		end = start
+	}
+	return start, end, start > 0
+}
+
+// jsonBlock returns the lines of the first object opened on a matching line that contains
+// the text, or of the first matching object when none does
+func jsonBlock(lines []string, match func(string) bool, contains string) (int, int) {
+	var firstStart, firstEnd int
+	for i, line := range lines {
+		if !match(line) {
+			continue
+		}
+		depth, end := 0, i
+		for j := i; j < len(lines); j++ {
+			depth += strings.Count(lines[j], "{") - strings.Count(lines[j], "}")
+			if depth <= 0 {
+				end = j
+				break
+			}
+		}
+		if blockContains(lines[i:end+1], contains) {
+			return i + 1, end + 1
+		}
+		if firstStart == 0 {
+			firstStart, firstEnd = i+1, end+1
+		}
+	}
+	return firstStart, firstEnd
+}
+
+// blankLineBlock is jsonBlock for formats whose entries are separated by blank lines, the
+// block runs from the matching line to the end of its entry
+func blankLineBlock(lines []string, match func(string) bool, contains string) (int, int) {
+	var firstStart, firstEnd int
+	for i, line := range lines {
+		if !match(line) {
+			continue
+		}
+		end := i
+		for end+1 < len(lines) && strings.TrimSpace(lines[end+1]) != "" && !strings.HasPrefix(lines[end+1], "[[") {
+			end++
+		}
+		if blockContains(lines[i:end+1], contains) {
+			return i + 1, end + 1
+		}
+		if firstStart == 0 {
+			firstStart, firstEnd = i+1, end+1
+		}
+	}
+	return firstStart, firstEnd
+}
+
+func blockContains(lines []string, text string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstLine(lines []string, match func(string) bool) int {
+	for i, line := range lines {
+		if match(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// normalizePythonName compares package names the way pip does
+func normalizePythonName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
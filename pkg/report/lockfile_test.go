@@ -0,0 +1,144 @@
+package report
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocatePackage(t *testing.T) {
+	tests := []struct {
+		filename  string
+		content   string
+		name      string
+		version   string
+		wantStart int
+		wantEnd   int
+	}{
+		{
+			filename: "package-lock.json",
+			content: `{
+  "packages": {
+    "node_modules/lodash": {
+      "version": "4.17.20"
+    },
+    "node_modules/minimist": {
+      "version": "1.2.5",
+      "resolved": "https://registry.npmjs.org/minimist/-/minimist-1.2.5.tgz"
+    }
+  }
+}`,
+			name: "minimist", version: "1.2.5", wantStart: 6, wantEnd: 9,
+		},
+		{
+			filename: "web/package-lock.json",
+			content: `{
+  "dependencies": {
+    "lodash": {
+      "version": "4.17.20"
+    }
+  }
+}`,
+			name: "lodash", version: "4.17.20", wantStart: 3, wantEnd: 5,
+		},
+		{
+			filename: "package.json",
+			content:  "{\n  \"dependencies\": {\n    \"lodash\": \"^4.17.20\"\n  }\n}",
+			name:     "lodash", version: "4.17.20", wantStart: 3, wantEnd: 3,
+		},
+		{
+			filename: "yarn.lock",
+			content:  "lodash@^4.17.19:\n  version \"4.17.19\"\n\nlodash@^4.17.20:\n  version \"4.17.20\"\n  resolved \"https://registry.yarnpkg.com/lodash\"\n",
+			name:     "lodash", version: "4.17.20", wantStart: 4, wantEnd: 6,
+		},
+		{
+			filename: "go.mod",
+			content:  "module example.com/m\n\nrequire (\n\tgolang.org/x/net v0.17.0\n\tgolang.org/x/text v0.13.0\n)\n",
+			name:     "golang.org/x/text", version: "v0.13.0", wantStart: 5, wantEnd: 5,
+		},
+		{
+			filename: "go.sum",
+			content:  "golang.org/x/net v0.17.0 h1:a=\ngolang.org/x/net v0.17.0/go.mod h1:b=\ngolang.org/x/text v0.13.0 h1:c=\n",
+			name:     "golang.org/x/net", version: "v0.17.0", wantStart: 1, wantEnd: 2,
+		},
+		{
+			filename: "requirements-dev.txt",
+			content:  "# tools\nrequests==2.31.0\nPyYAML>=5.3 ; python_version > \"3\"\n",
+			name:     "pyyaml", version: "5.3", wantStart: 3, wantEnd: 3,
+		},
+		{
+			filename: "poetry.lock",
+			content:  "[[package]]\nname = \"requests\"\nversion = \"2.31.0\"\n\n[[package]]\nname = \"urllib3\"\nversion = \"1.26.5\"\n",
+			name:     "urllib3", version: "1.26.5", wantStart: 6, wantEnd: 7,
+		},
+		{
+			filename: "Gemfile.lock",
+			content:  "GEM\n  specs:\n    rack (2.2.3)\n    rails (7.0.0)\n",
+			name:     "rack", version: "2.2.3", wantStart: 3, wantEnd: 3,
+		},
+		{
+			filename: "go.mod",
+			content:  "module example.com/m\n\nrequire golang.org/x/net v0.17.0\n",
+			name:     "golang.org/x/text", version: "v0.13.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename+" "+tt.name, func(t *testing.T) {
+			start, end, ok := LocatePackage(tt.filename, []byte(tt.content), tt.name, tt.version)
+			if ok != (tt.wantStart > 0) || start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("got lines %d-%d (%t), want %d-%d", start, end, ok, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestLocatePackages(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\nrequire golang.org/x/net v0.17.0\n",
+	}
+	read := func(target string) ([]byte, error) {
+		if content, ok := files[target]; ok {
+			return []byte(content), nil
+		}
+		return nil, errors.New("not found")
+	}
+	findings := []Finding{
+		{ID: "CVE-2023-1", Target: "go.mod", PkgName: "golang.org/x/net", InstalledVersion: "v0.17.0", FixedVersion: "0.23.0", Severity: "HIGH"},
+		{ID: "CVE-2023-2", Target: "go.sum", PkgName: "golang.org/x/net", InstalledVersion: "v0.17.0", Severity: "HIGH"},
+		{ID: "CVE-2023-3", Target: "go.mod", PkgName: "golang.org/x/text", InstalledVersion: "v0.13.0", Severity: "HIGH"},
+		{ID: "AVD-AWS-0086", Target: "go.mod", StartLine: 1, EndLine: 1, Severity: "HIGH"},
+	}
+
+	located := LocatePackages(findings, read)
+
+	byID := make(map[string]Finding)
+	for _, f := range located {
+		byID[f.ID] = f
+	}
+	if f := byID["CVE-2023-1"]; f.StartLine != 3 || f.EndLine != 3 || f.Suggestion != "require golang.org/x/net v0.23.0" {
+		t.Errorf("got lines %d-%d and the suggestion %q, want line 3 upgraded", f.StartLine, f.EndLine, f.Suggestion)
+	}
+	if f := byID["CVE-2023-2"]; f.StartLine != 0 {
+		t.Errorf("located a finding of an unreadable target on line %d", f.StartLine)
+	}
+	if f := byID["CVE-2023-3"]; f.StartLine != 0 {
+		t.Errorf("located a package missing from the manifest on line %d", f.StartLine)
+	}
+	if f := byID["AVD-AWS-0086"]; f.StartLine != 1 || f.Suggestion != "" {
+		t.Errorf("moved a finding with lines to %d", f.StartLine)
+	}
+}
+
+func TestFixedVersion(t *testing.T) {
+	tests := []struct{ installed, fixed, want string }{
+		{installed: "2.1.0", fixed: "2.2.1, 3.0.1", want: "2.2.1"},
+		{installed: "2.3.0", fixed: "2.2.1, 3.0.1", want: "3.0.1"},
+		{installed: "v0.17.0", fixed: "0.23.0", want: "0.23.0"},
+		{installed: "3.1.0", fixed: "2.2.1, 3.0.1"},
+		{installed: "1.0.0", fixed: ""},
+	}
+	for _, tt := range tests {
+		if got := FixedVersion(tt.installed, tt.fixed); got != tt.want {
+			t.Errorf("FixedVersion(%q, %q) = %q, want %q", tt.installed, tt.fixed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package report
+
+import "fmt"
+
+// MergeResults combines the results of several reports, e.g. the shards of a matrix build,
+// into one result per target and class. Findings repeated across the reports are kept once,
+// in the order they first appear. It returns the merged results and how many findings were
+// dropped as duplicates.
+func MergeResults(results []Result) ([]Result, int) {
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	var merged []Result
+	var dropped int
+	first := func(key string) bool {
+		if seen[key] {
+			dropped++
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+	for _, r := range results {
+		target := r.Target + "\x00" + r.Class
+		i, ok := index[target]
+		if !ok {
+			i = len(merged)
+			index[target] = i
+			merged = append(merged, Result{Target: r.Target, Class: r.Class, Type: r.Type, MisconfSummary: r.MisconfSummary, Image: r.Image, Extra: r.Extra})
+		}
+		m := &merged[i]
+		if m.Image == nil {
+			m.Image = r.Image
+		}
+		for _, misconf := range r.Misconfigurations {
+			if first(fmt.Sprintf("%s\x00misconf\x00%s\x00%s\x00%d\x00%d\x00%s", target, misconf.ID, misconf.CauseMetadata.Resource,
+				misconf.CauseMetadata.StartLine, misconf.CauseMetadata.EndLine, misconf.Message)) {
+				m.Misconfigurations = append(m.Misconfigurations, misconf)
+			}
+		}
+		for _, vuln := range r.Vulnerabilities {
+			if first(fmt.Sprintf("%s\x00vuln\x00%s\x00%s\x00%s\x00%s", target, vuln.VulnerabilityID, vuln.PkgName, vuln.InstalledVersion, vuln.PkgPath)) {
+				m.Vulnerabilities = append(m.Vulnerabilities, vuln)
+			}
+		}
+		for _, secret := range r.Secrets {
+			if first(fmt.Sprintf("%s\x00secret\x00%s\x00%d\x00%d", target, secret.RuleID, secret.StartLine, secret.EndLine)) {
+				m.Secrets = append(m.Secrets, secret)
+			}
+		}
+		for _, license := range r.Licenses {
+			if first(fmt.Sprintf("%s\x00license\x00%s\x00%s\x00%s", target, license.Name, license.PkgName, license.FilePath)) {
+				m.Licenses = append(m.Licenses, license)
+			}
+		}
+		for _, p := range r.Packages {
+			// packages aren't findings, they aren't counted as dropped
+			key := fmt.Sprintf("%s\x00pkg\x00%s\x00%s\x00%s", target, p.ID, p.Name, p.Version)
+			if !seen[key] {
+				seen[key] = true
+				m.Packages = append(m.Packages, p)
+			}
+		}
+	}
+	return merged, dropped
+}
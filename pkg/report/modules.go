@@ -0,0 +1,160 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// terraformModulesDir is where terraform init installs the modules a configuration calls
+const terraformModulesDir = ".terraform/modules/"
+
+// LocateModuleCalls moves the findings on resources of called modules, which aren't part of
+// the PR, onto the module block in the repo that calls them. The call is taken from the
+// occurrences trivy records for the finding, or else from the modules.json manifest terraform
+// init writes, with the list function returning the file names of a directory of the checkout.
+// The resource the finding was raised on is kept in ModuleResource and ModuleLocation.
+func LocateModuleCalls(findings []Finding, read func(target string) ([]byte, error), list func(dir string) ([]string, error)) []Finding {
+	located := make([]Finding, len(findings))
+	for i, f := range findings {
+		located[i] = f
+		if !inModule(f, read) {
+			continue
+		}
+		file, start, end, call, ok := occurrenceCall(f, read)
+		if !ok {
+			file, start, end, call, ok = manifestCall(f.Target, read, list)
+		}
+		if !ok {
+			continue
+		}
+		located[i].Target = file
+		located[i].StartLine, located[i].EndLine = start, end
+		located[i].Code = nil
+		located[i].Resource = call
+		located[i].ModuleResource = f.Resource
+		located[i].ModuleLocation = f.Target
+		if f.StartLine > 0 {
+			located[i].ModuleLocation = fmt.Sprintf("%s:%s", f.Target, lineRange(f.StartLine, f.EndLine))
+		}
+	}
+	SortFindings(located)
+	return located
+}
+
+// inModule reports whether the finding is in a module installed by terraform init or fetched
+// by trivy, neither of which is in the checkout
+func inModule(f Finding, read func(string) ([]byte, error)) bool {
+	if strings.HasPrefix(f.Target, terraformModulesDir) || strings.Contains(f.Target, "/"+terraformModulesDir) ||
+		strings.Contains(f.Target, "::") || strings.Contains(f.Target, "://") {
+		return true
+	}
+	if len(f.Occurrences) == 0 {
+		return false
+	}
+	_, err := read(f.Target)
+	return err != nil
+}
+
+// occurrenceCall returns the outermost module call of the finding's occurrences that is in
+// the checkout
+func occurrenceCall(f Finding, read func(string) ([]byte, error)) (string, int, int, string, bool) {
+	for i := len(f.Occurrences) - 1; i >= 0; i-- {
+		o := f.Occurrences[i]
+		if !strings.HasPrefix(o.Resource, "module.") || o.Location.StartLine < 1 || inModule(Finding{Target: o.Filename}, read) {
+			continue
+		}
+		if _, err := read(o.Filename); err != nil {
+			continue
+		}
+		return o.Filename, o.Location.StartLine, o.Location.EndLine, o.Resource, true
+	}
+	return "", 0, 0, "", false
+}
+
+// modulesManifest is terraform's record of the modules it installed
+type modulesManifest struct {
+	Modules []struct {
+		// Key is the call path, e.g. vpc or vpc.subnets for a module called by the vpc module
+		Key string `json:"Key"`
+		Dir string `json:"Dir"`
+	} `json:"Modules"`
+}
+
+// manifestCall finds the module block calling the installed module the target is in, in the
+// configuration the .terraform directory belongs to
+func manifestCall(target string, read func(string) ([]byte, error), list func(string) ([]string, error)) (string, int, int, string, bool) {
+	i := strings.Index(target, terraformModulesDir)
+	if i < 0 {
+		return "", 0, 0, "", false
+	}
+	root := target[:i]
+	data, err := read(root + terraformModulesDir + "modules.json")
+	if err != nil {
+		return "", 0, 0, "", false
+	}
+	var manifest modulesManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", 0, 0, "", false
+	}
+	var key, dir string
+	for _, m := range manifest.Modules {
+		d := strings.TrimSuffix(strings.TrimPrefix(m.Dir, "./"), "/") + "/"
+		if m.Key != "" && strings.HasPrefix(target[i:], d) && len(d) > len(dir) {
+			key, dir = m.Key, d
+		}
+	}
+	if key == "" {
+		return "", 0, 0, "", false
+	}
+	// the root configuration calls the first module of the path
+	name, _, _ := strings.Cut(key, ".")
+	files, err := list(path.Clean("./" + root))
+	if err != nil {
+		return "", 0, 0, "", false
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".tf") {
+			continue
+		}
+		filename := root + file
+		content, err := read(filename)
+		if err != nil {
+			continue
+		}
+		if start, end, ok := moduleBlock(strings.Split(string(content), "\n"), name); ok {
+			return filename, start, end, "module." + name, true
+		}
+	}
+	return "", 0, 0, "", false
+}
+
+var moduleHeader = regexp.MustCompile(`^\s*module\s+"([^"]+)"\s*\{`)
+
+// moduleBlock returns the lines of the module block with the name
+func moduleBlock(lines []string, name string) (int, int, bool) {
+	for i, line := range lines {
+		m := moduleHeader.FindStringSubmatch(line)
+		if m == nil || m[1] != name {
+			continue
+		}
+		depth := 0
+		for j := i; j < len(lines); j++ {
+			depth += strings.Count(lines[j], "{") - strings.Count(lines[j], "}")
+			if depth <= 0 {
+				return i + 1, j + 1, true
+			}
+		}
+		return i + 1, len(lines), true
+	}
+	return 0, 0, false
+}
+
+func lineRange(start, end int) string {
+	if end <= start {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
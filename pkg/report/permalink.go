@@ -0,0 +1,30 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Permalinks links each finding on a file of the repo to its lines at a commit, base being the
+// blob URL of the commit, e.g. https://github.com/owner/repo/blob/<sha>. The link stays valid
+// once the lines change or the comment on them is outdated. Findings on anything but a file
+// of the repo, such as an image, are left without one.
+func Permalinks(findings []Finding, base string, anchor func(target string) string, exists func(path string) bool) []Finding {
+	linked := append([]Finding(nil), findings...)
+	for i, f := range linked {
+		path := strings.TrimPrefix(anchor(f.Target), "./")
+		if path == "" || !exists(path) {
+			continue
+		}
+		url := fmt.Sprintf("%s/%s", strings.TrimSuffix(base, "/"), path)
+		if f.StartLine > 0 {
+			url += fmt.Sprintf("#L%d", f.StartLine)
+			if f.EndLine > f.StartLine {
+				url += fmt.Sprintf("-L%d", f.EndLine)
+			}
+		}
+		linked[i].Permalink = url
+	}
+	SortFindings(linked)
+	return linked
+}
@@ -0,0 +1,175 @@
+// Package report parses Trivy JSON reports into Go types and a flat Finding model.
+//
+// The exported types follow the module's semantic version: fields may be added in
+// minor releases, but existing fields and functions are only changed in a major release.
+package report
+
+import (
+	"encoding/json"
+)
+
+// Result is a single scanned target of a Trivy report
+type Result struct {
+	Target            string             `json:"Target"`
+	Class             string             `json:"Class"`
+	Type              string             `json:"Type"`
+	MisconfSummary    *MisconfSummary    `json:"MisconfSummary,omitempty"`
+	Misconfigurations []Misconfiguration `json:"Misconfigurations,omitempty"`
+	Vulnerabilities   []Vulnerability    `json:"Vulnerabilities,omitempty"`
+	Secrets           []Secret           `json:"Secrets,omitempty"`
+	Licenses          []License          `json:"Licenses,omitempty"`
+	// Packages are every package of the target, listed when trivy runs with --list-all-pkgs
+	Packages []Package `json:"Packages,omitempty"`
+	// Image is the image of a container image scan, shared by its results, nil for other scans
+	Image *Image `json:"-"`
+	// Extra holds the fields of the result the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type MisconfSummary struct {
+	Successes  int `json:"Successes"`
+	Failures   int `json:"Failures"`
+	Exceptions int `json:"Exceptions"`
+}
+
+type Misconfiguration struct {
+	Type          string            `json:"Type"`
+	ID            string            `json:"ID"`
+	AVDID         string            `json:"AVDID"`
+	Title         string            `json:"Title"`
+	Description   string            `json:"Description"`
+	Message       string            `json:"Message"`
+	Query         string            `json:"Query"`
+	Resolution    string            `json:"Resolution"`
+	Severity      string            `json:"Severity"`
+	PrimaryURL    string            `json:"PrimaryURL"`
+	References    []string          `json:"References"`
+	Status        string            `json:"Status"`
+	Layer         map[string]string `json:"Layer"`
+	CauseMetadata CauseMetadata     `json:"CauseMetadata"`
+	// Extra holds the fields of the misconfiguration the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Vulnerability is a vulnerable package found by a vulnerability scan, e.g. in a lockfile
+type Vulnerability struct {
+	VulnerabilityID  string            `json:"VulnerabilityID"`
+	PkgID            string            `json:"PkgID"`
+	PkgName          string            `json:"PkgName"`
+	PkgPath          string            `json:"PkgPath"`
+	InstalledVersion string            `json:"InstalledVersion"`
+	FixedVersion     string            `json:"FixedVersion"`
+	Status           string            `json:"Status"`
+	Title            string            `json:"Title"`
+	Description      string            `json:"Description"`
+	Severity         string            `json:"Severity"`
+	PrimaryURL       string            `json:"PrimaryURL"`
+	References       []string          `json:"References"`
+	Layer            map[string]string `json:"Layer"`
+	// Extra holds the fields of the vulnerability the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// License is a license found by a license scan, on a package or, for a loose file, in FilePath.
+// Category is trivy's classification, e.g. restricted or notice.
+type License struct {
+	Severity   string  `json:"Severity"`
+	Category   string  `json:"Category"`
+	PkgName    string  `json:"PkgName"`
+	FilePath   string  `json:"FilePath"`
+	Name       string  `json:"Name"`
+	Confidence float64 `json:"Confidence"`
+	Link       string  `json:"Link"`
+	// Extra holds the fields of the license the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Package is a package installed in a target, vulnerable or not
+type Package struct {
+	ID         string        `json:"ID"`
+	Name       string        `json:"Name"`
+	Version    string        `json:"Version"`
+	Identifier PkgIdentifier `json:"Identifier"`
+	// Extra holds the fields of the package the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type PkgIdentifier struct {
+	PURL string `json:"PURL"`
+	UID  string `json:"UID"`
+}
+
+// Secret is a credential found by a secret scan. Match is the matching line with the secret
+// masked by trivy.
+type Secret struct {
+	RuleID    string            `json:"RuleID"`
+	Category  string            `json:"Category"`
+	Severity  string            `json:"Severity"`
+	Title     string            `json:"Title"`
+	StartLine int               `json:"StartLine"`
+	EndLine   int               `json:"EndLine"`
+	Code      Code              `json:"Code"`
+	Match     string            `json:"Match"`
+	Layer     map[string]string `json:"Layer"`
+	// Extra holds the fields of the secret the types don't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type CauseMetadata struct {
+	Resource  string `json:"Resource"`
+	Provider  string `json:"Provider"`
+	Service   string `json:"Service"`
+	StartLine int    `json:"StartLine"`
+	EndLine   int    `json:"EndLine"`
+	Code      Code   `json:"Code"`
+	// Occurrences are the module calls a resource of a module was created by, innermost first
+	Occurrences []Occurrence `json:"Occurrences"`
+	// ManifestPath is the field of a Kubernetes manifest a finding of kubescape points at, e.g.
+	// spec.containers[0].securityContext, whose lines LocateManifestPaths finds
+	ManifestPath string `json:"ManifestPath,omitempty"`
+}
+
+// Occurrence is a block a finding in a module traces back to, such as a module call
+type Occurrence struct {
+	Resource string   `json:"Resource"`
+	Filename string   `json:"Filename"`
+	Location Location `json:"Location"`
+}
+
+type Location struct {
+	StartLine int `json:"StartLine"`
+	EndLine   int `json:"EndLine"`
+}
+
+type Code struct {
+	Lines []Line `json:"Lines"`
+}
+
+type Line struct {
+	Number      int    `json:"Number"`
+	Content     string `json:"Content"`
+	IsCause     bool   `json:"IsCause"`
+	Annotation  string `json:"Annotation"`
+	Truncated   bool   `json:"Truncated"`
+	Highlighted string `json:"Highlighted"`
+	FirstCause  bool   `json:"FirstCause"`
+	LastCause   bool   `json:"LastCause"`
+}
+
+// LoadFile reads the results of the Trivy JSON report at path, see ParseReport
+func LoadFile(path string) ([]Result, error) {
+	r, err := LoadReport(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.Results, nil
+}
+
+// Parse reads the results of a Trivy JSON report, see ParseReport for the drift found on the way
+func Parse(data []byte) ([]Result, error) {
+	r, err := ParseReport(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.Results, nil
+}
@@ -0,0 +1,18 @@
+package report
+
+import "strings"
+
+// DefaultRiskWeights are what a finding of each severity adds to the risk score
+var DefaultRiskWeights = map[string]int{"CRITICAL": 10, "HIGH": 5, "MEDIUM": 2, "LOW": 1}
+
+// RiskScore sums the weight of the severity of each finding that isn't suppressed,
+// severities without a weight add nothing
+func RiskScore(findings []Finding, weights map[string]int) int {
+	var score int
+	for _, f := range findings {
+		if !f.Suppressed {
+			score += weights[strings.ToUpper(f.Severity)]
+		}
+	}
+	return score
+}
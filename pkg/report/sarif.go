@@ -0,0 +1,213 @@
+package report
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// sarifLog is the part of a SARIF 2.1.0 log written by trivy --format sarif the findings are
+// read from
+type sarifLog struct {
+	Runs []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+	HelpURI          string       `json:"helpUri"`
+	Properties       struct {
+		Tags []string `json:"tags"`
+	} `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string       `json:"ruleId"`
+	RuleIndex *int         `json:"ruleIndex"`
+	Level     string       `json:"level"`
+	Message   sarifMessage `json:"message"`
+	Locations []struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine int `json:"startLine"`
+				EndLine   int `json:"endLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	} `json:"locations"`
+}
+
+// sarifLevels are the severities of results whose rule has no severity tag
+var sarifLevels = map[string]string{"error": "HIGH", "warning": "MEDIUM", "note": "LOW"}
+
+// isSARIF reports whether the top level fields of a report are those of a SARIF log
+func isSARIF(fields map[string]json.RawMessage) bool {
+	_, runs := fields["runs"]
+	_, results := fields["Results"]
+	return runs && !results
+}
+
+// parseSARIF maps the results of a SARIF log onto the results of a Trivy report, one per
+// file. The rule of a result tells a vulnerability from a misconfiguration or a secret, and
+// its metadata fills in the title, description and link. The lines of a location are those
+// of the finding; vulnerabilities get theirs from LocatePackages like in a JSON report.
+func parseSARIF(data []byte) ([]Result, error) {
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, err
+	}
+	byTarget := make(map[string]*Result)
+	var targets []string
+	for _, run := range log.Runs {
+		rules := make(map[string]sarifRule, len(run.Tool.Driver.Rules))
+		for _, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = rule
+		}
+		for _, result := range run.Results {
+			rule, ok := rules[result.RuleID]
+			if !ok && result.RuleIndex != nil && *result.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*result.RuleIndex]
+			}
+			for _, location := range result.Locations {
+				target := location.PhysicalLocation.ArtifactLocation.URI
+				r, ok := byTarget[target]
+				if !ok {
+					r = &Result{Target: target}
+					byTarget[target] = r
+					targets = append(targets, target)
+				}
+				region := location.PhysicalLocation.Region
+				addSARIFResult(r, rule, result, region.StartLine, region.EndLine)
+			}
+		}
+	}
+	sort.Strings(targets)
+	results := make([]Result, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, *byTarget[target])
+	}
+	return results, nil
+}
+
+func addSARIFResult(r *Result, rule sarifRule, result sarifResult, startLine, endLine int) {
+	if endLine < startLine {
+		endLine = startLine
+	}
+	fields := sarifFields(result.Message.Text)
+	id := result.RuleID
+	if id == "" {
+		id = rule.ID
+	}
+	severity := sarifSeverity(rule, result, fields)
+	title := rule.ShortDescription.Text
+	if title == "" {
+		title = rule.Name
+	}
+	var references []string
+	if rule.HelpURI != "" {
+		references = []string{rule.HelpURI}
+	}
+
+	switch {
+	case hasTag(rule, "vulnerability"):
+		r.Class = "lang-pkgs"
+		r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+			VulnerabilityID:  id,
+			PkgName:          fields["Package"],
+			InstalledVersion: fields["Installed Version"],
+			FixedVersion:     fields["Fixed Version"],
+			Title:            title,
+			Description:      rule.FullDescription.Text,
+			Severity:         severity,
+			PrimaryURL:       rule.HelpURI,
+			References:       references,
+		})
+	case hasTag(rule, "secret"):
+		r.Class = "secret"
+		r.Secrets = append(r.Secrets, Secret{
+			RuleID:    id,
+			Severity:  severity,
+			Title:     title,
+			StartLine: startLine,
+			EndLine:   endLine,
+			Match:     fields["Match"],
+		})
+	default:
+		r.Class = "config"
+		if r.Type == "" {
+			r.Type = fields["Type"]
+		}
+		message := fields["Message"]
+		if message == "" {
+			message = result.Message.Text
+		}
+		r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+			ID:            id,
+			AVDID:         id,
+			Title:         title,
+			Description:   rule.FullDescription.Text,
+			Message:       message,
+			Severity:      severity,
+			PrimaryURL:    rule.HelpURI,
+			References:    references,
+			Status:        "FAIL",
+			CauseMetadata: CauseMetadata{StartLine: startLine, EndLine: endLine},
+		})
+	}
+}
+
+// sarifFields reads the "Name: value" lines trivy writes into the message of a result, e.g.
+// the package and versions of a vulnerability
+func sarifFields(text string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		name, value, ok := strings.Cut(line, ": ")
+		if ok {
+			fields[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// sarifSeverity is the severity tag of the rule, the severity of the message or else mapped
+// from the level of the result
+func sarifSeverity(rule sarifRule, result sarifResult, fields map[string]string) string {
+	for _, tag := range rule.Properties.Tags {
+		if severity, err := ParseSeverity(tag); err == nil {
+			return severity
+		}
+	}
+	if severity, err := ParseSeverity(fields["Severity"]); err == nil {
+		return severity
+	}
+	if severity, ok := sarifLevels[result.Level]; ok {
+		return severity
+	}
+	return "UNKNOWN"
+}
+
+func hasTag(rule sarifRule, tag string) bool {
+	for _, t := range rule.Properties.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
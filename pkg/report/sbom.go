@@ -0,0 +1,361 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Dependency is a package of an SBOM or a trivy report listing every package
+type Dependency struct {
+	Name    string
+	Version string
+	PURL    string
+	// Vulnerabilities of the dependency, the most severe first
+	Vulnerabilities []DependencyVulnerability
+}
+
+// DependencyVulnerability is a vulnerability of a dependency
+type DependencyVulnerability struct {
+	ID       string
+	Severity string
+}
+
+// Worst returns the most severe vulnerability of the dependency, false when it has none
+func (d Dependency) Worst() (DependencyVulnerability, bool) {
+	if len(d.Vulnerabilities) == 0 {
+		return DependencyVulnerability{}, false
+	}
+	return d.Vulnerabilities[0], true
+}
+
+func (d Dependency) key() string {
+	return d.Name + "@" + d.Version
+}
+
+// ParseSBOM reads the dependencies of a CycloneDX or SPDX JSON SBOM, or of a trivy JSON
+// report of a scan run with --list-all-pkgs, an object or the legacy array of results. Only
+// CycloneDX and trivy reports carry the vulnerabilities of the dependencies.
+func ParseSBOM(data []byte) ([]Dependency, error) {
+	var probe struct {
+		BOMFormat   string          `json:"bomFormat"`
+		SPDXVersion string          `json:"spdxVersion"`
+		Results     json.RawMessage `json:"Results"`
+	}
+	data, err := uncompressedBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	legacy := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if !legacy {
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case probe.BOMFormat == "CycloneDX":
+		return parseCycloneDX(data)
+	case probe.SPDXVersion != "":
+		return parseSPDX(data)
+	case probe.Results != nil || legacy:
+		r, err := ParseReport(data)
+		if err != nil {
+			return nil, err
+		}
+		if !listsPackages(r.Results) {
+			return nil, errors.New("the report lists no packages, scan with --list-all-pkgs")
+		}
+		return Dependencies(r.Results), nil
+	}
+	return nil, errors.New("not a CycloneDX or SPDX SBOM or a trivy report")
+}
+
+// listsPackages reports whether the scan listed every package rather than only the vulnerable
+// ones, without which a diff would take every package that isn't vulnerable as removed
+func listsPackages(results []Result) bool {
+	for _, result := range results {
+		if len(result.Packages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Dependencies lists the packages of the results with their vulnerabilities
+func Dependencies(results []Result) []Dependency {
+	deps := make(map[string]*Dependency)
+	add := func(name, version, purl string) *Dependency {
+		d := Dependency{Name: name, Version: version, PURL: purl}
+		if existing, ok := deps[d.key()]; ok {
+			if existing.PURL == "" {
+				existing.PURL = purl
+			}
+			return existing
+		}
+		deps[d.key()] = &d
+		return &d
+	}
+	for _, result := range results {
+		for _, p := range result.Packages {
+			add(p.Name, p.Version, p.Identifier.PURL)
+		}
+		for _, v := range result.Vulnerabilities {
+			d := add(v.PkgName, v.InstalledVersion, "")
+			d.Vulnerabilities = append(d.Vulnerabilities, DependencyVulnerability{ID: v.VulnerabilityID, Severity: v.Severity})
+		}
+	}
+	return sortDependencies(deps)
+}
+
+// SetDependencyVulnerabilities replaces the vulnerabilities of the dependencies with those of
+// the findings, so they leave out what VEX statements suppressed and show downgrades
+func SetDependencyVulnerabilities(deps []Dependency, findings []Finding) []Dependency {
+	vulnerabilities := make(map[string][]DependencyVulnerability)
+	for _, f := range findings {
+		if f.PkgName == "" || f.Suppressed {
+			continue
+		}
+		key := Dependency{Name: f.PkgName, Version: f.InstalledVersion}.key()
+		vulnerabilities[key] = append(vulnerabilities[key], DependencyVulnerability{ID: f.ID, Severity: f.Severity})
+	}
+	set := make(map[string]*Dependency, len(deps))
+	for _, d := range deps {
+		d.Vulnerabilities = vulnerabilities[d.key()]
+		set[d.key()] = &d
+	}
+	return sortDependencies(set)
+}
+
+// DiffDependencies returns the dependencies of head that aren't in base and those of base
+// that aren't in head. An upgrade is both, the old version removed and the new one added.
+func DiffDependencies(base, head []Dependency) ([]Dependency, []Dependency) {
+	in := func(deps []Dependency) map[string]bool {
+		keys := make(map[string]bool, len(deps))
+		for _, d := range deps {
+			keys[d.key()] = true
+		}
+		return keys
+	}
+	baseKeys, headKeys := in(base), in(head)
+	var added, removed []Dependency
+	for _, d := range head {
+		if !baseKeys[d.key()] {
+			added = append(added, d)
+		}
+	}
+	for _, d := range base {
+		if !headKeys[d.key()] {
+			removed = append(removed, d)
+		}
+	}
+	return added, removed
+}
+
+// sortDependencies orders the dependencies by name and version, and their vulnerabilities the
+// most severe first, dropping the vulnerabilities listed twice
+func sortDependencies(deps map[string]*Dependency) []Dependency {
+	sorted := make([]Dependency, 0, len(deps))
+	for _, d := range deps {
+		seen := make(map[string]bool)
+		var vulnerabilities []DependencyVulnerability
+		for _, v := range d.Vulnerabilities {
+			if !seen[v.ID] {
+				seen[v.ID] = true
+				vulnerabilities = append(vulnerabilities, v)
+			}
+		}
+		sort.SliceStable(vulnerabilities, func(i, j int) bool {
+			if ri, rj := SeverityRank(vulnerabilities[i].Severity), SeverityRank(vulnerabilities[j].Severity); ri != rj {
+				return ri > rj
+			}
+			return vulnerabilities[i].ID < vulnerabilities[j].ID
+		})
+		d.Vulnerabilities = vulnerabilities
+		sorted = append(sorted, *d)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string               `json:"bom-ref"`
+	Type       string               `json:"type"`
+	Group      string               `json:"group"`
+	Name       string               `json:"name"`
+	Version    string               `json:"version"`
+	PURL       string               `json:"purl"`
+	Properties []cycloneDXProperty  `json:"properties"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// property returns the value of the named property, e.g. aquasecurity:trivy:Class
+func (c cycloneDXComponent) property(name string) string {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+type cycloneDXVulnerability struct {
+	ID     string `json:"id"`
+	Source struct {
+		URL string `json:"url"`
+	} `json:"source"`
+	Ratings []struct {
+		Severity string `json:"severity"`
+	} `json:"ratings"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation"`
+	Advisories     []struct {
+		URL string `json:"url"`
+	} `json:"advisories"`
+	Affects []struct {
+		Ref string `json:"ref"`
+	} `json:"affects"`
+}
+
+// severity is the highest rating of the vulnerability
+func (v cycloneDXVulnerability) severity() string {
+	severity := "UNKNOWN"
+	for _, rating := range v.Ratings {
+		if s, err := ParseSeverity(rating.Severity); err == nil && SeverityRank(s) > SeverityRank(severity) {
+			severity = s
+		}
+	}
+	return severity
+}
+
+type cycloneDXDocument struct {
+	Metadata struct {
+		Component cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+	Dependencies []struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	} `json:"dependencies"`
+	Vulnerabilities []cycloneDXVulnerability `json:"vulnerabilities"`
+}
+
+func parseCycloneDX(data []byte) ([]Dependency, error) {
+	var doc cycloneDXDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	deps := make(map[string]*Dependency)
+	refs := make(map[string]*Dependency)
+	var walk func(components []cycloneDXComponent)
+	walk = func(components []cycloneDXComponent) {
+		for _, c := range components {
+			walk(c.Components)
+			switch c.Type {
+			case "application", "operating-system", "container", "file", "device", "firmware":
+				// the lockfiles, images and systems the packages are in rather than packages
+				continue
+			}
+			d := Dependency{Name: dependencyName(c.PURL, c.Group, c.Name), Version: c.Version, PURL: c.PURL}
+			existing, ok := deps[d.key()]
+			if !ok {
+				existing = &d
+				deps[d.key()] = existing
+			}
+			if c.BOMRef != "" {
+				refs[c.BOMRef] = existing
+			}
+		}
+	}
+	walk(doc.Components)
+	for _, v := range doc.Vulnerabilities {
+		for _, affected := range v.Affects {
+			if d, ok := refs[affected.Ref]; ok {
+				d.Vulnerabilities = append(d.Vulnerabilities, DependencyVulnerability{ID: v.ID, Severity: v.severity()})
+			}
+		}
+	}
+	return sortDependencies(deps), nil
+}
+
+type spdxPackage struct {
+	SPDXID                string `json:"SPDXID"`
+	Name                  string `json:"name"`
+	VersionInfo           string `json:"versionInfo"`
+	PrimaryPackagePurpose string `json:"primaryPackagePurpose"`
+	SourceInfo            string `json:"sourceInfo"`
+	ExternalRefs          []struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	} `json:"externalRefs"`
+}
+
+// purl is the package URL of the package, empty for the document's own package and the files
+// it describes
+func (p spdxPackage) purl() string {
+	var purl string
+	for _, ref := range p.ExternalRefs {
+		if ref.ReferenceType == "purl" {
+			purl = ref.ReferenceLocator
+		}
+	}
+	return purl
+}
+
+type spdxDocument struct {
+	Packages      []spdxPackage `json:"packages"`
+	Relationships []struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	} `json:"relationships"`
+}
+
+func parseSPDX(data []byte) ([]Dependency, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	deps := make(map[string]*Dependency)
+	for _, p := range doc.Packages {
+		purl := p.purl()
+		if purl == "" {
+			continue
+		}
+		d := Dependency{Name: dependencyName(purl, "", p.Name), Version: p.VersionInfo, PURL: purl}
+		if _, ok := deps[d.key()]; !ok {
+			deps[d.key()] = &d
+		}
+	}
+	return sortDependencies(deps), nil
+}
+
+// dependencyName is the package name as trivy reports it, taken from the package URL where
+// there is one: golang.org/x/net, @types/node or, for maven, org.slf4j:slf4j-api
+func dependencyName(purl, group, name string) string {
+	if n, _, ok := purlPackage(purl); ok {
+		if strings.HasPrefix(purl, "pkg:maven/") {
+			return strings.Replace(n, "/", ":", 1)
+		}
+		return n
+	}
+	switch {
+	case group == "":
+		return name
+	case strings.HasPrefix(group, "@"):
+		return group + "/" + name
+	}
+	return group + ":" + name
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const cycloneDXSBOM = `{
+  "bomFormat": "CycloneDX",
+  "metadata": {"component": {"bom-ref": "app", "type": "application", "name": "app"}},
+  "components": [
+    {"bom-ref": "lock", "type": "application", "name": "package-lock.json", "components": [
+      {"bom-ref": "pkg:npm/lodash@4.17.20", "type": "library", "name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20"},
+      {"bom-ref": "pkg:npm/%40types/node@20.1.0", "type": "library", "group": "@types", "name": "node", "version": "20.1.0", "purl": "pkg:npm/%40types/node@20.1.0"}
+    ]},
+    {"bom-ref": "slf4j", "type": "library", "group": "org.slf4j", "name": "slf4j-api", "version": "2.0.9"}
+  ],
+  "vulnerabilities": [
+    {"id": "CVE-2020-8203", "ratings": [{"severity": "medium"}, {"severity": "high"}], "affects": [{"ref": "pkg:npm/lodash@4.17.20"}]},
+    {"id": "CVE-2021-23337", "ratings": [{"severity": "critical"}], "affects": [{"ref": "pkg:npm/lodash@4.17.20"}]},
+    {"id": "CVE-2021-23337", "ratings": [{"severity": "critical"}], "affects": [{"ref": "pkg:npm/lodash@4.17.20"}]}
+  ]
+}`
+
+const spdxSBOM = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"SPDXID": "SPDXRef-Application", "name": "go.mod", "primaryPackagePurpose": "APPLICATION"},
+    {"SPDXID": "SPDXRef-net", "name": "golang.org/x/net", "versionInfo": "v0.17.0",
+     "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/golang.org/x/net@v0.17.0"}]},
+    {"SPDXID": "SPDXRef-log4j", "name": "log4j-core", "versionInfo": "2.14.1",
+     "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"}]}
+  ]
+}`
+
+const trivyPackagesReport = `{"SchemaVersion": 2, "Results": [{"Target": "package-lock.json", "Class": "lang-pkgs", "Type": "npm",
+  "Packages": [
+    {"Name": "lodash", "Version": "4.17.20", "Identifier": {"PURL": "pkg:npm/lodash@4.17.20"}},
+    {"Name": "express", "Version": "4.18.2"}
+  ],
+  "Vulnerabilities": [{"VulnerabilityID": "CVE-2020-8203", "PkgName": "lodash", "InstalledVersion": "4.17.20", "Severity": "HIGH"}]}]}`
+
+// dependencies renders the dependencies as name@version[vulnerabilities], for comparing them
+func dependencies(deps []Dependency) string {
+	var rendered []string
+	for _, d := range deps {
+		var vulnerabilities []string
+		for _, v := range d.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, v.ID+" "+v.Severity)
+		}
+		rendered = append(rendered, fmt.Sprintf("%s@%s[%s]", d.Name, d.Version, strings.Join(vulnerabilities, ", ")))
+	}
+	return strings.Join(rendered, " ")
+}
+
+func TestParseSBOM(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "CycloneDX",
+			data: cycloneDXSBOM,
+			want: "@types/node@20.1.0[] lodash@4.17.20[CVE-2021-23337 CRITICAL, CVE-2020-8203 HIGH] org.slf4j:slf4j-api@2.0.9[]",
+		},
+		{
+			name: "SPDX",
+			data: spdxSBOM,
+			want: "golang.org/x/net@v0.17.0[] org.apache.logging.log4j:log4j-core@2.14.1[]",
+		},
+		{
+			name: "trivy",
+			data: trivyPackagesReport,
+			want: "express@4.18.2[] lodash@4.17.20[CVE-2020-8203 HIGH]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := ParseSBOM([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseSBOM: %v", err)
+			}
+			if got := dependencies(deps); got != tt.want {
+				t.Errorf("got the dependencies\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSBOMErrors(t *testing.T) {
+	tests := map[string]string{
+		"without packages": `{"SchemaVersion": 2, "Results": [{"Target": "package-lock.json", "Vulnerabilities": [{"VulnerabilityID": "CVE-2020-8203", "PkgName": "lodash"}]}]}`,
+		"not an SBOM":      `{"matches": []}`,
+		"not JSON":         `bom`,
+	}
+	for name, data := range tests {
+		if _, err := ParseSBOM([]byte(data)); err == nil {
+			t.Errorf("parsed a report %s", name)
+		}
+	}
+}
+
+func TestDiffDependencies(t *testing.T) {
+	base := []Dependency{{Name: "lodash", Version: "4.17.20"}, {Name: "express", Version: "4.18.2"}}
+	head := []Dependency{{Name: "lodash", Version: "4.17.21"}, {Name: "express", Version: "4.18.2"}, {Name: "left-pad", Version: "1.3.0"}}
+
+	added, removed := DiffDependencies(base, head)
+	if got := dependencies(added); got != "lodash@4.17.21[] left-pad@1.3.0[]" {
+		t.Errorf("got the added dependencies %s", got)
+	}
+	if got := dependencies(removed); got != "lodash@4.17.20[]" {
+		t.Errorf("got the removed dependencies %s", got)
+	}
+}
+
+func TestSetDependencyVulnerabilities(t *testing.T) {
+	deps := []Dependency{{Name: "lodash", Version: "4.17.20", Vulnerabilities: []DependencyVulnerability{{ID: "CVE-2020-8203", Severity: "HIGH"}}}}
+	findings := []Finding{
+		{ID: "CVE-2020-8203", PkgName: "lodash", InstalledVersion: "4.17.20", Severity: "LOW"},
+		{ID: "CVE-2021-23337", PkgName: "lodash", InstalledVersion: "4.17.20", Severity: "CRITICAL", Suppressed: true},
+		{ID: "AVD-AWS-0086", Severity: "HIGH"},
+	}
+
+	set := SetDependencyVulnerabilities(deps, findings)
+	if got := dependencies(set); got != "lodash@4.17.20[CVE-2020-8203 LOW]" {
+		t.Errorf("got the dependencies %s, want the downgrade without the suppressed vulnerability", got)
+	}
+	if worst, ok := set[0].Worst(); !ok || worst.ID != "CVE-2020-8203" {
+		t.Errorf("got the worst vulnerability %v", worst)
+	}
+	if _, ok := (Dependency{Name: "express"}).Worst(); ok {
+		t.Error("got the worst vulnerability of a dependency without any")
+	}
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"path"
+	"strings"
+)
+
+// SecretActions selects the remediation RemediateSecrets adds to secret findings
+type SecretActions struct {
+	// Gitignore suggests a .gitignore pattern for the kind of file the secret is in
+	Gitignore bool
+	// Rotation adds how to rotate the secret with its provider
+	Rotation bool
+	// History flags that the secret stays in the git history until it is rewritten
+	History bool
+}
+
+// SecretRemediation is what the author of a committed secret should do about it
+type SecretRemediation struct {
+	// Gitignore is the .gitignore pattern keeping files like this one out, empty when the
+	// file is one the repo has to track
+	Gitignore string
+	// Rotation is how to revoke and replace the secret
+	Rotation string
+	// RewriteHistory is set when the history has to be rewritten to get rid of the secret
+	RewriteHistory bool
+}
+
+// secretRotations are the rotation instructions of the providers of trivy's built-in secret
+// rules, keyed by the lower-cased rule category
+var secretRotations = map[string]string{
+	"aws":                  "Deactivate the access key in IAM, create a new one for the user or role, and review CloudTrail for its use: https://docs.aws.amazon.com/IAM/latest/UserGuide/id_credentials_access-keys.html#Using_RotateAccessKey",
+	"github":               "Revoke the token in Settings > Developer settings or the app's settings, create a new one with the least scopes needed, and review the security log: https://docs.github.com/en/authentication/keeping-your-account-and-data-secure/token-expiration-and-revocation",
+	"gitlab":               "Revoke the token under Access Tokens and create a new one: https://docs.gitlab.com/ee/user/profile/personal_access_tokens.html#revoke-a-personal-access-token",
+	"google":               "Delete the key in the Cloud console under APIs & Services > Credentials or IAM > Service accounts and create a new one: https://cloud.google.com/iam/docs/keys-create-delete",
+	"azure":                "Regenerate the key or secret in the Azure portal, e.g. the storage account's access keys or the app registration's client secrets: https://learn.microsoft.com/azure/storage/common/storage-account-keys-manage",
+	"slack":                "Revoke the token or webhook on the app's OAuth & Permissions page and reinstall the app: https://api.slack.com/authentication/rotation",
+	"stripe":               "Roll the key in the Stripe dashboard under Developers > API keys: https://stripe.com/docs/keys#rolling-keys",
+	"npm":                  "Revoke the token with npm token revoke and create a new one: https://docs.npmjs.com/revoking-access-tokens",
+	"pypi":                 "Remove the token in the account settings on pypi.org and create a new one scoped to the project: https://pypi.org/help/#apitoken",
+	"docker":               "Delete the access token in the Docker Hub account settings and create a new one: https://docs.docker.com/security/for-developers/access-tokens/",
+	"hashicorp":            "Revoke the token, e.g. with vault token revoke or in the Terraform Cloud user settings, and create a new one",
+	"sendgrid":             "Delete the API key in the SendGrid settings and create a new one: https://docs.sendgrid.com/ui/account-and-settings/api-keys",
+	"twilio":               "Delete the API key in the Twilio console, or rotate the auth token: https://www.twilio.com/docs/iam/api-keys",
+	"asymmetricprivatekey": "Generate a new key pair, replace the public key wherever it is trusted, and revoke any certificate issued for the old key",
+	"jwt":                  "Rotate the signing key the token was issued with so it and every other token signed with the key stop being accepted",
+}
+
+const defaultRotation = "Revoke the secret with the service that issued it and replace it with a new one, stored in a secret manager or the CI secrets rather than the repo"
+
+// RemediateSecrets adds the selected remediation to the secret findings
+func RemediateSecrets(findings []Finding, actions SecretActions) []Finding {
+	if actions == (SecretActions{}) {
+		return findings
+	}
+	remediated := make([]Finding, len(findings))
+	for i, f := range findings {
+		remediated[i] = f
+		if f.Type != "secret" {
+			continue
+		}
+		r := &SecretRemediation{RewriteHistory: actions.History}
+		if actions.Gitignore {
+			r.Gitignore = GitignorePattern(f.Target)
+		}
+		if actions.Rotation {
+			r.Rotation = SecretRotation(f.SecretCategory)
+		}
+		remediated[i].SecretRemediation = r
+	}
+	return remediated
+}
+
+// SecretRotation returns the rotation instructions for a secret rule category
+func SecretRotation(category string) string {
+	key := strings.ToLower(strings.ReplaceAll(category, " ", ""))
+	if rotation, ok := secretRotations[key]; ok {
+		return rotation
+	}
+	return defaultRotation
+}
+
+// credentialDotfiles are the files tools keep credentials in, never meant to be committed
+var credentialDotfiles = []string{".npmrc", ".pypirc", ".netrc", ".git-credentials", ".dockercfg", ".htpasswd", ".pgpass", ".s3cfg", ".boto"}
+
+// GitignorePattern returns the .gitignore pattern for the kind of file a secret was found
+// in, e.g. .env or *.pem, or the file itself when its name says it holds credentials. Other
+// files the repo has to track, such as *.go or *.yaml, get no pattern since ignoring them
+// would ignore the project.
+func GitignorePattern(target string) string {
+	base := path.Base(target)
+	switch {
+	case strings.HasPrefix(base, ".env"):
+		return ".env*"
+	case contains(credentialDotfiles, base):
+		return base
+	}
+	ext := path.Ext(base)
+	switch ext {
+	case ".pem", ".key", ".p12", ".pfx", ".jks", ".keystore", ".tfvars", ".tfstate", ".kubeconfig", ".ovpn", ".ppk":
+		return "*" + ext
+	case "":
+		if strings.HasPrefix(base, "id_") {
+			// ssh keys
+			return base
+		}
+	}
+	lower := strings.ToLower(base)
+	for _, word := range []string{"secret", "credential", "password", "token"} {
+		if strings.Contains(lower, word) {
+			return "/" + strings.TrimPrefix(target, "/")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGitignorePattern(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: ".env", want: ".env*"},
+		{target: "services/api/.env.production", want: ".env*"},
+		{target: "home/.npmrc", want: ".npmrc"},
+		{target: "certs/server.pem", want: "*.pem"},
+		{target: "prod.tfvars", want: "*.tfvars"},
+		{target: "deploy/id_rsa", want: "id_rsa"},
+		{target: "config/db_password.txt", want: "/config/db_password.txt"},
+		{target: "main.go"},
+		{target: "k8s/deployment.yaml"},
+	}
+	for _, tt := range tests {
+		if got := GitignorePattern(tt.target); got != tt.want {
+			t.Errorf("GitignorePattern(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	if got := SecretRotation("AWS"); !strings.Contains(got, "IAM") {
+		t.Errorf("got %q for an AWS secret, want the IAM instructions", got)
+	}
+	if got := SecretRotation("Asymmetric Private Key"); got != secretRotations["asymmetricprivatekey"] {
+		t.Errorf("got %q for a private key, want its instructions", got)
+	}
+	if got := SecretRotation("Acme"); got != defaultRotation {
+		t.Errorf("got %q for an unknown provider, want the default", got)
+	}
+}
+
+func TestRemediateSecrets(t *testing.T) {
+	results := []Result{{
+		Target: "services/.env", Class: "secret",
+		Secrets: []Secret{{RuleID: "aws-access-key-id", Category: "AWS", Severity: "CRITICAL", Title: "AWS Access Key ID", StartLine: 2, EndLine: 2}},
+	}, {
+		Target: "main.tf", Class: "config", Type: "terraform",
+		Misconfigurations: []Misconfiguration{{ID: "AVD-AWS-0086", Severity: "HIGH"}},
+	}}
+	findings := Findings(results)
+
+	if got := RemediateSecrets(findings, SecretActions{}); got[0].SecretRemediation != nil || got[1].SecretRemediation != nil {
+		t.Error("remediated with no action selected")
+	}
+
+	remediated := RemediateSecrets(findings, SecretActions{Gitignore: true, Rotation: true, History: true})
+	for _, f := range remediated {
+		switch f.Type {
+		case "secret":
+			r := f.SecretRemediation
+			if r == nil || r.Gitignore != ".env*" || r.Rotation != SecretRotation("AWS") || !r.RewriteHistory {
+				t.Errorf("got the remediation %+v, want every action", r)
+			}
+			if f.Message != "AWS secret found" || f.StartLine != 2 {
+				t.Errorf("got the message %q on line %d, want the secret's", f.Message, f.StartLine)
+			}
+		default:
+			if f.SecretRemediation != nil {
+				t.Errorf("remediated the %s finding %s", f.Type, f.ID)
+			}
+		}
+	}
+	if findings[0].SecretRemediation != nil || findings[1].SecretRemediation != nil {
+		t.Error("modified the findings passed in")
+	}
+}
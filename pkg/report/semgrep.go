@@ -0,0 +1,107 @@
+package report
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type semgrepReport struct {
+	Results []struct {
+		CheckID string `json:"check_id"`
+		Path    string `json:"path"`
+		Start   struct {
+			Line int `json:"line"`
+		} `json:"start"`
+		End struct {
+			Line int `json:"line"`
+		} `json:"end"`
+		Extra struct {
+			Message  string `json:"message"`
+			Severity string `json:"severity"`
+			Metadata struct {
+				Source     string          `json:"source"`
+				References json.RawMessage `json:"references"`
+			} `json:"metadata"`
+		} `json:"extra"`
+	} `json:"results"`
+}
+
+// isSemgrep reports whether the top level fields of a report are those of semgrep --json,
+// results with a check_id and path along with the errors of the scan
+func isSemgrep(fields map[string]json.RawMessage) bool {
+	_, errors := fields["errors"]
+	var results []map[string]json.RawMessage
+	if !errors || json.Unmarshal(fields["results"], &results) != nil {
+		return false
+	}
+	if len(results) == 0 {
+		return true
+	}
+	_, checkID := results[0]["check_id"]
+	_, path := results[0]["path"]
+	return checkID && path
+}
+
+// parseSemgrep maps the results of a semgrep --json report onto the misconfigurations of a
+// Trivy report, one result per file, so its SAST findings are commented like trivy's IaC
+// ones. The message of a result is its description, and its rule's source the link.
+func parseSemgrep(data []byte) ([]Result, error) {
+	var report semgrepReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	byTarget := make(map[string]*Result)
+	for _, result := range report.Results {
+		r, ok := byTarget[result.Path]
+		if !ok {
+			r = &Result{Target: result.Path, Class: "config", Type: "semgrep"}
+			byTarget[result.Path] = r
+		}
+		endLine := result.End.Line
+		if endLine < result.Start.Line {
+			endLine = result.Start.Line
+		}
+		// references are a list of URLs, or a single one for some rules
+		var references []string
+		if err := json.Unmarshal(result.Extra.Metadata.References, &references); err != nil {
+			var reference string
+			if json.Unmarshal(result.Extra.Metadata.References, &reference) == nil && reference != "" {
+				references = []string{reference}
+			}
+		}
+		primary := result.Extra.Metadata.Source
+		if primary == "" && len(references) > 0 {
+			primary = references[0]
+		} else if primary != "" {
+			references = append([]string{primary}, references...)
+		}
+		message := strings.TrimSpace(result.Extra.Message)
+		r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+			Type:          "semgrep",
+			ID:            result.CheckID,
+			AVDID:         result.CheckID,
+			Title:         semgrepRuleName(result.CheckID),
+			Description:   message,
+			Message:       message,
+			Severity:      scannerSeverity(result.Extra.Severity),
+			PrimaryURL:    primary,
+			References:    references,
+			Status:        "FAIL",
+			CauseMetadata: CauseMetadata{StartLine: result.Start.Line, EndLine: endLine},
+		})
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+// semgrepRuleName is the name of a rule without the registry path it's prefixed with, e.g.
+// sqlalchemy-execute-raw-query of python.sqlalchemy.security.sqlalchemy-execute-raw-query
+func semgrepRuleName(checkID string) string {
+	return checkID[strings.LastIndex(checkID, ".")+1:]
+}
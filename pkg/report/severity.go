@@ -0,0 +1,45 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities in ascending order, as reported by trivy
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// SeverityRank orders severities, unrecognised values rank as UNKNOWN
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return 0
+}
+
+// ParseSeverity normalises a user supplied severity
+func ParseSeverity(severity string) (string, error) {
+	for _, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown severity %q, expected one of %s", severity, strings.Join(Severities, ", "))
+}
+
+// lintLevels are the severities of the scanners that rate their findings as levels, such as
+// tfsec releases before 0.40, semgrep and hadolint
+var lintLevels = map[string]string{"error": "HIGH", "warning": "MEDIUM", "info": "LOW", "style": "LOW"}
+
+// scannerSeverity is the severity of a finding of another scanner, rated as a severity or a
+// level, or UNKNOWN
+func scannerSeverity(severity string) string {
+	if parsed, err := ParseSeverity(severity); err == nil {
+		return parsed
+	}
+	if parsed, ok := lintLevels[strings.ToLower(severity)]; ok {
+		return parsed
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,43 @@
+package report
+
+import "testing"
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     string
+		wantErr  bool
+	}{
+		{severity: "CRITICAL", want: "CRITICAL"},
+		{severity: "high", want: "HIGH"},
+		{severity: "Medium", want: "MEDIUM"},
+		{severity: "unknown", want: "UNKNOWN"},
+		{severity: "severe", wantErr: true},
+		{severity: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeverity(tt.severity)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %q, %v, want %q, error %t", tt.severity, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	for i := 1; i < len(Severities); i++ {
+		if SeverityRank(Severities[i-1]) >= SeverityRank(Severities[i]) {
+			t.Errorf("%s doesn't rank below %s", Severities[i-1], Severities[i])
+		}
+	}
+	if SeverityRank("severe") != SeverityRank("UNKNOWN") || SeverityRank("critical") != SeverityRank("CRITICAL") {
+		t.Error("an unrecognised or lowercase severity ranks wrong")
+	}
+}
+
+func TestScannerSeverity(t *testing.T) {
+	for severity, want := range map[string]string{"HIGH": "HIGH", "error": "HIGH", "WARNING": "MEDIUM", "info": "LOW", "style": "LOW", "note": "UNKNOWN"} {
+		if got := scannerSeverity(severity); got != want {
+			t.Errorf("scannerSeverity(%q) = %q, want %q", severity, got, want)
+		}
+	}
+}
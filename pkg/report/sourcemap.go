@@ -0,0 +1,123 @@
+package report
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceRule maps the targets of a build, such as a packaged CloudFormation template, a nested
+// stack or the ARM template compiled from Bicep, onto the authored file they were built from
+type SourceRule struct {
+	// Target matches the whole report target
+	Target *regexp.Regexp
+	// Source is the authored file, expanded with the submatches of Target, e.g. $1
+	Source string
+	// ByResource finds the lines of the finding's resource in the source instead of keeping
+	// the lines, for builds that don't keep the layout of the source
+	ByResource bool
+}
+
+// MapSources moves the findings on a target matching a rule onto its source, the first
+// matching rule wins. A finding whose resource can't be found in the source is anchored on
+// the source's first line.
+func MapSources(findings []Finding, rules []SourceRule, read func(target string) ([]byte, error)) []Finding {
+	if len(rules) == 0 {
+		return findings
+	}
+	contents := make(map[string][]string)
+	mapped := make([]Finding, len(findings))
+	for i, f := range findings {
+		mapped[i] = f
+		for _, rule := range rules {
+			m := rule.Target.FindStringSubmatchIndex(f.Target)
+			if m == nil || m[0] != 0 || m[1] != len(f.Target) {
+				continue
+			}
+			source := string(rule.Target.ExpandString(nil, rule.Source, f.Target, m))
+			mapped[i].Target = source
+			if rule.ByResource && f.StartLine > 0 {
+				lines, ok := contents[source]
+				if !ok {
+					if data, err := read(source); err == nil {
+						lines = strings.Split(string(data), "\n")
+					}
+					contents[source] = lines
+				}
+				start, end, ok := LocateResource(source, lines, f.Resource)
+				if !ok {
+					start, end = 1, 1
+				}
+				mapped[i].StartLine, mapped[i].EndLine = start, end
+				mapped[i].Code = nil
+			}
+			break
+		}
+	}
+	SortFindings(mapped)
+	return mapped
+}
+
+var (
+	bicepResource = regexp.MustCompile(`^\s*resource\s+(\S+)\s+'[^']*'`)
+	bicepName     = regexp.MustCompile(`^\s*name:\s*'([^']*)'`)
+)
+
+// LocateResource finds the declaration of a resource in a template: the logical ID of a
+// CloudFormation template in YAML or JSON, or the symbolic name or name of a Bicep resource
+func LocateResource(filename string, lines []string, resource string) (int, int, bool) {
+	if resource == "" {
+		return 0, 0, false
+	}
+	switch path.Ext(filename) {
+	case ".bicep":
+		declaration := -1
+		for i, line := range lines {
+			if m := bicepResource.FindStringSubmatch(line); m != nil {
+				declaration = i
+				if m[1] == resource {
+					return bicepBlock(lines, i)
+				}
+			}
+			if m := bicepName.FindStringSubmatch(line); m != nil && m[1] == resource && declaration >= 0 {
+				return bicepBlock(lines, declaration)
+			}
+		}
+	case ".json":
+		start, end := jsonBlock(lines, func(line string) bool {
+			return strings.HasPrefix(strings.TrimSpace(line), `"`+resource+`": {`)
+		}, "")
+		return start, end, start > 0
+	default:
+		for i, line := range lines {
+			if strings.TrimSpace(line) != resource+":" {
+				continue
+			}
+			indent, _ := yamlIndent(line)
+			end := i
+			for j := i + 1; j < len(lines); j++ {
+				if strings.TrimSpace(lines[j]) == "" {
+					continue
+				}
+				if k, _ := yamlIndent(lines[j]); k <= indent {
+					break
+				}
+				end = j
+			}
+			return i + 1, end + 1, true
+		}
+	}
+	return 0, 0, false
+}
+
+func bicepBlock(lines []string, start int) (int, int, bool) {
+	depth, opened := 0, false
+	for j := start; j < len(lines); j++ {
+		depth += strings.Count(lines[j], "{") - strings.Count(lines[j], "}")
+		opened = opened || strings.Contains(lines[j], "{")
+		if opened && depth <= 0 {
+			return start + 1, j + 1, true
+		}
+	}
+	return start + 1, start + 1, true
+}
@@ -0,0 +1,132 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// spdxAdvisoryID is a vulnerability ID at the end of an advisory URL, e.g.
+// https://nvd.nist.gov/vuln/detail/CVE-2021-23337
+var spdxAdvisoryID = regexp.MustCompile(`^(CVE-\d+-\d+|GHSA(-[0-9a-z]{4}){3}|[A-Z]+-\d{4}[-:][0-9A-Za-z:-]+)$`)
+
+// isSPDX reports whether the top level fields of a report are those of an SPDX document
+func isSPDX(fields map[string]json.RawMessage) bool {
+	_, ok := fields["spdxVersion"]
+	return ok
+}
+
+// parseSPDXReport maps an SPDX JSON document, e.g. from trivy fs --format spdx-json, onto the
+// results of a Trivy report. Each application or operating system package is a result with
+// the packages it contains, from the relationships or the sourceInfo trivy writes (package
+// found in: package-lock.json). SPDX has no severities, so the advisories of a package's
+// SECURITY references are its vulnerabilities at UNKNOWN severity.
+func parseSPDXReport(data []byte) ([]Result, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	packages := make(map[string]spdxPackage, len(doc.Packages))
+	for _, p := range doc.Packages {
+		packages[p.SPDXID] = p
+	}
+	owners := make(map[string]string)
+	for _, r := range doc.Relationships {
+		owner, pkg := r.Element, r.Related
+		if r.Type == "CONTAINED_BY" || r.Type == "DEPENDENCY_OF" {
+			owner, pkg = pkg, owner
+		}
+		switch r.Type {
+		case "CONTAINS", "DEPENDS_ON", "CONTAINED_BY", "DEPENDENCY_OF":
+			if isSPDXTarget(packages[owner]) && !isSPDXTarget(packages[pkg]) {
+				if _, ok := owners[pkg]; !ok {
+					owners[pkg] = owner
+				}
+			}
+		}
+	}
+
+	byTarget := make(map[string]*Result)
+	for _, p := range doc.Packages {
+		purl := p.purl()
+		if purl == "" || isSPDXTarget(p) {
+			continue
+		}
+		target, class := spdxTarget(p, packages[owners[p.SPDXID]])
+		r, ok := byTarget[target]
+		if !ok {
+			r = &Result{Target: target, Class: class}
+			byTarget[target] = r
+		}
+		name := dependencyName(purl, "", p.Name)
+		r.Packages = append(r.Packages, Package{
+			ID: p.SPDXID, Name: name, Version: p.VersionInfo, Identifier: PkgIdentifier{PURL: purl, UID: p.SPDXID},
+		})
+		seen := make(map[string]bool)
+		for _, ref := range p.ExternalRefs {
+			if ref.ReferenceCategory != "SECURITY" || ref.ReferenceType != "advisory" {
+				continue
+			}
+			id := spdxVulnerabilityID(ref.ReferenceLocator)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+				VulnerabilityID:  id,
+				PkgID:            p.SPDXID,
+				PkgName:          name,
+				InstalledVersion: p.VersionInfo,
+				Description:      fmt.Sprintf("%s %s is affected by %s, the SBOM doesn't rate its severity", name, p.VersionInfo, id),
+				Severity:         "UNKNOWN",
+				PrimaryURL:       ref.ReferenceLocator,
+				References:       []string{ref.ReferenceLocator},
+			})
+		}
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
+
+// isSPDXTarget reports whether the package is what trivy scans packages in rather than a
+// package: a lockfile or manifest, or an operating system
+func isSPDXTarget(p spdxPackage) bool {
+	return p.PrimaryPackagePurpose == "APPLICATION" || p.PrimaryPackagePurpose == "OPERATING-SYSTEM"
+}
+
+// spdxTarget is the target and class of the result of a package, its owner's name or else the
+// file of its sourceInfo
+func spdxTarget(p, owner spdxPackage) (string, string) {
+	class := "lang-pkgs"
+	if owner.PrimaryPackagePurpose == "OPERATING-SYSTEM" {
+		class = "os-pkgs"
+	}
+	switch {
+	case owner.Name != "" && owner.PrimaryPackagePurpose == "OPERATING-SYSTEM" && owner.VersionInfo != "":
+		return owner.Name + " " + owner.VersionInfo, class
+	case owner.Name != "":
+		return owner.Name, class
+	}
+	if _, file, ok := strings.Cut(p.SourceInfo, "package found in: "); ok {
+		return strings.TrimSpace(file), class
+	}
+	return "sbom", class
+}
+
+// spdxVulnerabilityID is the vulnerability ID an advisory URL ends with, the URL itself when it
+// ends with none
+func spdxVulnerabilityID(locator string) string {
+	trimmed, _, _ := strings.Cut(locator, "?")
+	if id := path.Base(strings.TrimSuffix(trimmed, "/")); spdxAdvisoryID.MatchString(id) {
+		return id
+	}
+	return locator
+}
@@ -0,0 +1,79 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+const spdxReport = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"SPDXID": "SPDXRef-Application-lock", "name": "web/package-lock.json", "primaryPackagePurpose": "APPLICATION"},
+    {"SPDXID": "SPDXRef-lodash", "name": "lodash", "versionInfo": "4.17.20", "externalRefs": [
+      {"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:npm/lodash@4.17.20"},
+      {"referenceCategory": "SECURITY", "referenceType": "advisory", "referenceLocator": "https://nvd.nist.gov/vuln/detail/CVE-2021-23337"},
+      {"referenceCategory": "SECURITY", "referenceType": "advisory", "referenceLocator": "https://github.com/advisories/CVE-2021-23337/"}
+    ]},
+    {"SPDXID": "SPDXRef-OperatingSystem", "name": "debian", "versionInfo": "12.2", "primaryPackagePurpose": "OPERATING-SYSTEM"},
+    {"SPDXID": "SPDXRef-openssl", "name": "openssl", "versionInfo": "3.0.11-1", "externalRefs": [
+      {"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:deb/debian/openssl@3.0.11-1"},
+      {"referenceCategory": "SECURITY", "referenceType": "advisory", "referenceLocator": "https://security-tracker.debian.org/tracker/DSA-5532-1"}
+    ]},
+    {"SPDXID": "SPDXRef-net", "name": "golang.org/x/net", "versionInfo": "v0.17.0", "sourceInfo": "package found in: go.mod", "externalRefs": [
+      {"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/golang.org/x/net@v0.17.0"}
+    ]},
+    {"SPDXID": "SPDXRef-File", "name": "README.md"}
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-Application-lock", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-lodash"},
+    {"spdxElementId": "SPDXRef-openssl", "relationshipType": "CONTAINED_BY", "relatedSpdxElement": "SPDXRef-OperatingSystem"}
+  ]
+}`
+
+func TestParseSPDXReport(t *testing.T) {
+	results, err := parseSPDXReport([]byte(spdxReport))
+	if err != nil {
+		t.Fatalf("parseSPDXReport: %v", err)
+	}
+
+	byTarget := make(map[string]Result)
+	var targets []string
+	for _, r := range results {
+		byTarget[r.Target] = r
+		targets = append(targets, r.Target)
+	}
+	if got := strings.Join(targets, ", "); got != "debian 12.2, go.mod, web/package-lock.json" {
+		t.Fatalf("got the targets %s, want those of the relationships and the sourceInfo", got)
+	}
+
+	lock := byTarget["web/package-lock.json"]
+	if lock.Class != "lang-pkgs" || len(lock.Packages) != 1 || len(lock.Vulnerabilities) != 1 {
+		t.Fatalf("got the lockfile's result %+v, want lodash with one vulnerability", lock)
+	}
+	if v := lock.Vulnerabilities[0]; v.VulnerabilityID != "CVE-2021-23337" || v.PkgName != "lodash" || v.InstalledVersion != "4.17.20" ||
+		v.Severity != "UNKNOWN" || v.PrimaryURL != "https://nvd.nist.gov/vuln/detail/CVE-2021-23337" {
+		t.Errorf("got the lodash vulnerability %+v", v)
+	}
+
+	system := byTarget["debian 12.2"]
+	if system.Class != "os-pkgs" || len(system.Vulnerabilities) != 1 || system.Vulnerabilities[0].VulnerabilityID != "DSA-5532-1" ||
+		system.Vulnerabilities[0].PkgName != "openssl" {
+		t.Errorf("got the system's result %+v", system)
+	}
+	if mod := byTarget["go.mod"]; len(mod.Packages) != 1 || mod.Packages[0].Name != "golang.org/x/net" || len(mod.Vulnerabilities) != 0 {
+		t.Errorf("got the go.mod result %+v", mod)
+	}
+}
+
+func TestSPDXVulnerabilityID(t *testing.T) {
+	for locator, want := range map[string]string{
+		"https://nvd.nist.gov/vuln/detail/CVE-2021-23337":         "CVE-2021-23337",
+		"https://github.com/advisories/GHSA-35jh-r3h4-6jhm/":      "GHSA-35jh-r3h4-6jhm",
+		"https://access.redhat.com/errata/RHSA-2023:5455?lang=en": "RHSA-2023:5455",
+		"https://example.com/advisories/42":                       "https://example.com/advisories/42",
+	} {
+		if got := spdxVulnerabilityID(locator); got != want {
+			t.Errorf("spdxVulnerabilityID(%q) = %q, want %q", locator, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"regexp"
+	"strings"
+)
+
+// terraformFix sets an attribute of the resource a check points at
+type terraformFix struct {
+	attribute string
+	value     string
+}
+
+// terraformFixes are the fixes of the common Terraform checks whose resolution is setting a
+// single attribute of the resource, keyed by their AVD ID
+var terraformFixes = map[string]terraformFix{
+	"AVD-AWS-0014": {attribute: "is_multi_region_trail", value: "true"},
+	"AVD-AWS-0016": {attribute: "enable_log_file_validation", value: "true"},
+	"AVD-AWS-0026": {attribute: "encrypted", value: "true"},
+	"AVD-AWS-0031": {attribute: "image_tag_mutability", value: `"IMMUTABLE"`},
+	"AVD-AWS-0065": {attribute: "enable_key_rotation", value: "true"},
+	"AVD-AWS-0080": {attribute: "storage_encrypted", value: "true"},
+	"AVD-AWS-0086": {attribute: "block_public_acls", value: "true"},
+	"AVD-AWS-0087": {attribute: "block_public_policy", value: "true"},
+	"AVD-AWS-0091": {attribute: "ignore_public_acls", value: "true"},
+	"AVD-AWS-0093": {attribute: "restrict_public_buckets", value: "true"},
+	"AVD-AWS-0176": {attribute: "iam_database_authentication_enabled", value: "true"},
+	"AVD-AWS-0177": {attribute: "deletion_protection", value: "true"},
+	"AVD-AZU-0008": {attribute: "enable_https_traffic_only", value: "true"},
+	"AVD-AZU-0011": {attribute: "min_tls_version", value: `"TLS1_2"`},
+}
+
+var (
+	// the first line of a resource block, e.g. resource "aws_s3_bucket" "b" {
+	terraformResourceLine = regexp.MustCompile(`^\s*resource\s+"[^"]+"\s+"[^"]+"\s*\{\s*$`)
+	// an attribute assignment, with its indentation and name
+	terraformAttributeLine = regexp.MustCompile(`^(\s*)([A-Za-z_][A-Za-z0-9_-]*)\s*=`)
+)
+
+// SuggestTerraformFixes sets the suggestion of the findings of the common Terraform checks to
+// their lines with the attribute set. The cause lines of a finding are either the attribute,
+// whose value is replaced, or the resource missing it, where it's added after the other
+// attributes.
+func SuggestTerraformFixes(findings []Finding, read func(target string) ([]byte, error)) []Finding {
+	contents := make(map[string][]string)
+	suggested := make([]Finding, len(findings))
+	for i, f := range findings {
+		suggested[i] = f
+		fix, ok := terraformFixes[f.AVDID]
+		if !ok {
+			fix, ok = terraformFixes[f.ID]
+		}
+		if !ok || f.Suggestion != "" || !strings.HasSuffix(f.Target, ".tf") || f.StartLine < 1 || f.EndLine < f.StartLine {
+			continue
+		}
+		lines, ok := contents[f.Target]
+		if !ok {
+			if data, err := read(f.Target); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			contents[f.Target] = lines
+		}
+		if f.EndLine > len(lines) {
+			continue
+		}
+		if fixed, ok := fixTerraformBlock(lines[f.StartLine-1:f.EndLine], fix); ok {
+			suggested[i].Suggestion = strings.Join(fixed, "\n")
+		}
+	}
+	return suggested
+}
+
+// fixTerraformBlock applies the fix to the lines of a finding, false when they are neither the
+// attribute nor a single resource block
+func fixTerraformBlock(block []string, fix terraformFix) ([]string, bool) {
+	fixed := append([]string(nil), block...)
+	if len(block) == 1 {
+		if m := terraformAttributeLine.FindStringSubmatch(block[0]); m != nil && m[2] == fix.attribute {
+			fixed[0] = m[1] + fix.attribute + " = " + fix.value
+			return fixed, true
+		}
+		return nil, false
+	}
+	if !terraformResourceLine.MatchString(block[0]) || strings.TrimSpace(block[len(block)-1]) != "}" {
+		return nil, false
+	}
+
+	indent := leadingSpace(block[0]) + "  "
+	depth := 0
+	for i, line := range block[1 : len(block)-1] {
+		if depth == 0 {
+			if m := terraformAttributeLine.FindStringSubmatch(line); m != nil {
+				indent = m[1]
+				if m[2] == fix.attribute {
+					fixed[i+1] = m[1] + fix.attribute + " = " + fix.value
+					return fixed, true
+				}
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth < 0 {
+			// the block closed before its last line, it's more than one resource
+			return nil, false
+		}
+	}
+	if depth != 0 {
+		return nil, false
+	}
+	last := len(fixed) - 1
+	return append(fixed[:last:last], indent+fix.attribute+" = "+fix.value, fixed[last]), true
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+type tfsecReport struct {
+	Results []tfsecResult `json:"results"`
+}
+
+type tfsecResult struct {
+	RuleID          string   `json:"rule_id"`
+	LongID          string   `json:"long_id"`
+	RuleDescription string   `json:"rule_description"`
+	RuleProvider    string   `json:"rule_provider"`
+	RuleService     string   `json:"rule_service"`
+	Impact          string   `json:"impact"`
+	Resolution      string   `json:"resolution"`
+	Links           []string `json:"links"`
+	Description     string   `json:"description"`
+	Severity        string   `json:"severity"`
+	Resource        string   `json:"resource"`
+	Location        struct {
+		Filename  string `json:"filename"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	} `json:"location"`
+}
+
+// isTfsec reports whether the top level fields of a report are those of a tfsec report, whose
+// results have a location where trivy's have a Target
+func isTfsec(fields map[string]json.RawMessage) bool {
+	raw, ok := fields["results"]
+	if !ok {
+		return false
+	}
+	if _, checkov := fields["check_type"]; checkov {
+		return false
+	}
+	var results []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return false
+	}
+	if len(results) == 0 {
+		return true
+	}
+	_, location := results[0]["location"]
+	return location
+}
+
+// parseTfsec maps the results of a tfsec --format json report onto the misconfigurations of a
+// Trivy report, one result per file. The long ID, e.g. aws-s3-block-public-acls, is the rule
+// the comments name, as it's what tfsec:ignore comments take, and the AVD ID the rule ID.
+func parseTfsec(data []byte) ([]Result, error) {
+	var report tfsecReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	byTarget := make(map[string]*Result)
+	for _, result := range report.Results {
+		target := result.Location.Filename
+		r, ok := byTarget[target]
+		if !ok {
+			r = &Result{Target: target, Class: "config", Type: "terraform"}
+			byTarget[target] = r
+		}
+		id := result.LongID
+		if id == "" {
+			id = result.RuleID
+		}
+		description := result.Description
+		if description == "" {
+			description = result.RuleDescription
+		}
+		var primary string
+		if len(result.Links) > 0 {
+			primary = result.Links[0]
+		}
+		endLine := result.Location.EndLine
+		if endLine < result.Location.StartLine {
+			endLine = result.Location.StartLine
+		}
+		r.Misconfigurations = append(r.Misconfigurations, Misconfiguration{
+			Type:        "terraform",
+			ID:          id,
+			AVDID:       result.RuleID,
+			Title:       result.RuleDescription,
+			Description: description,
+			Message:     description,
+			Resolution:  result.Resolution,
+			Severity:    scannerSeverity(result.Severity),
+			PrimaryURL:  primary,
+			References:  result.Links,
+			Status:      "FAIL",
+			CauseMetadata: CauseMetadata{
+				Resource:  result.Resource,
+				Provider:  result.RuleProvider,
+				Service:   result.RuleService,
+				StartLine: result.Location.StartLine,
+				EndLine:   endLine,
+			},
+		})
+	}
+
+	results := make([]Result, 0, len(byTarget))
+	for _, r := range byTarget {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Target < results[j].Target })
+	return results, nil
+}
@@ -0,0 +1,149 @@
+package report
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// UpgradeLine rewrites the manifest line declaring the vulnerable package of the finding to
+// require its fixed version, for a suggestion that remediates it in one click. Only go.mod,
+// package.json and requirements*.txt declare a package on a line of its own the author edits,
+// false is returned for any other file and for lines the rewrite can't be sure about.
+func UpgradeLine(filename, line string, f Finding) (string, bool) {
+	fixed := FixedVersion(f.InstalledVersion, f.FixedVersion)
+	if f.PkgName == "" || fixed == "" {
+		return "", false
+	}
+	base := path.Base(filename)
+	switch {
+	case base == "go.mod":
+		return upgradeGoMod(line, f.PkgName, fixed)
+	case base == "package.json":
+		return upgradePackageJSON(line, f.PkgName, fixed)
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		return upgradeRequirement(line, f.PkgName, fixed)
+	}
+	return "", false
+}
+
+// FixedVersion picks the version to upgrade to from Trivy's list of fixed versions, which has
+// one per release line, e.g. "2.2.1, 3.0.1". The lowest one above the installed version is the
+// smallest upgrade, empty when none is.
+func FixedVersion(installed, fixed string) string {
+	var best string
+	for _, candidate := range strings.Split(fixed, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" || compareVersions(candidate, installed) <= 0 {
+			continue
+		}
+		if best == "" || compareVersions(candidate, best) < 0 {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func upgradeGoMod(line, name, fixed string) (string, bool) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "require "))
+	if len(fields) < 2 || fields[0] != name {
+		return "", false
+	}
+	if !strings.HasPrefix(fixed, "v") {
+		fixed = "v" + fixed
+	}
+	i := strings.Index(line, name+" "+fields[1])
+	if i < 0 {
+		return "", false
+	}
+	i += len(name) + 1
+	return line[:i] + fixed + line[i+len(fields[1]):], true
+}
+
+func upgradePackageJSON(line, name, fixed string) (string, bool) {
+	key := `"` + name + `": "`
+	i := strings.Index(line, key)
+	if i < 0 {
+		return "", false
+	}
+	start := i + len(key)
+	end := strings.IndexByte(line[start:], '"')
+	if end < 0 {
+		return "", false
+	}
+	value := line[start : start+end]
+	// keep the range operator, anything but a plain version such as a tag or URL is left alone
+	version := strings.TrimLeft(value, "^~>=v")
+	if !isVersion(version) {
+		return "", false
+	}
+	prefix := value[:len(value)-len(version)]
+	return line[:start] + prefix + strings.TrimPrefix(fixed, "v") + line[start+end:], true
+}
+
+func upgradeRequirement(line, name, fixed string) (string, bool) {
+	requirement, comment, _ := strings.Cut(line, "#")
+	if strings.Contains(requirement, ",") || strings.Contains(requirement, ";") {
+		// several specifiers or an environment marker, too many ways to get it wrong
+		return "", false
+	}
+	for _, operator := range []string{"==", "~=", ">="} {
+		pkg, version, ok := strings.Cut(requirement, operator)
+		if !ok {
+			continue
+		}
+		if normalizePythonName(strings.TrimSpace(pkg)) != normalizePythonName(name) || !isVersion(strings.TrimSpace(version)) {
+			return "", false
+		}
+		upgraded := strings.TrimRight(pkg, " ") + operator + fixed
+		if comment != "" {
+			trailing := requirement[len(strings.TrimRight(requirement, " \t")):]
+			upgraded += trailing + "#" + comment
+		}
+		return upgraded, true
+	}
+	return "", false
+}
+
+func isVersion(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9' && strings.Trim(s, "0123456789.-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+// compareVersions orders dotted versions by their numeric parts, enough to choose between the
+// fixed versions of a single package
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	// a pre-release or build suffix doesn't take part in the comparison
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
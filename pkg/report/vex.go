@@ -0,0 +1,360 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// VEX statuses that say a product isn't exploitable through a vulnerability
+const (
+	VEXNotAffected = "not_affected"
+	VEXFixed       = "fixed"
+)
+
+// VEX actions, what ApplyVEX does with a finding a statement covers
+const (
+	// VEXSuppress leaves the finding out of the comments and the gate, listing it in the summary
+	VEXSuppress = "suppress"
+	// VEXDowngrade lowers the finding to LOW
+	VEXDowngrade = "downgrade"
+)
+
+// VEXStatement is a statement of an OpenVEX or CSAF document that products are not affected
+// by a vulnerability, or have it fixed
+type VEXStatement struct {
+	// Vulnerability is the ID the statement is about, with its Aliases
+	Vulnerability string
+	Aliases       []string
+	// Products are the product IDs, usually package URLs, the statement covers, empty for
+	// every product
+	Products []string
+	Status   string
+	// Justification is the machine readable reason, e.g. vulnerable_code_not_in_execute_path,
+	// and Statement the text explaining it
+	Justification string
+	Statement     string
+	// Document is where the statement was read from
+	Document string
+}
+
+// Reason is the justification and statement, for showing next to the status
+func (s VEXStatement) Reason() string {
+	switch {
+	case s.Justification != "" && s.Statement != "":
+		return s.Justification + ": " + s.Statement
+	case s.Justification != "":
+		return s.Justification
+	}
+	return s.Statement
+}
+
+// ParseVEX reads the not_affected and fixed statements of an OpenVEX or CSAF VEX document,
+// the source is recorded as their Document
+func ParseVEX(data []byte, source string) ([]VEXStatement, error) {
+	var probe struct {
+		Context    any             `json:"@context"`
+		Statements json.RawMessage `json:"statements"`
+		Document   *struct {
+			CSAFVersion string `json:"csaf_version"`
+		} `json:"document"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.Statements != nil:
+		return parseOpenVEX(data, source)
+	case probe.Document != nil && probe.Document.CSAFVersion != "":
+		return parseCSAF(data, source)
+	}
+	return nil, errors.New("not an OpenVEX or CSAF document")
+}
+
+type openVEXDocument struct {
+	Statements []struct {
+		// a plain ID in early versions of the spec, an object since 0.2
+		Vulnerability json.RawMessage   `json:"vulnerability"`
+		Products      []json.RawMessage `json:"products"`
+		Status        string            `json:"status"`
+		Justification string            `json:"justification"`
+		Impact        string            `json:"impact_statement"`
+		Notes         string            `json:"status_notes"`
+	} `json:"statements"`
+}
+
+type openVEXProduct struct {
+	ID            string `json:"@id"`
+	Subcomponents []struct {
+		ID string `json:"@id"`
+	} `json:"subcomponents"`
+}
+
+func parseOpenVEX(data []byte, source string) ([]VEXStatement, error) {
+	var doc openVEXDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var statements []VEXStatement
+	for _, s := range doc.Statements {
+		if s.Status != VEXNotAffected && s.Status != VEXFixed {
+			continue
+		}
+		statement := VEXStatement{Status: s.Status, Justification: s.Justification, Statement: s.Impact, Document: source}
+		if statement.Statement == "" {
+			statement.Statement = s.Notes
+		}
+		var vulnerability struct {
+			Name    string   `json:"name"`
+			ID      string   `json:"@id"`
+			Aliases []string `json:"aliases"`
+		}
+		if err := json.Unmarshal(s.Vulnerability, &statement.Vulnerability); err != nil {
+			if err := json.Unmarshal(s.Vulnerability, &vulnerability); err != nil {
+				return nil, fmt.Errorf("statement of %s has an invalid vulnerability: %w", source, err)
+			}
+			statement.Vulnerability, statement.Aliases = vulnerability.Name, vulnerability.Aliases
+			if statement.Vulnerability == "" {
+				statement.Vulnerability = vulnerability.ID
+			}
+		}
+		for _, raw := range s.Products {
+			var id string
+			if json.Unmarshal(raw, &id) == nil {
+				statement.Products = append(statement.Products, id)
+				continue
+			}
+			var product openVEXProduct
+			if err := json.Unmarshal(raw, &product); err != nil {
+				return nil, fmt.Errorf("statement on %s of %s has an invalid product: %w", statement.Vulnerability, source, err)
+			}
+			// the statement is about the subcomponents of the product when it names them
+			if len(product.Subcomponents) == 0 {
+				statement.Products = append(statement.Products, product.ID)
+			}
+			for _, sub := range product.Subcomponents {
+				statement.Products = append(statement.Products, sub.ID)
+			}
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+type csafDocument struct {
+	ProductTree     csafBranch `json:"product_tree"`
+	Vulnerabilities []struct {
+		CVE           string `json:"cve"`
+		ProductStatus struct {
+			KnownNotAffected []string `json:"known_not_affected"`
+			Fixed            []string `json:"fixed"`
+			FirstFixed       []string `json:"first_fixed"`
+		} `json:"product_status"`
+		Flags []struct {
+			Label      string   `json:"label"`
+			ProductIDs []string `json:"product_ids"`
+		} `json:"flags"`
+		Threats []struct {
+			Category   string   `json:"category"`
+			Details    string   `json:"details"`
+			ProductIDs []string `json:"product_ids"`
+		} `json:"threats"`
+		IDs []struct {
+			Text string `json:"text"`
+		} `json:"ids"`
+	} `json:"vulnerabilities"`
+}
+
+type csafProduct struct {
+	ProductID string `json:"product_id"`
+	Helper    struct {
+		PURL string `json:"purl"`
+	} `json:"product_identification_helper"`
+}
+
+type csafBranch struct {
+	Branches         []csafBranch  `json:"branches"`
+	Product          *csafProduct  `json:"product"`
+	FullProductNames []csafProduct `json:"full_product_names"`
+	Relationships    []struct {
+		FullProductName csafProduct `json:"full_product_name"`
+	} `json:"relationships"`
+}
+
+// purls maps the product IDs of the tree to their package URL, where they have one
+func (b csafBranch) purls(ids map[string]string) {
+	add := func(p csafProduct) {
+		if p.ProductID != "" && p.Helper.PURL != "" {
+			ids[p.ProductID] = p.Helper.PURL
+		}
+	}
+	if b.Product != nil {
+		add(*b.Product)
+	}
+	for _, p := range b.FullProductNames {
+		add(p)
+	}
+	for _, r := range b.Relationships {
+		add(r.FullProductName)
+	}
+	for _, branch := range b.Branches {
+		branch.purls(ids)
+	}
+}
+
+func parseCSAF(data []byte, source string) ([]VEXStatement, error) {
+	var doc csafDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	purls := make(map[string]string)
+	doc.ProductTree.purls(purls)
+	products := func(ids []string) []string {
+		var products []string
+		for _, id := range ids {
+			products = append(products, id)
+			if purl, ok := purls[id]; ok {
+				products = append(products, purl)
+			}
+		}
+		return products
+	}
+
+	var statements []VEXStatement
+	for _, v := range doc.Vulnerabilities {
+		var aliases []string
+		for _, id := range v.IDs {
+			aliases = append(aliases, id.Text)
+		}
+		reason := func(ids []string) (string, string) {
+			var justification, details string
+			for _, flag := range v.Flags {
+				if overlaps(flag.ProductIDs, ids) {
+					justification = flag.Label
+				}
+			}
+			for _, threat := range v.Threats {
+				if threat.Category == "impact" && overlaps(threat.ProductIDs, ids) {
+					details = threat.Details
+				}
+			}
+			return justification, details
+		}
+		fixed := append(append([]string(nil), v.ProductStatus.Fixed...), v.ProductStatus.FirstFixed...)
+		for _, status := range []struct {
+			name string
+			ids  []string
+		}{{VEXNotAffected, v.ProductStatus.KnownNotAffected}, {VEXFixed, fixed}} {
+			ids := status.ids
+			if len(ids) == 0 {
+				continue
+			}
+			justification, details := reason(ids)
+			statements = append(statements, VEXStatement{
+				Vulnerability: v.CVE,
+				Aliases:       aliases,
+				Products:      products(ids),
+				Status:        status.name,
+				Justification: justification,
+				Statement:     details,
+				Document:      source,
+			})
+		}
+	}
+	return statements, nil
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		if contains(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyVEX records on each vulnerability the first statement covering it and acts on it. A
+// statement covers a finding when it is about its vulnerability, by ID or alias, and names no
+// products, one of the products given as ours, or the finding's package by package URL.
+func ApplyVEX(findings []Finding, statements []VEXStatement, ours []string, action string) []Finding {
+	if len(statements) == 0 {
+		return findings
+	}
+	applied := make([]Finding, len(findings))
+	for i, f := range findings {
+		applied[i] = f
+		if f.PkgName == "" {
+			continue
+		}
+		for _, s := range statements {
+			if !s.covers(f, ours) {
+				continue
+			}
+			statement := s
+			applied[i].VEX = &statement
+			if action == VEXDowngrade {
+				if SeverityRank(f.Severity) > SeverityRank("LOW") {
+					applied[i].VEXSeverity = f.Severity
+					applied[i].Severity = "LOW"
+				}
+			} else {
+				applied[i].Suppressed = true
+			}
+			break
+		}
+	}
+	return applied
+}
+
+func (s VEXStatement) covers(f Finding, ours []string) bool {
+	if s.Vulnerability != f.ID && !contains(s.Aliases, f.ID) {
+		return false
+	}
+	if len(s.Products) == 0 {
+		return true
+	}
+	for _, product := range s.Products {
+		if contains(ours, product) {
+			return true
+		}
+		// maven names the group with a colon where package URLs use a slash
+		if name, version, ok := purlPackage(product); ok && (name == f.PkgName || strings.ReplaceAll(name, "/", ":") == f.PkgName) &&
+			(version == "" || version == f.InstalledVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// purlPackage returns the package name and version of a package URL, the namespace included
+// in the name as ecosystems such as Go and npm scopes use it, e.g. golang.org/x/net for
+// pkg:golang/golang.org/x/net@v0.1.0. The namespace of an OS package is its distribution,
+// which trivy leaves out of the name: openssl for pkg:apk/alpine/openssl@3.1.3-r0.
+func purlPackage(purl string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return "", "", false
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "?")
+	kind, rest, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", "", false
+	}
+	name, version, _ := strings.Cut(rest, "@")
+	switch strings.ToLower(kind) {
+	case "apk", "deb", "rpm", "alpm":
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if unescaped, err := url.PathUnescape(version); err == nil {
+		version = unescaped
+	}
+	return name, version, true
+}
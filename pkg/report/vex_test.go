@@ -0,0 +1,224 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+const openVEXDocumentJSON = `{
+  "@context": "https://openvex.dev/ns/v0.2.0",
+  "statements": [
+    {
+      "vulnerability": {"name": "CVE-2023-0001", "aliases": ["GHSA-aaaa-bbbb-cccc"]},
+      "products": [{"@id": "pkg:oci/app", "subcomponents": [{"@id": "pkg:npm/%40scope/lib@1.0.0"}]}],
+      "status": "not_affected",
+      "justification": "vulnerable_code_not_in_execute_path",
+      "impact_statement": "the parser is never called"
+    },
+    {"vulnerability": "CVE-2023-0002", "products": ["pkg:golang/golang.org/x/net"], "status": "fixed", "status_notes": "backported"},
+    {"vulnerability": {"@id": "CVE-2023-0003"}, "status": "affected"},
+    {"vulnerability": {"@id": "CVE-2023-0004"}, "status": "not_affected", "justification": "component_not_present"}
+  ]
+}`
+
+const csafDocumentJSON = `{
+  "document": {"csaf_version": "2.0", "category": "csaf_vex"},
+  "product_tree": {"branches": [{"branches": [{"product": {"product_id": "CSAFPID-1", "product_identification_helper": {"purl": "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"}}}]}]},
+  "vulnerabilities": [{
+    "cve": "CVE-2021-44228",
+    "ids": [{"text": "GHSA-jfh8-c2jp-5v3q"}],
+    "product_status": {"known_not_affected": ["CSAFPID-1"], "first_fixed": ["CSAFPID-2"]},
+    "flags": [{"label": "vulnerable_code_not_present", "product_ids": ["CSAFPID-1"]}],
+    "threats": [{"category": "impact", "details": "JNDI lookups are disabled", "product_ids": ["CSAFPID-1"]}]
+  }]
+}`
+
+func TestParseVEX(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []VEXStatement
+	}{
+		{
+			name: "OpenVEX",
+			data: openVEXDocumentJSON,
+			want: []VEXStatement{
+				{Vulnerability: "CVE-2023-0001", Aliases: []string{"GHSA-aaaa-bbbb-cccc"}, Products: []string{"pkg:npm/%40scope/lib@1.0.0"},
+					Status: VEXNotAffected, Justification: "vulnerable_code_not_in_execute_path", Statement: "the parser is never called"},
+				{Vulnerability: "CVE-2023-0002", Products: []string{"pkg:golang/golang.org/x/net"}, Status: VEXFixed, Statement: "backported"},
+				{Vulnerability: "CVE-2023-0004", Status: VEXNotAffected, Justification: "component_not_present"},
+			},
+		},
+		{
+			name: "CSAF",
+			data: csafDocumentJSON,
+			want: []VEXStatement{
+				{Vulnerability: "CVE-2021-44228", Aliases: []string{"GHSA-jfh8-c2jp-5v3q"},
+					Products: []string{"CSAFPID-1", "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"},
+					Status:   VEXNotAffected, Justification: "vulnerable_code_not_present", Statement: "JNDI lookups are disabled"},
+				{Vulnerability: "CVE-2021-44228", Aliases: []string{"GHSA-jfh8-c2jp-5v3q"}, Products: []string{"CSAFPID-2"}, Status: VEXFixed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVEX([]byte(tt.data), "vex.json")
+			if err != nil {
+				t.Fatalf("ParseVEX: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d statements, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				want.Document = "vex.json"
+				if g := got[i]; g.Vulnerability != want.Vulnerability || strings.Join(g.Aliases, ",") != strings.Join(want.Aliases, ",") ||
+					strings.Join(g.Products, ",") != strings.Join(want.Products, ",") || g.Status != want.Status ||
+					g.Justification != want.Justification || g.Statement != want.Statement || g.Document != want.Document {
+					t.Errorf("statement %d is\n%+v\nwant\n%+v", i, g, want)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseVEX([]byte(`{"bomFormat": "CycloneDX"}`), "bom.json"); err == nil {
+		t.Error("parsed a document that isn't VEX")
+	}
+}
+
+func TestApplyVEX(t *testing.T) {
+	finding := func(id, pkg, version string) Finding {
+		return Finding{ID: id, PkgName: pkg, InstalledVersion: version, Severity: "HIGH", Target: "package-lock.json"}
+	}
+	tests := []struct {
+		name      string
+		finding   Finding
+		statement VEXStatement
+		ours      []string
+		covered   bool
+	}{
+		{
+			name:      "not affected",
+			finding:   finding("CVE-2023-0001", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Status: VEXNotAffected},
+			covered:   true,
+		},
+		{
+			name:      "fixed",
+			finding:   finding("CVE-2023-0002", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0002", Status: VEXFixed},
+			covered:   true,
+		},
+		{
+			name:      "by alias",
+			finding:   finding("GHSA-aaaa-bbbb-cccc", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Aliases: []string{"GHSA-aaaa-bbbb-cccc"}, Status: VEXNotAffected},
+			covered:   true,
+		},
+		{
+			name:      "another vulnerability",
+			finding:   finding("CVE-2023-0009", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Status: VEXNotAffected},
+		},
+		{
+			name:      "the package's purl",
+			finding:   finding("CVE-2023-0001", "@scope/lib", "1.0.0"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Products: []string{"pkg:npm/%40scope/lib@1.0.0"}, Status: VEXNotAffected},
+			covered:   true,
+		},
+		{
+			name:      "the purl of another version",
+			finding:   finding("CVE-2023-0001", "@scope/lib", "1.1.0"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Products: []string{"pkg:npm/%40scope/lib@1.0.0"}, Status: VEXNotAffected},
+		},
+		{
+			name:      "the purl of every version",
+			finding:   finding("CVE-2023-0002", "golang.org/x/net", "v0.1.0"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0002", Products: []string{"pkg:golang/golang.org/x/net"}, Status: VEXFixed},
+			covered:   true,
+		},
+		{
+			name:      "a maven purl",
+			finding:   finding("CVE-2021-44228", "org.apache.logging.log4j:log4j-core", "2.14.1"),
+			statement: VEXStatement{Vulnerability: "CVE-2021-44228", Products: []string{"pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"}, Status: VEXNotAffected},
+			covered:   true,
+		},
+		{
+			name:      "an OS package's purl",
+			finding:   finding("CVE-2023-5363", "openssl", "3.1.3-r0"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-5363", Products: []string{"pkg:apk/alpine/openssl@3.1.3-r0?arch=x86_64"}, Status: VEXNotAffected},
+			covered:   true,
+		},
+		{
+			name:      "the purl of another package",
+			finding:   finding("CVE-2023-0001", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Products: []string{"pkg:npm/underscore@1.13.0"}, Status: VEXNotAffected},
+		},
+		{
+			name:      "one of our products",
+			finding:   finding("CVE-2023-0001", "lodash", "4.17.20"),
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Products: []string{"pkg:oci/app"}, Status: VEXNotAffected},
+			ours:      []string{"pkg:oci/app"},
+			covered:   true,
+		},
+		{
+			name:      "not a package",
+			finding:   Finding{ID: "CVE-2023-0001", Severity: "HIGH", Target: "main.tf"},
+			statement: VEXStatement{Vulnerability: "CVE-2023-0001", Status: VEXNotAffected},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressed := ApplyVEX([]Finding{tt.finding}, []VEXStatement{tt.statement}, tt.ours, VEXSuppress)[0]
+			if suppressed.Suppressed != tt.covered || (suppressed.VEX != nil) != tt.covered {
+				t.Errorf("suppressed %t with the statement %v, want %t", suppressed.Suppressed, suppressed.VEX, tt.covered)
+			}
+			if suppressed.Severity != "HIGH" {
+				t.Errorf("suppressing changed the severity to %s", suppressed.Severity)
+			}
+
+			downgraded := ApplyVEX([]Finding{tt.finding}, []VEXStatement{tt.statement}, tt.ours, VEXDowngrade)[0]
+			if downgraded.Suppressed {
+				t.Error("downgrading suppressed the finding")
+			}
+			wantSeverity, wantVEXSeverity := "HIGH", ""
+			if tt.covered {
+				wantSeverity, wantVEXSeverity = "LOW", "HIGH"
+			}
+			if downgraded.Severity != wantSeverity || downgraded.VEXSeverity != wantVEXSeverity {
+				t.Errorf("downgraded to %s from %q, want %s from %q", downgraded.Severity, downgraded.VEXSeverity, wantSeverity, wantVEXSeverity)
+			}
+		})
+	}
+}
+
+func TestApplyVEXKeepsLowerSeverities(t *testing.T) {
+	findings := []Finding{{ID: "CVE-2023-0001", PkgName: "lodash", Severity: "LOW"}, {ID: "CVE-2023-0001", PkgName: "lodash", Severity: "UNKNOWN"}}
+	statements := []VEXStatement{
+		{Vulnerability: "CVE-2023-0001", Status: VEXNotAffected, Document: "first.json"},
+		{Vulnerability: "CVE-2023-0001", Status: VEXFixed, Document: "second.json"},
+	}
+
+	for _, f := range ApplyVEX(findings, statements, nil, VEXDowngrade) {
+		if f.VEXSeverity != "" {
+			t.Errorf("downgraded a %s finding from %s", f.Severity, f.VEXSeverity)
+		}
+		if f.VEX == nil || f.VEX.Document != "first.json" {
+			t.Errorf("recorded the statement %v, want the first covering it", f.VEX)
+		}
+	}
+	if findings[0].VEX != nil {
+		t.Error("ApplyVEX changed the findings it was given")
+	}
+}
+
+func TestVEXStatementReason(t *testing.T) {
+	for want, s := range map[string]VEXStatement{
+		"component_not_present: not shipped": {Justification: "component_not_present", Statement: "not shipped"},
+		"component_not_present":              {Justification: "component_not_present"},
+		"not shipped":                        {Statement: "not shipped"},
+	} {
+		if got := s.Reason(); got != want {
+			t.Errorf("Reason() = %q, want %q", got, want)
+		}
+	}
+}
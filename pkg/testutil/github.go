@@ -0,0 +1,777 @@
+// Package testutil provides an in-memory fake of the GitHub API, so custom providers,
+// formatters and configurations can be tested end to end without a real pull request.
+//
+// Point the commenter at the fake by setting GITHUB_API_URL to its URL, or use Setenv:
+//
+//	gh := testutil.NewFakeGitHub("org", "repo")
+//	defer gh.Close()
+//	gh.AddPullRequest(1, testutil.AddedFile("main.tf", 20))
+//	gh.Setenv(t, 1)
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// File is a file changed by a pull request, Patch is its unified diff
+type File struct {
+	Filename string
+	Status   string
+	Patch    string
+}
+
+// PullRequest is a pull request of the fake repository
+type PullRequest struct {
+	Number  int
+	HeadSHA string
+	Files   []File
+}
+
+type failure struct {
+	status    int
+	remaining int
+}
+
+// FakeGitHub serves the parts of the GitHub API the commenter uses
+type FakeGitHub struct {
+	*httptest.Server
+
+	Owner string
+	Repo  string
+	// Permissions are reported on the repository, nil reports none like an Actions token
+	Permissions map[string]bool
+	// Scopes are reported in X-OAuth-Scopes like a classic token, empty reports none
+	Scopes string
+	// Latency delays every response, to simulate a slow API
+	Latency time.Duration
+	// Login is the user the token belongs to and the author of the comments it writes, empty
+	// answers /user with 403 like an Actions token, whose comments are github-actions[bot]'s
+	Login string
+
+	mu             sync.Mutex
+	pulls          map[int]*PullRequest
+	comments       []*github.PullRequestComment
+	issueComments  []*github.IssueComment
+	reviews        []*github.PullRequestReview
+	resolved       map[string]bool
+	checkRuns      []*github.CheckRun
+	nextID         int64
+	rateLimited    int
+	failures       map[string]*failure
+	requestsByPath map[string]int
+}
+
+// NewFakeGitHub starts a fake GitHub API for the repository, Close it when done
+func NewFakeGitHub(owner, repo string) *FakeGitHub {
+	f := &FakeGitHub{
+		Owner:          owner,
+		Repo:           repo,
+		pulls:          make(map[int]*PullRequest),
+		resolved:       make(map[string]bool),
+		failures:       make(map[string]*failure),
+		requestsByPath: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rate_limit", f.getRateLimit)
+	mux.HandleFunc("GET /user", f.getUser)
+	mux.HandleFunc("GET /repos/{owner}/{repo}", f.getRepository)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", f.getPullRequest)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/files", f.listFiles)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/comments", f.listComments)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/pulls/{number}/comments", f.createComment)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/pulls/comments/{id}", f.editComment)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/pulls/comments/{id}", f.deleteComment)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/reviews", f.listReviews)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/pulls/{number}/reviews", f.createReview)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/pulls/{number}/reviews/{id}", f.editReview)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/reviews/{id}/comments", f.listReviewComments)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}/comments", f.listIssueComments)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/comments", f.createIssueComment)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/issues/comments/{id}", f.editIssueComment)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{sha}/pulls", f.listPullRequestsWithCommit)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/check-runs", f.createCheckRun)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/check-runs/{id}", f.updateCheckRun)
+	mux.HandleFunc("POST /api/graphql", f.graphQL)
+
+	f.Server = httptest.NewServer(f.middleware(mux))
+	return f
+}
+
+// Setenv points the commenter at the fake for a run against the pull request, e.g. with a *testing.T
+func (f *FakeGitHub) Setenv(t interface{ Setenv(key, value string) }, prNumber int) {
+	t.Setenv("GITHUB_API_URL", f.URL)
+	t.Setenv("GITHUB_REPOSITORY", f.Owner+"/"+f.Repo)
+	t.Setenv("INPUT_GITHUB_TOKEN", "fake-token")
+	t.Setenv("INPUT_PR_NUMBER", strconv.Itoa(prNumber))
+}
+
+// AddPullRequest adds an open pull request changing the files
+func (f *FakeGitHub) AddPullRequest(number int, files ...File) *PullRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pr := &PullRequest{Number: number, HeadSHA: fmt.Sprintf("%040d", number), Files: files}
+	f.pulls[number] = pr
+	return pr
+}
+
+// AddedFile is a new file of the given number of lines, so every line can be commented on
+func AddedFile(filename string, lines int) File {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -0,0 +1,%d @@", lines)
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&sb, "\n+line %d", i)
+	}
+	return File{Filename: filename, Status: "added", Patch: sb.String()}
+}
+
+// Comments returns the review comments written so far
+func (f *FakeGitHub) Comments() []*github.PullRequestComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*github.PullRequestComment(nil), f.comments...)
+}
+
+// Resolved reports whether the review thread the comment starts has been resolved
+func (f *FakeGitHub) Resolved(commentID int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resolved[threadID(commentID)]
+}
+
+// IssueComments returns the general PR comments written so far
+func (f *FakeGitHub) IssueComments() []*github.IssueComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*github.IssueComment(nil), f.issueComments...)
+}
+
+// Reviews returns the reviews submitted so far
+func (f *FakeGitHub) Reviews() []*github.PullRequestReview {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*github.PullRequestReview(nil), f.reviews...)
+}
+
+// CheckRuns returns the check runs created so far, with every annotation sent for them
+func (f *FakeGitHub) CheckRuns() []*github.CheckRun {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*github.CheckRun(nil), f.checkRuns...)
+}
+
+// RateLimit answers the next requests with GitHub's primary rate limit response
+func (f *FakeGitHub) RateLimit(requests int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimited = requests
+}
+
+// Fail answers the next requests of the method and path, e.g. "POST /repos/org/repo/pulls/1/comments",
+// with the status code
+func (f *FakeGitHub) Fail(methodAndPath string, status, requests int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[methodAndPath] = &failure{status: status, remaining: requests}
+}
+
+// Requests counts the requests received for the method and path
+func (f *FakeGitHub) Requests(methodAndPath string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requestsByPath[methodAndPath]
+}
+
+// middleware accepts the /api/v3 prefix of Enterprise servers and applies the simulated failures
+func (f *FakeGitHub) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api/v3")
+		key := r.Method + " " + r.URL.Path
+
+		f.mu.Lock()
+		f.requestsByPath[key]++
+		rateLimited := f.rateLimited > 0
+		if rateLimited {
+			f.rateLimited--
+		}
+		failStatus := 0
+		if fail, ok := f.failures[key]; ok && fail.remaining > 0 {
+			fail.remaining--
+			failStatus = fail.status
+		}
+		latency := f.Latency
+		f.mu.Unlock()
+
+		time.Sleep(latency)
+		if rateLimited {
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+			writeError(w, http.StatusForbidden, "API rate limit exceeded")
+			return
+		}
+		if failStatus != 0 {
+			writeError(w, failStatus, http.StatusText(failStatus))
+			return
+		}
+		if f.Scopes != "" {
+			w.Header().Set("X-OAuth-Scopes", f.Scopes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeGitHub) getRateLimit(w http.ResponseWriter, _ *http.Request) {
+	reset := time.Now().Add(time.Hour).Unix()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resources": map[string]any{
+			"core": map[string]any{"limit": 5000, "remaining": 5000, "reset": reset},
+		},
+	})
+}
+
+func (f *FakeGitHub) getUser(w http.ResponseWriter, _ *http.Request) {
+	if f.Login == "" {
+		writeError(w, http.StatusForbidden, "Resource not accessible by integration")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.User{Login: github.String(f.Login)})
+}
+
+// author is the user the comments of the token are written by
+func (f *FakeGitHub) author() *github.User {
+	if f.Login == "" {
+		return &github.User{Login: github.String("github-actions[bot]"), Type: github.String("Bot")}
+	}
+	return &github.User{Login: github.String(f.Login), Type: github.String("User")}
+}
+
+// AddComment adds a review comment by another user, e.g. a reviewer or another bot
+func (f *FakeGitHub) AddComment(prNumber int, login, path string, line int, body string) *github.PullRequestComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	prURL := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", f.URL, f.Owner, f.Repo, prNumber)
+	comment := &github.PullRequestComment{
+		ID: &id, Path: &path, Line: &line, Body: &body, PullRequestURL: &prURL, User: &github.User{Login: &login},
+	}
+	f.comments = append(f.comments, comment)
+	return comment
+}
+
+// AddIssueComment adds a comment on the conversation of the PR by another user
+func (f *FakeGitHub) AddIssueComment(login, body string) *github.IssueComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	comment := &github.IssueComment{ID: &id, Body: &body, User: &github.User{Login: &login}}
+	f.issueComments = append(f.issueComments, comment)
+	return comment
+}
+
+func (f *FakeGitHub) getRepository(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	name := f.Repo
+	fullName := f.Owner + "/" + f.Repo
+	writeJSON(w, http.StatusOK, &github.Repository{Name: &name, FullName: &fullName, Permissions: &f.Permissions})
+}
+
+func (f *FakeGitHub) getPullRequest(w http.ResponseWriter, r *http.Request) {
+	pr, ok := f.pullRequest(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, f.toGithub(pr))
+}
+
+func (f *FakeGitHub) listFiles(w http.ResponseWriter, r *http.Request) {
+	pr, ok := f.pullRequest(w, r)
+	if !ok {
+		return
+	}
+	files := make([]*github.CommitFile, 0, len(pr.Files))
+	for _, file := range pr.Files {
+		filename, status, patch := file.Filename, file.Status, file.Patch
+		if status == "" {
+			status = "modified"
+		}
+		contentsURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", f.URL, f.Owner, f.Repo, filename, pr.HeadSHA)
+		files = append(files, &github.CommitFile{Filename: &filename, Status: &status, Patch: &patch, ContentsURL: &contentsURL})
+	}
+	writeListing(w, r, files)
+}
+
+func (f *FakeGitHub) listComments(w http.ResponseWriter, r *http.Request) {
+	pr, ok := f.pullRequest(w, r)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	comments := []*github.PullRequestComment{}
+	for _, c := range f.comments {
+		if strings.HasSuffix(c.GetPullRequestURL(), fmt.Sprintf("/pulls/%d", pr.Number)) {
+			comments = append(comments, c)
+		}
+	}
+	writeListing(w, r, comments)
+}
+
+func (f *FakeGitHub) createComment(w http.ResponseWriter, r *http.Request) {
+	pr, ok := f.pullRequest(w, r)
+	if !ok {
+		return
+	}
+	var comment github.PullRequestComment
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if comment.Path == nil || comment.Body == nil || !pr.changes(comment.GetPath()) {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	prURL := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", f.URL, f.Owner, f.Repo, pr.Number)
+	comment.ID = &id
+	comment.PullRequestURL = &prURL
+	comment.User = f.author()
+	f.comments = append(f.comments, &comment)
+	writeJSON(w, http.StatusCreated, &comment)
+}
+
+func (f *FakeGitHub) editComment(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var edit github.PullRequestComment
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.comments {
+		if c.GetID() == id {
+			c.Body = edit.Body
+			writeJSON(w, http.StatusOK, c)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (f *FakeGitHub) deleteComment(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, c := range f.comments {
+		if c.GetID() == id {
+			f.comments = append(f.comments[:i], f.comments[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (f *FakeGitHub) listReviews(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.pullRequest(w, r); !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON(w, http.StatusOK, append([]*github.PullRequestReview{}, f.reviews...))
+}
+
+func (f *FakeGitHub) createReview(w http.ResponseWriter, r *http.Request) {
+	pr, ok := f.pullRequest(w, r)
+	if !ok {
+		return
+	}
+	var request github.PullRequestReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// like GitHub, a single comment off the PR's files fails the whole review
+	for _, c := range request.Comments {
+		if c.Path == nil || c.Body == nil || !pr.changes(c.GetPath()) {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	prURL := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", f.URL, f.Owner, f.Repo, pr.Number)
+	for _, c := range request.Comments {
+		f.nextID++
+		commentID := f.nextID
+		htmlURL := fmt.Sprintf("%s/%s/%s/pull/%d#discussion_r%d", f.URL, f.Owner, f.Repo, pr.Number, commentID)
+		f.comments = append(f.comments, &github.PullRequestComment{
+			ID:                  &commentID,
+			HTMLURL:             &htmlURL,
+			User:                f.author(),
+			PullRequestReviewID: &id,
+			Path:                c.Path,
+			Body:                c.Body,
+			StartLine:           c.StartLine,
+			Line:                c.Line,
+			CommitID:            request.CommitID,
+			PullRequestURL:      &prURL,
+		})
+	}
+	state := "COMMENTED"
+	switch request.GetEvent() {
+	case "APPROVE":
+		state = "APPROVED"
+	case "REQUEST_CHANGES":
+		state = "CHANGES_REQUESTED"
+	}
+	review := &github.PullRequestReview{ID: &id, Body: request.Body, State: &state}
+	f.reviews = append(f.reviews, review)
+	writeJSON(w, http.StatusOK, review)
+}
+
+func (f *FakeGitHub) editReview(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.pullRequest(w, r); !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var edit struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, review := range f.reviews {
+		if review.GetID() == id {
+			review.Body = &edit.Body
+			writeJSON(w, http.StatusOK, review)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (f *FakeGitHub) listReviewComments(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.pullRequest(w, r); !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	comments := []*github.PullRequestComment{}
+	for _, c := range f.comments {
+		if c.GetPullRequestReviewID() == id {
+			comments = append(comments, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+func (f *FakeGitHub) listIssueComments(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.pullRequest(w, r); !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON(w, http.StatusOK, append([]*github.IssueComment{}, f.issueComments...))
+}
+
+func (f *FakeGitHub) createIssueComment(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.pullRequest(w, r); !ok {
+		return
+	}
+	var comment github.IssueComment
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	comment.ID = &id
+	comment.User = f.author()
+	f.issueComments = append(f.issueComments, &comment)
+	writeJSON(w, http.StatusCreated, &comment)
+}
+
+func (f *FakeGitHub) editIssueComment(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var edit github.IssueComment
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.issueComments {
+		if c.GetID() == id {
+			c.Body = edit.Body
+			writeJSON(w, http.StatusOK, c)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (f *FakeGitHub) listPullRequestsWithCommit(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prs := []*github.PullRequest{}
+	for _, pr := range f.pulls {
+		if pr.HeadSHA == r.PathValue("sha") {
+			prs = append(prs, f.toGithub(pr))
+		}
+	}
+	writeJSON(w, http.StatusOK, prs)
+}
+
+func (f *FakeGitHub) createCheckRun(w http.ResponseWriter, r *http.Request) {
+	if !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var opts github.CreateCheckRunOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	run := &github.CheckRun{ID: &id, Name: &opts.Name, HeadSHA: &opts.HeadSHA, Status: opts.Status, Conclusion: opts.Conclusion, Output: opts.Output}
+	f.checkRuns = append(f.checkRuns, run)
+	writeJSON(w, http.StatusCreated, run)
+}
+
+// updateCheckRun appends the annotations to the earlier ones, like GitHub does
+func (f *FakeGitHub) updateCheckRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	var opts github.UpdateCheckRunOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, run := range f.checkRuns {
+		if run.GetID() != id {
+			continue
+		}
+		if opts.Status != nil {
+			run.Status = opts.Status
+		}
+		if opts.Conclusion != nil {
+			run.Conclusion = opts.Conclusion
+		}
+		if opts.Output != nil {
+			annotations := opts.Output.Annotations
+			if run.Output != nil {
+				annotations = append(run.Output.Annotations, annotations...)
+			}
+			run.Output = opts.Output
+			run.Output.Annotations = annotations
+		}
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// threadID is the node ID of the review thread a comment that isn't a reply starts
+func threadID(commentID int64) string {
+	return fmt.Sprintf("thread-%d", commentID)
+}
+
+// graphQL answers the query of a pull request's review threads, on a single page, and the
+// resolveReviewThread mutations, the only GraphQL the fake knows
+func (f *FakeGitHub) graphQL(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                     `json:"query"`
+		Variables map[string]json.RawMessage `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.HasPrefix(strings.TrimSpace(request.Query), "mutation") {
+		data := make(map[string]any)
+		var errs []map[string]any
+		for name, raw := range request.Variables {
+			alias := "m" + strings.TrimPrefix(name, "i")
+			var input struct {
+				ThreadID string `json:"threadId"`
+			}
+			if err := json.Unmarshal(raw, &input); err != nil || input.ThreadID == "" {
+				errs = append(errs, map[string]any{"message": "unsupported mutation", "path": []string{alias}})
+				continue
+			}
+			f.resolved[input.ThreadID] = true
+			data[alias] = map[string]any{"clientMutationId": nil}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": data, "errors": errs})
+		return
+	}
+
+	var number int
+	_ = json.Unmarshal(request.Variables["number"], &number)
+	threads := []map[string]any{}
+	for _, c := range f.comments {
+		if !strings.HasSuffix(c.GetPullRequestURL(), fmt.Sprintf("/pulls/%d", number)) || c.InReplyTo != nil {
+			continue
+		}
+		id := threadID(c.GetID())
+		threads = append(threads, map[string]any{
+			"id":         id,
+			"isResolved": f.resolved[id],
+			// GraphQL names a bot without the [bot] suffix of the REST API
+			"comments": map[string]any{"nodes": []map[string]any{{
+				"body": c.GetBody(), "author": map[string]any{"login": strings.TrimSuffix(c.GetUser().GetLogin(), "[bot]")},
+			}}},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"repository": map[string]any{"pullRequest": map[string]any{
+		"reviewThreads": map[string]any{"pageInfo": map[string]any{"hasNextPage": false, "endCursor": ""}, "nodes": threads},
+	}}}})
+}
+
+func (f *FakeGitHub) isRepository(r *http.Request) bool {
+	return r.PathValue("owner") == f.Owner && r.PathValue("repo") == f.Repo
+}
+
+// pullRequest looks up the PR of the request, answering 404 when there is none
+func (f *FakeGitHub) pullRequest(w http.ResponseWriter, r *http.Request) (*PullRequest, bool) {
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || !f.isRepository(r) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pr, ok := f.pulls[number]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+	return pr, ok
+}
+
+func (f *FakeGitHub) toGithub(pr *PullRequest) *github.PullRequest {
+	number, sha, state, changed := pr.Number, pr.HeadSHA, "open", len(pr.Files)
+	return &github.PullRequest{Number: &number, State: &state, ChangedFiles: &changed, Head: &github.PullRequestBranch{SHA: &sha}}
+}
+
+func (pr *PullRequest) changes(filename string) bool {
+	for _, file := range pr.Files {
+		if file.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeListing answers with an ETag like GitHub, and 304 Not Modified when it matches If-None-Match
+func writeListing(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:]))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}